@@ -10,6 +10,9 @@ import (
 func main() {
 	if err := cli.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		if hint := cli.Hint(err); hint != "" {
+			fmt.Fprintf(os.Stderr, "  → %s\n", hint)
+		}
+		os.Exit(cli.ExitCode(err))
 	}
 }
@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kernelshard/expose/internal/tunnel"
+)
+
+// apiStatus is the JSON body of the control API's status endpoint.
+type apiStatus struct {
+	Provider  string  `json:"provider"`
+	URL       string  `json:"url"`
+	Port      int     `json:"port"`
+	Ready     bool    `json:"ready"`
+	Connected bool    `json:"connected"`
+	Health    string  `json:"health,omitempty"`
+	Uptime    float64 `json:"uptime_seconds"`
+	Requests  int64   `json:"requests"`
+	Active    int64   `json:"active"`
+	Errors    int64   `json:"errors"`
+	BytesIn   int64   `json:"bytes_in"`
+	BytesOut  int64   `json:"bytes_out"`
+}
+
+// apiHandler serves the control API of the running tunnel:
+//
+//	GET  /api/status  the tunnel's state and request counters
+//	POST /api/start   reconnects the tunnel if it dropped
+//	POST /api/stop    shuts expose down, like Ctrl+C
+//
+// ctx is the tunnel's, a reconnect lives as long as it does. stop ends it.
+func apiHandler(ctx context.Context, svc *tunnel.Service, opts tunnelOptions, stop func()) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, statusOf(svc, opts))
+	})
+	mux.HandleFunc("POST /api/start", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-svc.Ready():
+		default:
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "tunnel is still starting"})
+			return
+		}
+		if !svc.IsConnected() {
+			if err := svc.Restart(ctx); err != nil {
+				writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, statusOf(svc, opts))
+	})
+	mux.HandleFunc("POST /api/stop", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "stopping"})
+		// get the answer out before the listener closes with ctx
+		_ = http.NewResponseController(w).Flush()
+		stop()
+	})
+	return localOnly(mux)
+}
+
+// localOnly refuses requests that name a non-loopback host, as a DNS
+// rebinding attack would, or come from a web page, which sends an Origin.
+func localOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "the control API only answers on localhost"})
+			return
+		}
+		if r.Header.Get("Origin") != "" {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "the control API doesn't answer browsers"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// statusOf reports the state of svc for the status endpoint. The port is
+// the service's, a config reload may have moved it since startup.
+func statusOf(svc *tunnel.Service, opts tunnelOptions) apiStatus {
+	st := svc.Stats()
+	port := svc.LocalPort()
+	if port == 0 {
+		port = opts.port
+	}
+	status := apiStatus{
+		Provider:  svc.ProviderName(),
+		URL:       displayURL(opts, svc.PublicURL()),
+		Port:      port,
+		Connected: svc.IsConnected(),
+		Health:    string(st.Health),
+		Uptime:    st.Uptime.Seconds(),
+		Requests:  st.Requests,
+		Active:    st.Active,
+		Errors:    st.Errors,
+		BytesIn:   st.BytesIn,
+		BytesOut:  st.BytesOut,
+	}
+	select {
+	case <-svc.Ready():
+		status.Ready = true
+	default:
+	}
+	return status
+}
+
+// writeJSON answers with v as JSON.
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// serveAPI serves the control API on addr until ctx is done. It returns
+// the address listened on.
+func serveAPI(ctx context.Context, addr string, h http.Handler) (net.Addr, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("start control API listener: %w", err)
+	}
+
+	srv := &http.Server{Handler: h, ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(ln)
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	return ln.Addr(), nil
+}
+
+// checkAPIAddr rejects an --api-addr beyond loopback, the control API has
+// no authentication, or on the port the tunnel forwards to.
+func checkAPIAddr(addr string, localPort int) error {
+	if err := tunnel.ValidateListenAddr(addr); err != nil {
+		return err
+	}
+	host, portStr, _ := net.SplitHostPort(addr)
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("--api-addr %s must be a loopback address, the control API is local only", addr)
+	}
+	if port, _ := strconv.Atoi(portStr); port != 0 && port == localPort {
+		return fmt.Errorf("--api-addr %s is the exposed port %d, the control API would be public", addr, localPort)
+	}
+	return nil
+}
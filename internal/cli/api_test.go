@@ -0,0 +1,201 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kernelshard/expose/internal/tunnel"
+)
+
+// apiRequest sends method path to the control API at base and decodes the
+// JSON answer into v.
+func apiRequest(t *testing.T, method, base, path string, v any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, base+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("%s %s: decode answer: %v", method, path, err)
+	}
+	return resp.StatusCode
+}
+
+// TestAPI_Status verifies the status endpoint reports the running tunnel
+func TestAPI_Status(t *testing.T) {
+	svc := tunnel.NewService(&portProvider{})
+	if err := svc.Start(context.Background(), 3000); err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Close()
+
+	api := httptest.NewServer(apiHandler(context.Background(), svc, tunnelOptions{port: 3000}, func() {}))
+	defer api.Close()
+
+	var status apiStatus
+	if code := apiRequest(t, http.MethodGet, api.URL, "/api/status", &status); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	want := apiStatus{Provider: "fake", URL: "https://fake.example.com", Port: 3000, Ready: true, Connected: true}
+	status.Uptime = 0
+	if status != want {
+		t.Errorf("expected status %+v, got %+v", want, status)
+	}
+}
+
+// TestAPI_StatusAfterReload verifies the status endpoint reports the port
+// a config reload moved the tunnel to, not the one it started with
+func TestAPI_StatusAfterReload(t *testing.T) {
+	svc, _, opts := startReloadable(t)
+	api := httptest.NewServer(apiHandler(context.Background(), svc, opts, func() {}))
+	defer api.Close()
+
+	writeConfig(t, "project: demo\nport: 4000\nprovider: loopback\n")
+	if _, _, err := reloadTunnel(context.Background(), svc, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	var status apiStatus
+	apiRequest(t, http.MethodGet, api.URL, "/api/status", &status)
+	if status.Port != 4000 {
+		t.Errorf("expected port 4000 after the reload, got %d", status.Port)
+	}
+}
+
+// TestAPI_Stop verifies the stop endpoint shuts the tunnel down cleanly
+func TestAPI_Stop(t *testing.T) {
+	p := newFakeProvider(nil)
+	svc := tunnel.NewService(p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- serveTunnel(ctx, svc, tunnelOptions{port: 3000, quiet: true, stdout: io.Discard}, &hooks{})
+	}()
+	<-svc.Ready()
+
+	api := httptest.NewServer(apiHandler(ctx, svc, tunnelOptions{port: 3000}, cancel))
+	defer api.Close()
+
+	var answer map[string]string
+	if code := apiRequest(t, http.MethodPost, api.URL, "/api/stop", &answer); code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", code)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected a clean shutdown, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("serveTunnel did not return after the stop request")
+	}
+	if p.closed.Load() == 0 || svc.IsConnected() {
+		t.Error("expected the tunnel closed after the stop request")
+	}
+}
+
+// TestAPI_Start verifies the start endpoint reconnects a dropped tunnel
+func TestAPI_Start(t *testing.T) {
+	p := &droppingProvider{}
+	svc := tunnel.NewService(p)
+	if err := svc.Start(context.Background(), 3000); err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Close()
+
+	api := httptest.NewServer(apiHandler(context.Background(), svc, tunnelOptions{port: 3000}, func() {}))
+	defer api.Close()
+
+	var status apiStatus
+	apiRequest(t, http.MethodPost, api.URL, "/api/start", &status)
+	if n := p.connects.Load(); n != 1 {
+		t.Errorf("expected a connected tunnel left alone, got %d connects", n)
+	}
+
+	p.up.Store(false)
+	if code := apiRequest(t, http.MethodPost, api.URL, "/api/start", &status); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if n := p.connects.Load(); n != 2 || !status.Connected {
+		t.Errorf("expected the tunnel reconnected, got %d connects and %+v", n, status)
+	}
+}
+
+// TestAPI_LocalOnly verifies requests naming another host or coming from
+// a web page are refused
+func TestAPI_LocalOnly(t *testing.T) {
+	svc := tunnel.NewService(&portProvider{})
+	h := apiHandler(context.Background(), svc, tunnelOptions{}, func() { t.Error("unexpected stop") })
+
+	tests := []struct {
+		name   string
+		host   string
+		origin string
+		want   int
+	}{
+		{name: "loopback", host: "127.0.0.1:4040", want: http.StatusOK},
+		{name: "localhost", host: "localhost:4040", want: http.StatusOK},
+		{name: "rebound name", host: "attacker.example.com:4040", want: http.StatusForbidden},
+		{name: "browser", host: "127.0.0.1:4040", origin: "https://attacker.example.com", want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+			req.Host = tt.host
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+// TestCheckAPIAddr verifies the control API is kept on loopback and off
+// the exposed port
+func TestCheckAPIAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		wantErr string
+	}{
+		{addr: "127.0.0.1:4040"},
+		{addr: "localhost:4040"},
+		{addr: "[::1]:0"},
+		{addr: ":4040", wantErr: "must be a loopback address"},
+		{addr: "0.0.0.0:4040", wantErr: "must be a loopback address"},
+		{addr: "127.0.0.1:3000", wantErr: "the control API would be public"},
+		{addr: "4040", wantErr: "invalid listen address"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			err := checkAPIAddr(tt.addr, 3000)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected %q error, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package cli
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 
 	"github.com/spf13/cobra"
 
@@ -19,6 +21,7 @@ func newConfigCmd() *cobra.Command {
 	//
 	cmd.AddCommand(newConfigListCmd())
 	cmd.AddCommand(newConfigGetCmd())
+	cmd.AddCommand(newConfigEffectiveCmd())
 
 	return cmd
 }
@@ -34,19 +37,41 @@ func newConfigListCmd() *cobra.Command {
 }
 
 // newConfigGetCmd creates the 'config get' command
-// e.g. expose config get <key>
+// e.g. expose config get <key> [key...]
 func newConfigGetCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "get <key>",
-		Short: "Get a specific configuration value",
-		Args:  cobra.ExactArgs(1),
+	cmd := &cobra.Command{
+		Use:   "get <key> [key...]",
+		Short: "Get one or more configuration values",
+		Args:  cobra.MinimumNArgs(1),
 		RunE:  runConfigGet,
 	}
+	cmd.Flags().Bool("json", false, "Print the values as a JSON object")
+	return cmd
+}
+
+// newConfigEffectiveCmd creates the 'config effective' command
+// e.g. expose config effective -p 8080 --json
+func newConfigEffectiveCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "effective [port]",
+		Short: "Show the configuration the tunnel command would use",
+		Long: "Print the config as resolved by 'expose tunnel' with the same arguments: " +
+			"the config file, overridden by --port/-P or a bare port argument, " +
+			"with the port falling back to PORT from .env files. 'config list' shows the file as is.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: runConfigEffective,
+	}
+	cmd.Flags().Bool("json", false, "Print the config as a JSON object")
+
+	// same overrides as 'expose tunnel'
+	cmd.Flags().IntP("port", "p", 0, "Local port to expose (overrides config)")
+	cmd.Flags().StringP("provider", "P", "localtunnel", "Tunnel provider: localtunnel, cloudflare, loopback (local only) or auto. defaults to localtunnel")
+	return cmd
 }
 
 // runConfigList handles the 'config list' command
-func runConfigList(_ *cobra.Command, args []string) error {
-	cfg, err := config.Load("")
+func runConfigList(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load(configPath(cmd))
 	if err != nil {
 		return fmt.Errorf("config not found (run 'expose init' first): %w", err)
 	}
@@ -57,17 +82,60 @@ func runConfigList(_ *cobra.Command, args []string) error {
 	return nil
 }
 
-// runConfigGet handles the 'config get <key>' command
-func runConfigGet(_ *cobra.Command, args []string) error {
-	key := args[0]
-	cfg, err := config.Load("")
+// runConfigGet handles the 'config get <key> [key...]' command
+func runConfigGet(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load(configPath(cmd))
 	if err != nil {
 		return fmt.Errorf("config not found (run 'expose init' first): %w", err)
 	}
-	val, err := cfg.Get(key)
+	asJSON, _ := cmd.Flags().GetBool("json")
+	return writeConfigValues(cmd.OutOrStdout(), cfg, args, asJSON)
+}
+
+// writeConfigValues prints the values of keys to w. A single key prints
+// just its value, several print "key: value" lines, asJSON prints an object.
+// Nothing is printed if any key is unknown.
+func writeConfigValues(w io.Writer, cfg *config.Config, keys []string, asJSON bool) error {
+	values := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		val, err := cfg.Get(key)
+		if err != nil {
+			return err
+		}
+		values[key] = val
+	}
+
+	switch {
+	case asJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(values)
+	case len(keys) == 1:
+		_, err := fmt.Fprintln(w, values[keys[0]])
+		return err
+	default:
+		for _, key := range keys {
+			if _, err := fmt.Fprintf(w, "%s: %v\n", key, values[key]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// effectiveKeys are printed by 'config effective', in this order
+var effectiveKeys = []string{"version", "project", "port", "provider"}
+
+// runConfigEffective handles the 'config effective [port]' command
+func runConfigEffective(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load(configPath(cmd))
+	if err != nil {
+		return fmt.Errorf("config not found (run 'expose init' first): %w", err)
+	}
+	eff, _, err := effectiveConfig(cmd, args, cfg)
 	if err != nil {
 		return err
 	}
-	fmt.Println(val)
-	return nil
+	asJSON, _ := cmd.Flags().GetBool("json")
+	return writeConfigValues(cmd.OutOrStdout(), &eff, effectiveKeys, asJSON)
 }
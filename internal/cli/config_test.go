@@ -1 +1,143 @@
 package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kernelshard/expose/internal/config"
+)
+
+var testConfig = &config.Config{Version: 1, Project: "demo", Port: 3000}
+
+func TestWriteConfigValues_SingleKey(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeConfigValues(&out, testConfig, []string{"port"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "3000\n" {
+		t.Errorf("expected bare value for a single key, got %q", out.String())
+	}
+}
+
+func TestWriteConfigValues_MultipleKeys(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeConfigValues(&out, testConfig, []string{"project", "port"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "project: demo\nport: 3000\n" {
+		t.Errorf("expected key: value lines in order, got %q", out.String())
+	}
+}
+
+func TestWriteConfigValues_UnknownKey(t *testing.T) {
+	var out bytes.Buffer
+	err := writeConfigValues(&out, testConfig, []string{"project", "colour", "port"}, false)
+	if err == nil || !strings.Contains(err.Error(), "colour") {
+		t.Errorf("expected error naming the unknown key, got %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no partial output, got %q", out.String())
+	}
+}
+
+func TestWriteConfigValues_JSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeConfigValues(&out, testConfig, []string{"project", "port"}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out.String(), err)
+	}
+	if len(got) != 2 || got["project"] != "demo" || got["port"] != float64(3000) {
+		t.Errorf("unexpected JSON subset %v", got)
+	}
+}
+
+// execConfigEffective executes 'config effective' with args in a temp project
+// holding the given config file and .env, returning its output.
+func execConfigEffective(t *testing.T, configYAML, dotEnv string, args ...string) (string, error) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(config.DefaultConfigFile, []byte(configYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if dotEnv != "" {
+		if err := os.WriteFile(".env", []byte(dotEnv), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	cmd := newConfigEffectiveCmd()
+	cmd.SetArgs(args)
+	cmd.SetOut(&out)
+	cmd.SetErr(io.Discard)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestConfigEffective(t *testing.T) {
+	const file = "version: 1\nproject: demo\nport: 3000\n"
+	tests := []struct {
+		name   string
+		config string
+		dotEnv string
+		args   []string
+		want   string
+	}{
+		{"file only", file, "", nil,
+			"version: 1\nproject: demo\nport: 3000\nprovider: localtunnel\n"},
+		{"file provider", file + "provider: cloudflare\n", "", nil,
+			"version: 1\nproject: demo\nport: 3000\nprovider: cloudflare\n"},
+		{"flags override file", file + "provider: cloudflare\n", "", []string{"-p", "8080", "-P", "localtunnel"},
+			"version: 1\nproject: demo\nport: 8080\nprovider: localtunnel\n"},
+		{"positional port", file, "", []string{"4000"},
+			"version: 1\nproject: demo\nport: 4000\nprovider: localtunnel\n"},
+		{".env fallback", "version: 1\nproject: demo\n", "PORT=5173\n", nil,
+			"version: 1\nproject: demo\nport: 5173\nprovider: localtunnel\n"},
+		{".env ignored when configured", file, "PORT=5173\n", nil,
+			"version: 1\nproject: demo\nport: 3000\nprovider: localtunnel\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := execConfigEffective(t, tt.config, tt.dotEnv, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestConfigEffective_JSON verifies --json prints the resolved config, overrides included
+func TestConfigEffective_JSON(t *testing.T) {
+	out, err := execConfigEffective(t, "version: 1\nproject: demo\nport: 3000\n", "", "--json", "-p", "8080", "-P", "cloudflare")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	if got["port"] != float64(8080) || got["provider"] != "cloudflare" || got["project"] != "demo" {
+		t.Errorf("unexpected effective config %v", got)
+	}
+}
+
+// TestConfigEffective_InvalidPort verifies an unresolvable port is an error, like for the tunnel
+func TestConfigEffective_InvalidPort(t *testing.T) {
+	_, err := execConfigEffective(t, "version: 1\nproject: demo\n", "", nil...)
+	if err == nil || !strings.Contains(err.Error(), "invalid port") {
+		t.Errorf("expected invalid port error, got %v", err)
+	}
+}
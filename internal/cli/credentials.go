@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// readCredentials returns the provider credential stored in the file at
+// path, e.g. a Cloudflare tunnel token, so it never shows up in `ps`. It
+// warns when other users can read the file. Neither the warning nor the
+// errors include the file's contents.
+func readCredentials(path string, warn io.Writer) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("credentials file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("credentials file %s is not a regular file", path)
+	}
+	// Windows has no permission bits to check
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o004 != 0 {
+		fmt.Fprintf(warn, "⚠ Credentials file %s is readable by every user, restrict it with chmod 600\n", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("credentials file: %w", err)
+	}
+	credential := strings.TrimSpace(string(data))
+	if credential == "" {
+		return "", fmt.Errorf("credentials file %s is empty", path)
+	}
+	return credential, nil
+}
@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestReadCredentials verifies the credential is read from the file and
+// never echoed in warnings or errors
+func TestReadCredentials(t *testing.T) {
+	const secret = "eyJhIjoiczNjcjN0In0"
+
+	tests := []struct {
+		name     string
+		content  string
+		perm     os.FileMode
+		want     string
+		wantWarn bool
+		wantErr  string
+	}{
+		{name: "private file", content: secret + "\n", perm: 0600, want: secret},
+		{name: "world-readable file", content: secret, perm: 0644, want: secret, wantWarn: true},
+		{name: "empty file", content: " \n", perm: 0600, wantErr: "is empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "token")
+			if err := os.WriteFile(path, []byte(tt.content), tt.perm); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(path, tt.perm); err != nil { // regardless of umask
+				t.Fatal(err)
+			}
+
+			var warn bytes.Buffer
+			got, err := readCredentials(path, &warn)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected %q error, got %v", tt.wantErr, err)
+				}
+			} else if err != nil || got != tt.want {
+				t.Fatalf("readCredentials() = %q, %v, want %q", got, err, tt.want)
+			}
+
+			if runtime.GOOS != "windows" && (warn.Len() > 0) != tt.wantWarn {
+				t.Errorf("expected warning %v, got %q", tt.wantWarn, warn.String())
+			}
+			if strings.Contains(warn.String(), secret) || (err != nil && strings.Contains(err.Error(), secret)) {
+				t.Errorf("credential leaked into output: %q, %v", warn.String(), err)
+			}
+		})
+	}
+
+	if _, err := readCredentials(filepath.Join(t.TempDir(), "missing"), io.Discard); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+// TestTunnelCmd_CredentialsFile verifies --credentials-file only applies to
+// providers taking credentials and the config's file is read too
+func TestTunnelCmd_CredentialsFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("empty-token", nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(".expose.yml", []byte("version: 1\nproject: demo\nport: 3000\ncredentials_file: empty-token\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	named := []string{"-P", "cloudflare", "--cf-tunnel-name", "dev", "--cf-hostname", "dev.example.com"}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "without named tunnel", args: []string{"--credentials-file", "token"}, want: "requires a provider taking credentials"},
+		{name: "with cf-token", args: append([]string{"--cf-token", "x", "--credentials-file", "token"}, named...), want: "none of the others can be"},
+		{name: "from config", args: named, want: "credentials file empty-token is empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := newTunnelCmd()
+			cmd.SetArgs(tt.args)
+			cmd.SetOut(io.Discard)
+			cmd.SetErr(io.Discard)
+
+			err := cmd.Execute()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected %q error, got %v", tt.want, err)
+			}
+		})
+	}
+}
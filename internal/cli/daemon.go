@@ -0,0 +1,226 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kernelshard/expose/internal/tunnel"
+)
+
+const (
+	// daemonEnv marks the re-executed background process of --detach
+	daemonEnv = "EXPOSE_DAEMON"
+
+	// detachReadyTimeout bounds how long --detach waits for the public URL
+	detachReadyTimeout = 30 * time.Second
+)
+
+// daemonFiles are the files shared by a detached tunnel and 'expose stop'.
+type daemonFiles struct {
+	pid   string // PID of the background process
+	state string // tunnelState as JSON, written once the tunnel is ready
+	log   string // stdout and stderr of the background process
+}
+
+// daemonFilesIn returns the daemon files inside dir, "" is the working directory.
+func daemonFilesIn(dir string) daemonFiles {
+	return daemonFiles{
+		pid:   filepath.Join(dir, ".expose.pid"),
+		state: filepath.Join(dir, ".expose.state"),
+		log:   filepath.Join(dir, ".expose.log"),
+	}
+}
+
+// tunnelState describes a running detached tunnel.
+type tunnelState struct {
+	PID      int       `json:"pid"`
+	URL      string    `json:"url"`
+	Provider string    `json:"provider"`
+	Port     int       `json:"port"`
+	Started  time.Time `json:"started"`
+}
+
+// writePID records pid in the PID file.
+func (f daemonFiles) writePID(pid int) error {
+	return os.WriteFile(f.pid, []byte(strconv.Itoa(pid)+"\n"), 0644)
+}
+
+// readPID returns the PID from the PID file. A missing file is reported
+// as an error wrapping os.ErrNotExist.
+func (f daemonFiles) readPID() (int, error) {
+	data, err := os.ReadFile(f.pid)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid PID file %s", f.pid)
+	}
+	return pid, nil
+}
+
+// writeState records st in the state file.
+func (f daemonFiles) writeState(st tunnelState) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(f.state, append(data, '\n'), 0644)
+}
+
+// readState returns the recorded tunnel state.
+func (f daemonFiles) readState() (tunnelState, error) {
+	var st tunnelState
+	data, err := os.ReadFile(f.state)
+	if err != nil {
+		return st, err
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		return st, fmt.Errorf("invalid state file %s: %w", f.state, err)
+	}
+	return st, nil
+}
+
+// remove deletes the PID and state files, the log is kept for inspection.
+func (f daemonFiles) remove() {
+	_ = os.Remove(f.pid)
+	_ = os.Remove(f.state)
+}
+
+// signaler sends sig to the process pid. It is swapped out in tests.
+type signaler func(pid int, sig os.Signal) error
+
+// signalProcess is the real signaler.
+func signalProcess(pid int, sig os.Signal) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Signal(sig)
+}
+
+// processGone reports whether a signal failed because the process no longer exists.
+func processGone(err error) bool {
+	return errors.Is(err, os.ErrProcessDone) || errors.Is(err, syscall.ESRCH)
+}
+
+// processAlive reports whether pid is still running, probing it with signal 0.
+func processAlive(signal signaler, pid int) bool {
+	return signal(pid, syscall.Signal(0)) == nil
+}
+
+// isDaemon reports whether this process is the background half of --detach.
+func isDaemon() bool {
+	return os.Getenv(daemonEnv) != ""
+}
+
+// recordState writes the state file once svc is ready, for --detach and
+// 'expose stop' to find.
+func recordState(ctx context.Context, svc *tunnel.Service, files daemonFiles, opts tunnelOptions) {
+	select {
+	case <-svc.Ready():
+	case <-ctx.Done():
+		return
+	}
+
+	st := tunnelState{
+		PID:      os.Getpid(),
+		URL:      displayURL(opts, svc.PublicURL()),
+		Provider: svc.ProviderName(),
+		Port:     opts.port,
+		Started:  time.Now(),
+	}
+	if err := files.writeState(st); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠ write state file: %v\n", err)
+	}
+}
+
+// startDetached re-executes expose with args in the background, its output
+// going to the log file, and returns once the tunnel reports its public URL.
+// A stale PID file from a crashed tunnel is cleaned up first.
+func startDetached(files daemonFiles, args []string, signal signaler, quiet bool) error {
+	if !detachSupported {
+		return errors.New("--detach is not supported on this platform")
+	}
+
+	if pid, err := files.readPID(); err == nil {
+		if processAlive(signal, pid) {
+			return fmt.Errorf("tunnel already running (PID %d), run 'expose stop' first", pid)
+		}
+		files.remove()
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locate expose binary: %w", err)
+	}
+
+	logFile, err := os.OpenFile(files.log, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("open daemon log: %w", err)
+	}
+	defer logFile.Close()
+
+	// no stdin, output to the log and a new session so closing the
+	// terminal doesn't take the tunnel down with it
+	cmd := exec.Command(exe, args...)
+	cmd.Env = append(os.Environ(), daemonEnv+"=1")
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = detachSysProcAttr()
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start background tunnel: %w", err)
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	st, err := waitForState(files, cmd.Process.Pid, exited, detachReadyTimeout)
+	if err != nil {
+		return err
+	}
+
+	if quiet {
+		fmt.Println(st.URL)
+		return nil
+	}
+	fmt.Printf("🚀 Tunnel[%s] running in background for localhost:%d (PID %d)\n", st.Provider, st.Port, st.PID)
+	fmt.Printf("✓ Public URL: %s\n", st.URL)
+	fmt.Printf("✓ Logs: %s\n", files.log)
+	fmt.Println("Run 'expose stop' to stop it")
+	return nil
+}
+
+// waitForState polls the state file until the process pid reports its URL,
+// failing if the process exits or timeout passes first.
+func waitForState(files daemonFiles, pid int, exited <-chan error, timeout time.Duration) (tunnelState, error) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.After(timeout)
+
+	for {
+		if st, err := files.readState(); err == nil && st.PID == pid && st.URL != "" {
+			return st, nil
+		}
+
+		select {
+		case err := <-exited:
+			if err == nil {
+				err = errors.New("exited")
+			}
+			return tunnelState{}, fmt.Errorf("background tunnel failed to start (%v), see %s", err, files.log)
+		case <-deadline:
+			return tunnelState{}, fmt.Errorf("background tunnel (PID %d) not ready after %s, see %s", pid, timeout, files.log)
+		case <-ticker.C:
+		}
+	}
+}
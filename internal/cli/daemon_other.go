@@ -0,0 +1,13 @@
+//go:build !unix
+
+package cli
+
+import "syscall"
+
+// detachSupported reports whether --detach works on this platform.
+const detachSupported = false
+
+// detachSysProcAttr is unused where --detach isn't supported.
+func detachSysProcAttr() *syscall.SysProcAttr {
+	return nil
+}
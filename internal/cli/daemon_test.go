@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeSignaler records the signals sent and answers with err.
+type fakeSignaler struct {
+	pids    []int
+	signals []os.Signal
+	err     error
+}
+
+func (f *fakeSignaler) signal(pid int, sig os.Signal) error {
+	f.pids = append(f.pids, pid)
+	f.signals = append(f.signals, sig)
+	return f.err
+}
+
+func TestDaemonFiles_PIDRoundTrip(t *testing.T) {
+	files := daemonFilesIn(t.TempDir())
+
+	if _, err := files.readPID(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist before writing, got %v", err)
+	}
+	if err := files.writePID(4242); err != nil {
+		t.Fatal(err)
+	}
+	pid, err := files.readPID()
+	if err != nil || pid != 4242 {
+		t.Errorf("expected PID 4242, got %d (%v)", pid, err)
+	}
+}
+
+func TestDaemonFiles_InvalidPID(t *testing.T) {
+	files := daemonFilesIn(t.TempDir())
+	if err := os.WriteFile(files.pid, []byte("not-a-pid\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := files.readPID(); err == nil || !strings.Contains(err.Error(), "invalid PID file") {
+		t.Errorf("expected invalid PID file error, got %v", err)
+	}
+}
+
+func TestDaemonFiles_StateRoundTrip(t *testing.T) {
+	files := daemonFilesIn(t.TempDir())
+	want := tunnelState{PID: 7, URL: "https://abc.loca.lt", Provider: "localtunnel", Port: 3000}
+
+	if err := files.writeState(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := files.readState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	files.remove()
+	if _, err := files.readState(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected state file removed, got %v", err)
+	}
+}
+
+func TestStartDetached_AlreadyRunning(t *testing.T) {
+	files := daemonFilesIn(t.TempDir())
+	if err := files.writePID(4242); err != nil {
+		t.Fatal(err)
+	}
+
+	// the recorded process answers the liveness probe
+	sig := &fakeSignaler{}
+	err := startDetached(files, nil, sig.signal, false)
+	if err == nil || !strings.Contains(err.Error(), "already running (PID 4242)") {
+		t.Fatalf("expected already running error, got %v", err)
+	}
+	if len(sig.signals) != 1 || sig.signals[0] != syscall.Signal(0) {
+		t.Errorf("expected a single signal 0 probe, got %v", sig.signals)
+	}
+}
+
+func TestWaitForState(t *testing.T) {
+	t.Run("ready", func(t *testing.T) {
+		files := daemonFilesIn(t.TempDir())
+		if err := files.writeState(tunnelState{PID: 7, URL: "https://abc.loca.lt"}); err != nil {
+			t.Fatal(err)
+		}
+		st, err := waitForState(files, 7, nil, time.Second)
+		if err != nil || st.URL != "https://abc.loca.lt" {
+			t.Errorf("expected the recorded URL, got %+v (%v)", st, err)
+		}
+	})
+
+	t.Run("state of another process is ignored", func(t *testing.T) {
+		files := daemonFilesIn(t.TempDir())
+		if err := files.writeState(tunnelState{PID: 8, URL: "https://old.loca.lt"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := waitForState(files, 7, nil, 200*time.Millisecond); err == nil || !strings.Contains(err.Error(), "not ready") {
+			t.Errorf("expected timeout error, got %v", err)
+		}
+	})
+
+	t.Run("process exited", func(t *testing.T) {
+		files := daemonFilesIn(t.TempDir())
+		exited := make(chan error, 1)
+		exited <- errors.New("exit status 1")
+		_, err := waitForState(files, 7, exited, time.Second)
+		if err == nil || !strings.Contains(err.Error(), "exit status 1") || !strings.Contains(err.Error(), files.log) {
+			t.Errorf("expected startup failure pointing at the log, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package cli
+
+import "syscall"
+
+// detachSupported reports whether --detach works on this platform.
+const detachSupported = true
+
+// detachSysProcAttr starts the background tunnel in its own session,
+// away from the terminal's signals.
+func detachSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kernelshard/expose/internal/config"
+	"github.com/kernelshard/expose/internal/tunnel"
+)
+
+const doctorDialTimeout = 3 * time.Second
+
+// tunnelServers maps providers to the endpoint their tunnels are requested from,
+// "" for providers that run in-process.
+var tunnelServers = map[string]string{
+	"localtunnel": "localtunnel.me:443",
+	"cloudflare":  "api.trycloudflare.com:443",
+	"loopback":    "",
+}
+
+// doctorCheck is a single diagnostic run by 'expose doctor'.
+type doctorCheck struct {
+	name     string
+	critical bool // a failing critical check makes doctor exit non-zero
+	hint     string
+	run      func() (string, error)
+}
+
+// newDoctorCmd creates the 'doctor' command
+func newDoctorCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose common setup problems",
+		Long:  "Check config, provider availability, local server and tunnel server connectivity",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			providerName, err := cmd.Flags().GetString("provider")
+			if err != nil {
+				return err
+			}
+			return runDoctor(cmd.OutOrStdout(), doctorChecks(providerName, configPath(cmd)))
+		},
+	}
+
+	cmd.Flags().StringP("provider", "P", "localtunnel", "Provider to diagnose: localtunnel, cloudflare, loopback or auto")
+	return cmd
+}
+
+// doctorChecks returns the diagnostics for the given provider.
+func doctorChecks(providerName, cfgPath string) []doctorCheck {
+	// diagnose the provider auto would pick
+	if providerName == "auto" {
+		providerName = resolveAutoProvider(tunnelOptions{})
+	}
+
+	// the local port comes from the config, if there is one
+	var cfg *config.Config
+
+	return []doctorCheck{
+		{
+			name:     "Config",
+			critical: true,
+			hint:     "run 'expose init' to create " + configFileName(cfgPath),
+			run: func() (string, error) {
+				c, err := config.Load(cfgPath)
+				if err != nil {
+					return "", err
+				}
+				if c.Port <= 0 || c.Port > 65535 {
+					return "", fmt.Errorf("invalid port %d (must be 1-65535)", c.Port)
+				}
+				cfg = c
+				return fmt.Sprintf("%s (project: %s, port: %d)", configFileName(cfgPath), c.Project, c.Port), nil
+			},
+		},
+		{
+			name:     "Provider " + providerName,
+			critical: true,
+			hint:     "install the provider's client or choose another with --provider",
+			run: func() (string, error) {
+				if err := tunnel.Available(newProvider(tunnelOptions{provider: providerName})); err != nil {
+					return "", err
+				}
+				return "available", nil
+			},
+		},
+		{
+			name: "Local server",
+			hint: "start your dev server, or the tunnel will answer 502",
+			run: func() (string, error) {
+				if cfg == nil {
+					return "", errors.New("skipped, no valid config")
+				}
+				addr := net.JoinHostPort("localhost", strconv.Itoa(cfg.Port))
+				if err := checkTCP(addr); err != nil {
+					return "", err
+				}
+				return "listening on " + addr, nil
+			},
+		},
+		{
+			name:     "Tunnel server",
+			critical: true,
+			hint:     "check your network, proxy or firewall settings",
+			run: func() (string, error) {
+				addr, ok := tunnelServers[providerName]
+				if !ok {
+					return "", fmt.Errorf("unknown provider %q", providerName)
+				}
+				if addr == "" {
+					return "not needed, in-process provider", nil
+				}
+				if err := checkTCP(addr); err != nil {
+					return "", err
+				}
+				return "reachable at " + addr, nil
+			},
+		},
+	}
+}
+
+// checkTCP reports whether a TCP connection to addr can be established.
+func checkTCP(addr string) error {
+	conn, err := net.DialTimeout("tcp", addr, doctorDialTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// runDoctor runs every check in order, writes a pass/fail report to w and
+// returns an error if any critical check failed.
+func runDoctor(w io.Writer, checks []doctorCheck) error {
+	failed := 0
+	for _, c := range checks {
+		detail, err := c.run()
+		switch {
+		case err == nil:
+			fmt.Fprintf(w, "✓ %s: %s\n", c.name, detail)
+		case c.critical:
+			failed++
+			fmt.Fprintf(w, "✗ %s: %v\n  → %s\n", c.name, err, c.hint)
+		default:
+			fmt.Fprintf(w, "! %s: %v\n  → %s\n", c.name, err, c.hint)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d critical check(s) failed", failed)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRunDoctor(t *testing.T) {
+	pass := func() (string, error) { return "fine", nil }
+	fail := func() (string, error) { return "", errors.New("broken") }
+
+	tests := []struct {
+		name     string
+		checks   []doctorCheck
+		wantErr  bool
+		contains []string
+	}{
+		{
+			name: "all checks pass",
+			checks: []doctorCheck{
+				{name: "Config", critical: true, run: pass},
+				{name: "Local server", run: pass},
+			},
+			contains: []string{"✓ Config: fine", "✓ Local server: fine"},
+		},
+		{
+			name: "non-critical failure is a warning",
+			checks: []doctorCheck{
+				{name: "Config", critical: true, run: pass},
+				{name: "Local server", hint: "start it", run: fail},
+			},
+			contains: []string{"! Local server: broken", "→ start it"},
+		},
+		{
+			name: "critical failure fails doctor",
+			checks: []doctorCheck{
+				{name: "Config", critical: true, hint: "run init", run: fail},
+				{name: "Tunnel server", critical: true, run: fail},
+				{name: "Local server", run: pass},
+			},
+			wantErr:  true,
+			contains: []string{"✗ Config: broken", "→ run init", "✗ Tunnel server", "✓ Local server"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := runDoctor(&out, tt.checks)
+
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err != nil && !strings.Contains(err.Error(), "2 critical") {
+				t.Errorf("expected failure count in error, got %v", err)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("expected %q in report:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestDoctorChecks_UnknownProvider(t *testing.T) {
+	checks := doctorChecks("nope", "")
+
+	last := checks[len(checks)-1]
+	if _, err := last.run(); err == nil {
+		t.Error("expected tunnel server check to fail for unknown provider")
+	}
+}
+
+// TestDoctorChecks_Loopback verifies the in-process provider needs no tunnel server
+func TestDoctorChecks_Loopback(t *testing.T) {
+	checks := doctorChecks("loopback", "")
+
+	last := checks[len(checks)-1]
+	if _, err := last.run(); err != nil {
+		t.Errorf("expected tunnel server check to pass for loopback, got %v", err)
+	}
+}
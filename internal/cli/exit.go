@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"errors"
+
+	"github.com/kernelshard/expose/internal/tunnel"
+)
+
+// Exit codes returned by ExitCode, taken from sysexits.h so scripts can
+// tell a missing dependency from a dropped tunnel.
+const (
+	exitFailure     = 1
+	exitUnavailable = 69 // EX_UNAVAILABLE, the provider can't be used here
+	exitTempFail    = 75 // EX_TEMPFAIL, the tunnel or local server went away
+)
+
+// ExitCode returns the process exit code for an error returned by Execute.
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, tunnel.ErrProviderUnavailable):
+		return exitUnavailable
+	case errors.Is(err, tunnel.ErrNotConnected), errors.Is(err, tunnel.ErrLocalUnreachable):
+		return exitTempFail
+	}
+	return exitFailure
+}
+
+// Hint returns a suggestion for fixing err, "" when there is none.
+func Hint(err error) string {
+	switch {
+	case errors.Is(err, tunnel.ErrProviderUnavailable):
+		return "install the provider's client or choose another with --provider"
+	case errors.Is(err, tunnel.ErrLocalUnreachable):
+		return "start your dev server, or check the port with 'expose config effective'"
+	case errors.Is(err, tunnel.ErrNotConnected):
+		return "check your network with 'expose doctor'"
+	}
+	return ""
+}
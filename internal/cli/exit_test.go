@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/kernelshard/expose/internal/tunnel"
+)
+
+// TestExitCode tests the mapping of wrapped tunnel errors to exit codes.
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		want     int
+		wantHint bool
+	}{
+		{"success", nil, 0, false},
+		{"plain error", errors.New("boom"), exitFailure, false},
+		{"provider unavailable", fmt.Errorf("start: %w", tunnel.ErrProviderUnavailable), exitUnavailable, true},
+		{"tunnel dropped", fmt.Errorf("reconnect gave up: %w", tunnel.ErrNotConnected), exitTempFail, true},
+		{"local server down", fmt.Errorf("probe: %w", tunnel.ErrLocalUnreachable), exitTempFail, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.err); got != tt.want {
+				t.Errorf("ExitCode() = %d, want %d", got, tt.want)
+			}
+			if hint := Hint(tt.err); (hint != "") != tt.wantHint {
+				t.Errorf("Hint() = %q, want a hint: %v", hint, tt.wantHint)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// forwarding maps a public URL to the local server it forwards to.
+type forwarding struct {
+	PublicURL string `json:"public_url"`
+	Local     string `json:"local"`
+}
+
+// forwardingOf returns the forwarding of the public url, as displayed, to
+// the local server of opts.
+func forwardingOf(opts tunnelOptions, url string) forwarding {
+	return forwarding{
+		PublicURL: url,
+		Local:     fmt.Sprintf("%s://%s", localScheme(opts), localTarget(opts)),
+	}
+}
+
+// writeForwardingTable prints one "PUBLIC URL → http://localhost:PORT" row
+// per forwarding, arrows aligned, or a JSON array when asJSON is set.
+func writeForwardingTable(w io.Writer, rows []forwarding, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if rows == nil {
+			rows = []forwarding{}
+		}
+		return enc.Encode(rows)
+	}
+
+	width := 0
+	for _, row := range rows {
+		width = max(width, utf8.RuneCountInString(row.PublicURL))
+	}
+
+	var b strings.Builder
+	for _, row := range rows {
+		pad := width - utf8.RuneCountInString(row.PublicURL)
+		fmt.Fprintf(&b, "%s%s → %s\n", row.PublicURL, strings.Repeat(" ", pad), row.Local)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kernelshard/expose/internal/tunnel"
+)
+
+var testForwardings = []forwarding{
+	{PublicURL: "https://api.loca.lt", Local: "localhost:8080"},
+	{PublicURL: "https://frontend-app.loca.lt", Local: "localhost:3000"},
+	{PublicURL: "https://docs.loca.lt", Local: "unix:/tmp/docs.sock"},
+}
+
+func TestWriteForwardingTable(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []forwarding
+		want string
+	}{
+		{"none", nil, ""},
+		{"single", testForwardings[:1], "https://api.loca.lt → localhost:8080\n"},
+		{"aligned", testForwardings,
+			"https://api.loca.lt          → localhost:8080\n" +
+				"https://frontend-app.loca.lt → localhost:3000\n" +
+				"https://docs.loca.lt         → unix:/tmp/docs.sock\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := writeForwardingTable(&out, tt.rows, false); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("writeForwardingTable() =\n%s\nwant\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+// TestWriteForwardingTable_JSON verifies --json prints the rows in order,
+// and an empty array rather than null without any
+func TestWriteForwardingTable_JSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeForwardingTable(&out, testForwardings, true); err != nil {
+		t.Fatal(err)
+	}
+	var got []forwarding
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out.String(), err)
+	}
+	if len(got) != len(testForwardings) || got[1] != testForwardings[1] {
+		t.Errorf("expected the rows back in order, got %+v", got)
+	}
+	if !bytes.Contains(out.Bytes(), []byte(`"public_url": "https://api.loca.lt"`)) {
+		t.Errorf("expected public_url keys, got %s", out.String())
+	}
+
+	out.Reset()
+	if err := writeForwardingTable(&out, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "[]\n" {
+		t.Errorf("expected an empty array, got %q", out.String())
+	}
+}
+
+// TestForwardingOf verifies a row takes the URL and the local server
+func TestForwardingOf(t *testing.T) {
+	tests := []struct {
+		opts tunnelOptions
+		want string
+	}{
+		{tunnelOptions{port: 3000}, "http://localhost:3000"},
+		{tunnelOptions{port: 8443, localScheme: "https"}, "https://localhost:8443"},
+	}
+	for _, tt := range tests {
+		got := forwardingOf(tt.opts, "https://fake.example.com")
+		if want := (forwarding{PublicURL: "https://fake.example.com", Local: tt.want}); got != want {
+			t.Errorf("expected %+v, got %+v", want, got)
+		}
+	}
+}
+
+// TestServeTunnel_JSON verifies --json prints the forwarding as JSON and
+// nothing else on stdout
+func TestServeTunnel_JSON(t *testing.T) {
+	svc := tunnel.NewService(newFakeProvider(nil))
+	var out bytes.Buffer
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serveTunnel(ctx, svc, tunnelOptions{port: 3000, json: true, stdout: &out}, &hooks{})
+	}()
+	<-svc.Ready()
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	var got []forwarding
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("expected only JSON on stdout, got %q: %v", out.String(), err)
+	}
+	want := forwarding{PublicURL: "https://fake.example.com", Local: "http://localhost:3000"}
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("expected [%+v], got %+v", want, got)
+	}
+}
+
+// TestServeTunnel_ForwardingRow verifies the banner shows the forwarding row
+func TestServeTunnel_ForwardingRow(t *testing.T) {
+	svc := tunnel.NewService(newFakeProvider(nil))
+	var out bytes.Buffer
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serveTunnel(ctx, svc, tunnelOptions{port: 3000, stdout: &out}, &hooks{})
+	}()
+	<-svc.Ready()
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "✓ Forwarding: https://fake.example.com → http://localhost:3000\n"; !strings.Contains(out.String(), want) {
+		t.Errorf("expected %q in the banner, got %q", want, out.String())
+	}
+}
+
+// TestTunnelCmd_JSONExclusive verifies --json can't be combined with the
+// other ways of shaping stdout
+func TestTunnelCmd_JSONExclusive(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(".expose.yml", []byte("version: 1\nproject: demo\nport: 3000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, other := range []string{"--quiet", "--detach"} {
+		cmd := newTunnelCmd()
+		cmd.SetArgs([]string{"--json", other})
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+
+		if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "none of the others can be") {
+			t.Errorf("--json %s: expected a mutually exclusive flags error, got %v", other, err)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	// hookTimeout bounds each event's hooks so a stuck command can't hang
+	// the tunnel or its shutdown
+	hookTimeout = 10 * time.Second
+
+	// urlPlaceholder is replaced by the shell-quoted public URL in hook commands
+	urlPlaceholder = "{url}"
+)
+
+// commandRunner runs a shell command with extra environment variables.
+type commandRunner func(ctx context.Context, command string, env []string) error
+
+// hooks runs the user-configured commands and webhooks around the tunnel
+// lifecycle. Failures are reported as warnings, never as fatal errors.
+type hooks struct {
+	onReadyExec    string
+	onReadyWebhook string
+	onCloseExec    string
+	onCloseWebhook string
+
+	// file holding the current public URL, removed on close
+	urlFile string
+	// descriptor getting each public URL as a line, closed on close
+	urlFD io.WriteCloser
+
+	run    commandRunner
+	client *http.Client
+	warn   io.Writer
+}
+
+// newHooks builds the hooks configured by opts.
+func newHooks(opts tunnelOptions) *hooks {
+	return &hooks{
+		onReadyExec:    opts.onReadyExec,
+		onReadyWebhook: opts.onReadyWebhook,
+		onCloseExec:    opts.onCloseExec,
+		onCloseWebhook: opts.onCloseWebhook,
+		urlFile:        opts.urlFile,
+		urlFD:          urlFD(opts),
+		run:            runShell,
+		client:         &http.Client{Timeout: hookTimeout},
+		warn:           os.Stderr,
+	}
+}
+
+// ready writes the URL file and descriptor and fires the on-ready hooks
+// with the public URL.
+func (h *hooks) ready(ctx context.Context, url string) {
+	h.writeURLFile(url)
+	h.writeURLFD(url)
+	h.fire(ctx, "on-ready", h.onReadyExec, h.onReadyWebhook, url)
+}
+
+// urlChanged keeps the URL file current after a reconnect and passes the
+// new URL on to the descriptor.
+func (h *hooks) urlChanged(url string) {
+	h.writeURLFile(url)
+	h.writeURLFD(url)
+}
+
+// closing fires the on-close hooks with the public URL that is going away,
+// removes the URL file and closes the URL descriptor so its reader sees EOF.
+func (h *hooks) closing(ctx context.Context, url string) {
+	h.fire(ctx, "on-close", h.onCloseExec, h.onCloseWebhook, url)
+	if h.urlFile != "" {
+		if err := os.Remove(h.urlFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			fmt.Fprintf(h.warn, "⚠ remove URL file: %v\n", err)
+		}
+	}
+	if h.urlFD != nil {
+		h.urlFD.Close()
+		h.urlFD = nil
+	}
+}
+
+// writeURLFile replaces the URL file's content with url, through a rename
+// so readers never see it half written.
+func (h *hooks) writeURLFile(url string) {
+	if h.urlFile == "" {
+		return
+	}
+	tmp := h.urlFile + ".tmp"
+	err := os.WriteFile(tmp, []byte(url+"\n"), 0644)
+	if err == nil {
+		err = os.Rename(tmp, h.urlFile)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		fmt.Fprintf(h.warn, "⚠ write URL file: %v\n", err)
+	}
+}
+
+// writeURLFD writes url as a line to the URL descriptor. A reader that
+// went away only costs a warning.
+func (h *hooks) writeURLFD(url string) {
+	if h.urlFD == nil {
+		return
+	}
+	if _, err := io.WriteString(h.urlFD, url+"\n"); err != nil {
+		fmt.Fprintf(h.warn, "⚠ write URL fd: %v\n", err)
+	}
+}
+
+// fire runs command and posts to webhook, each optional, for the given event.
+func (h *hooks) fire(ctx context.Context, event, command, webhook, url string) {
+	ctx, cancel := context.WithTimeout(ctx, hookTimeout)
+	defer cancel()
+
+	if command != "" {
+		// the URL comes from the tunnel server, it must stay a single word
+		cmd := strings.ReplaceAll(command, urlPlaceholder, shellQuote(url))
+		if err := h.run(ctx, cmd, []string{"EXPOSE_URL=" + url}); err != nil {
+			fmt.Fprintf(h.warn, "⚠ %s command failed: %v\n", event, err)
+		}
+	}
+
+	if webhook != "" {
+		if err := h.post(ctx, webhook, event, url); err != nil {
+			fmt.Fprintf(h.warn, "⚠ %s webhook failed: %v\n", event, err)
+		}
+	}
+}
+
+// shellQuote quotes s as a single sh word, with no expansions in it.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// post sends {"event": ..., "url": ...} as JSON to webhook.
+func (h *hooks) post(ctx context.Context, webhook, event, url string) error {
+	body, err := json.Marshal(map[string]string{"event": event, "url": url})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// urlFD returns opts.urlFD as a writer, nil when unset, so a nil *os.File
+// doesn't become a non-nil interface.
+func urlFD(opts tunnelOptions) io.WriteCloser {
+	if opts.urlFD == nil {
+		return nil
+	}
+	return opts.urlFD
+}
+
+// runShell runs command through sh with env added to the current environment.
+func runShell(ctx context.Context, command string, env []string) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,284 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kernelshard/expose/internal/tunnel"
+)
+
+const hookURL = "https://abc.loca.lt"
+
+// recordingRunner captures the command and environment it is asked to run.
+type recordingRunner struct {
+	command string
+	env     []string
+	err     error
+}
+
+func (r *recordingRunner) run(_ context.Context, command string, env []string) error {
+	r.command = command
+	r.env = env
+	return r.err
+}
+
+func TestHooks_ReadyExecSubstitutesURL(t *testing.T) {
+	runner := &recordingRunner{}
+	h := &hooks{onReadyExec: "notify {url} --again {url}", run: runner.run, warn: &bytes.Buffer{}}
+
+	h.ready(context.Background(), hookURL)
+
+	if want := "notify '" + hookURL + "' --again '" + hookURL + "'"; runner.command != want {
+		t.Errorf("expected command %q, got %q", want, runner.command)
+	}
+	if len(runner.env) != 1 || runner.env[0] != "EXPOSE_URL="+hookURL {
+		t.Errorf("expected EXPOSE_URL in env, got %v", runner.env)
+	}
+}
+
+// TestHooks_ExecQuotesURL verifies shell metacharacters in a URL from the
+// tunnel server reach the command as text instead of running
+func TestHooks_ExecQuotesURL(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	url := `https://x.loca.lt/$(touch pwned);touch pwned|` + "`touch pwned`" + `'quoted' "ok" $HOME`
+	h := &hooks{onReadyExec: "cd " + shellQuote(dir) + " && printf %s {url} > out", run: runShell, warn: &bytes.Buffer{}}
+
+	h.ready(context.Background(), url)
+
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != url {
+		t.Errorf("expected the URL as one argument %q, got %q", url, got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pwned")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected nothing in the URL to run, got %v", err)
+	}
+}
+
+func TestHooks_ReadyWebhookPostsURL(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("expected POST, got %s", r.Method)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	warn := &bytes.Buffer{}
+	h := &hooks{onReadyWebhook: srv.URL, client: srv.Client(), warn: warn}
+
+	h.ready(context.Background(), hookURL)
+
+	if got["url"] != hookURL || got["event"] != "on-ready" {
+		t.Errorf("unexpected webhook payload %v", got)
+	}
+	if warn.Len() != 0 {
+		t.Errorf("expected no warnings, got %q", warn.String())
+	}
+}
+
+func TestHooks_FailuresAreWarnings(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	warn := &bytes.Buffer{}
+	h := &hooks{
+		onReadyExec:    "false",
+		onReadyWebhook: srv.URL,
+		run:            (&recordingRunner{err: errors.New("exit status 1")}).run,
+		client:         srv.Client(),
+		warn:           warn,
+	}
+
+	h.ready(context.Background(), hookURL)
+
+	out := warn.String()
+	if !strings.Contains(out, "on-ready command failed") {
+		t.Errorf("expected command warning, got %q", out)
+	}
+	if !strings.Contains(out, "on-ready webhook failed: status 500") {
+		t.Errorf("expected webhook warning, got %q", out)
+	}
+}
+
+func TestHooks_NothingConfigured(t *testing.T) {
+	// no runner or client: nothing must be called
+	h := &hooks{warn: &bytes.Buffer{}}
+	h.ready(context.Background(), hookURL)
+}
+
+func TestServeTunnel_OnCloseHookFiresBeforeClose(t *testing.T) {
+	p := newFakeProvider(nil)
+	svc := tunnel.NewService(p)
+
+	var closedAtHook int32 = -1
+	runner := &recordingRunner{}
+	h := &hooks{
+		onCloseExec: "deregister {url}",
+		run: func(ctx context.Context, command string, env []string) error {
+			closedAtHook = p.closed.Load()
+			// the hook must get a live context even on signal shutdown
+			if err := ctx.Err(); err != nil {
+				t.Errorf("expected live hook context, got %v", err)
+			}
+			return runner.run(ctx, command, env)
+		},
+		warn: &bytes.Buffer{},
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serveTunnel(ctx, svc, tunnelOptions{port: 3000}, h)
+	}()
+
+	<-p.connected
+	cancel(fmt.Errorf("%w: interrupt", errInterrupted))
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("serveTunnel did not return after cancellation")
+	}
+
+	if runner.command != "deregister 'https://fake.example.com'" {
+		t.Errorf("expected on-close command with the URL, got %q", runner.command)
+	}
+	if closedAtHook != 0 {
+		t.Errorf("expected hook to run before the provider is closed, closed=%d", closedAtHook)
+	}
+}
+
+// TestHooks_URLFile verifies the URL file holds the URL while ready and is removed on close
+func TestHooks_URLFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "url.txt")
+	warn := &bytes.Buffer{}
+	h := &hooks{urlFile: path, warn: warn}
+
+	h.ready(context.Background(), hookURL)
+	if got, err := os.ReadFile(path); err != nil || string(got) != hookURL+"\n" {
+		t.Fatalf("expected URL file with %q, got %q (%v)", hookURL, got, err)
+	}
+
+	h.urlChanged("https://new.loca.lt")
+	if got, _ := os.ReadFile(path); string(got) != "https://new.loca.lt\n" {
+		t.Errorf("expected URL file updated on change, got %q", got)
+	}
+
+	h.closing(context.Background(), hookURL)
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected URL file removed on close, got %v", err)
+	}
+	if warn.Len() != 0 {
+		t.Errorf("expected no warnings, got %q", warn.String())
+	}
+}
+
+// TestHooks_URLFileErrorIsWarning verifies an unwritable URL file only warns
+func TestHooks_URLFileErrorIsWarning(t *testing.T) {
+	warn := &bytes.Buffer{}
+	h := &hooks{urlFile: filepath.Join(t.TempDir(), "missing", "url.txt"), warn: warn}
+
+	h.ready(context.Background(), hookURL)
+	if !strings.Contains(warn.String(), "write URL file") {
+		t.Errorf("expected write warning, got %q", warn.String())
+	}
+
+	// nothing was written, so there is nothing to complain about removing
+	warn.Reset()
+	h.closing(context.Background(), hookURL)
+	if warn.Len() != 0 {
+		t.Errorf("expected no warning on close, got %q", warn.String())
+	}
+}
+
+// TestHooks_URLFD verifies each URL reaches the descriptor as a line and
+// its reader sees EOF on close
+func TestHooks_URLFD(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	warn := &bytes.Buffer{}
+	h := &hooks{urlFD: w, warn: warn}
+	lines := bufio.NewReader(r)
+
+	h.ready(context.Background(), hookURL)
+	if got, err := lines.ReadString('\n'); err != nil || got != hookURL+"\n" {
+		t.Fatalf("expected %q from the descriptor, got %q (%v)", hookURL, got, err)
+	}
+
+	h.urlChanged("https://new.loca.lt")
+	if got, _ := lines.ReadString('\n'); got != "https://new.loca.lt\n" {
+		t.Errorf("expected the new URL from the descriptor, got %q", got)
+	}
+
+	h.closing(context.Background(), hookURL)
+	if rest, err := io.ReadAll(lines); err != nil || len(rest) != 0 {
+		t.Errorf("expected EOF after close, got %q (%v)", rest, err)
+	}
+	if warn.Len() != 0 {
+		t.Errorf("expected no warnings, got %q", warn.String())
+	}
+}
+
+// TestServeTunnel_URLFile verifies serveTunnel writes the URL file once ready and removes it on shutdown
+func TestServeTunnel_URLFile(t *testing.T) {
+	p := newFakeProvider(nil)
+	svc := tunnel.NewService(p)
+	path := filepath.Join(t.TempDir(), "url.txt")
+	h := &hooks{urlFile: path, warn: &bytes.Buffer{}}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serveTunnel(ctx, svc, tunnelOptions{port: 3000}, h)
+	}()
+
+	<-p.connected
+	// the file is written right after the provider connects
+	deadline := time.Now().Add(time.Second)
+	for {
+		got, err := os.ReadFile(path)
+		if err == nil && string(got) == "https://fake.example.com\n" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected URL file with the public URL, got %q (%v)", got, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel(fmt.Errorf("%w: interrupt", errInterrupted))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("serveTunnel did not return after cancellation")
+	}
+
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected URL file removed on shutdown, got %v", err)
+	}
+}
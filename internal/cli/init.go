@@ -1,7 +1,15 @@
 package cli
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/spf13/cobra"
 
@@ -10,20 +18,106 @@ import (
 
 // newInitCmd creates the 'init' command for initializing configuration.
 func newInitCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "init",
 		Short: "Initialize expose configuration",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.Init()
+			// upgrade an existing config instead of creating one
+			if migrate, _ := cmd.Flags().GetBool("migrate"); migrate {
+				return runInitMigrate(configPath(cmd))
+			}
+
+			force, _ := cmd.Flags().GetBool("force")
+			interactive, _ := cmd.Flags().GetBool("interactive")
+
+			opts := config.InitOptions{Force: force}
+			if interactive {
+				var err error
+				if opts, err = promptInit(cmd.InOrStdin(), cmd.OutOrStdout()); err != nil {
+					return err
+				}
+				opts.Force = force
+			}
+			opts.Path = configPath(cmd)
+
+			cfg, err := config.InitWith(opts)
+			if errors.Is(err, config.ErrConfigExists) {
+				return fmt.Errorf("%w (use --force to overwrite)", err)
+			}
 			if err != nil {
 				return err
 			}
 
-			fmt.Printf("✓ Created .expose.yml\n")
+			fmt.Printf("✓ Created %s\n", configFileName(opts.Path))
 			fmt.Printf("✓ Project: %s\n", cfg.Project)
 			fmt.Printf("✓ Port: %d\n", cfg.Port)
+			if cfg.Provider != "" {
+				fmt.Printf("✓ Provider: %s\n", cfg.Provider)
+			}
 			return nil
 
 		},
 	}
+
+	// migrate flag upgrades an existing config e.g. expose init --migrate
+	cmd.Flags().Bool("migrate", false, "Upgrade an existing .expose.yml to the current schema")
+	cmd.Flags().Bool("force", false, "Overwrite an existing .expose.yml")
+	cmd.Flags().BoolP("interactive", "i", false, "Prompt for project name, port and provider")
+	return cmd
+}
+
+// promptInit asks for the init values on out, reading answers from in.
+// Empty answers, and the end of input, keep the defaults shown in brackets.
+func promptInit(in io.Reader, out io.Writer) (config.InitOptions, error) {
+	scanner := bufio.NewScanner(in)
+	ask := func(question, def string) string {
+		fmt.Fprintf(out, "%s [%s]: ", question, def)
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return def
+		}
+		if answer := strings.TrimSpace(scanner.Text()); answer != "" {
+			return answer
+		}
+		return def
+	}
+
+	dir, _ := os.Getwd()
+	opts := config.InitOptions{Project: ask("Project name", filepath.Base(dir))}
+
+	for opts.Port == 0 {
+		answer := ask("Port", strconv.Itoa(config.DefaultPort))
+		if p, err := strconv.Atoi(answer); err == nil && p > 0 && p <= 65535 {
+			opts.Port = p
+			continue
+		}
+		fmt.Fprintf(out, "invalid port %q (must be 1-65535)\n", answer)
+	}
+
+	for opts.Provider == "" {
+		answer := ask("Provider ("+strings.Join(knownProviders, ", ")+")", knownProviders[0])
+		if slices.Contains(knownProviders, answer) {
+			opts.Provider = answer
+			continue
+		}
+		fmt.Fprintf(out, "unknown provider %q\n", answer)
+	}
+
+	return opts, scanner.Err()
+}
+
+// runInitMigrate rewrites the existing config in the current schema version.
+func runInitMigrate(path string) error {
+	migrated, err := config.Migrate(path)
+	if err != nil {
+		return fmt.Errorf("migrate config: %w", err)
+	}
+
+	if !migrated {
+		fmt.Printf("✓ %s is already at version %d\n", configFileName(path), config.CurrentVersion)
+		return nil
+	}
+
+	fmt.Printf("✓ Migrated %s to version %d\n", configFileName(path), config.CurrentVersion)
+	return nil
 }
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPromptInit(t *testing.T) {
+	in := strings.NewReader("demo\n5173\ncloudflare\n")
+	out := &bytes.Buffer{}
+
+	opts, err := promptInit(in, out)
+	if err != nil {
+		t.Fatalf("promptInit failed: %v", err)
+	}
+	if opts.Project != "demo" || opts.Port != 5173 || opts.Provider != "cloudflare" {
+		t.Errorf("expected answers to be used, got %+v", opts)
+	}
+}
+
+func TestPromptInit_Defaults(t *testing.T) {
+	opts, err := promptInit(strings.NewReader("\n\n\n"), &bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("promptInit failed: %v", err)
+	}
+	if opts.Project == "" || opts.Port != 3000 || opts.Provider != "localtunnel" {
+		t.Errorf("expected defaults, got %+v", opts)
+	}
+}
+
+func TestPromptInit_InvalidPort(t *testing.T) {
+	// an invalid port is asked again
+	out := &bytes.Buffer{}
+	opts, err := promptInit(strings.NewReader("demo\n99999\n8080\n\n"), out)
+	if err != nil {
+		t.Fatalf("promptInit failed: %v", err)
+	}
+	if opts.Port != 8080 {
+		t.Errorf("expected re-prompted port 8080, got %d", opts.Port)
+	}
+	if !strings.Contains(out.String(), `invalid port "99999"`) {
+		t.Errorf("expected invalid port message, got %q", out.String())
+	}
+
+	// running out of input after an invalid answer falls back to the default
+	opts, err = promptInit(strings.NewReader("demo\nabc"), &bytes.Buffer{})
+	if err != nil || opts.Port != 3000 {
+		t.Errorf("expected default port at end of input, got %d (%v)", opts.Port, err)
+	}
+}
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"time"
+
+	"github.com/kernelshard/expose/internal/tunnel"
+)
+
+// pprofMux returns the net/http/pprof handlers on a mux of their own, so
+// they are only reachable through the listener servePprof opens.
+func pprofMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// servePprof serves the profiling endpoints on addr, a listener separate
+// from the proxy, until ctx is done. It returns the address listened on.
+func servePprof(ctx context.Context, addr string) (net.Addr, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("start pprof listener: %w", err)
+	}
+
+	// no write timeout, CPU profiles and traces take as long as requested
+	srv := &http.Server{Handler: pprofMux(), ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(ln)
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	return ln.Addr(), nil
+}
+
+// checkPprofAddr rejects a --pprof-addr the tunnel would forward to, which
+// would publish the profiles, and warns when it isn't on loopback.
+func checkPprofAddr(addr string, localPort int, warn io.Writer) error {
+	if err := tunnel.ValidateListenAddr(addr); err != nil {
+		return err
+	}
+	host, portStr, _ := net.SplitHostPort(addr)
+	if port, _ := strconv.Atoi(portStr); port != 0 && port == localPort {
+		return fmt.Errorf("--pprof-addr %s is the exposed port %d, the profiles would be public", addr, localPort)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		fmt.Fprintf(warn, "⚠ pprof listens on %s, reachable beyond this machine\n", addr)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kernelshard/expose/internal/tunnel"
+)
+
+// TestServePprof verifies the profiles are served on the admin listener
+// while enabled and gone once its context ends
+func TestServePprof(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	addr, err := servePprof(ctx, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/goroutine?debug=1", "/debug/pprof/heap"} {
+		resp, err := http.Get(fmt.Sprintf("http://%s%s", addr, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", path, resp.StatusCode)
+		}
+	}
+
+	cancel()
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	if resp, err := client.Get(fmt.Sprintf("http://%s/debug/pprof/", addr)); err == nil {
+		resp.Body.Close()
+		t.Errorf("expected the admin listener closed, got %d", resp.StatusCode)
+	}
+}
+
+// TestPprofNotProxied verifies the tunnel's proxy never answers with the
+// profiles, the request reaches the local server
+func TestPprofNotProxied(t *testing.T) {
+	local := httptest.NewServer(http.NotFoundHandler())
+	defer local.Close()
+	localPort := local.Listener.Addr().(*net.TCPAddr).Port
+
+	p := &portProvider{}
+	svc := tunnel.NewService(p, tunnel.WithProxy(proxyOptions(tunnelOptions{port: localPort})...))
+	if err := svc.Start(context.Background(), localPort); err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Close()
+
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/debug/pprof/", p.connects()[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected the local server's 404 through the tunnel, got %d", resp.StatusCode)
+	}
+}
+
+// TestCheckPprofAddr verifies the exposed port is refused and addresses
+// beyond loopback are warned about
+func TestCheckPprofAddr(t *testing.T) {
+	tests := []struct {
+		addr     string
+		wantErr  string
+		wantWarn bool
+	}{
+		{addr: "127.0.0.1:6060"},
+		{addr: "localhost:6060"},
+		{addr: "[::1]:0"},
+		{addr: ":6060", wantWarn: true},
+		{addr: "0.0.0.0:6060", wantWarn: true},
+		{addr: "127.0.0.1:3000", wantErr: "the profiles would be public"},
+		{addr: "6060", wantErr: "invalid listen address"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			var warn bytes.Buffer
+			err := checkPprofAddr(tt.addr, 3000, &warn)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected %q error, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := warn.Len() > 0; got != tt.wantWarn {
+				t.Errorf("expected warning %v, got %q", tt.wantWarn, warn.String())
+			}
+		})
+	}
+}
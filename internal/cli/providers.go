@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kernelshard/expose/internal/tunnel"
+)
+
+// providerInfo describes a provider for 'expose providers'.
+type providerInfo struct {
+	Name         string   `json:"name"`         // as passed to --provider
+	DisplayName  string   `json:"display_name"` // the provider's Name()
+	Available    bool     `json:"available"`
+	Reason       string   `json:"reason,omitempty"` // why it isn't available
+	Capabilities []string `json:"capabilities"`     // see capabilityNames
+}
+
+// newProvidersCmd creates the 'providers' command
+// e.g. expose providers --json
+func newProvidersCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "providers",
+		Short: "List the tunnel providers and whether they can be used here",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			asJSON, _ := cmd.Flags().GetBool("json")
+			return writeProviders(cmd.OutOrStdout(), listProviders(), resolveAutoProvider(tunnelOptions{}), asJSON)
+		},
+	}
+	cmd.Flags().Bool("json", false, "Print the providers as JSON")
+	return cmd
+}
+
+// listProviders describes every provider newProvider builds, in the order
+// of knownProviders. auto only picks one of them and isn't listed.
+func listProviders() []providerInfo {
+	infos := make([]providerInfo, 0, len(knownProviders))
+	for _, name := range knownProviders {
+		if name == "auto" {
+			continue
+		}
+		p := newProvider(tunnelOptions{provider: name})
+		info := providerInfo{
+			Name:         name,
+			DisplayName:  p.Name(),
+			Available:    true,
+			Capabilities: capabilityNames(tunnel.CapabilitiesOf(p)),
+		}
+		if err := tunnel.Available(p); err != nil {
+			info.Available, info.Reason = false, err.Error()
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// writeProviders prints infos to w, one line per provider followed by the
+// one --provider auto picks, or as a JSON object.
+func writeProviders(w io.Writer, infos []providerInfo, auto string, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Providers []providerInfo `json:"providers"`
+			Auto      string         `json:"auto"`
+		}{infos, auto})
+	}
+
+	for _, info := range infos {
+		if !info.Available {
+			fmt.Fprintf(w, "! %s (%s): %s\n", info.Name, info.DisplayName, info.Reason)
+			continue
+		}
+		status := "available"
+		if len(info.Capabilities) > 0 {
+			status += ", supports " + strings.Join(info.Capabilities, ", ")
+		}
+		fmt.Fprintf(w, "✓ %s (%s): %s\n", info.Name, info.DisplayName, status)
+	}
+	_, err := fmt.Fprintf(w, "  --provider auto picks %s\n", auto)
+	return err
+}
+
+// capabilityNames returns the optional features set in caps.
+func capabilityNames(caps tunnel.Capabilities) []string {
+	names := []string{}
+	if caps.SupportsTCP {
+		names = append(names, "tcp")
+	}
+	if caps.SupportsSubdomain {
+		names = append(names, "subdomain")
+	}
+	if caps.SupportsRegion {
+		names = append(names, "region")
+	}
+	if caps.SupportsCustomDomain {
+		names = append(names, "custom-domain")
+	}
+	return names
+}
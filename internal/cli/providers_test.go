@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestProvidersCmd verifies the built-in providers are listed with their
+// availability in the environment, as text and as JSON
+func TestProvidersCmd(t *testing.T) {
+	tests := []struct {
+		name      string
+		installed bool
+		wantAuto  string
+	}{
+		{name: "cloudflared installed", installed: true, wantAuto: "cloudflare"},
+		{name: "cloudflared missing", installed: false, wantAuto: "localtunnel"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withCloudflared(t, tt.installed)
+
+			var out bytes.Buffer
+			cmd := newProvidersCmd()
+			cmd.SetOut(&out)
+			cmd.SetArgs([]string{"--json"})
+			if err := cmd.Execute(); err != nil {
+				t.Fatal(err)
+			}
+
+			var got struct {
+				Providers []providerInfo `json:"providers"`
+				Auto      string         `json:"auto"`
+			}
+			if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+				t.Fatalf("invalid JSON %q: %v", out.String(), err)
+			}
+
+			names := make([]string, 0, len(got.Providers))
+			for _, info := range got.Providers {
+				names = append(names, info.Name)
+				wantAvailable := info.Name != "cloudflare" || tt.installed
+				if info.Available != wantAvailable {
+					t.Errorf("%s: expected available %v, got %+v", info.Name, wantAvailable, info)
+				}
+				if !info.Available && !strings.Contains(info.Reason, "cloudflared not found") {
+					t.Errorf("%s: expected the reason it's unavailable, got %q", info.Name, info.Reason)
+				}
+			}
+			if want := []string{"localtunnel", "cloudflare", "loopback"}; !slices.Equal(names, want) {
+				t.Errorf("expected providers %v, got %v", want, names)
+			}
+			if got.Auto != tt.wantAuto {
+				t.Errorf("expected auto to pick %s, got %s", tt.wantAuto, got.Auto)
+			}
+		})
+	}
+}
+
+// TestWriteProviders verifies the text listing marks unavailable providers
+// and names the supported features
+func TestWriteProviders(t *testing.T) {
+	infos := []providerInfo{
+		{Name: "localtunnel", DisplayName: "LocalTunnel", Available: true, Capabilities: []string{"subdomain"}},
+		{Name: "cloudflare", DisplayName: "Cloudflare", Reason: "cloudflared not found in PATH"},
+	}
+
+	var out bytes.Buffer
+	if err := writeProviders(&out, infos, "localtunnel", false); err != nil {
+		t.Fatal(err)
+	}
+	want := "✓ localtunnel (LocalTunnel): available, supports subdomain\n" +
+		"! cloudflare (Cloudflare): cloudflared not found in PATH\n" +
+		"  --provider auto picks localtunnel\n"
+	if out.String() != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, out.String())
+	}
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/kernelshard/expose/internal/config"
+	"github.com/kernelshard/expose/internal/tunnel"
+)
+
+// reloadConfig reads the config file again and returns opts with the port
+// and provider it now resolves to. Command line flags still win over the
+// file. opts is returned unchanged with the error when the config is invalid.
+func reloadConfig(opts tunnelOptions) (tunnelOptions, error) {
+	cfg, err := config.Load(opts.configPath)
+	if err != nil {
+		return opts, fmt.Errorf("load config: %w", err)
+	}
+
+	eff, _, err := resolveConfig(cfg, opts.overrides)
+	if err != nil {
+		return opts, err
+	}
+	if !slices.Contains(knownProviders, eff.Provider) {
+		return opts, fmt.Errorf("unknown provider %q", eff.Provider)
+	}
+
+	next := opts
+	next.port, next.provider = eff.Port, eff.Provider
+	if next.provider == "auto" {
+		next.provider = resolveAutoProvider(next)
+	}
+	return next, nil
+}
+
+// reloadTunnel applies a reloaded config to the running svc, reconnecting
+// it when the port or provider changed; behind the proxy a new port alone
+// keeps the connection, see tunnel.Service.Reconfigure. A new provider is checked before
+// the current one is dropped, so an unusable config keeps the tunnel as
+// it is. It returns the settings now in effect and whether they changed.
+func reloadTunnel(ctx context.Context, svc *tunnel.Service, opts tunnelOptions) (tunnelOptions, bool, error) {
+	next, err := reloadConfig(opts)
+	if err != nil {
+		return opts, false, err
+	}
+	if next.port == opts.port && next.provider == opts.provider {
+		return opts, false, nil
+	}
+
+	var p tunnel.Provider
+	if next.provider != opts.provider {
+		p = newProvider(next)
+		if err := checkCapabilities(p, next); err != nil {
+			return opts, false, err
+		}
+		if err := tunnel.Available(p); err != nil {
+			return opts, false, err
+		}
+	}
+
+	// past this point the settings are applied, report the new ones
+	if err := svc.Reconfigure(ctx, next.port, p); err != nil {
+		return next, true, fmt.Errorf("reconnect: %w", err)
+	}
+	return next, true, nil
+}
+
+// applyReload runs reloadTunnel for a SIGHUP and reports the outcome,
+// returning the settings now in effect.
+func applyReload(ctx context.Context, svc *tunnel.Service, opts tunnelOptions) tunnelOptions {
+	next, changed, err := reloadTunnel(ctx, svc, opts)
+	switch {
+	case err != nil && !changed:
+		fmt.Fprintf(os.Stderr, "⚠ Config reload failed, keeping the current settings: %v\n", err)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "⚠ Config reloaded but the tunnel failed to reconnect: %v\n", err)
+	case changed:
+		fmt.Fprintf(infoWriter(next), "✓ Config reloaded: forwarding to %s://%s via %s\n",
+			localScheme(next), localTarget(next), svc.ProviderName())
+	default:
+		fmt.Fprintln(infoWriter(next), "✓ Config reloaded, nothing changed")
+	}
+	return next
+}
@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/kernelshard/expose/internal/tunnel"
+)
+
+// portProvider records the local port of every Connect.
+type portProvider struct {
+	mu    sync.Mutex
+	ports []int
+}
+
+func (p *portProvider) Connect(ctx context.Context, localPort int) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ports = append(p.ports, localPort)
+	return "https://fake.example.com", nil
+}
+
+func (p *portProvider) connects() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.ports)
+}
+
+func (p *portProvider) Close() error      { return nil }
+func (p *portProvider) IsConnected() bool { return true }
+func (p *portProvider) PublicURL() string { return "https://fake.example.com" }
+func (p *portProvider) Name() string      { return "fake" }
+
+// writeConfig writes .expose.yml in the current directory.
+func writeConfig(t *testing.T, yaml string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(".", ".expose.yml"), []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startReloadable starts a service on port 3000 from a config naming the
+// loopback provider, the one the running tunnel uses.
+func startReloadable(t *testing.T) (*tunnel.Service, *portProvider, tunnelOptions) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	writeConfig(t, "project: demo\nport: 3000\nprovider: loopback\n")
+
+	p := &portProvider{}
+	svc := tunnel.NewService(p)
+	if err := svc.Start(context.Background(), 3000); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { svc.Close() })
+	return svc, p, tunnelOptions{port: 3000, provider: "loopback"}
+}
+
+// TestReloadTunnel_PortChange verifies a changed port reconnects the
+// provider to the new port
+func TestReloadTunnel_PortChange(t *testing.T) {
+	svc, p, opts := startReloadable(t)
+	writeConfig(t, "project: demo\nport: 4000\nprovider: loopback\n")
+
+	next, changed, err := reloadTunnel(context.Background(), svc, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || next.port != 4000 {
+		t.Errorf("expected a change to port 4000, got port %d, changed %v", next.port, changed)
+	}
+	if got := p.connects(); !slices.Equal(got, []int{3000, 4000}) {
+		t.Errorf("expected connects to [3000 4000], got %v", got)
+	}
+}
+
+// TestReloadTunnel_Unchanged verifies an unchanged config leaves the
+// tunnel alone
+func TestReloadTunnel_Unchanged(t *testing.T) {
+	svc, p, opts := startReloadable(t)
+
+	_, changed, err := reloadTunnel(context.Background(), svc, opts)
+	if err != nil || changed {
+		t.Fatalf("expected no change and no error, got changed %v, %v", changed, err)
+	}
+	if got := p.connects(); len(got) != 1 {
+		t.Errorf("expected only the first connect, got %v", got)
+	}
+}
+
+// TestReloadTunnel_Invalid verifies a broken config keeps the current
+// settings and connection
+func TestReloadTunnel_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"bad port", "project: demo\nport: 70000\nprovider: loopback\n"},
+		{"unknown provider", "project: demo\nport: 4000\nprovider: nope\n"},
+		{"unparsable", "port: [\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, p, opts := startReloadable(t)
+			writeConfig(t, tt.config)
+
+			next, changed, err := reloadTunnel(context.Background(), svc, opts)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if changed || next.port != opts.port || next.provider != opts.provider {
+				t.Errorf("expected the settings kept, got %+v", next)
+			}
+			if got := p.connects(); len(got) != 1 {
+				t.Errorf("expected only the first connect, got %v", got)
+			}
+		})
+	}
+}
+
+// TestReloadTunnel_FlagsWin verifies a port given on the command line
+// is kept over the reloaded config
+func TestReloadTunnel_FlagsWin(t *testing.T) {
+	svc, p, opts := startReloadable(t)
+	opts.overrides = configOverrides{port: 3000}
+	writeConfig(t, "project: demo\nport: 4000\nprovider: loopback\n")
+
+	if _, changed, err := reloadTunnel(context.Background(), svc, opts); err != nil || changed {
+		t.Fatalf("expected no change and no error, got changed %v, %v", changed, err)
+	}
+	if got := p.connects(); len(got) != 1 {
+		t.Errorf("expected only the first connect, got %v", got)
+	}
+}
@@ -3,22 +3,52 @@ package cli
 import (
 	"github.com/spf13/cobra"
 
+	"github.com/kernelshard/expose/internal/config"
 	"github.com/kernelshard/expose/internal/version"
 )
 
-var rootCmd = &cobra.Command{
-	Use:     "expose",
-	Short:   "Expose localhost to the internet",
-	Long:    "Minimal CLI to expose your local dev server",
-	Version: version.GetFullVersion(),
+// newRootCmd creates the 'expose' command with all subcommands.
+func newRootCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "expose",
+		Short:   "Expose localhost to the internet",
+		Long:    "Minimal CLI to expose your local dev server",
+		Version: version.GetFullVersion(),
+
+		// errors are printed once by main, which also sets the exit code
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+
+	// config flag for setups with several configs e.g. expose --config staging.yml tunnel
+	cmd.PersistentFlags().String("config", "", "Config file to use (default ./.expose.yml)")
+
+	// Add commands
+	cmd.AddCommand(newInitCmd())
+	cmd.AddCommand(newTunnelCmd())
+	cmd.AddCommand(newConfigCmd())
+	cmd.AddCommand(newDoctorCmd())
+	cmd.AddCommand(newStopCmd())
+	cmd.AddCommand(newProvidersCmd())
+
+	return cmd
 }
 
 func Execute() error {
+	return newRootCmd().Execute()
+}
 
-	// Add commands
-	rootCmd.AddCommand(newInitCmd())
-	rootCmd.AddCommand(newTunnelCmd())
-	rootCmd.AddCommand(newConfigCmd())
+// configPath returns the --config file of cmd, "" for the default one.
+// Commands run on their own, as in tests, have no --config flag.
+func configPath(cmd *cobra.Command) string {
+	path, _ := cmd.Flags().GetString("config")
+	return path
+}
 
-	return rootCmd.Execute()
+// configFileName returns the config file path names for messages.
+func configFileName(path string) string {
+	if path == "" {
+		return config.DefaultConfigFile
+	}
+	return path
 }
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kernelshard/expose/internal/config"
+)
+
+// writeConfigs sets up a temp project holding a default config for project
+// "default" and custom.yml for project "custom".
+func writeConfigs(t *testing.T) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(config.DefaultConfigFile, []byte("version: 1\nproject: default\nport: 3000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("custom.yml", []byte("version: 1\nproject: custom\nport: 4000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// execRoot executes the expose command with args, see writeConfigs.
+func execRoot(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	writeConfigs(t)
+
+	var out bytes.Buffer
+	cmd := newRootCmd()
+	cmd.SetArgs(args)
+	cmd.SetOut(&out)
+	cmd.SetErr(io.Discard)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+// TestConfigFlag verifies --config replaces the default file for the config
+// commands, before or after the subcommand
+func TestConfigFlag(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"default", []string{"config", "get", "project"}, "default\n"},
+		{"config get", []string{"--config", "custom.yml", "config", "get", "project", "port"}, "project: custom\nport: 4000\n"},
+		{"flag after subcommand", []string{"config", "get", "project", "--config", "custom.yml"}, "custom\n"},
+		{"config effective", []string{"--config", "custom.yml", "config", "effective", "-p", "8080"},
+			"version: 1\nproject: custom\nport: 8080\nprovider: localtunnel\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := execRoot(t, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestConfigFlag_Missing verifies a missing --config file is an error, not
+// a fallback to the default file
+func TestConfigFlag_Missing(t *testing.T) {
+	for _, args := range [][]string{
+		{"--config", "missing.yml", "config", "get", "project"},
+		{"--config", "missing.yml", "tunnel"},
+	} {
+		t.Run(args[2], func(t *testing.T) {
+			_, err := execRoot(t, args...)
+			if err == nil || !strings.Contains(err.Error(), "missing.yml") {
+				t.Errorf("expected error naming missing.yml, got %v", err)
+			}
+		})
+	}
+}
+
+// TestConfigFlag_Tunnel verifies the tunnel command and its reloads use the
+// --config file: without a default file it gets past loading the config to
+// the flag checks
+func TestConfigFlag_Tunnel(t *testing.T) {
+	writeConfigs(t)
+	if err := os.Remove(config.DefaultConfigFile); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := newRootCmd()
+	cmd.SetArgs([]string{"--config", "custom.yml", "tunnel", "--insecure-skip-local-verify"})
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	err := cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "--local-scheme https") {
+		t.Fatalf("expected the flag check error, got %v", err)
+	}
+
+	opts, err := reloadConfig(tunnelOptions{port: 3000, provider: "loopback", configPath: "custom.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.port != 4000 {
+		t.Errorf("expected reload to read port 4000 from custom.yml, got %d", opts.port)
+	}
+}
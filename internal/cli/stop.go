@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// stopTimeout bounds how long 'expose stop' waits for the tunnel to exit.
+// The tunnel runs its on-close hooks first, which are bounded by hookTimeout.
+const stopTimeout = hookTimeout + 5*time.Second
+
+// newStopCmd creates the 'stop' command
+// e.g. expose stop
+func newStopCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "stop",
+		Short: "Stop a tunnel started with --detach",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return stopTunnel(cmd.OutOrStdout(), daemonFilesIn(""), signalProcess, stopTimeout)
+		},
+	}
+}
+
+// stopTunnel sends SIGTERM to the detached tunnel recorded in files, waits
+// up to timeout for it to exit and removes its PID and state files.
+// No running tunnel, including a stale PID file, is not an error.
+func stopTunnel(w io.Writer, files daemonFiles, signal signaler, timeout time.Duration) error {
+	pid, err := files.readPID()
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintln(w, "No tunnel running")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := signal(pid, syscall.SIGTERM); err != nil {
+		if processGone(err) {
+			files.remove()
+			fmt.Fprintf(w, "No tunnel running (PID %d had already exited), removed stale PID file\n", pid)
+			return nil
+		}
+		return fmt.Errorf("stop tunnel (PID %d): %w", pid, err)
+	}
+
+	fmt.Fprintf(w, "Stopping tunnel (PID %d)...\n", pid)
+	if err := waitForExit(signal, pid, timeout); err != nil {
+		return err
+	}
+
+	// the tunnel cleans up after itself, this covers a crash during shutdown
+	files.remove()
+	fmt.Fprintln(w, "✓ Tunnel stopped")
+	return nil
+}
+
+// waitForExit polls pid until it is gone or timeout passes.
+func waitForExit(signal signaler, pid int, timeout time.Duration) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.After(timeout)
+
+	for processAlive(signal, pid) {
+		select {
+		case <-deadline:
+			return fmt.Errorf("tunnel (PID %d) did not exit within %s", pid, timeout)
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeProcess is a process that exits a few liveness probes after SIGTERM.
+type fakeProcess struct {
+	pid        int
+	terminated bool
+	probes     int // liveness probes answered after SIGTERM
+	exitAfter  int // probes until the process is gone, < 0 never exits
+}
+
+func (p *fakeProcess) signal(pid int, sig os.Signal) error {
+	if pid != p.pid {
+		return syscall.ESRCH
+	}
+	if sig == syscall.SIGTERM {
+		p.terminated = true
+		return nil
+	}
+	if !p.terminated {
+		return nil
+	}
+	p.probes++
+	if p.exitAfter >= 0 && p.probes > p.exitAfter {
+		return os.ErrProcessDone
+	}
+	return nil
+}
+
+func TestStopTunnel_WaitsForExit(t *testing.T) {
+	files := daemonFilesIn(t.TempDir())
+	if err := files.writePID(4242); err != nil {
+		t.Fatal(err)
+	}
+	if err := files.writeState(tunnelState{PID: 4242, URL: "https://abc.loca.lt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	proc := &fakeProcess{pid: 4242, exitAfter: 2}
+	var out bytes.Buffer
+	if err := stopTunnel(&out, files, proc.signal, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if !proc.terminated {
+		t.Error("expected SIGTERM to be sent")
+	}
+	if proc.probes != 3 {
+		t.Errorf("expected to poll until the process exited, got %d probes", proc.probes)
+	}
+	for _, path := range []string{files.pid, files.state} {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected %s removed, got %v", path, err)
+		}
+	}
+	if !strings.Contains(out.String(), "Tunnel stopped") {
+		t.Errorf("expected stopped message, got %q", out.String())
+	}
+}
+
+func TestStopTunnel_Timeout(t *testing.T) {
+	files := daemonFilesIn(t.TempDir())
+	if err := files.writePID(4242); err != nil {
+		t.Fatal(err)
+	}
+
+	proc := &fakeProcess{pid: 4242, exitAfter: -1}
+	err := stopTunnel(&bytes.Buffer{}, files, proc.signal, 200*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "did not exit") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	// the process is still running, keep its PID file for another attempt
+	if _, err := os.Stat(files.pid); err != nil {
+		t.Errorf("expected PID file kept, got %v", err)
+	}
+}
+
+func TestStopTunnel_StalePID(t *testing.T) {
+	files := daemonFilesIn(t.TempDir())
+	if err := files.writePID(4242); err != nil {
+		t.Fatal(err)
+	}
+
+	// no process with that PID
+	proc := &fakeProcess{pid: 1}
+	var out bytes.Buffer
+	if err := stopTunnel(&out, files, proc.signal, time.Second); err != nil {
+		t.Fatalf("expected stale PID to be handled, got %v", err)
+	}
+
+	if _, err := os.Stat(files.pid); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected stale PID file removed, got %v", err)
+	}
+	if !strings.Contains(out.String(), "stale") {
+		t.Errorf("expected stale notice, got %q", out.String())
+	}
+}
+
+func TestStopTunnel_NothingRunning(t *testing.T) {
+	proc := &fakeProcess{pid: 4242}
+	var out bytes.Buffer
+	if err := stopTunnel(&out, daemonFilesIn(t.TempDir()), proc.signal, time.Second); err != nil {
+		t.Fatalf("expected no error without a tunnel, got %v", err)
+	}
+	if proc.terminated {
+		t.Error("expected no signal to be sent")
+	}
+	if !strings.Contains(out.String(), "No tunnel running") {
+		t.Errorf("expected friendly message, got %q", out.String())
+	}
+}
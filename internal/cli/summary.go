@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/kernelshard/expose/internal/tunnel"
+)
+
+// formatSummary renders the --summary end-of-session report for stats.
+func formatSummary(stats tunnel.Stats) string {
+	return fmt.Sprintf("Session summary:\n"+
+		"  uptime:   %s\n"+
+		"  requests: %d (%d errors)\n"+
+		"  in:       %s\n"+
+		"  out:      %s\n",
+		stats.Uptime.Round(time.Second), stats.Requests, stats.Errors,
+		tunnel.FormatBytes(stats.BytesIn), tunnel.FormatBytes(stats.BytesOut))
+}
+
+// printUsage prints the --summary report for stats to summary, or else
+// the bytes transferred, which the report includes.
+func printUsage(opts tunnelOptions, summary io.Writer, stats tunnel.Stats) {
+	if opts.summary {
+		fmt.Fprint(summary, formatSummary(stats))
+		return
+	}
+	fmt.Fprintf(infoWriter(opts), "✓ Transferred %s in / %s out\n", tunnel.FormatBytes(stats.BytesIn), tunnel.FormatBytes(stats.BytesOut))
+}
@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/kernelshard/expose/internal/tunnel"
+)
+
+func TestFormatSummary(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats tunnel.Stats
+		want  string
+	}{
+		{"idle", tunnel.Stats{},
+			"Session summary:\n  uptime:   0s\n  requests: 0 (0 errors)\n  in:       0 B\n  out:      0 B\n"},
+		{"busy", tunnel.Stats{Requests: 42, Errors: 3, BytesIn: 1536, BytesOut: 5 << 20, Uptime: 90*time.Minute + 1400*time.Millisecond},
+			"Session summary:\n  uptime:   1h30m1s\n  requests: 42 (3 errors)\n  in:       1.5 KB\n  out:      5.0 MB\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatSummary(tt.stats); got != tt.want {
+				t.Errorf("formatSummary() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPrintUsage verifies the transferred bytes are printed only without
+// --summary, whose report already has them
+func TestPrintUsage(t *testing.T) {
+	stats := tunnel.Stats{BytesIn: 1536, BytesOut: 2048}
+	tests := []struct {
+		name                 string
+		summary              bool
+		wantOut, wantSummary string
+	}{
+		{"default", false, "✓ Transferred 1.5 KB in / 2.0 KB out\n", ""},
+		{"summary", true, "", formatSummary(stats)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out, summary bytes.Buffer
+			printUsage(tunnelOptions{summary: tt.summary, stdout: &out}, &summary, stats)
+			if out.String() != tt.wantOut {
+				t.Errorf("expected output %q, got %q", tt.wantOut, out.String())
+			}
+			if summary.String() != tt.wantSummary {
+				t.Errorf("expected summary %q, got %q", tt.wantSummary, summary.String())
+			}
+		})
+	}
+}
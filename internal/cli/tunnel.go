@@ -2,18 +2,126 @@ package cli
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"text/template"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/kernelshard/expose/internal/config"
 	"github.com/kernelshard/expose/internal/provider"
 	"github.com/kernelshard/expose/internal/tunnel"
+	"github.com/kernelshard/expose/internal/version"
 )
 
+// tunnelOptions holds the resolved settings for a single tunnel run.
+type tunnelOptions struct {
+	port            int
+	provider        string
+	subdomain       string
+	localScheme     string
+	localHTTP2      bool
+	localNetwork    string // "tcp4" or "tcp6" pins the local server's IP family
+	unixSocket      string // local server socket, dialed instead of port
+	listenAddr      string
+	requestIDHeader string
+	identify        bool
+	allowConnect    bool
+	retrySafe       bool
+	cache           bool
+	stripPrefix     string
+	addPrefix       string
+	preserveHost    bool              // forward the public Host instead of localhost:port
+	proxyProtocol   int               // PROXY protocol version sent to the local server, 0 = off
+	allowMethods    []string          // empty allows every method
+	allowPaths      []tunnel.PathRule // empty allows every path
+	stripHeaders    []string          // response headers removed, a trailing * matches a prefix
+	cacheTTL        time.Duration
+	slowThreshold   time.Duration
+	largePayload    int64 // bodies above this many bytes are logged, 0 disables it
+	maxConcurrency  int
+	maxQueue        int           // localtunnel requests waiting for a --max-concurrency slot, 0 = unbounded
+	queueTimeout    time.Duration // how long a queued request waits, 0 = no limit
+	maxPerClient    int
+	tcpWorkers      int // raw TCP connections forwarded at once, 0 = unbounded
+	maxHeaderBytes  int
+	bufferLimit     int64 // responses are streamed when 0
+	throttleUp      int64 // bytes/s to the local server, 0 = unlimited
+	throttleDown    int64 // bytes/s back to clients, 0 = unlimited
+	tcpKeepAlive    time.Duration
+	timeouts        tunnel.ServerTimeouts
+	healthInterval  time.Duration
+	readyTimeout    time.Duration // Start must be ready within it, 0 = no limit
+	reconnect       bool          // --keep-alive: reconnect a dropped tunnel instead of exiting
+	reconnectPolicy tunnel.ReconnectPolicy
+	pprofAddr       string // profiling endpoints listen here, "" disables them
+	apiAddr         string // control API listens here, "" disables it
+	watch           bool
+	watchInterval   time.Duration // 0 picks watchInterval's default
+	summary         bool          // end-of-session report on stderr
+
+	// formats the public URL for output and hooks, nil keeps it raw
+	urlTemplate *template.Template
+
+	// quiet prints only the public URL to stdout, see infoWriter, json
+	// only the forwarding as JSON, see printURL
+	quiet  bool
+	json   bool
+	stdout io.Writer // os.Stdout when nil
+
+	// logger of --debug, nil keeps the default logger
+	logger *slog.Logger
+
+	// skip certificate checks of an https local server, never the tunnel's
+	insecureSkipLocalVerify bool
+
+	// access log settings, an empty format disables the access log
+	accessLogFormat tunnel.AccessLogFormat
+	logFile         string
+	accessLog       io.Writer // opened by runTunnel, stdout by default
+
+	// localtunnel server connection settings
+	tunnelServer string // self-hosted server API, "" for localtunnel.me
+	tunnelProxy  *url.URL
+	tunnelTLS    bool
+	tunnelSNI    string // TLS server name of the tunnel connections, "" for the host
+	maxRetries   int    // retries of the whole connect sequence, 0 = API retries only
+	onDemand     bool   // grow the connection pool as requests arrive
+	bindAddr     net.IP // source IP of the localtunnel connections
+
+	// lookups of the localtunnel server names, see provider.WithResolver
+	dnsServer  string        // "" for the system resolver
+	dnsTimeout time.Duration // bound of each lookup, 0 = none
+
+	// lifecycle hooks, see hooks.go
+	onReadyExec    string
+	onReadyWebhook string
+	onCloseExec    string
+	onCloseWebhook string
+	urlFile        string   // holds the public URL while the tunnel is up
+	urlFD          *os.File // gets each public URL as a line, nil when unset
+
+	// cloudflare named tunnel settings
+	cfTunnelName string
+	cfToken      string
+	cfHostname   string
+
+	// command line settings kept over the config on reload, see reload.go
+	overrides  configOverrides
+	configPath string // --config, "" for config.DefaultConfigFile
+}
+
 // tunnelCmd represents the tunnel command
 func newTunnelCmd() *cobra.Command {
 	//Use:   "tunnel",
@@ -22,110 +130,1319 @@ func newTunnelCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "tunnel",
 		Short: "Expose local server via tunnel",
-		RunE:  runTunnelCmd,
+		Long:  "Expose local server via tunnel. The port comes from --port, a bare port argument or the config, in that order.",
+		Example: `  expose tunnel
+  expose tunnel 8080
+  expose tunnel --port 8080 -P cloudflare`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: runTunnelCmd,
 	}
 
 	// Define flags
 	// provider flag to specify provider e.g. expose tunnel --provider cloudflare
-	cmd.Flags().StringP("provider", "P", "localtunnel", "Tunnel provider: localtunnel, cloudflare, etc. defaults to localtunnel")
+	cmd.Flags().StringP("provider", "P", "localtunnel", "Tunnel provider: localtunnel, cloudflare, loopback (local only) or auto. defaults to localtunnel")
 
 	// port flag to specify local port e.g. expose tunnel --port 8080
 	cmd.Flags().IntP("port", "p", 0, "Local port to expose (overrides config)")
+
+	// subdomain flag to request a specific subdomain e.g. expose tunnel --subdomain myapp,myapp-dev
+	cmd.Flags().String("subdomain", "", "Request a specific public subdomain (if the provider supports it), a comma-separated list is tried in order until one is free")
+
+	// max-concurrency flag to protect the local server e.g. expose tunnel --max-concurrency 4
+	cmd.Flags().Int("max-concurrency", 0, "Maximum requests forwarded to the local server at once (0 = unlimited)")
+	cmd.Flags().Int("max-queue", 0, "Maximum localtunnel requests waiting for a --max-concurrency slot, excess get 503 (0 = unlimited)")
+	cmd.Flags().Duration("queue-timeout", 0, "How long a localtunnel request waits for a --max-concurrency slot before it gets 503 (0 = no limit)")
+	cmd.Flags().Int("max-conns-per-client", 0, "Maximum concurrent requests per client IP, excess get 429 (0 = unlimited)")
+
+	// tcp-workers flag to bound raw TCP forwarding e.g. expose tunnel -P loopback --tcp-workers 64
+	cmd.Flags().Int("tcp-workers", 0, "Maximum raw TCP connections forwarded at once by providers forwarding TCP, others wait to be accepted (0 = unlimited)")
+
+	// localtunnel connection flags e.g. expose tunnel --tunnel-proxy socks5://127.0.0.1:1080
+	cmd.Flags().String("tunnel-proxy", "", "Proxy for the localtunnel server connections (http:// or socks5://)")
+	cmd.Flags().Bool("tunnel-tls", false, "Use TLS for the localtunnel server connections")
+	cmd.Flags().String("tunnel-sni", "", "TLS server name (SNI) for the localtunnel server connections, requires --tunnel-tls")
+	cmd.Flags().Int("max-retries", 0, "Retry the whole localtunnel connect sequence (tunnel request and connection pool) up to this many times (0 only retries the request)")
+	cmd.Flags().String("tunnel-server", "", "Self-hosted localtunnel server to request tunnels from (default https://localtunnel.me)")
+	cmd.Flags().String("bind", "", "Source IP for the localtunnel connections, on machines with several interfaces")
+	cmd.Flags().Bool("on-demand", false, "Open one localtunnel connection and add more as requests arrive, instead of the whole pool upfront")
+	cmd.Flags().String("dns-server", "", "DNS server (IP[:port]) to look up the localtunnel server with, instead of the system resolver")
+	cmd.Flags().Duration("dns-timeout", 0, "How long a localtunnel server lookup may take before the connection fails (0 = no limit)")
+
+	// on-ready hooks e.g. expose tunnel --on-ready-exec 'echo {url} > url.txt'
+	cmd.Flags().String("on-ready-exec", "", "Shell command to run once the tunnel is ready ({url} is replaced by the quoted URL, also in $EXPOSE_URL)")
+	cmd.Flags().String("on-ready-webhook", "", "URL to POST {\"event\",\"url\"} JSON to once the tunnel is ready")
+
+	// on-close hooks run before the tunnel shuts down, also on Ctrl+C
+	cmd.Flags().String("on-close-exec", "", "Shell command to run before the tunnel closes ({url} is replaced by the quoted URL, also in $EXPOSE_URL)")
+	cmd.Flags().String("on-close-webhook", "", "URL to POST {\"event\",\"url\"} JSON to before the tunnel closes")
+
+	// url-file flag for CI steps e.g. expose tunnel --detach --url-file url.txt
+	cmd.Flags().String("url-file", "", "Write the public URL to this file once ready, removed when the tunnel closes")
+
+	// url-fd flag for launchers reading the URL from a pipe e.g. expose tunnel --url-fd 3 3>url.pipe
+	cmd.Flags().Int("url-fd", 0, "Write the public URL as a line to this inherited file descriptor (3 or above) once ready, closed when the tunnel closes")
+
+	// cloudflare named tunnel flags e.g. expose tunnel -P cloudflare --cf-tunnel-name dev --cf-hostname dev.example.com
+	cmd.Flags().String("cf-tunnel-name", "", "Run a Cloudflare named tunnel instead of a quick tunnel")
+	cmd.Flags().String("cf-token", "", "Cloudflare tunnel token for the named tunnel (visible in ps, prefer --credentials-file)")
+	cmd.Flags().String("cf-hostname", "", "Public hostname routed to the Cloudflare named tunnel")
+	cmd.Flags().String("credentials-file", "", "File holding the provider credential, e.g. the Cloudflare tunnel token (overrides config)")
+	cmd.MarkFlagsMutuallyExclusive("cf-token", "credentials-file")
+
+	// local-scheme flag for HTTPS dev servers e.g. expose tunnel --local-scheme https
+	cmd.Flags().String("local-scheme", "http", "Scheme of the local server: http or https")
+	cmd.Flags().Bool("insecure-skip-local-verify", false, "Don't verify the local server's certificate with --local-scheme https (e.g. self-signed dev certs)")
+	cmd.Flags().Bool("local-http2", false, "Speak HTTP/2 to the local server (h2 over https, h2c over http)")
+	cmd.Flags().Bool("local-ipv4", false, "Reach the local server over IPv4 only (127.0.0.1)")
+	cmd.Flags().Bool("local-ipv6", false, "Reach the local server over IPv6 only (::1)")
+
+	// unix flag for servers listening on a socket e.g. expose tunnel --unix /var/run/docker.sock
+	cmd.Flags().String("unix", "", "Forward to the local server on this Unix domain socket instead of a TCP port")
+
+	// proxy-protocol flag passes client addresses to servers that expect it e.g. expose tunnel --proxy-protocol v2
+	cmd.Flags().String("proxy-protocol", "", "Start local connections with a PROXY protocol header carrying the client address: v1 or v2 (the local server must expect it)")
+
+	// listen flag for a predictable proxy port e.g. expose tunnel --listen :8000
+	cmd.Flags().String("listen", tunnel.DefaultListenAddr, "Address the local proxy listens on, must be reachable via localhost (:0 picks a free port)")
+
+	// request-id-header flag to correlate logs e.g. expose tunnel --request-id-header X-Correlation-ID
+	cmd.Flags().String("request-id-header", tunnel.DefaultRequestIDHeader, "Header carrying a per-request correlation ID (empty disables)")
+
+	// identify flag so backends can tell traffic came through expose
+	cmd.Flags().Bool("identify", false, "Add Via and X-Expose-Version headers to forwarded requests and responses")
+
+	// allow-connect flag tunnels CONNECT requests to the local port instead of refusing them
+	cmd.Flags().Bool("allow-connect", false, "Tunnel CONNECT requests as raw TCP to the local server (default 405)")
+
+	// retry-idempotent flag smooths over dev server restarts
+	cmd.Flags().Bool("retry-idempotent", false, "Resend GET, HEAD, OPTIONS, PUT and DELETE once if the local server drops the connection before responding")
+
+	// cache flags for demoing static-ish endpoints e.g. expose tunnel --cache --cache-ttl 30s
+	cmd.Flags().Bool("cache", false, "Cache cacheable GET responses in memory (X-Expose-Cache: HIT/MISS)")
+	cmd.Flags().Duration("cache-ttl", time.Minute, "Maximum age of cached responses")
+
+	// path prefix rewriting e.g. expose tunnel --add-prefix /api maps the public root to /api
+	cmd.Flags().String("strip-prefix", "", "Remove this path prefix from requests before forwarding")
+	cmd.Flags().String("add-prefix", "", "Prepend this path prefix to requests before forwarding")
+
+	// preserve-host flag for backends that route on the public hostname
+	cmd.Flags().Bool("preserve-host", false, "Forward the public Host header as is (default: rewrite it to localhost:<port>, the public host goes in X-Forwarded-Host)")
+
+	// request filters for read-only demos e.g. expose tunnel --allow-methods GET,HEAD --allow-path /docs
+	cmd.Flags().StringSlice("allow-methods", nil, "Only forward these methods, others get 405 (e.g. GET,HEAD)")
+	cmd.Flags().StringArray("allow-path", nil, "Only forward paths with this prefix, or matching it when it starts with ^ (repeatable)")
+
+	// strip-response-header flag hides what the local server is e.g. expose tunnel --strip-response-header 'X-Internal-*'
+	cmd.Flags().StringArray("strip-response-header", nil, "Remove this header from responses, a trailing * removes every header with that prefix (repeatable)")
+
+	// max-header-bytes flag answers oversized request headers with 431
+	cmd.Flags().Int("max-header-bytes", tunnel.DefaultMaxHeaderBytes, "Largest request header forwarded to the local server (0 disables)")
+
+	// buffer-responses flag trades streaming for exact Content-Length and clean 502s
+	cmd.Flags().Bool("buffer-responses", false, "Read whole responses from the local server before sending them, instead of streaming")
+	cmd.Flags().Int64("max-buffer-bytes", tunnel.DefaultBufferLimit, "Largest response body --buffer-responses holds in memory, bigger ones get 502")
+
+	// throttle flags simulate a slow network e.g. expose tunnel --throttle-down 64
+	cmd.Flags().Int64("throttle-up", 0, "Limit request bodies sent to the local server to this many KB/s (0 = unlimited)")
+	cmd.Flags().Int64("throttle-down", 0, "Limit responses sent back to clients to this many KB/s (0 = unlimited)")
+
+	// tcp-keepalive flag keeps idle connections alive behind NATs
+	cmd.Flags().Duration("tcp-keepalive", tunnel.DefaultKeepAlive, "TCP keep-alive period for tunnel and local connections (0 disables)")
+
+	// access log flags e.g. expose tunnel --access-log-format combined --log-file access.log
+	cmd.Flags().String("access-log-format", "", "Write an Apache-style access log: common or combined")
+	cmd.Flags().String("log-file", "", "File to append the access log to (default stdout)")
+
+	// proxy server timeouts, the defaults guard against slowloris clients
+	cmd.Flags().Duration("read-header-timeout", tunnel.DefaultServerTimeouts.ReadHeader, "Time allowed to read request headers (0 disables)")
+	cmd.Flags().Duration("read-timeout", tunnel.DefaultServerTimeouts.Read, "Time allowed to read a whole request (0 disables)")
+	cmd.Flags().Duration("write-timeout", tunnel.DefaultServerTimeouts.Write, "Time allowed to write a response, cuts off streams (0 disables)")
+	cmd.Flags().Duration("idle-timeout", tunnel.DefaultServerTimeouts.Idle, "Time an idle keep-alive connection is kept open (0 disables)")
+
+	// url-template flag shapes the printed URL e.g. expose tunnel --url-template '{{.URL}}/webhook'
+	cmd.Flags().String("url-template", "", "Go template for the printed and announced URL, with .URL, .Scheme and .Host")
+
+	// health-interval flag to probe the provider and log when it turns unhealthy
+	cmd.Flags().Duration("health-interval", tunnel.DefaultHealthInterval, "How often to health-check the tunnel (0 disables)")
+
+	// reconnection policy flags e.g. expose tunnel --keep-alive
+	cmd.Flags().Bool("fail-fast", false, "Exit with an error when the tunnel drops (default)")
+	cmd.Flags().Bool("keep-alive", false, "Reconnect the tunnel when it drops instead of exiting")
+	cmd.MarkFlagsMutuallyExclusive("fail-fast", "keep-alive")
+
+	// pprof-addr flag to inspect a running tunnel e.g. expose tunnel --pprof-addr 127.0.0.1:6060
+	cmd.Flags().String("pprof-addr", "", "Serve net/http/pprof profiles on this address, a listener the tunnel never forwards to")
+
+	// api-addr flag for dev tooling e.g. expose tunnel --api-addr 127.0.0.1:4040
+	cmd.Flags().String("api-addr", "", "Serve a JSON control API (status, start, stop) on this loopback address")
+
+	// ready-timeout flag so a hanging provider fails startup e.g. expose tunnel --ready-timeout 1m
+	cmd.Flags().Duration("ready-timeout", 0, "Give up if the tunnel isn't ready within this time, including retries (0 = wait indefinitely)")
+
+	// quiet flag for scripts that only want the URL e.g. URL=$(expose tunnel -q | head -1)
+	cmd.Flags().BoolP("quiet", "q", false, "Print only the public URL, warnings still go to stderr")
+
+	// json flag for tools reading the forwarding e.g. expose tunnel --json | jq -r '.[0].public_url'
+	cmd.Flags().Bool("json", false, "Print only the forwarding (public URL and local server) as JSON, again when the URL changes")
+	cmd.MarkFlagsMutuallyExclusive("json", "quiet")
+
+	// debug flag traces the connection lifecycle e.g. expose tunnel --debug 2> debug.log
+	cmd.Flags().Bool("debug", false, "Log every tunnel connection, dial, API response and proxied request to stderr")
+
+	// watch flag keeps a live status line e.g. expose tunnel --watch
+	cmd.Flags().Bool("watch", false, "Show live request, connection and traffic counts")
+	cmd.Flags().Duration("watch-interval", 0, "How often --watch refreshes (default 1s on a terminal, 30s otherwise)")
+
+	// summary flag reports the session on exit e.g. expose tunnel --summary
+	cmd.Flags().Bool("summary", false, "Print requests, errors, traffic and uptime to stderr on exit")
+
+	// detach flag frees the terminal, stop it again with 'expose stop'
+	cmd.Flags().Bool("detach", false, "Run the tunnel in the background (logs go to .expose.log)")
+	cmd.MarkFlagsMutuallyExclusive("json", "detach")
+
+	// slow-threshold flag to warn about slow requests e.g. expose tunnel --slow-threshold 2s
+	cmd.Flags().Duration("slow-threshold", 0, "Log a warning for requests slower than this (0 disables)")
+	// large-payload-bytes flag to find memory-hungry endpoints e.g. expose tunnel --large-payload-bytes 10485760
+	cmd.Flags().Int64("large-payload-bytes", 0, "Log a warning for request or response bodies larger than this many bytes (0 disables)")
 	return cmd
 }
 
 // runTunnelCmd represents the 'tunnel' command in the CLI application.
-func runTunnelCmd(cmd *cobra.Command, _ []string) error {
+func runTunnelCmd(cmd *cobra.Command, args []string) error {
 
 	// Load config
-	cfg, err := config.Load("")
+	cfg, err := config.Load(configPath(cmd))
 	if err != nil {
 		return fmt.Errorf("config not found (run 'expose init' first): %w", err)
 	}
 
-	// Get port from flag
+	overrides, err := overridesFrom(cmd, args)
+	if err != nil {
+		return err
+	}
+	eff, detected, err := resolveConfig(cfg, overrides)
+	if err != nil {
+		return err
+	}
+	if quiet, _ := cmd.Flags().GetBool("quiet"); detected && !quiet {
+		fmt.Printf("Detected port %d from .env\n", eff.Port)
+	}
+	port, providerName := eff.Port, eff.Provider
+
+	subdomain, err := cmd.Flags().GetString("subdomain")
+	if err != nil {
+		return fmt.Errorf("invalid subdomain flag %w", err)
+	}
+	if strings.Contains(subdomain, ",") {
+		names := strings.Split(subdomain, ",")
+		for i, name := range names {
+			if names[i] = strings.TrimSpace(name); names[i] == "" {
+				return fmt.Errorf("invalid subdomain %q: empty name in the list", subdomain)
+			}
+		}
+		subdomain = strings.Join(names, ",")
+	}
+
+	localScheme, err := cmd.Flags().GetString("local-scheme")
+	if err != nil {
+		return fmt.Errorf("invalid local-scheme flag %w", err)
+	}
+	if localScheme != "http" && localScheme != "https" {
+		return fmt.Errorf("invalid local scheme %q (must be http or https)", localScheme)
+	}
+
+	insecureSkipLocalVerify, err := cmd.Flags().GetBool("insecure-skip-local-verify")
+	if err != nil {
+		return fmt.Errorf("invalid insecure-skip-local-verify flag %w", err)
+	}
+	if insecureSkipLocalVerify {
+		if localScheme != "https" {
+			return errors.New("--insecure-skip-local-verify requires --local-scheme https")
+		}
+		fmt.Fprintln(os.Stderr, "⚠ Local server certificate verification is disabled (--insecure-skip-local-verify)")
+	}
+
+	localHTTP2, err := cmd.Flags().GetBool("local-http2")
+	if err != nil {
+		return fmt.Errorf("invalid local-http2 flag %w", err)
+	}
+
+	localNetwork, err := localNetworkFlag(cmd)
+	if err != nil {
+		return err
+	}
+	if overrides.unix != "" {
+		if localNetwork != "" {
+			return errors.New("--unix can't be used with --local-ipv4 or --local-ipv6")
+		}
+		if err := tunnel.ValidateUnixSocket(overrides.unix); err != nil {
+			return err
+		}
+	}
+
+	proxyProtocol, err := proxyProtocolFlag(cmd, localHTTP2)
+	if err != nil {
+		return err
+	}
+
+	listenAddr, err := cmd.Flags().GetString("listen")
+	if err != nil {
+		return fmt.Errorf("invalid listen flag %w", err)
+	}
+	if err := tunnel.ValidateListenAddr(listenAddr); err != nil {
+		return err
+	}
+	if overrides.unix == "" {
+		if err := tunnel.CheckSelfForward(listenAddr, port); err != nil {
+			return fmt.Errorf("%w (change --listen or --port)", err)
+		}
+	}
+
+	pprofAddr, _ := cmd.Flags().GetString("pprof-addr")
+	if pprofAddr != "" {
+		if err := checkPprofAddr(pprofAddr, port, os.Stderr); err != nil {
+			return err
+		}
+	}
+
+	apiAddr, _ := cmd.Flags().GetString("api-addr")
+	if apiAddr != "" {
+		if err := checkAPIAddr(apiAddr, port); err != nil {
+			return err
+		}
+	}
+
+	requestIDHeader, err := cmd.Flags().GetString("request-id-header")
+	if err != nil {
+		return fmt.Errorf("invalid request-id-header flag %w", err)
+	}
+
+	identify, err := cmd.Flags().GetBool("identify")
+	if err != nil {
+		return fmt.Errorf("invalid identify flag %w", err)
+	}
+
+	allowConnect, err := cmd.Flags().GetBool("allow-connect")
+	if err != nil {
+		return fmt.Errorf("invalid allow-connect flag %w", err)
+	}
+
+	retrySafe, err := cmd.Flags().GetBool("retry-idempotent")
+	if err != nil {
+		return fmt.Errorf("invalid retry-idempotent flag %w", err)
+	}
+
+	cache, err := cmd.Flags().GetBool("cache")
+	if err != nil {
+		return fmt.Errorf("invalid cache flag %w", err)
+	}
+
+	cacheTTL, err := cmd.Flags().GetDuration("cache-ttl")
+	if err != nil {
+		return fmt.Errorf("invalid cache-ttl flag %w", err)
+	}
+
+	stripPrefix, err := cmd.Flags().GetString("strip-prefix")
+	if err != nil {
+		return fmt.Errorf("invalid strip-prefix flag %w", err)
+	}
+
+	addPrefix, err := cmd.Flags().GetString("add-prefix")
+	if err != nil {
+		return fmt.Errorf("invalid add-prefix flag %w", err)
+	}
+
+	preserveHost, err := cmd.Flags().GetBool("preserve-host")
+	if err != nil {
+		return fmt.Errorf("invalid preserve-host flag %w", err)
+	}
+
+	allowMethods, err := cmd.Flags().GetStringSlice("allow-methods")
+	if err != nil {
+		return fmt.Errorf("invalid allow-methods flag %w", err)
+	}
+
+	allowPathFlags, err := cmd.Flags().GetStringArray("allow-path")
+	if err != nil {
+		return fmt.Errorf("invalid allow-path flag %w", err)
+	}
+	var allowPaths []tunnel.PathRule
+	for _, raw := range allowPathFlags {
+		rule, err := tunnel.ParsePathRule(raw)
+		if err != nil {
+			return err
+		}
+		allowPaths = append(allowPaths, rule)
+	}
+
+	stripHeaders, err := cmd.Flags().GetStringArray("strip-response-header")
+	if err != nil {
+		return fmt.Errorf("invalid strip-response-header flag %w", err)
+	}
+	for _, name := range stripHeaders {
+		if prefix, _ := strings.CutSuffix(name, "*"); prefix == "" || strings.ContainsAny(prefix, "*: \t") {
+			return fmt.Errorf("invalid response header %q (must be a header name, optionally ending in *)", name)
+		}
+	}
+
+	maxHeaderBytes, err := cmd.Flags().GetInt("max-header-bytes")
+	if err != nil {
+		return fmt.Errorf("invalid max-header-bytes flag %w", err)
+	}
+
+	var bufferLimit int64
+	if buffer, _ := cmd.Flags().GetBool("buffer-responses"); buffer {
+		if bufferLimit, err = cmd.Flags().GetInt64("max-buffer-bytes"); err != nil {
+			return fmt.Errorf("invalid max-buffer-bytes flag %w", err)
+		}
+		if bufferLimit <= 0 {
+			return fmt.Errorf("invalid max buffer bytes %d (must be positive)", bufferLimit)
+		}
+	}
+
+	throttleUp, err := cmd.Flags().GetInt64("throttle-up")
+	if err != nil {
+		return fmt.Errorf("invalid throttle-up flag %w", err)
+	}
+	throttleDown, err := cmd.Flags().GetInt64("throttle-down")
+	if err != nil {
+		return fmt.Errorf("invalid throttle-down flag %w", err)
+	}
+	if throttleUp < 0 || throttleDown < 0 {
+		return fmt.Errorf("invalid throttle %d/%d KB/s (must not be negative)", throttleUp, throttleDown)
+	}
+
+	tcpKeepAlive, err := cmd.Flags().GetDuration("tcp-keepalive")
+	if err != nil {
+		return fmt.Errorf("invalid tcp-keepalive flag %w", err)
+	}
+
+	var accessLogFormat tunnel.AccessLogFormat
+	if name, _ := cmd.Flags().GetString("access-log-format"); name != "" {
+		if accessLogFormat, err = tunnel.ParseAccessLogFormat(name); err != nil {
+			return err
+		}
+	}
+	logFile, _ := cmd.Flags().GetString("log-file")
+	if logFile != "" && accessLogFormat == "" {
+		return fmt.Errorf("--log-file requires --access-log-format")
+	}
+
+	var timeouts tunnel.ServerTimeouts
+	for name, d := range map[string]*time.Duration{
+		"read-header-timeout": &timeouts.ReadHeader,
+		"read-timeout":        &timeouts.Read,
+		"write-timeout":       &timeouts.Write,
+		"idle-timeout":        &timeouts.Idle,
+	} {
+		if *d, err = cmd.Flags().GetDuration(name); err != nil {
+			return fmt.Errorf("invalid %s flag %w", name, err)
+		}
+	}
+
+	healthInterval, err := cmd.Flags().GetDuration("health-interval")
+	if err != nil {
+		return fmt.Errorf("invalid health-interval flag %w", err)
+	}
+
+	readyTimeout, err := cmd.Flags().GetDuration("ready-timeout")
+	if err != nil {
+		return fmt.Errorf("invalid ready-timeout flag %w", err)
+	}
+	if readyTimeout < 0 {
+		return fmt.Errorf("invalid ready timeout %s (must not be negative)", readyTimeout)
+	}
+
+	reconnect, err := cmd.Flags().GetBool("keep-alive")
+	if err != nil {
+		return fmt.Errorf("invalid keep-alive flag %w", err)
+	}
+
+	watch, err := cmd.Flags().GetBool("watch")
+	if err != nil {
+		return fmt.Errorf("invalid watch flag %w", err)
+	}
+	watchInterval, err := cmd.Flags().GetDuration("watch-interval")
+	if err != nil {
+		return fmt.Errorf("invalid watch-interval flag %w", err)
+	}
+	if watchInterval < 0 {
+		return fmt.Errorf("invalid watch interval %s (must not be negative)", watchInterval)
+	}
+
+	summary, err := cmd.Flags().GetBool("summary")
+	if err != nil {
+		return fmt.Errorf("invalid summary flag %w", err)
+	}
+
+	var urlTemplate *template.Template
+	if text, _ := cmd.Flags().GetString("url-template"); text != "" {
+		if urlTemplate, err = parseURLTemplate(text); err != nil {
+			return err
+		}
+	}
+
+	slowThreshold, err := cmd.Flags().GetDuration("slow-threshold")
+	if err != nil {
+		return fmt.Errorf("invalid slow-threshold flag %w", err)
+	}
+
+	largePayload, err := cmd.Flags().GetInt64("large-payload-bytes")
+	if err != nil {
+		return fmt.Errorf("invalid large-payload-bytes flag %w", err)
+	}
+	if largePayload < 0 {
+		return fmt.Errorf("invalid large payload bytes %d (must not be negative)", largePayload)
+	}
+
+	maxConcurrency, err := cmd.Flags().GetInt("max-concurrency")
+	if err != nil {
+		return fmt.Errorf("invalid max-concurrency flag %w", err)
+	}
+
+	maxQueue, err := cmd.Flags().GetInt("max-queue")
+	if err != nil {
+		return fmt.Errorf("invalid max-queue flag %w", err)
+	}
+	queueTimeout, err := cmd.Flags().GetDuration("queue-timeout")
+	if err != nil {
+		return fmt.Errorf("invalid queue-timeout flag %w", err)
+	}
+	if maxQueue < 0 || queueTimeout < 0 {
+		return fmt.Errorf("--max-queue and --queue-timeout must not be negative")
+	}
+	if (maxQueue > 0 || queueTimeout > 0) && maxConcurrency <= 0 {
+		return fmt.Errorf("--max-queue and --queue-timeout require --max-concurrency")
+	}
+
+	maxPerClient, err := cmd.Flags().GetInt("max-conns-per-client")
+	if err != nil {
+		return fmt.Errorf("invalid max-conns-per-client flag %w", err)
+	}
+
+	tcpWorkers, err := cmd.Flags().GetInt("tcp-workers")
+	if err != nil {
+		return fmt.Errorf("invalid tcp-workers flag %w", err)
+	}
+	if tcpWorkers < 0 {
+		return fmt.Errorf("invalid tcp workers %d (must not be negative)", tcpWorkers)
+	}
+
+	tunnelServer, _ := cmd.Flags().GetString("tunnel-server")
+	if tunnelServer != "" {
+		if tunnelServer, err = provider.ParseAPIEndpoint(tunnelServer); err != nil {
+			return err
+		}
+	}
+
+	var tunnelProxy *url.URL
+	if raw, _ := cmd.Flags().GetString("tunnel-proxy"); raw != "" {
+		if tunnelProxy, err = provider.ParseProxyURL(raw); err != nil {
+			return err
+		}
+	}
+	tunnelTLS, _ := cmd.Flags().GetBool("tunnel-tls")
+
+	tunnelSNI, _ := cmd.Flags().GetString("tunnel-sni")
+	if tunnelSNI != "" {
+		if !tunnelTLS {
+			return fmt.Errorf("--tunnel-sni requires --tunnel-tls")
+		}
+		if tunnelSNI, err = provider.ParseServerName(tunnelSNI); err != nil {
+			return err
+		}
+	}
+
+	maxRetries, err := cmd.Flags().GetInt("max-retries")
+	if err != nil {
+		return fmt.Errorf("invalid max-retries flag %w", err)
+	}
+	if maxRetries < 0 {
+		return fmt.Errorf("invalid max retries %d (must not be negative)", maxRetries)
+	}
+
+	onDemand, _ := cmd.Flags().GetBool("on-demand")
+
+	var bindAddr net.IP
+	if raw, _ := cmd.Flags().GetString("bind"); raw != "" {
+		if bindAddr, err = provider.ParseBindAddr(raw); err != nil {
+			return err
+		}
+	}
+
+	var dnsServer string
+	if raw, _ := cmd.Flags().GetString("dns-server"); raw != "" {
+		if dnsServer, err = provider.ParseDNSServer(raw); err != nil {
+			return err
+		}
+	}
+	dnsTimeout, err := cmd.Flags().GetDuration("dns-timeout")
+	if err != nil {
+		return fmt.Errorf("invalid dns-timeout flag %w", err)
+	}
+	if dnsTimeout < 0 {
+		return fmt.Errorf("invalid dns timeout %s (must not be negative)", dnsTimeout)
+	}
+
+	onReadyExec, _ := cmd.Flags().GetString("on-ready-exec")
+	onReadyWebhook, _ := cmd.Flags().GetString("on-ready-webhook")
+	onCloseExec, _ := cmd.Flags().GetString("on-close-exec")
+	onCloseWebhook, _ := cmd.Flags().GetString("on-close-webhook")
+	urlFile, _ := cmd.Flags().GetString("url-file")
+	urlFD, err := urlFDFlag(cmd)
+	if err != nil {
+		return err
+	}
+
+	cfTunnelName, _ := cmd.Flags().GetString("cf-tunnel-name")
+	cfToken, _ := cmd.Flags().GetString("cf-token")
+	cfHostname, _ := cmd.Flags().GetString("cf-hostname")
+	if cfTunnelName != "" && cfHostname == "" {
+		return fmt.Errorf("--cf-tunnel-name requires --cf-hostname")
+	}
+
+	// the credential is read from a file, never taken from the command line
+	credentialsFile := cfg.CredentialsFile
+	if cmd.Flags().Changed("credentials-file") {
+		credentialsFile, _ = cmd.Flags().GetString("credentials-file")
+		if cfTunnelName == "" {
+			return fmt.Errorf("--credentials-file requires a provider taking credentials (-P cloudflare --cf-tunnel-name)")
+		}
+	}
+	if credentialsFile != "" && cfTunnelName != "" && cfToken == "" {
+		if cfToken, err = readCredentials(credentialsFile, os.Stderr); err != nil {
+			return err
+		}
+	}
+
+	quiet, err := cmd.Flags().GetBool("quiet")
+	if err != nil {
+		return fmt.Errorf("invalid quiet flag %w", err)
+	}
+	asJSON, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return fmt.Errorf("invalid json flag %w", err)
+	}
+
+	debug, err := cmd.Flags().GetBool("debug")
+	if err != nil {
+		return fmt.Errorf("invalid debug flag %w", err)
+	}
+	var logger *slog.Logger
+	if debug {
+		logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+
+	// hand off to a background copy of ourselves, see daemon.go
+	if detach, _ := cmd.Flags().GetBool("detach"); detach && !isDaemon() {
+		return startDetached(daemonFilesIn(""), os.Args[1:], signalProcess, quiet)
+	}
+
+	return runTunnel(tunnelOptions{
+		port:            port,
+		provider:        providerName,
+		subdomain:       subdomain,
+		localScheme:     localScheme,
+		localHTTP2:      localHTTP2,
+		localNetwork:    localNetwork,
+		unixSocket:      overrides.unix,
+		listenAddr:      listenAddr,
+		pprofAddr:       pprofAddr,
+		apiAddr:         apiAddr,
+		requestIDHeader: requestIDHeader,
+		identify:        identify,
+		allowConnect:    allowConnect,
+		retrySafe:       retrySafe,
+		cache:           cache,
+		cacheTTL:        cacheTTL,
+		stripPrefix:     stripPrefix,
+		allowMethods:    allowMethods,
+		allowPaths:      allowPaths,
+		stripHeaders:    stripHeaders,
+		addPrefix:       addPrefix,
+		preserveHost:    preserveHost,
+		proxyProtocol:   proxyProtocol,
+		slowThreshold:   slowThreshold,
+		largePayload:    largePayload,
+		maxConcurrency:  maxConcurrency,
+		maxQueue:        maxQueue,
+		queueTimeout:    queueTimeout,
+		maxPerClient:    maxPerClient,
+		tcpWorkers:      tcpWorkers,
+		maxHeaderBytes:  maxHeaderBytes,
+		bufferLimit:     bufferLimit,
+		throttleUp:      throttleUp * 1024,
+		throttleDown:    throttleDown * 1024,
+		tcpKeepAlive:    tcpKeepAlive,
+		timeouts:        timeouts,
+		healthInterval:  healthInterval,
+		readyTimeout:    readyTimeout,
+		reconnect:       reconnect,
+		watch:           watch,
+		watchInterval:   watchInterval,
+		summary:         summary,
+		urlTemplate:     urlTemplate,
+		quiet:           quiet,
+		json:            asJSON,
+		logger:          logger,
+		accessLogFormat: accessLogFormat,
+		logFile:         logFile,
+		tunnelServer:    tunnelServer,
+		tunnelProxy:     tunnelProxy,
+		tunnelTLS:       tunnelTLS,
+		tunnelSNI:       tunnelSNI,
+		maxRetries:      maxRetries,
+		onDemand:        onDemand,
+		bindAddr:        bindAddr,
+		dnsServer:       dnsServer,
+		dnsTimeout:      dnsTimeout,
+		onReadyExec:     onReadyExec,
+		onReadyWebhook:  onReadyWebhook,
+		onCloseExec:     onCloseExec,
+		onCloseWebhook:  onCloseWebhook,
+		urlFile:         urlFile,
+		urlFD:           urlFD,
+		cfTunnelName:    cfTunnelName,
+		cfToken:         cfToken,
+		cfHostname:      cfHostname,
+
+		insecureSkipLocalVerify: insecureSkipLocalVerify,
+		overrides:               overrides,
+		configPath:              configPath(cmd),
+	})
+}
+
+// knownProviders lists the provider names accepted by newProvider.
+var knownProviders = []string{"localtunnel", "cloudflare", "loopback", "auto"}
+
+// autoProviders are tried in this order by --provider auto, the last one
+// is used when none is available.
+var autoProviders = []string{"cloudflare", "localtunnel"}
+
+// resolveAutoProvider returns the first of autoProviders that is available
+// and can honour opts, e.g. localtunnel when --subdomain is set.
+func resolveAutoProvider(opts tunnelOptions) string {
+	candidates := make([]tunnel.Provider, 0, len(autoProviders))
+	names := make(map[tunnel.Provider]string, len(autoProviders))
+	for _, name := range autoProviders {
+		opts.provider = name
+		p := newProvider(opts)
+		if checkCapabilities(p, opts) != nil {
+			continue
+		}
+		candidates = append(candidates, p)
+		names[p] = name
+	}
+
+	p, err := tunnel.FirstAvailable(candidates...)
+	if err != nil {
+		return autoProviders[len(autoProviders)-1]
+	}
+	return names[p]
+}
+
+// newProvider returns the tunnel provider selected by opts.
+func newProvider(opts tunnelOptions) tunnel.Provider {
+	switch opts.provider {
+	case "auto":
+		opts.provider = resolveAutoProvider(opts)
+		return newProvider(opts)
+	case "cloudflare":
+		if opts.cfTunnelName != "" {
+			return provider.NewCloudFlare(provider.WithNamedTunnel(opts.cfTunnelName, opts.cfToken, opts.cfHostname))
+		}
+		return provider.NewCloudFlare()
+	case "loopback":
+		// in-process dev mode, the "public" URL is a port on 127.0.0.1
+		return provider.NewLoopback(provider.WithLoopbackTCP("127.0.0.1:0"), provider.WithLoopbackWorkers(opts.tcpWorkers))
+	default:
+		ltOpts := []provider.LocalTunnelOption{
+			provider.WithMaxConcurrency(opts.maxConcurrency),
+			provider.WithRequestQueue(opts.maxQueue, opts.queueTimeout),
+			provider.WithKeepAlive(opts.tcpKeepAlive),
+			provider.WithConnectRetries(opts.maxRetries),
+			provider.WithOnDemand(opts.onDemand),
+			provider.WithLogger(opts.logger),
+		}
+		if names := strings.Split(opts.subdomain, ","); len(names) > 1 {
+			ltOpts = append(ltOpts, provider.WithSubdomainCandidates(names...))
+		} else {
+			ltOpts = append(ltOpts, provider.WithSubdomain(opts.subdomain))
+		}
+		if opts.tunnelServer != "" {
+			ltOpts = append(ltOpts, provider.WithAPIEndpoint(opts.tunnelServer))
+		}
+		if opts.tunnelProxy != nil {
+			ltOpts = append(ltOpts, provider.WithTunnelProxy(opts.tunnelProxy))
+		}
+		if opts.tunnelTLS {
+			ltOpts = append(ltOpts, provider.WithTunnelTLS(&tls.Config{}), provider.WithTunnelSNI(opts.tunnelSNI))
+		}
+		if opts.bindAddr != nil {
+			ltOpts = append(ltOpts, provider.WithBindAddr(opts.bindAddr))
+		}
+		if opts.dnsServer != "" || opts.dnsTimeout > 0 {
+			ltOpts = append(ltOpts, provider.WithResolver(provider.NewResolver(opts.dnsServer), opts.dnsTimeout))
+		}
+		return provider.NewLocalTunnel(nil, ltOpts...)
+	}
+}
+
+// checkCapabilities rejects options the provider cannot honour,
+// so users get a clear error before any tunnel is requested.
+func checkCapabilities(p tunnel.Provider, opts tunnelOptions) error {
+	caps := tunnel.CapabilitiesOf(p)
+	if opts.subdomain != "" && !caps.SupportsSubdomain {
+		return fmt.Errorf("provider %s does not support --subdomain", p.Name())
+	}
+	if opts.cfTunnelName != "" && !caps.SupportsCustomDomain {
+		return fmt.Errorf("provider %s does not support --cf-tunnel-name", p.Name())
+	}
+	if opts.tcpWorkers > 0 && !caps.SupportsTCP {
+		return fmt.Errorf("provider %s does not support --tcp-workers", p.Name())
+	}
+	return nil
+}
+
+// proxyOptions translates the tunnel flags into local proxy options.
+func proxyOptions(opts tunnelOptions) []tunnel.ManagerOption {
+	proxyOpts := []tunnel.ManagerOption{
+		tunnel.WithSlowThreshold(opts.slowThreshold),
+		tunnel.WithLargePayloadThreshold(opts.largePayload),
+		tunnel.WithMaxConcurrency(opts.maxConcurrency),
+		tunnel.WithMaxConnsPerClient(opts.maxPerClient),
+		tunnel.WithMaxHeaderBytes(opts.maxHeaderBytes),
+		tunnel.WithBufferResponses(opts.bufferLimit),
+		tunnel.WithRequestIDHeader(opts.requestIDHeader),
+		tunnel.WithKeepAlive(opts.tcpKeepAlive),
+		tunnel.WithServerTimeouts(opts.timeouts),
+		tunnel.WithConnect(opts.allowConnect),
+		tunnel.WithRetrySafeRequests(opts.retrySafe),
+		tunnel.WithLocalHTTP2(opts.localHTTP2),
+		tunnel.WithThrottle(opts.throttleUp, opts.throttleDown),
+		tunnel.WithPreserveHost(opts.preserveHost),
+		tunnel.WithProxyProtocol(opts.proxyProtocol),
+		tunnel.WithLogger(opts.logger),
+	}
+	if opts.identify {
+		proxyOpts = append(proxyOpts, tunnel.WithIdentify(version.GetVersion()))
+	}
+	if len(opts.allowMethods) > 0 {
+		proxyOpts = append(proxyOpts, tunnel.WithAllowedMethods(opts.allowMethods...))
+	}
+	if len(opts.allowPaths) > 0 {
+		proxyOpts = append(proxyOpts, tunnel.WithAllowedPaths(opts.allowPaths...))
+	}
+	if len(opts.stripHeaders) > 0 {
+		proxyOpts = append(proxyOpts, tunnel.WithStripResponseHeaders(opts.stripHeaders...))
+	}
+	if opts.stripPrefix != "" {
+		proxyOpts = append(proxyOpts, tunnel.WithStripPrefix(opts.stripPrefix))
+	}
+	if opts.addPrefix != "" {
+		proxyOpts = append(proxyOpts, tunnel.WithAddPrefix(opts.addPrefix))
+	}
+	if opts.accessLogFormat != "" {
+		w := opts.accessLog
+		if w == nil {
+			w = os.Stdout
+		}
+		proxyOpts = append(proxyOpts, tunnel.WithAccessLog(w, opts.accessLogFormat))
+	}
+	if opts.cache {
+		proxyOpts = append(proxyOpts, tunnel.WithCache(tunnel.DefaultCacheSize, opts.cacheTTL))
+	}
+	if opts.listenAddr != "" {
+		proxyOpts = append(proxyOpts, tunnel.WithListenAddr(opts.listenAddr))
+	}
+	if opts.localNetwork != "" {
+		proxyOpts = append(proxyOpts, tunnel.WithLocalNetwork(opts.localNetwork))
+	}
+	if opts.unixSocket != "" {
+		proxyOpts = append(proxyOpts, tunnel.WithUnixSocket(opts.unixSocket))
+	}
+	if cfg := localTLSConfig(opts); cfg != nil {
+		proxyOpts = append(proxyOpts, tunnel.WithLocalTLS(cfg))
+	}
+	return proxyOpts
+}
+
+// localNetworkFlag returns the dial network picked by --local-ipv4 or
+// --local-ipv6, "" when neither is set.
+func localNetworkFlag(cmd *cobra.Command) (string, error) {
+	ipv4, err := cmd.Flags().GetBool("local-ipv4")
+	if err != nil {
+		return "", fmt.Errorf("invalid local-ipv4 flag %w", err)
+	}
+	ipv6, err := cmd.Flags().GetBool("local-ipv6")
+	if err != nil {
+		return "", fmt.Errorf("invalid local-ipv6 flag %w", err)
+	}
+
+	switch {
+	case ipv4 && ipv6:
+		return "", errors.New("--local-ipv4 and --local-ipv6 can't be used together")
+	case ipv4:
+		return "tcp4", nil
+	case ipv6:
+		return "tcp6", nil
+	}
+	return "", nil
+}
+
+// urlFDFlag opens the file descriptor named by --url-fd, nil when unset.
+// 0 to 2 are the standard streams, and a detached tunnel doesn't inherit
+// the descriptors of the process starting it.
+func urlFDFlag(cmd *cobra.Command) (*os.File, error) {
+	fd, err := cmd.Flags().GetInt("url-fd")
+	if err != nil {
+		return nil, fmt.Errorf("invalid url-fd flag %w", err)
+	}
+	if fd == 0 {
+		return nil, nil
+	}
+	if fd < 3 {
+		return nil, fmt.Errorf("invalid url fd %d (must be 3 or above, use --quiet for stdout)", fd)
+	}
+	if detach, _ := cmd.Flags().GetBool("detach"); detach {
+		return nil, errors.New("--url-fd and --detach can't be used together")
+	}
+
+	f := os.NewFile(uintptr(fd), "url-fd")
+	if f == nil {
+		return nil, fmt.Errorf("invalid url fd %d", fd)
+	}
+	if _, err := f.Stat(); err != nil {
+		return nil, fmt.Errorf("invalid url fd %d: %w", fd, err)
+	}
+	return f, nil
+}
+
+// proxyProtocolFlag parses --proxy-protocol into a PROXY protocol version,
+// 0 when unset. HTTP/2 connections are shared between clients, so it can't
+// be combined with --local-http2.
+func proxyProtocolFlag(cmd *cobra.Command, localHTTP2 bool) (int, error) {
+	value, err := cmd.Flags().GetString("proxy-protocol")
+	if err != nil {
+		return 0, fmt.Errorf("invalid proxy-protocol flag %w", err)
+	}
+
+	var version int
+	switch value {
+	case "":
+		return 0, nil
+	case "v1", "1":
+		version = tunnel.ProxyProtocolV1
+	case "v2", "2":
+		version = tunnel.ProxyProtocolV2
+	default:
+		return 0, fmt.Errorf("invalid proxy protocol %q (must be v1 or v2)", value)
+	}
+	if localHTTP2 {
+		return 0, errors.New("--proxy-protocol and --local-http2 can't be used together")
+	}
+	return version, nil
+}
+
+// localTLSConfig returns the TLS settings of the hop to an https local
+// server, nil for plain http. Certificates are verified unless
+// --insecure-skip-local-verify is set.
+func localTLSConfig(opts tunnelOptions) *tls.Config {
+	if opts.localScheme != "https" {
+		return nil
+	}
+	return &tls.Config{InsecureSkipVerify: opts.insecureSkipLocalVerify}
+}
+
+// errInterrupted is the shutdown cause when a signal stops the tunnel,
+// it's a clean exit rather than a failure.
+var errInterrupted = errors.New("interrupted by signal")
+
+// resolvePort picks the local port from --port, then the positional port
+// argument, then the config. Zero means none of them set a port.
+func resolvePort(cmd *cobra.Command, args []string, cfgPort int) (int, error) {
 	port, err := cmd.Flags().GetInt("port")
 	if err != nil {
-		return fmt.Errorf("invalid port flag %w", err)
+		return 0, fmt.Errorf("invalid port flag %w", err)
+	}
+	if port != 0 {
+		return port, nil
+	}
+
+	// e.g. expose tunnel 3000
+	if len(args) > 0 {
+		port, err := strconv.Atoi(args[0])
+		if err != nil || port <= 0 || port > 65535 {
+			return 0, fmt.Errorf("invalid port argument %q (must be 1-65535)", args[0])
+		}
+		return port, nil
 	}
 
-	// use config port if flag not set
-	if port == 0 {
-		port = cfg.Port
+	return cfgPort, nil
+}
+
+// defaultProvider is used when neither -P nor the config names a provider.
+const defaultProvider = "localtunnel"
+
+// configOverrides are the command line settings that win over the config file.
+type configOverrides struct {
+	port     int    // --port or the bare port argument, 0 when not given
+	provider string // -P, "" when not given
+	unix     string // --unix, the port isn't needed when given
+}
+
+// overridesFrom reads the config overrides from cmd's flags and args.
+func overridesFrom(cmd *cobra.Command, args []string) (configOverrides, error) {
+	port, err := resolvePort(cmd, args, 0)
+	if err != nil {
+		return configOverrides{}, err
 	}
 
-	if port <= 0 || port > 65535 {
-		return fmt.Errorf("invalid port %d (must be 1-65535)", port)
+	var provider string
+	if cmd.Flags().Changed("provider") {
+		if provider, err = cmd.Flags().GetString("provider"); err != nil {
+			return configOverrides{}, fmt.Errorf("invalid provider flag %w", err)
+		}
 	}
+	// only the tunnel command has --unix
+	unix, _ := cmd.Flags().GetString("unix")
+	return configOverrides{port: port, provider: provider, unix: unix}, nil
+}
 
-	// use provider flag shorthand -P to select provider
-	providerName, err := cmd.Flags().GetString("provider")
+// effectiveConfig resolves the config the tunnel command runs with, see
+// resolveConfig. detected reports that the .env fallback was used.
+func effectiveConfig(cmd *cobra.Command, args []string, cfg *config.Config) (config.Config, bool, error) {
+	o, err := overridesFrom(cmd, args)
 	if err != nil {
-		return fmt.Errorf("invalid port %d (must be 1-65535)", port)
+		return *cfg, false, err
+	}
+	return resolveConfig(cfg, o)
+}
+
+// resolveConfig returns cfg with the port and provider overrides applied,
+// the port falling back to PORT from .env files. detected reports that the
+// .env fallback was used.
+func resolveConfig(cfg *config.Config, o configOverrides) (config.Config, bool, error) {
+	eff := *cfg
+
+	port := cfg.Port
+	if o.port != 0 {
+		port = o.port
+	}
+
+	// last resort, guess from the project's .env files
+	detected := false
+	if port == 0 && o.unix == "" {
+		if p, err := config.DetectPort(); err == nil {
+			port, detected = p, true
+		}
+	}
+
+	if o.unix == "" && (port <= 0 || port > 65535) {
+		return eff, false, fmt.Errorf("invalid port %d (must be 1-65535)", port)
+	}
+	eff.Port = port
+
+	// the config's provider applies unless -P is given
+	switch {
+	case o.provider != "":
+		eff.Provider = o.provider
+	case cfg.Provider == "":
+		eff.Provider = defaultProvider
 	}
 
-	return runTunnel(port, providerName)
+	return eff, detected, nil
 }
 
 // runTunnel sets up a reverse proxy to expose the local server
 // on the specified port.
-func runTunnel(port int, providerName string) error {
-	var svc *tunnel.Service
+func runTunnel(opts tunnelOptions) error {
+	if opts.provider == "auto" {
+		opts.provider = resolveAutoProvider(opts)
+		fmt.Fprintf(infoWriter(opts), "✓ Auto-selected provider: %s\n", opts.provider)
+	}
 
-	switch providerName {
-	case "cloudflare":
-		svc = tunnel.NewService(provider.NewCloudFlare())
-	default:
-		svc = tunnel.NewService(provider.NewLocalTunnel(nil))
+	p := newProvider(opts)
+	if err := checkCapabilities(p, opts); err != nil {
+		return err
+	}
+	if err := tunnel.Available(p); err != nil {
+		return err
+	}
 
+	if opts.logFile != "" {
+		f, err := os.OpenFile(opts.logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("open log file: %w", err)
+		}
+		defer f.Close()
+		opts.accessLog = f
 	}
 
-	// Setup ctx & signal handling
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	svc := tunnel.NewService(p, tunnel.WithProxy(proxyOptions(opts)...), tunnel.WithServiceLogger(opts.logger))
 
 	// handle Ctrl+C, kill pid etc.
+	ctx, stop := signalContext(infoWriter(opts))
+	defer stop()
+
+	if opts.pprofAddr != "" {
+		addr, err := servePprof(ctx, opts.pprofAddr)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(infoWriter(opts), "✓ Profiling at http://%s/debug/pprof/\n", addr)
+	}
+
+	if opts.apiAddr != "" {
+		stopAPI := func() {
+			fmt.Fprint(infoWriter(opts), "\n\nShutting down (control API)...\n")
+			stop()
+		}
+		addr, err := serveAPI(ctx, opts.apiAddr, apiHandler(ctx, svc, opts, stopAPI))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(infoWriter(opts), "✓ Control API at http://%s/api/status\n", addr)
+	}
+
+	// the background half of --detach tells the foreground and 'expose stop' about itself
+	if isDaemon() {
+		files := daemonFilesIn("")
+		if err := files.writePID(os.Getpid()); err != nil {
+			return fmt.Errorf("write PID file: %w", err)
+		}
+		defer files.remove()
+		go recordState(ctx, svc, files, opts)
+	}
+
+	err := serveTunnel(ctx, svc, opts, newHooks(opts))
+
+	// usage summary for tunnels that came up
+	select {
+	case <-svc.Ready():
+		// stderr keeps --quiet stdout to the URL alone
+		printUsage(opts, os.Stderr, svc.Stats())
+	default:
+	}
+	return err
+}
+
+// signalContext returns a context cancelled with errInterrupted
+// on SIGINT or SIGTERM, reporting the signal to info.
+func signalContext(info io.Writer) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
 	// waiting to read from channel is blocking ops, so wait in bg.
 	go func() {
-		<-sigChan
-		fmt.Println("\n\nShutting down...")
-		cancel()
+		select {
+		case sig := <-sigChan:
+			fmt.Fprintf(info, "\n\nShutting down (%s)...\n", sig)
+			cancel(fmt.Errorf("%w: %s", errInterrupted, sig))
+		case <-ctx.Done():
+		}
 	}()
 
-	// - Start  tunnel in background
+	return ctx, func() {
+		signal.Stop(sigChan)
+		cancel(nil)
+	}
+}
+
+// serveTunnel starts svc, prints the tunnel info and blocks until ctx is
+// done. It returns nil on a signal-driven shutdown and the real cause
+// for anything else, so the process exit code reflects failures. Teardown
+// happens once, after Start has returned: on-close hooks, then svc.Close.
+func serveTunnel(ctx context.Context, svc *tunnel.Service, opts tunnelOptions, h *hooks) error {
+	port := opts.port
+
+	// - Start tunnel in background, Start returns once the tunnel is ready
+	startCtx, cancelStart := context.WithCancel(ctx)
+	defer cancelStart()
 	errChan := make(chan error, 1)
 	go func() {
-		errChan <- svc.Start(ctx, port)
+		errChan <- svc.Start(startCtx, port)
 	}()
 
-	// wait for ready
 	select {
-	case <-svc.Ready():
-		// Show info
-		fmt.Printf("🚀 Tunnel[%s] started for localhost:%d\n", svc.ProviderName(), port)
-		fmt.Printf("✓ Public URL: %s\n", svc.PublicURL())
-		fmt.Printf("✓ Forwarding to: http://localhost:%d\n", port)
-		fmt.Printf("✓ Provider: %s\n", svc.ProviderName())
-		fmt.Println("Press Ctrl+C to stop")
-
 	case err := <-errChan:
 		if err != nil {
+			_ = svc.Close()
 			return err
 		}
+	case err := <-waitReady(svc, opts.readyTimeout):
+		if err == nil {
+			// ready, Start is about to return
+			err = <-errChan
+		} else {
+			// give up on Start and let it unwind before closing
+			cancelStart()
+			<-errChan
+			err = fmt.Errorf("%w (--ready-timeout %s)", err, opts.readyTimeout)
+		}
+		if err != nil {
+			_ = svc.Close()
+			return err
+		}
+	case <-ctx.Done():
+		// stopped before the tunnel came up, let Start unwind before
+		// closing so the two don't tear down the provider concurrently
+		<-errChan
+		_ = svc.Close()
+		return shutdownCause(ctx)
+	}
+
+	// Show info, just the URL in quiet mode
+	publicURL := displayURL(opts, svc.PublicURL())
+	info := infoWriter(opts)
+	fmt.Fprintf(info, "🚀 Tunnel[%s] started for %s\n", svc.ProviderName(), localTarget(opts))
+	printURL(opts, "✓ Public URL: ", publicURL)
+	fmt.Fprint(info, "✓ Forwarding: ")
+	_ = writeForwardingTable(info, []forwarding{forwardingOf(opts, publicURL)}, false)
+	fmt.Fprintf(info, "✓ Provider: %s\n", svc.ProviderName())
+	fmt.Fprintln(info, "Press Ctrl+C to stop")
+
+	// let external systems know where the tunnel lives
+	h.ready(ctx, publicURL)
+
+	if opts.healthInterval > 0 {
+		go svc.MonitorHealth(ctx, opts.healthInterval)
+	}
+
+	// a dropped tunnel ends the session with an error, unless --keep-alive
+	// reconnects it; giving up on reconnecting ends it too
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go func() {
+		policy := opts.reconnectPolicy
+		policy.FailFast = !opts.reconnect
+		if err := svc.Supervise(ctx, policy); err != nil {
+			cancel(err)
+		}
+	}()
+
+	// live status line until shutdown
+	var watchDone chan struct{}
+	if opts.watch {
+		watchDone = make(chan struct{})
+		go func() {
+			defer close(watchDone)
+			watchStats(ctx, info, svc.Stats, opts.watchInterval)
+		}()
+	}
+
+	// SIGHUP re-reads the config, see reload.go
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
 
+	// - Wait for shutdown, reporting URL changes (e.g. after a reconnect)
+	waitForShutdown(ctx, svc, opts, h, reload)
+	if watchDone != nil {
+		<-watchDone
 	}
 
-	// - Wait for shutdown
-	<-ctx.Done()
+	// - Cleanup, deregister the URL while it still points at us: the
+	// tunnel runs until svc.Close, whatever ended ctx. The context is
+	// usually cancelled by now, the hooks bound themselves.
+	h.closing(context.WithoutCancel(ctx), displayURL(opts, svc.PublicURL()))
 
-	// - Cleanup
 	if err := svc.Close(); err != nil {
 		return fmt.Errorf("close failed %w", err)
 	}
 
-	fmt.Println("✓ Tunnel closed")
-	return nil
+	fmt.Fprintln(info, "✓ Tunnel closed")
+	return shutdownCause(ctx)
+}
+
+// waitReady reports the result of svc.WaitReady(timeout), a nil channel
+// when timeout is 0 and there is no limit.
+func waitReady(svc *tunnel.Service, timeout time.Duration) <-chan error {
+	if timeout <= 0 {
+		return nil
+	}
+	ch := make(chan error, 1)
+	go func() {
+		ch <- svc.WaitReady(timeout)
+	}()
+	return ch
+}
+
+// stdoutOf returns where the tunnel's output goes.
+func stdoutOf(opts tunnelOptions) io.Writer {
+	if opts.stdout == nil {
+		return os.Stdout
+	}
+	return opts.stdout
+}
+
+// infoWriter returns where decorative output goes, nowhere in quiet or
+// JSON mode.
+func infoWriter(opts tunnelOptions) io.Writer {
+	if opts.quiet || opts.json {
+		return io.Discard
+	}
+	return stdoutOf(opts)
+}
+
+// printURL prints the public URL after label, or bare in quiet mode so
+// scripts can read it line by line. In JSON mode it prints the forwarding
+// to the URL as a JSON document instead.
+func printURL(opts tunnelOptions, label, url string) {
+	if opts.json {
+		if err := writeForwardingTable(stdoutOf(opts), []forwarding{forwardingOf(opts, url)}, true); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠ write forwarding: %v\n", err)
+		}
+		return
+	}
+	if opts.quiet {
+		label = ""
+	}
+	fmt.Fprintf(stdoutOf(opts), "%s%s\n", label, url)
+}
+
+// localTarget names the local server in output, localhost:<port> or
+// unix:<path> for --unix.
+func localTarget(opts tunnelOptions) string {
+	if opts.unixSocket != "" {
+		return "unix:" + opts.unixSocket
+	}
+	return fmt.Sprintf("localhost:%d", opts.port)
+}
+
+// localScheme returns the scheme of the local server, http by default.
+func localScheme(opts tunnelOptions) string {
+	if opts.localScheme == "" {
+		return "http"
+	}
+	return opts.localScheme
+}
+
+// shutdownCause maps the reason ctx was cancelled to the command result:
+// signals and plain cancellation are clean exits, anything else is an error.
+func shutdownCause(ctx context.Context) error {
+	cause := context.Cause(ctx)
+	if cause == nil || errors.Is(cause, errInterrupted) || errors.Is(cause, context.Canceled) {
+		return nil
+	}
+	return cause
+}
+
+// waitForShutdown blocks until ctx is done, printing the new public URL
+// (and passing it to h) each time the provider reports a change and
+// applying the config each time reload fires.
+func waitForShutdown(ctx context.Context, svc *tunnel.Service, opts tunnelOptions, h *hooks, reload <-chan os.Signal) {
+	for {
+		select {
+		case url := <-svc.URLChanges():
+			printURL(opts, "✓ Public URL changed: ", displayURL(opts, url))
+			h.urlChanged(displayURL(opts, url))
+		case <-reload:
+			opts = applyReload(ctx, svc, opts)
+		case <-ctx.Done():
+			return
+		}
+	}
 }
@@ -1,7 +1,22 @@
 package cli
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/kernelshard/expose/internal/tunnel"
 )
 
 func TestTunnelCmd(t *testing.T) {
@@ -25,3 +40,906 @@ func TestTunnelCmd(t *testing.T) {
 		t.Errorf("expected shorthand 'p' got %s", flag.Shorthand)
 	}
 }
+
+// TestResolvePort verifies --port beats the positional port, which beats the config
+func TestResolvePort(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		cfgPort int
+		want    int
+		wantErr bool
+	}{
+		{"config", nil, 3000, 3000, false},
+		{"positional", []string{"8080"}, 0, 8080, false},
+		{"positional over config", []string{"8080"}, 3000, 8080, false},
+		{"flag over positional", []string{"--port", "9090", "8080"}, 3000, 9090, false},
+		{"shorthand flag", []string{"-p", "9090"}, 3000, 9090, false},
+		{"nothing set", nil, 0, 0, false},
+		{"positional not a number", []string{"web"}, 3000, 0, true},
+		{"positional out of range", []string{"70000"}, 3000, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := newTunnelCmd()
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := resolvePort(cmd, cmd.Flags().Args(), tt.cfgPort)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected port %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestTunnelCmd_Args verifies at most one positional port is accepted
+func TestTunnelCmd_Args(t *testing.T) {
+	cmd := newTunnelCmd()
+	if err := cmd.Args(cmd, []string{"3000"}); err != nil {
+		t.Errorf("expected a single port argument to be accepted, got %v", err)
+	}
+	if err := cmd.Args(cmd, []string{"3000", "4000"}); err == nil {
+		t.Error("expected two positional arguments to be rejected")
+	}
+}
+
+func TestCheckCapabilities(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     tunnelOptions
+		wantErr  bool
+		contains string
+	}{
+		{"localtunnel with subdomain", tunnelOptions{provider: "localtunnel", subdomain: "myapp"}, false, ""},
+		{"cloudflare with subdomain", tunnelOptions{provider: "cloudflare", subdomain: "myapp"}, true, "--subdomain"},
+		{"cloudflare without subdomain", tunnelOptions{provider: "cloudflare"}, false, ""},
+		{"loopback with subdomain", tunnelOptions{provider: "loopback", subdomain: "myapp"}, true, "--subdomain"},
+		{"loopback with tcp workers", tunnelOptions{provider: "loopback", tcpWorkers: 8}, false, ""},
+		{"localtunnel with tcp workers", tunnelOptions{provider: "localtunnel", tcpWorkers: 8}, true, "--tcp-workers"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCapabilities(newProvider(tt.opts), tt.opts)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err != nil && !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("expected error to mention %s, got %v", tt.contains, err)
+			}
+		})
+	}
+}
+
+func TestCheckCapabilities_NamedTunnel(t *testing.T) {
+	opts := tunnelOptions{provider: "localtunnel", cfTunnelName: "dev", cfHostname: "dev.example.com"}
+	if err := checkCapabilities(newProvider(opts), opts); err == nil {
+		t.Error("expected --cf-tunnel-name to be rejected for localtunnel")
+	}
+
+	opts.provider = "cloudflare"
+	if err := checkCapabilities(newProvider(opts), opts); err != nil {
+		t.Errorf("unexpected error for cloudflare named tunnel: %v", err)
+	}
+}
+
+// withCloudflared points PATH at a directory that holds a fake cloudflared
+// binary when installed is true, and at an empty one otherwise.
+func withCloudflared(t *testing.T, installed bool) {
+	t.Helper()
+	dir := t.TempDir()
+	if installed {
+		if err := os.WriteFile(filepath.Join(dir, "cloudflared"), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir)
+}
+
+func TestResolveAutoProvider(t *testing.T) {
+	tests := []struct {
+		name      string
+		installed bool
+		opts      tunnelOptions
+		want      string
+	}{
+		{"cloudflared installed", true, tunnelOptions{}, "cloudflare"},
+		{"cloudflared missing", false, tunnelOptions{}, "localtunnel"},
+		{"subdomain needs localtunnel", true, tunnelOptions{subdomain: "myapp"}, "localtunnel"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withCloudflared(t, tt.installed)
+			if got := resolveAutoProvider(tt.opts); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNewProvider_Auto(t *testing.T) {
+	withCloudflared(t, false)
+	if p := newProvider(tunnelOptions{provider: "auto"}); p.Name() != "LocalTunnel" {
+		t.Errorf("expected auto to fall back to LocalTunnel, got %s", p.Name())
+	}
+}
+
+// fakeProvider is a tunnel.Provider for exercising the tunnel command flow.
+type fakeProvider struct {
+	connectErr error
+	connected  chan struct{}
+	closed     atomic.Int32
+}
+
+func newFakeProvider(connectErr error) *fakeProvider {
+	return &fakeProvider{connectErr: connectErr, connected: make(chan struct{})}
+}
+
+func (f *fakeProvider) Connect(ctx context.Context, localPort int) (string, error) {
+	if f.connectErr != nil {
+		return "", f.connectErr
+	}
+	close(f.connected)
+	return "https://fake.example.com", nil
+}
+
+func (f *fakeProvider) Close() error {
+	f.closed.Add(1)
+	return nil
+}
+
+func (f *fakeProvider) IsConnected() bool { return f.closed.Load() == 0 }
+func (f *fakeProvider) PublicURL() string { return "https://fake.example.com" }
+func (f *fakeProvider) Name() string      { return "fake" }
+
+func TestServeTunnel_ConnectErrorPropagates(t *testing.T) {
+	connectErr := errors.New("boom")
+	svc := tunnel.NewService(newFakeProvider(connectErr))
+
+	err := serveTunnel(context.Background(), svc, tunnelOptions{port: 3000}, &hooks{})
+	if !errors.Is(err, connectErr) {
+		t.Errorf("expected connect error to propagate, got %v", err)
+	}
+}
+
+func TestServeTunnel_ShutdownCause(t *testing.T) {
+	tests := []struct {
+		name    string
+		cause   error
+		wantErr bool
+	}{
+		{"signal is a clean exit", fmt.Errorf("%w: terminated", errInterrupted), false},
+		{"plain cancel is a clean exit", nil, false},
+		{"other cause is an error", errors.New("fatal"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newFakeProvider(nil)
+			svc := tunnel.NewService(p)
+
+			ctx, cancel := context.WithCancelCause(context.Background())
+			defer cancel(nil)
+
+			done := make(chan error, 1)
+			go func() {
+				done <- serveTunnel(ctx, svc, tunnelOptions{port: 3000}, &hooks{})
+			}()
+
+			<-p.connected
+			cancel(tt.cause)
+
+			select {
+			case err := <-done:
+				if tt.wantErr != (err != nil) {
+					t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("serveTunnel did not return after cancellation")
+			}
+
+			if p.closed.Load() == 0 {
+				t.Error("expected provider to be closed on shutdown")
+			}
+		})
+	}
+}
+
+// TestServeTunnel_CleanShutdown verifies a signal shutdown with the proxy
+// reports no closed-connection error and closes the provider once
+func TestServeTunnel_CleanShutdown(t *testing.T) {
+	p := newFakeProvider(nil)
+	svc := tunnel.NewService(p, tunnel.WithProxy())
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serveTunnel(ctx, svc, tunnelOptions{port: 3000}, &hooks{})
+	}()
+
+	<-p.connected
+	cancel(fmt.Errorf("%w: interrupt", errInterrupted))
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected a clean shutdown, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("serveTunnel did not return after cancellation")
+	}
+	if n := p.closed.Load(); n != 1 {
+		t.Errorf("expected the provider closed exactly once, got %d", n)
+	}
+}
+
+// slowConnectProvider is a fakeProvider whose Connect blocks until its
+// context is done, and which records Close racing an unfinished Connect.
+type slowConnectProvider struct {
+	fakeProvider
+	connecting   atomic.Bool
+	closedEarly  atomic.Bool
+	connectStart chan struct{}
+}
+
+func (s *slowConnectProvider) Connect(ctx context.Context, localPort int) (string, error) {
+	s.connecting.Store(true)
+	defer s.connecting.Store(false)
+	close(s.connectStart)
+	<-ctx.Done()
+	// unwinding takes a moment, like a provider cleaning up its pool
+	time.Sleep(20 * time.Millisecond)
+	return "", ctx.Err()
+}
+
+func (s *slowConnectProvider) Close() error {
+	if s.connecting.Load() {
+		s.closedEarly.Store(true)
+	}
+	return s.fakeProvider.Close()
+}
+
+// TestServeTunnel_CancelBeforeReady verifies a shutdown during Start waits
+// for Start to return and then closes the provider once
+func TestServeTunnel_CancelBeforeReady(t *testing.T) {
+	p := &slowConnectProvider{connectStart: make(chan struct{})}
+	svc := tunnel.NewService(p)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serveTunnel(ctx, svc, tunnelOptions{port: 3000}, &hooks{})
+	}()
+
+	<-p.connectStart
+	cancel(fmt.Errorf("%w: interrupt", errInterrupted))
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected a clean shutdown, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("serveTunnel did not return after cancellation")
+	}
+	if p.closedEarly.Load() {
+		t.Error("expected Close only after Connect returned")
+	}
+	if n := p.closed.Load(); n != 1 {
+		t.Errorf("expected the provider closed exactly once, got %d", n)
+	}
+}
+
+// TestServeTunnel_ReadyTimeout verifies a provider that never becomes
+// ready fails startup after --ready-timeout, closing it once Connect returned
+func TestServeTunnel_ReadyTimeout(t *testing.T) {
+	p := &slowConnectProvider{connectStart: make(chan struct{})}
+	svc := tunnel.NewService(p)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- serveTunnel(context.Background(), svc, tunnelOptions{port: 3000, readyTimeout: 50 * time.Millisecond}, &hooks{})
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "tunnel readiness timeout") {
+			t.Errorf("expected a readiness timeout error, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("serveTunnel did not give up on the tunnel")
+	}
+	if p.closedEarly.Load() {
+		t.Error("expected Close only after Connect returned")
+	}
+	if n := p.closed.Load(); n != 1 {
+		t.Errorf("expected the provider closed exactly once, got %d", n)
+	}
+}
+
+// droppingProvider is a fakeProvider whose tunnel can be dropped, handing
+// out a new URL on every Connect.
+type droppingProvider struct {
+	fakeProvider
+	up       atomic.Bool
+	connects atomic.Int32
+}
+
+func (d *droppingProvider) Connect(ctx context.Context, localPort int) (string, error) {
+	d.up.Store(true)
+	return fmt.Sprintf("https://session-%d.example.com", d.connects.Add(1)), nil
+}
+
+func (d *droppingProvider) IsConnected() bool { return d.up.Load() }
+
+// TestServeTunnel_ReconnectPolicy verifies a dropped tunnel ends the
+// session by default and is reconnected with --keep-alive
+func TestServeTunnel_ReconnectPolicy(t *testing.T) {
+	policy := tunnel.ReconnectPolicy{CheckInterval: 5 * time.Millisecond, Backoff: time.Millisecond}
+
+	t.Run("fail fast", func(t *testing.T) {
+		p := &droppingProvider{}
+		svc := tunnel.NewService(p)
+		done := make(chan error, 1)
+		go func() {
+			done <- serveTunnel(context.Background(), svc, tunnelOptions{port: 3000, quiet: true, stdout: io.Discard, reconnectPolicy: policy}, &hooks{})
+		}()
+
+		<-svc.Ready()
+		p.up.Store(false)
+
+		select {
+		case err := <-done:
+			if !errors.Is(err, tunnel.ErrNotConnected) {
+				t.Errorf("expected the drop to be reported, got %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("serveTunnel did not exit on the drop")
+		}
+		if n := p.connects.Load(); n != 1 {
+			t.Errorf("expected no reconnect, got %d connects", n)
+		}
+	})
+
+	t.Run("keep alive", func(t *testing.T) {
+		p := &droppingProvider{}
+		svc := tunnel.NewService(p)
+		ctx, cancel := context.WithCancelCause(context.Background())
+		defer cancel(nil)
+		done := make(chan error, 1)
+		go func() {
+			done <- serveTunnel(ctx, svc, tunnelOptions{port: 3000, quiet: true, stdout: io.Discard, reconnect: true, reconnectPolicy: policy}, &hooks{})
+		}()
+
+		<-svc.Ready()
+		p.up.Store(false)
+		deadline := time.Now().Add(2 * time.Second)
+		for p.connects.Load() < 2 {
+			if time.Now().After(deadline) {
+				t.Fatal("expected the tunnel to be reconnected")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		select {
+		case err := <-done:
+			t.Fatalf("expected the session to go on, it ended with %v", err)
+		default:
+		}
+		cancel(fmt.Errorf("%w: interrupt", errInterrupted))
+		if err := <-done; err != nil {
+			t.Errorf("expected a clean shutdown, got %v", err)
+		}
+	})
+}
+
+func TestProxyOptions_LocalScheme(t *testing.T) {
+	if got := localScheme(tunnelOptions{}); got != "http" {
+		t.Errorf("expected http default, got %s", got)
+	}
+
+	plain := len(proxyOptions(tunnelOptions{localScheme: "http"}))
+	secure := len(proxyOptions(tunnelOptions{localScheme: "https"}))
+	if secure != plain+1 {
+		t.Errorf("expected https to add a TLS option, got %d vs %d options", secure, plain)
+	}
+}
+
+// TestLocalTLSConfig verifies local certificates are checked unless
+// --insecure-skip-local-verify is given
+func TestLocalTLSConfig(t *testing.T) {
+	if cfg := localTLSConfig(tunnelOptions{localScheme: "http"}); cfg != nil {
+		t.Errorf("expected no TLS config for http, got %+v", cfg)
+	}
+	if cfg := localTLSConfig(tunnelOptions{localScheme: "https"}); cfg == nil || cfg.InsecureSkipVerify {
+		t.Errorf("expected verification on by default, got %+v", cfg)
+	}
+	cfg := localTLSConfig(tunnelOptions{localScheme: "https", insecureSkipLocalVerify: true})
+	if cfg == nil || !cfg.InsecureSkipVerify {
+		t.Errorf("expected verification off with the flag, got %+v", cfg)
+	}
+}
+
+// TestLocalNetworkFlag verifies --local-ipv4/--local-ipv6 pick the dial
+// network and can't be combined
+func TestLocalNetworkFlag(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{nil, "", false},
+		{[]string{"--local-ipv4"}, "tcp4", false},
+		{[]string{"--local-ipv6"}, "tcp6", false},
+		{[]string{"--local-ipv4", "--local-ipv6"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			cmd := newTunnelCmd()
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			got, err := localNetworkFlag(cmd)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("localNetworkFlag() = %q, %v, want %q, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestProxyProtocolFlag verifies --proxy-protocol accepts v1 and v2 and
+// can't be combined with --local-http2
+func TestProxyProtocolFlag(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    int
+		wantErr bool
+	}{
+		{nil, 0, false},
+		{[]string{"--proxy-protocol", "v1"}, tunnel.ProxyProtocolV1, false},
+		{[]string{"--proxy-protocol", "2"}, tunnel.ProxyProtocolV2, false},
+		{[]string{"--proxy-protocol", "v3"}, 0, true},
+		{[]string{"--proxy-protocol", "v2", "--local-http2"}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			cmd := newTunnelCmd()
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			localHTTP2, _ := cmd.Flags().GetBool("local-http2")
+			got, err := proxyProtocolFlag(cmd, localHTTP2)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("proxyProtocolFlag() = %d, %v, want %d, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+// unixSocketServer starts an HTTP server answering "unix" on a Unix
+// socket, returning its path.
+func unixSocketServer(t *testing.T) string {
+	t.Helper()
+	// socket paths are limited to ~100 bytes, t.TempDir can be longer
+	dir, err := os.MkdirTemp("", "expose")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "app.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("no unix sockets: %v", err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "unix")
+	})}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return path
+}
+
+// TestTunnelCmd_Unix verifies --unix needs an existing socket, no port,
+// and can't be combined with an IP family
+func TestTunnelCmd_Unix(t *testing.T) {
+	path := unixSocketServer(t)
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(".expose.yml", []byte("version: 1\nproject: demo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"missing socket", []string{"--unix", path + ".gone"}, "invalid unix socket"},
+		{"ip family", []string{"--unix", path, "--local-ipv4"}, "can't be used with --local-ipv4"},
+		// gets past the port and socket checks to the next flag check
+		{"no port needed", []string{"--unix", path, "--insecure-skip-local-verify"}, "--local-scheme https"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := newTunnelCmd()
+			cmd.SetArgs(tt.args)
+			cmd.SetOut(io.Discard)
+			cmd.SetErr(io.Discard)
+
+			err := cmd.Execute()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+// TestProxyOptions_Unix verifies the proxy forwards to the --unix socket
+func TestProxyOptions_Unix(t *testing.T) {
+	opts := tunnelOptions{unixSocket: unixSocketServer(t), listenAddr: "127.0.0.1:0"}
+	if got := localTarget(opts); got != "unix:"+opts.unixSocket {
+		t.Errorf("expected the socket as local target, got %s", got)
+	}
+
+	p := &portProvider{}
+	svc := tunnel.NewService(p, tunnel.WithProxy(proxyOptions(opts)...))
+	if err := svc.Start(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Close()
+
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/", p.connects()[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "unix" {
+		t.Errorf("expected the socket server's answer, got %d %q", resp.StatusCode, body)
+	}
+}
+
+// TestTunnelCmd_TunnelServer verifies --tunnel-server must be an http(s) URL
+func TestTunnelCmd_TunnelServer(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(".expose.yml", []byte("version: 1\nproject: demo\nport: 3000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := newTunnelCmd()
+	cmd.SetArgs([]string{"--tunnel-server", "ftp://lt.example.com"})
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+
+	err := cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "unsupported tunnel server scheme") {
+		t.Errorf("expected scheme error, got %v", err)
+	}
+}
+
+// TestTunnelCmd_MaxRetries verifies a negative --max-retries is rejected
+func TestTunnelCmd_MaxRetries(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(".expose.yml", []byte("version: 1\nproject: demo\nport: 3000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := newTunnelCmd()
+	cmd.SetArgs([]string{"--max-retries", "-1"})
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+
+	err := cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "invalid max retries -1") {
+		t.Errorf("expected max retries error, got %v", err)
+	}
+}
+
+// TestTunnelCmd_TunnelSNI verifies --tunnel-sni needs --tunnel-tls and a hostname
+func TestTunnelCmd_TunnelSNI(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(".expose.yml", []byte("version: 1\nproject: demo\nport: 3000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "without TLS", args: []string{"--tunnel-sni", "lt.example.com"}, want: "--tunnel-sni requires --tunnel-tls"},
+		{name: "IP address", args: []string{"--tunnel-tls", "--tunnel-sni", "10.0.0.1"}, want: "must be a hostname"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := newTunnelCmd()
+			cmd.SetArgs(tt.args)
+			cmd.SetOut(io.Discard)
+			cmd.SetErr(io.Discard)
+
+			err := cmd.Execute()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected %q error, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+// TestTunnelCmd_RequestQueue verifies the queue flags are rejected without
+// --max-concurrency or with negative values
+func TestTunnelCmd_RequestQueue(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(".expose.yml", []byte("version: 1\nproject: demo\nport: 3000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "queue without limit", args: []string{"--max-queue", "8"}, want: "require --max-concurrency"},
+		{name: "timeout without limit", args: []string{"--queue-timeout", "5s"}, want: "require --max-concurrency"},
+		{name: "negative queue", args: []string{"--max-concurrency", "2", "--max-queue", "-1"}, want: "must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := newTunnelCmd()
+			cmd.SetArgs(tt.args)
+			cmd.SetOut(io.Discard)
+			cmd.SetErr(io.Discard)
+
+			err := cmd.Execute()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected %q error, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+// TestTunnelCmd_SubdomainList verifies an empty name in a --subdomain
+// list is rejected
+func TestTunnelCmd_SubdomainList(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(".expose.yml", []byte("version: 1\nproject: demo\nport: 3000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, subdomain := range []string{"myapp,,myapp-2", "myapp, ", ",myapp"} {
+		cmd := newTunnelCmd()
+		cmd.SetArgs([]string{"--subdomain", subdomain})
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+
+		if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "empty name") {
+			t.Errorf("--subdomain %q: expected an empty name error, got %v", subdomain, err)
+		}
+	}
+}
+
+// TestTunnelCmd_URLFD verifies --url-fd rejects the standard streams,
+// descriptors that aren't open and --detach
+func TestTunnelCmd_URLFD(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(".expose.yml", []byte("version: 1\nproject: demo\nport: 3000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args     []string
+		contains string
+	}{
+		{[]string{"--url-fd", "1"}, "3 or above"},
+		{[]string{"--url-fd", "-1"}, "3 or above"},
+		{[]string{"--url-fd", "987"}, "invalid url fd 987"},
+		{[]string{"--url-fd", "3", "--detach"}, "--detach"},
+	}
+
+	for _, tt := range tests {
+		cmd := newTunnelCmd()
+		cmd.SetArgs(tt.args)
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+
+		if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), tt.contains) {
+			t.Errorf("%v: expected an error mentioning %q, got %v", tt.args, tt.contains, err)
+		}
+	}
+}
+
+// TestTunnelCmd_DNSFlags verifies --dns-server takes only an IP address
+// and --dns-timeout no negative duration
+func TestTunnelCmd_DNSFlags(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(".expose.yml", []byte("version: 1\nproject: demo\nport: 3000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args     []string
+		contains string
+	}{
+		{[]string{"--dns-server", "dns.example.com"}, "invalid DNS server"},
+		{[]string{"--dns-server", "1.1.1.1:99999"}, "invalid DNS server port"},
+		{[]string{"--dns-timeout", "-1s"}, "invalid dns timeout"},
+	}
+
+	for _, tt := range tests {
+		cmd := newTunnelCmd()
+		cmd.SetArgs(tt.args)
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+
+		if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), tt.contains) {
+			t.Errorf("%v: expected an error mentioning %q, got %v", tt.args, tt.contains, err)
+		}
+	}
+}
+
+// TestTunnelCmd_InsecureSkipLocalVerifyNeedsHTTPS verifies the flag is
+// rejected for a plain http local server
+func TestTunnelCmd_InsecureSkipLocalVerifyNeedsHTTPS(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(".expose.yml", []byte("version: 1\nproject: demo\nport: 3000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := newTunnelCmd()
+	cmd.SetArgs([]string{"--port", "3000", "--insecure-skip-local-verify"})
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+
+	err := cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "--local-scheme https") {
+		t.Errorf("expected error requiring --local-scheme https, got %v", err)
+	}
+}
+
+// TestProxyOptions_Identify verifies --identify marks proxied responses
+func TestProxyOptions_Identify(t *testing.T) {
+	if v := proxied(t, tunnelOptions{}, http.MethodGet, "/").Header.Get("Via"); v != "" {
+		t.Errorf("expected no Via header by default, got %q", v)
+	}
+	if v := proxied(t, tunnelOptions{identify: true}, http.MethodGet, "/").Header.Get("Via"); !strings.Contains(v, "expose") {
+		t.Errorf("expected --identify to add a Via header, got %q", v)
+	}
+}
+
+// proxied sends a request through a proxy built from proxyOptions(opts)
+// to a local server answering 200 with a few identifying headers.
+func proxied(t *testing.T, opts tunnelOptions, method, path string) *http.Response {
+	t.Helper()
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "dev-server")
+		w.Header().Set("X-Internal-Trace", "abc")
+		w.Header().Set("X-App", "demo")
+	}))
+	t.Cleanup(local.Close)
+	opts.port = local.Listener.Addr().(*net.TCPAddr).Port
+
+	p := &portProvider{}
+	svc := tunnel.NewService(p, tunnel.WithProxy(proxyOptions(opts)...))
+	if err := svc.Start(context.Background(), opts.port); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { svc.Close() })
+
+	req, _ := http.NewRequest(method, fmt.Sprintf("http://127.0.0.1:%d%s", p.connects()[0], path), nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+// TestProxyOptions_AllowFilters verifies --allow-methods and --allow-path
+// reach the proxy and refuse everything else
+func TestProxyOptions_AllowFilters(t *testing.T) {
+	rule, err := tunnel.ParsePathRule("/docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := tunnelOptions{allowMethods: []string{"GET"}, allowPaths: []tunnel.PathRule{rule}}
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/docs", http.StatusOK},
+		{http.MethodPost, "/docs", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/admin", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if resp := proxied(t, opts, tt.method, tt.path); resp.StatusCode != tt.want {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.path, tt.want, resp.StatusCode)
+		}
+	}
+}
+
+// TestTunnelCmd_StripResponseHeader verifies --strip-response-header drops
+// the headers from proxied responses and rejects anything that isn't a
+// header name or prefix
+func TestTunnelCmd_StripResponseHeader(t *testing.T) {
+	resp := proxied(t, tunnelOptions{stripHeaders: []string{"Server", "X-Internal-*"}}, http.MethodGet, "/")
+	for _, name := range []string{"Server", "X-Internal-Trace"} {
+		if v := resp.Header.Get(name); v != "" {
+			t.Errorf("expected %s to be stripped, got %q", name, v)
+		}
+	}
+	if v := resp.Header.Get("X-App"); v != "demo" {
+		t.Errorf("expected X-App to be kept, got %q", v)
+	}
+
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(".expose.yml", []byte("version: 1\nproject: demo\nport: 3000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"*", "X-*-Debug", "Server:", "X Powered By"} {
+		cmd := newTunnelCmd()
+		cmd.SetArgs([]string{"--strip-response-header", name})
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+
+		if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "invalid response header") {
+			t.Errorf("--strip-response-header %q: expected an invalid header error, got %v", name, err)
+		}
+	}
+}
+
+// TestServeTunnel_Quiet verifies quiet mode prints nothing but the public URL
+func TestServeTunnel_Quiet(t *testing.T) {
+	tests := []struct {
+		name  string
+		quiet bool
+		want  func(out string) bool
+	}{
+		{"quiet", true, func(out string) bool { return out == "https://fake.example.com\n" }},
+		{"default", false, func(out string) bool {
+			return strings.Contains(out, "✓ Public URL: https://fake.example.com\n") && strings.Contains(out, "Tunnel closed")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newFakeProvider(nil)
+			svc := tunnel.NewService(p)
+			var out bytes.Buffer
+
+			// the on-ready hook runs once the banner is out
+			printed := make(chan struct{})
+			h := &hooks{onReadyExec: "ready", run: func(context.Context, string, []string) error {
+				close(printed)
+				return nil
+			}}
+
+			ctx, cancel := context.WithCancelCause(context.Background())
+			done := make(chan error, 1)
+			go func() {
+				done <- serveTunnel(ctx, svc, tunnelOptions{port: 3000, quiet: tt.quiet, stdout: &out}, h)
+			}()
+
+			<-printed
+			cancel(fmt.Errorf("%w: interrupt", errInterrupted))
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+
+			if !tt.want(out.String()) {
+				t.Errorf("unexpected output %q", out.String())
+			}
+		})
+	}
+}
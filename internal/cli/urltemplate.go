@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// urlTemplateData is what --url-template can refer to.
+type urlTemplateData struct {
+	URL    string // the raw public URL, e.g. https://abc.loca.lt
+	Scheme string // e.g. https
+	Host   string // e.g. abc.loca.lt
+}
+
+// parseURLTemplate parses a --url-template and renders it once against a
+// sample URL, so mistakes like unknown fields fail at startup.
+func parseURLTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("url-template").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url-template: %w", err)
+	}
+	if _, err := formatURL(tmpl, "https://example.loca.lt"); err != nil {
+		return nil, fmt.Errorf("invalid url-template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// formatURL renders raw through tmpl.
+func formatURL(tmpl *template.Template, raw string) (string, error) {
+	data := urlTemplateData{URL: raw}
+	if u, err := url.Parse(raw); err == nil {
+		data.Scheme, data.Host = u.Scheme, u.Host
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// displayURL returns the public URL as shown to the user and passed to
+// hooks: raw by default, formatted by --url-template when given.
+func displayURL(opts tunnelOptions, raw string) string {
+	if opts.urlTemplate == nil || raw == "" {
+		return raw
+	}
+	formatted, err := formatURL(opts.urlTemplate, raw)
+	if err != nil {
+		// validated at startup, so this should not happen
+		fmt.Fprintf(os.Stderr, "⚠ url-template failed, using the raw URL: %v\n", err)
+		return raw
+	}
+	return formatted
+}
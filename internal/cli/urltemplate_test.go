@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kernelshard/expose/internal/tunnel"
+)
+
+func TestParseURLTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		raw      string
+		want     string
+		wantErr  bool
+	}{
+		{"append path", "{{.URL}}/webhook", "https://abc.loca.lt", "https://abc.loca.lt/webhook", false},
+		{"force https", "https://{{.Host}}", "http://abc.loca.lt", "https://abc.loca.lt", false},
+		{"scheme", "{{.Scheme}}", "https://abc.loca.lt", "https", false},
+		{"syntax error", "{{.URL", "", "", true},
+		{"unknown field", "{{.Port}}", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseURLTemplate(tt.template)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := displayURL(tunnelOptions{urlTemplate: tmpl}, tt.raw); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDisplayURL_RawByDefault(t *testing.T) {
+	if got := displayURL(tunnelOptions{}, "https://abc.loca.lt"); got != "https://abc.loca.lt" {
+		t.Errorf("expected the raw URL, got %q", got)
+	}
+}
+
+// TestServeTunnel_URLTemplateReachesHooks verifies hooks get the formatted URL
+func TestServeTunnel_URLTemplateReachesHooks(t *testing.T) {
+	tmpl, err := parseURLTemplate("{{.URL}}/webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := newFakeProvider(nil)
+	svc := tunnel.NewService(p)
+	commands := make(chan string, 1)
+	h := &hooks{
+		onReadyExec: "register {url}",
+		run: func(_ context.Context, command string, _ []string) error {
+			commands <- command
+			return nil
+		},
+		warn: &bytes.Buffer{},
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serveTunnel(ctx, svc, tunnelOptions{port: 3000, urlTemplate: tmpl}, h)
+	}()
+
+	select {
+	case command := <-commands:
+		if want := "register 'https://fake.example.com/webhook'"; command != want {
+			t.Errorf("expected %q, got %q", want, command)
+		}
+	case <-time.After(time.Second):
+		t.Error("on-ready hook did not run")
+	}
+
+	cancel(fmt.Errorf("%w: interrupt", errInterrupted))
+	<-done
+}
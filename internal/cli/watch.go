@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/kernelshard/expose/internal/tunnel"
+)
+
+const (
+	// watchTTYInterval redraws the --watch status line on a terminal
+	watchTTYInterval = time.Second
+
+	// watchLogInterval spaces out --watch lines when output is a file or pipe
+	watchLogInterval = 30 * time.Second
+)
+
+// formatStatus renders the --watch status line for stats.
+func formatStatus(stats tunnel.Stats) string {
+	return fmt.Sprintf("requests: %d | active: %d | in: %s | out: %s",
+		stats.Requests, stats.Active, tunnel.FormatBytes(stats.BytesIn), tunnel.FormatBytes(stats.BytesOut))
+}
+
+// isTerminal reports whether w is a character device such as a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// watchStats writes the status from stats every interval until ctx is done.
+// On a terminal the line is redrawn in place, elsewhere each update is a
+// timestamped line. An interval of 0 picks a default for the output.
+func watchStats(ctx context.Context, w io.Writer, stats func() tunnel.Stats, interval time.Duration) {
+	tty := isTerminal(w)
+	if interval <= 0 {
+		interval = watchLogInterval
+		if tty {
+			interval = watchTTYInterval
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	drawn := false
+	for {
+		select {
+		case <-ctx.Done():
+			// leave the last status on its own line
+			if drawn {
+				fmt.Fprintln(w)
+			}
+			return
+		case now := <-ticker.C:
+			if tty {
+				fmt.Fprintf(w, "\r\033[K%s", formatStatus(stats()))
+				drawn = true
+			} else {
+				fmt.Fprintf(w, "[%s] %s\n", now.Format(time.TimeOnly), formatStatus(stats()))
+			}
+		}
+	}
+}
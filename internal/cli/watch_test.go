@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kernelshard/expose/internal/tunnel"
+)
+
+func TestFormatStatus(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats tunnel.Stats
+		want  string
+	}{
+		{"idle", tunnel.Stats{}, "requests: 0 | active: 0 | in: 0 B | out: 0 B"},
+		{"busy", tunnel.Stats{Requests: 42, Active: 3, BytesIn: 1536, BytesOut: 5 << 20},
+			"requests: 42 | active: 3 | in: 1.5 KB | out: 5.0 MB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatStatus(tt.stats); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for a writer and a reader goroutine.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// TestWatchStats_NonTTY verifies each update is a plain line when output is not a terminal
+func TestWatchStats_NonTTY(t *testing.T) {
+	var out syncBuffer
+	ctx, cancel := context.WithCancel(context.Background())
+
+	updates := make(chan struct{}, 1)
+	stats := func() tunnel.Stats {
+		select {
+		case updates <- struct{}{}:
+		default:
+		}
+		return tunnel.Stats{Requests: 7}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		watchStats(ctx, &out, stats, time.Millisecond)
+	}()
+	<-updates
+	<-updates
+	cancel()
+	<-done
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("expected a line per update, got %q", out.String())
+	}
+	for _, line := range lines {
+		if !strings.HasSuffix(line, "] requests: 7 | active: 0 | in: 0 B | out: 0 B") || strings.Contains(line, "\r") {
+			t.Errorf("unexpected status line %q", line)
+		}
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	if isTerminal(&bytes.Buffer{}) {
+		t.Error("expected a buffer not to be a terminal")
+	}
+}
@@ -1,7 +1,9 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
@@ -10,13 +12,27 @@ import (
 
 const DefaultConfigFile = ".expose.yml"
 
+// DefaultPort is the local port written by Init when none is given.
+const DefaultPort = 3000
+
+// CurrentVersion is the config schema version written by this build.
+const CurrentVersion = 1
+
+// warnOutput receives non-fatal config warnings, swapped in tests
+var warnOutput io.Writer = os.Stderr
+
 // Config represents the structure of the configuration file.
 type Config struct {
-	Project string `yaml:"project"`
-	Port    int    `yaml:"port"`
+	Version  int    `yaml:"version"`
+	Project  string `yaml:"project"`
+	Port     int    `yaml:"port"`
+	Provider string `yaml:"provider,omitempty"`
+	// CredentialsFile holds the provider credential, see 'expose tunnel --credentials-file'
+	CredentialsFile string `yaml:"credentials_file,omitempty"`
 }
 
 // Load reads the configuration from the specified or default file path.
+// Older schema versions are migrated in memory, see Migrate to rewrite the file.
 func Load(path string) (*Config, error) {
 
 	// Use default config file if no path is provided
@@ -29,60 +45,150 @@ func Load(path string) (*Config, error) {
 		return nil, err
 	}
 
+	cfg, _, err := parse(data)
+	return cfg, err
+}
+
+// Migrate upgrades the config file at path (or the default file) to
+// CurrentVersion and rewrites it. It reports whether the file changed.
+func Migrate(path string) (bool, error) {
+	if path == "" {
+		path = DefaultConfigFile
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	cfg, migrated, err := parse(data)
+	if err != nil || !migrated {
+		return false, err
+	}
+
+	return true, save(path, cfg)
+}
+
+// parse decodes YAML config data, applying schema migrations.
+// It reports whether any migration was applied.
+func parse(data []byte) (*Config, bool, error) {
+	// decode into a generic map first so migrations can rename keys
+	raw := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, false, err
+	}
+
+	migrated, err := migrate(raw)
+	if err != nil {
+		return nil, false, err
+	}
+
+	upgraded, err := yaml.Marshal(raw)
+	if err != nil {
+		return nil, false, err
+	}
+
 	var cfg Config
 	// Unmarshal YAML data into Config struct to populate cfg fields
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, err
+	if err := yaml.Unmarshal(upgraded, &cfg); err != nil {
+		return nil, false, err
 	}
 
-	return &cfg, nil
+	return &cfg, migrated, nil
+}
+
+// save writes cfg as YAML to path.
+func save(path string, cfg *Config) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
 }
 
 // Init creates a default configuration file in the current directory.
 func Init() (*Config, error) {
-	// Check if default config file exists
-	if _, err := os.Stat(DefaultConfigFile); err == nil {
-		return nil, fmt.Errorf("config already exists")
+	return InitWith(InitOptions{})
+}
+
+// ErrConfigExists is returned by InitWith when the config file already exists.
+var ErrConfigExists = errors.New("config already exists")
+
+// InitOptions customise the config written by InitWith.
+// Zero values fall back to the defaults used by Init.
+type InitOptions struct {
+	Project  string
+	Port     int
+	Provider string
+	// Force overwrites an existing config file
+	Force bool
+	// Path is the file to write, "" for DefaultConfigFile
+	Path string
+}
+
+// InitWith creates the config file from opts.
+func InitWith(opts InitOptions) (*Config, error) {
+	if opts.Path == "" {
+		opts.Path = DefaultConfigFile
 	}
 
-	// Get project name from current directory
-	dir, _ := os.Getwd()
-	projectName := filepath.Base(dir)
+	// Check if config file exists
+	if _, err := os.Stat(opts.Path); err == nil && !opts.Force {
+		return nil, ErrConfigExists
+	}
+
+	if opts.Port < 0 || opts.Port > 65535 {
+		return nil, fmt.Errorf("invalid port %d (must be 1-65535)", opts.Port)
+	}
 
 	cfg := &Config{
-		Project: projectName,
-		Port:    3000,
+		Version:  CurrentVersion,
+		Project:  opts.Project,
+		Port:     opts.Port,
+		Provider: opts.Provider,
 	}
 
-	// Write config file
-	data, err := yaml.Marshal(cfg)
-	if err != nil {
-		return nil, err
+	// Get project name from current directory
+	if cfg.Project == "" {
+		dir, _ := os.Getwd()
+		cfg.Project = filepath.Base(dir)
+	}
+	if cfg.Port == 0 {
+		cfg.Port = DefaultPort
 	}
 
-	if err := os.WriteFile(DefaultConfigFile, data, 0644); err != nil {
+	// Write config file
+	if err := save(opts.Path, cfg); err != nil {
 		return nil, err
 	}
 
 	return cfg, nil
-
 }
 
 // List returns all configuration values as a map
 func (c *Config) List() map[string]interface{} {
 	return map[string]interface{}{
-		"project": c.Project,
-		"port":    c.Port,
+		"version":          c.Version,
+		"project":          c.Project,
+		"port":             c.Port,
+		"provider":         c.Provider,
+		"credentials_file": c.CredentialsFile,
 	}
 }
 
 // Get returns the value of a specific configuration key
 func (c *Config) Get(key string) (interface{}, error) {
 	switch key {
+	case "version":
+		return c.Version, nil
 	case "project":
 		return c.Project, nil
 	case "port":
 		return c.Port, nil
+	case "provider":
+		return c.Provider, nil
+	case "credentials_file":
+		return c.CredentialsFile, nil
 	default:
 		return nil, fmt.Errorf("unknown config key: %s", key)
 	}
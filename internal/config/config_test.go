@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -174,6 +175,7 @@ func TestGet(t *testing.T) {
 	}{
 		{"project", "my_project", false},
 		{"port", 3000, false},
+		{"credentials_file", "", false},
 		{"invalid", nil, true},
 	}
 
@@ -195,3 +197,52 @@ func TestGet(t *testing.T) {
 		})
 	}
 }
+
+func TestInitWith(t *testing.T) {
+	t.Run("force overwrites existing config", func(t *testing.T) {
+		_ = os.Chdir(t.TempDir())
+		if err := os.WriteFile(DefaultConfigFile, []byte("project: old\nport: 1\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := InitWith(InitOptions{}); !errors.Is(err, ErrConfigExists) {
+			t.Fatalf("expected ErrConfigExists without force, got %v", err)
+		}
+
+		if _, err := InitWith(InitOptions{Project: "new", Port: 8080, Force: true}); err != nil {
+			t.Fatalf("InitWith(force) failed: %v", err)
+		}
+
+		cfg, err := Load("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Project != "new" || cfg.Port != 8080 {
+			t.Errorf("expected overwritten config, got %+v", cfg)
+		}
+	})
+
+	t.Run("writes provided values", func(t *testing.T) {
+		_ = os.Chdir(t.TempDir())
+
+		if _, err := InitWith(InitOptions{Project: "demo", Port: 5173, Provider: "cloudflare"}); err != nil {
+			t.Fatalf("InitWith failed: %v", err)
+		}
+
+		cfg, err := Load("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Project != "demo" || cfg.Port != 5173 || cfg.Provider != "cloudflare" {
+			t.Errorf("expected provided values, got %+v", cfg)
+		}
+	})
+
+	t.Run("rejects invalid port", func(t *testing.T) {
+		_ = os.Chdir(t.TempDir())
+
+		if _, err := InitWith(InitOptions{Port: 70000}); err == nil {
+			t.Error("expected error for invalid port")
+		}
+	})
+}
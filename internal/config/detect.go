@@ -0,0 +1,64 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// envFiles are searched in order for a PORT entry.
+var envFiles = []string{".env", ".env.local", ".env.development"}
+
+// ErrNoPortHint is returned by DetectPort when no port could be found.
+var ErrNoPortHint = errors.New("no PORT found in .env files")
+
+// DetectPort makes a best-effort guess at the dev server port of the project
+// in the current directory, from a PORT entry in its .env files.
+func DetectPort() (int, error) {
+	return detectPort(".")
+}
+
+// detectPort looks for a valid PORT in the env files in dir.
+func detectPort(dir string) (int, error) {
+	for _, name := range envFiles {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		if port, ok := envPort(data); ok {
+			return port, nil
+		}
+	}
+	return 0, ErrNoPortHint
+}
+
+// envPort extracts PORT from .env style data, e.g. `export PORT="3000" # dev`.
+func envPort(data []byte) (int, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(key) != "PORT" {
+			continue
+		}
+
+		// drop inline comments and quotes
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = value[:i]
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			return 0, false
+		}
+		return port, true
+	}
+	return 0, false
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectPort_FromEnv(t *testing.T) {
+	dir := t.TempDir()
+	env := "# dev settings\nHOST=localhost\nexport PORT=\"5173\" # vite\n"
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte(env), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	port, err := detectPort(dir)
+	if err != nil {
+		t.Fatalf("detectPort failed: %v", err)
+	}
+	if port != 5173 {
+		t.Errorf("expected port 5173, got %d", port)
+	}
+}
+
+func TestDetectPort_FallsBackToLaterFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, ".env"), []byte("PORT=not-a-port\n"), 0644)
+	os.WriteFile(filepath.Join(dir, ".env.local"), []byte("PORT=8080\n"), 0644)
+
+	port, err := detectPort(dir)
+	if err != nil || port != 8080 {
+		t.Errorf("expected 8080 from .env.local, got %d (%v)", port, err)
+	}
+}
+
+func TestDetectPort_NoHints(t *testing.T) {
+	port, err := detectPort(t.TempDir())
+	if !errors.Is(err, ErrNoPortHint) {
+		t.Errorf("expected ErrNoPortHint, got %v", err)
+	}
+	if port != 0 {
+		t.Errorf("expected port 0, got %d", port)
+	}
+}
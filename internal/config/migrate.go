@@ -0,0 +1,44 @@
+package config
+
+import "fmt"
+
+// migrations upgrade a raw config one schema version at a time,
+// migrations[i] turns version i into version i+1.
+var migrations = []func(raw map[string]interface{}){
+	migrateV0,
+}
+
+// migrate upgrades raw in place to CurrentVersion and reports whether
+// anything changed. Configs from a newer version are left alone with a warning.
+func migrate(raw map[string]interface{}) (bool, error) {
+	start := 0
+	if v, ok := raw["version"]; ok {
+		n, ok := v.(int)
+		if !ok || n < 0 {
+			return false, fmt.Errorf("invalid config version %v", v)
+		}
+		start = n
+	}
+
+	if start > CurrentVersion {
+		fmt.Fprintf(warnOutput, "warning: config version %d is newer than supported version %d, some settings may be ignored\n", start, CurrentVersion)
+		return false, nil
+	}
+
+	for version := start; version < CurrentVersion; version++ {
+		migrations[version](raw)
+		raw["version"] = version + 1
+	}
+
+	return start < CurrentVersion, nil
+}
+
+// migrateV0 upgrades unversioned configs, which used default_port for the port.
+func migrateV0(raw map[string]interface{}) {
+	if port, ok := raw["default_port"]; ok {
+		if _, exists := raw["port"]; !exists {
+			raw["port"] = port
+		}
+		delete(raw, "default_port")
+	}
+}
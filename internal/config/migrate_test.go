@@ -0,0 +1,117 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes content to a config file in a temp dir and returns its path.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), DefaultConfigFile)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_MigratesV0(t *testing.T) {
+	path := writeConfig(t, "project: legacy\ndefault_port: 4000\n")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if cfg.Version != CurrentVersion {
+		t.Errorf("expected version %d, got %d", CurrentVersion, cfg.Version)
+	}
+	if cfg.Port != 4000 {
+		t.Errorf("expected default_port to migrate to port 4000, got %d", cfg.Port)
+	}
+	if cfg.Project != "legacy" {
+		t.Errorf("expected project 'legacy', got %s", cfg.Project)
+	}
+
+	// Load must not rewrite the file
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "default_port") {
+		t.Error("Load should not rewrite the config file")
+	}
+}
+
+func TestMigrate_RoundTrip(t *testing.T) {
+	path := writeConfig(t, "project: legacy\ndefault_port: 4000\n")
+
+	migrated, err := Migrate(path)
+	if err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if !migrated {
+		t.Fatal("expected v0 config to be migrated")
+	}
+
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "default_port") {
+		t.Errorf("expected default_port to be gone, got:\n%s", data)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load after migrate failed: %v", err)
+	}
+	want := Config{Version: CurrentVersion, Project: "legacy", Port: 4000}
+	if *cfg != want {
+		t.Errorf("expected %+v after round trip, got %+v", want, *cfg)
+	}
+
+	// migrating again is a no-op
+	migrated, err = Migrate(path)
+	if err != nil || migrated {
+		t.Errorf("expected no second migration, got migrated=%v err=%v", migrated, err)
+	}
+}
+
+func TestMigrate_PortWinsOverDefaultPort(t *testing.T) {
+	raw := map[string]interface{}{"port": 8080, "default_port": 4000}
+
+	if _, err := migrate(raw); err != nil {
+		t.Fatal(err)
+	}
+	if raw["port"] != 8080 {
+		t.Errorf("expected explicit port to win, got %v", raw["port"])
+	}
+	if _, ok := raw["default_port"]; ok {
+		t.Error("expected default_port to be removed")
+	}
+}
+
+func TestLoad_FutureVersionWarns(t *testing.T) {
+	var warnings bytes.Buffer
+	warnOutput = &warnings
+	defer func() { warnOutput = os.Stderr }()
+
+	path := writeConfig(t, "version: 99\nproject: future\nport: 3000\n")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Version != 99 || cfg.Port != 3000 {
+		t.Errorf("expected future config to load as-is, got %+v", cfg)
+	}
+	if !strings.Contains(warnings.String(), "version 99") {
+		t.Errorf("expected future version warning, got %q", warnings.String())
+	}
+}
+
+func TestLoad_InvalidVersion(t *testing.T) {
+	path := writeConfig(t, "version: abc\nport: 3000\n")
+
+	if _, err := Load(path); err == nil {
+		t.Error("expected error for non-numeric version")
+	}
+}
@@ -0,0 +1,67 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Benchmarks of the localtunnel proxy path against in-memory local
+// servers, no network beyond loopback. Run with
+//
+//	go test -run '^$' -bench . -benchmem ./internal/provider
+
+// BenchmarkProxyRequest measures proxyRequest forwarding one request from
+// a tunnel connection to the local server and the response back. Local
+// connections aren't pooled, each request dials the local server.
+func BenchmarkProxyRequest(b *testing.B) {
+	for _, size := range []int{1 << 10, 64 << 10, 1 << 20} {
+		b.Run(fmt.Sprintf("%dKB", size>>10), func(b *testing.B) {
+			body := bytes.Repeat([]byte("x"), size)
+			local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write(body)
+			}))
+			b.Cleanup(local.Close)
+
+			lt := NewLocalTunnel(nil).(*localTunnel)
+			lt.ctx, lt.cancel = context.WithCancel(context.Background())
+			b.Cleanup(lt.cancel)
+			lt.localPort = local.Listener.Addr().(*net.TCPAddr).Port
+
+			request := []byte("GET / HTTP/1.1\r\nHost: bench.loca.lt\r\nConnection: close\r\n\r\n")
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				tunnelSide, remote := net.Pipe()
+				done := make(chan error, 1)
+				go func() {
+					done <- lt.proxyRequest(lt.ctx, tunnelSide)
+				}()
+
+				// the tunnel server side: send the request, read the response
+				remote.Write(request)
+				resp, err := http.ReadResponse(bufio.NewReader(remote), nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+				n, _ := io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				remote.Close()
+				if err := <-done; err != nil {
+					b.Fatal(err)
+				}
+				tunnelSide.Close()
+				if n != int64(size) {
+					b.Fatalf("expected %d bytes, got %d", size, n)
+				}
+			}
+		})
+	}
+}
@@ -1,143 +1,124 @@
 package provider
 
 import (
-	"bufio"
 	"context"
 	"fmt"
+	"os"
 	"os/exec"
 	"regexp"
-	"sync"
+	"strings"
 	"time"
+
+	"github.com/kernelshard/expose/internal/tunnel"
 )
 
-// Cloudflare implements the Provider interface for Cloudflare Tunnel
+// quickTunnelURLRegex matches the ephemeral URL announced by a quick tunnel
+var quickTunnelURLRegex = regexp.MustCompile(`https://[a-z0-9-]+\.trycloudflare\.com`)
+
+// namedTunnelReadyMarker is logged by cloudflared once a named tunnel serves traffic
+const namedTunnelReadyMarker = "Registered tunnel connection"
+
+// Cloudflare implements the Provider interface for Cloudflare Tunnel, on
+// top of a ProcessProvider running cloudflared.
 type Cloudflare struct {
-	cmd       *exec.Cmd
-	mu        sync.RWMutex
-	publicURL string
+	*ProcessProvider
+
+	// named tunnel settings, empty tunnelName means quick tunnel mode
+	tunnelName string
+	token      string
+	hostname   string
 
 	// RequestTunnel is exported for test mocking
 	RequestTunnel func(ctx context.Context, port int, timeout time.Duration) (string, *exec.Cmd, error)
 }
 
-// NewCloudFlare creates a new instance of Cloudflare provider
-func NewCloudFlare() *Cloudflare {
-	return &Cloudflare{
-		RequestTunnel: requestTunnel, // Use real implementation by default
+// CloudflareOption configures optional Cloudflare behaviour.
+type CloudflareOption func(*Cloudflare)
+
+// WithNamedTunnel runs the named tunnel `name` bound to hostname instead of
+// an ephemeral quick tunnel. The token is optional; without it cloudflared
+// uses the credentials from its own config directory.
+func WithNamedTunnel(name, token, hostname string) CloudflareOption {
+	return func(c *Cloudflare) {
+		c.tunnelName = name
+		c.token = token
+		c.hostname = hostname
 	}
 }
 
-// Connect establishes a Cloudflare Tunnel to the specified local port
-func (c *Cloudflare) Connect(ctx context.Context, localPort int) (string, error) {
-	timeout := 30 * time.Second
-	url, cmd, err := c.RequestTunnel(ctx, localPort, timeout)
-	if err != nil {
-		return "", err
+// NewCloudFlare creates a new instance of Cloudflare provider
+func NewCloudFlare(opts ...CloudflareOption) *Cloudflare {
+	c := &Cloudflare{}
+	for _, opt := range opts {
+		opt(c)
 	}
-
-	c.mu.Lock()
-	c.cmd = cmd
-	c.publicURL = url
-	c.mu.Unlock()
-
-	return url, nil
+	c.ProcessProvider = NewProcessProvider(c.processConfig())
+	c.RequestTunnel = c.start // Use real implementation by default
+	return c
 }
 
-// Close terminates the Cloudflare Tunnel
-func (c *Cloudflare) Close() error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	// if cmd is running, kill the process
-	if c.cmd != nil && c.cmd.Process != nil {
-		err := c.cmd.Process.Kill()
-		// clear fields safely under write lock
-		c.cmd = nil
-		c.publicURL = ""
-		return err
+// processConfig describes the cloudflared command for the configured mode.
+func (c *Cloudflare) processConfig() ProcessConfig {
+	cfg := ProcessConfig{
+		Name:    "Cloudflare",
+		Command: "cloudflared",
+		Output:  os.Stderr, // cloudflared logs, stdout is for the URL
+	}
+	if c.token != "" {
+		// pass the token via env so it doesn't show up in `ps`
+		cfg.Env = []string{"TUNNEL_TOKEN=" + c.token}
 	}
-	return nil
-}
-
-// PublicURL returns the public URL of the Cloudflare Tunnel
-func (c *Cloudflare) PublicURL() string {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	return c.publicURL
-}
 
-// IsConnected checks if the Cloudflare Tunnel is active
-func (c *Cloudflare) IsConnected() bool {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	if c.tunnelName == "" {
+		// quick tunnel: cloudflared announces a random trycloudflare.com URL
+		cfg.Args = func(port int) []string {
+			return []string{"tunnel", "--url", cloudflaredLocalURL(port)}
+		}
+		cfg.URL = quickTunnelURLRegex
+		return cfg
+	}
 
-	return c.cmd != nil && c.cmd.ProcessState == nil
+	// named tunnel: the hostname is routed in the Cloudflare dashboard,
+	// so the tunnel is ready once a connection is registered
+	publicURL := "https://" + c.hostname
+	cfg.Args = func(port int) []string {
+		return []string{"tunnel", "run", "--url", cloudflaredLocalURL(port), c.tunnelName}
+	}
+	cfg.MatchURL = func(line string) string {
+		if strings.Contains(line, namedTunnelReadyMarker) {
+			return publicURL
+		}
+		return ""
+	}
+	return cfg
 }
 
-// Name returns the name of the provider
-func (c *Cloudflare) Name() string {
-	return "Cloudflare"
+// cloudflaredLocalURL is the origin cloudflared forwards to.
+func cloudflaredLocalURL(port int) string {
+	return fmt.Sprintf("http://localhost:%d", port)
 }
 
-// requestTunnel starts the cloudflared process and retrieves the public URL
-func requestTunnel(ctx context.Context, port int, timeout time.Duration) (string, *exec.Cmd, error) {
-	urlRegex := regexp.MustCompile(`https://[a-z0-9-]+\.trycloudflare\.com`)
-
-	cmd := exec.CommandContext(ctx, "cloudflared", "tunnel", "--url", fmt.Sprintf("http://localhost:%d", port))
-
-	stderr, err := cmd.StderrPipe()
+// Connect establishes a Cloudflare Tunnel to the specified local port
+func (c *Cloudflare) Connect(ctx context.Context, localPort int) (string, error) {
+	url, cmd, err := c.RequestTunnel(ctx, localPort, c.cfg.Timeout)
 	if err != nil {
-		return "", nil, fmt.Errorf("get stderr pipe: %w", err)
-	}
-
-	if err := cmd.Start(); err != nil {
-		return "", nil, fmt.Errorf("start cloudflared: %w", err)
+		return "", err
 	}
+	c.connected(cmd, localPort, url)
+	return url, nil
+}
 
-	urlCh := make(chan string, 1)
-	errCh := make(chan error, 1)
-
-	// Read stderr for URL
-	go func() {
-		scanner := bufio.NewScanner(stderr)
-		for scanner.Scan() {
-			line := scanner.Text()
-			fmt.Println(line) // logs
-
-			if url := urlRegex.FindString(line); url != "" {
-				urlCh <- url
-				return
-			}
-		}
+// Reconnect restarts cloudflared for localPort. A quick tunnel comes back
+// on a new URL, a named tunnel on the same hostname.
+func (c *Cloudflare) Reconnect(ctx context.Context, localPort int) (string, error) {
+	// a dead process can't be killed, that's not a reason to give up
+	_ = c.Close()
+	return c.Connect(ctx, localPort)
+}
 
-		// Handle scanner error or no URL found
-		if err := scanner.Err(); err != nil {
-			errCh <- fmt.Errorf("read stderr: %w", err)
-		} else {
-			errCh <- fmt.Errorf("cloudflared exited without providing URL")
-		}
-	}()
-
-	// Wait for result with timeout
-	select {
-	case url := <-urlCh:
-		// Success - return cmd so caller can manage it
-		return url, cmd, nil
-
-	case err := <-errCh:
-		_ = cmd.Process.Kill()
-		_ = cmd.Wait()
-		return "", nil, err
-
-	case <-time.After(timeout):
-		_ = cmd.Process.Kill()
-		_ = cmd.Wait()
-		return "", nil, fmt.Errorf("timeout waiting for tunnel URL")
-
-	case <-ctx.Done():
-		_ = cmd.Process.Kill()
-		_ = cmd.Wait()
-		return "", nil, ctx.Err()
+// Capabilities reports the optional features supported by Cloudflare tunnels.
+func (c *Cloudflare) Capabilities() tunnel.Capabilities {
+	return tunnel.Capabilities{
+		SupportsCustomDomain: true, // via named tunnels
 	}
 }
@@ -3,9 +3,15 @@ package provider
 import (
 	"context"
 	"errors"
+	"fmt"
+	"os"
 	"os/exec"
+	"slices"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/kernelshard/expose/internal/tunnel"
 )
 
 // TestCloudflare_Connect tests the Connect method of Cloudflare provider
@@ -49,6 +55,32 @@ func TestCloudflare_ConnectError(t *testing.T) {
 	}
 }
 
+// TestCloudflare_Reconnect verifies Reconnect restarts cloudflared for the port it is given
+func TestCloudflare_Reconnect(t *testing.T) {
+	cf := NewCloudFlare()
+
+	var ports []int
+	cf.RequestTunnel = func(ctx context.Context, port int, timeout time.Duration) (string, *exec.Cmd, error) {
+		ports = append(ports, port)
+		return fmt.Sprintf("https://session-%d.trycloudflare.com", len(ports)), nil, nil
+	}
+
+	if _, err := cf.Connect(context.Background(), 3000); err != nil {
+		t.Fatal(err)
+	}
+	url, err := cf.Reconnect(context.Background(), 4000)
+	if err != nil {
+		t.Fatalf("Reconnect() error = %v", err)
+	}
+
+	if !slices.Equal(ports, []int{3000, 4000}) {
+		t.Errorf("expected cloudflared started for port 3000, then 4000, got %v", ports)
+	}
+	if url != "https://session-2.trycloudflare.com" || cf.PublicURL() != url {
+		t.Errorf("expected the new quick tunnel URL, got %s (PublicURL %s)", url, cf.PublicURL())
+	}
+}
+
 // TestCloudflare_Name tests the Name method of Cloudflare provider
 func TestCloudflare_Name(t *testing.T) {
 	cf := NewCloudFlare()
@@ -82,3 +114,229 @@ func TestCloudflare_ConnectTimeout(t *testing.T) {
 		t.Fatal("Expected timeout error, got nil")
 	}
 }
+
+// TestCloudflare_Capabilities verifies the features advertised by Cloudflare
+func TestCloudflare_Capabilities(t *testing.T) {
+	want := tunnel.Capabilities{SupportsCustomDomain: true}
+	if caps := tunnel.CapabilitiesOf(NewCloudFlare()); caps != want {
+		t.Errorf("expected capabilities %+v, got %+v", want, caps)
+	}
+}
+
+// TestHelperProcess is not a real test, it stands in for cloudflared when
+// re-executed by fakeCommand and prints the lines from HELPER_STDERR.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	for i, line := range strings.Split(os.Getenv("HELPER_STDERR"), "\n") {
+		if i > 0 {
+			// give the caller time to handle the previous line
+			time.Sleep(100 * time.Millisecond)
+		}
+		fmt.Fprintln(os.Stderr, line)
+	}
+	// keep running like cloudflared until killed
+	time.Sleep(10 * time.Second)
+	os.Exit(0)
+}
+
+// fakeCommand returns an execCommand replacement that records the arguments
+// and runs TestHelperProcess printing stderrLine instead of cloudflared.
+// Multiple lines are separated by "\n" and printed with a short pause.
+func fakeCommand(gotArgs *[]string, stderrLine string) func(context.Context, string, ...string) *exec.Cmd {
+	return func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		*gotArgs = append([]string{name}, args...)
+		cmd := exec.CommandContext(ctx, os.Args[0], "-test.run=TestHelperProcess")
+		cmd.Env = append(os.Environ(), "GO_WANT_HELPER_PROCESS=1", "HELPER_STDERR="+stderrLine)
+		return cmd
+	}
+}
+
+// TestCloudflare_NamedTunnel verifies named tunnel args and that the hostname becomes the URL
+func TestCloudflare_NamedTunnel(t *testing.T) {
+	var args []string
+	cf := NewCloudFlare(WithNamedTunnel("dev", "secret-token", "dev.example.com"))
+	cf.execCommand = fakeCommand(&args, "INF Registered tunnel connection connIndex=0")
+
+	url, err := cf.Connect(context.Background(), 3000)
+	if err != nil {
+		t.Fatalf("Connect() failed: %v", err)
+	}
+	defer cf.Close()
+
+	if url != "https://dev.example.com" {
+		t.Errorf("expected hostname URL, got %s", url)
+	}
+
+	want := "cloudflared tunnel run --url http://localhost:3000 dev"
+	if got := strings.Join(args, " "); got != want {
+		t.Errorf("expected args %q, got %q", want, got)
+	}
+
+	// token must be passed via env, not on the command line
+	if strings.Contains(strings.Join(args, " "), "secret-token") {
+		t.Error("token leaked into command arguments")
+	}
+	if !slices.Contains(cf.cmd.Env, "TUNNEL_TOKEN=secret-token") {
+		t.Error("expected TUNNEL_TOKEN in command env")
+	}
+}
+
+// TestCloudflare_QuickTunnelArgs verifies quick tunnel mode stays the default
+func TestCloudflare_QuickTunnelArgs(t *testing.T) {
+	var args []string
+	cf := NewCloudFlare()
+	cf.execCommand = fakeCommand(&args, "INF |  https://quick-test.trycloudflare.com  |")
+
+	url, err := cf.Connect(context.Background(), 8080)
+	if err != nil {
+		t.Fatalf("Connect() failed: %v", err)
+	}
+	defer cf.Close()
+
+	if url != "https://quick-test.trycloudflare.com" {
+		t.Errorf("expected quick tunnel URL, got %s", url)
+	}
+
+	want := "cloudflared tunnel --url http://localhost:8080"
+	if got := strings.Join(args, " "); got != want {
+		t.Errorf("expected args %q, got %q", want, got)
+	}
+}
+
+// TestCloudflare_OnURLChange verifies the callback receives the connected URL
+func TestCloudflare_OnURLChange(t *testing.T) {
+	cf := NewCloudFlare()
+	cf.RequestTunnel = func(ctx context.Context, port int, timeout time.Duration) (string, *exec.Cmd, error) {
+		return "https://changed.trycloudflare.com", nil, nil
+	}
+
+	var got string
+	cf.OnURLChange(func(url string) { got = url })
+
+	if _, err := cf.Connect(context.Background(), 3000); err != nil {
+		t.Fatalf("Connect() failed: %v", err)
+	}
+	if got != "https://changed.trycloudflare.com" {
+		t.Errorf("expected callback with new URL, got %q", got)
+	}
+}
+
+// TestCloudflare_Available verifies the cloudflared binary lookup
+func TestCloudflare_Available(t *testing.T) {
+	cf := NewCloudFlare()
+
+	cf.lookPath = func(file string) (string, error) { return "/usr/bin/" + file, nil }
+	if err := tunnel.Available(cf); err != nil {
+		t.Errorf("expected cloudflared to be available, got %v", err)
+	}
+
+	cf.lookPath = func(file string) (string, error) { return "", exec.ErrNotFound }
+	err := tunnel.Available(cf)
+	if err == nil || !strings.Contains(err.Error(), "cloudflared not found") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+	if !errors.Is(err, tunnel.ErrProviderUnavailable) {
+		t.Errorf("expected ErrProviderUnavailable, got %v", err)
+	}
+}
+
+// TestCloudflare_ReannouncedURL verifies a later URL from cloudflared updates PublicURL
+func TestCloudflare_ReannouncedURL(t *testing.T) {
+	var args []string
+	cf := NewCloudFlare()
+	cf.execCommand = fakeCommand(&args,
+		"INF |  https://first.trycloudflare.com  |\nINF |  https://second.trycloudflare.com  |")
+
+	changes := make(chan string, 2)
+	cf.OnURLChange(func(url string) { changes <- url })
+
+	url, err := cf.Connect(context.Background(), 3000)
+	if err != nil {
+		t.Fatalf("Connect() failed: %v", err)
+	}
+	defer cf.Close()
+
+	if url != "https://first.trycloudflare.com" {
+		t.Errorf("expected first URL from Connect, got %s", url)
+	}
+
+	// read concurrently with the scanner's update
+	deadline := time.After(2 * time.Second)
+	for cf.PublicURL() != "https://second.trycloudflare.com" {
+		select {
+		case <-deadline:
+			t.Fatalf("expected re-announced URL, still %s", cf.PublicURL())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	if got := <-changes; got != "https://first.trycloudflare.com" {
+		t.Errorf("expected first notification for the initial URL, got %s", got)
+	}
+	if got := <-changes; got != "https://second.trycloudflare.com" {
+		t.Errorf("expected second notification for the new URL, got %s", got)
+	}
+}
+
+// TestCloudflare_HealthCheck verifies a dead cloudflared process is reported unhealthy
+func TestCloudflare_HealthCheck(t *testing.T) {
+	var args []string
+	cf := NewCloudFlare()
+	cf.execCommand = fakeCommand(&args, "INF |  https://health.trycloudflare.com  |")
+
+	if _, err := cf.Connect(context.Background(), 3000); err != nil {
+		t.Fatalf("Connect() failed: %v", err)
+	}
+	defer cf.Close()
+
+	if err := cf.HealthCheck(context.Background()); err != nil {
+		t.Fatalf("expected running process to be healthy, got %v", err)
+	}
+
+	// cloudflared dies behind our back
+	cf.mu.RLock()
+	proc := cf.cmd.Process
+	cf.mu.RUnlock()
+	if err := proc.Kill(); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for cf.HealthCheck(context.Background()) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("expected dead process to be reported unhealthy")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if cf.IsConnected() {
+		t.Error("expected IsConnected to be false after the process exited")
+	}
+}
+
+// TestCloudflare_CloseAfterCancel verifies Close reports no error for the
+// process cancelling Connect's context already killed
+func TestCloudflare_CloseAfterCancel(t *testing.T) {
+	var args []string
+	cf := NewCloudFlare()
+	cf.execCommand = fakeCommand(&args, "INF |  https://cancel.trycloudflare.com  |")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := cf.Connect(ctx, 3000); err != nil {
+		t.Fatalf("Connect() failed: %v", err)
+	}
+
+	cancel()
+	deadline := time.Now().Add(2 * time.Second)
+	for cf.IsConnected() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the process to exit once the context is cancelled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := cf.Close(); err != nil {
+		t.Errorf("expected nil from Close, got %v", err)
+	}
+}
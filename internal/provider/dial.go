@@ -0,0 +1,306 @@
+package provider
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DialFunc dials a network address, it matches net.Dialer.DialContext.
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// defaultDial is the plain TCP dialer used when nothing else is configured.
+var defaultDial DialFunc = (&net.Dialer{}).DialContext
+
+// ParseDNSServer parses and validates a DNS server for NewResolver, an IP
+// address with an optional port that defaults to 53.
+func ParseDNSServer(raw string) (string, error) {
+	host, port, err := net.SplitHostPort(raw)
+	if err != nil {
+		host, port = raw, "53"
+	}
+	if net.ParseIP(host) == nil {
+		return "", fmt.Errorf("invalid DNS server %q (must be an IP address, optionally with a port)", raw)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("invalid DNS server port in %q", raw)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// NewResolver returns a resolver sending its queries to server, see
+// ParseDNSServer, or the system resolver when server is empty.
+func NewResolver(server string) *net.Resolver {
+	if server == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// resolvingDial returns a DialFunc that looks host names up with resolver,
+// each lookup bounded by timeout unless it is <= 0, and dials the
+// addresses through dial in turn until one connects.
+func resolvingDial(resolver *net.Resolver, timeout time.Duration, dial DialFunc) DialFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, address)
+		}
+
+		lookupCtx := ctx
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			lookupCtx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		ips, err := resolver.LookupNetIP(lookupCtx, "ip", host)
+		if err != nil {
+			if ctx.Err() == nil && errors.Is(lookupCtx.Err(), context.DeadlineExceeded) {
+				return nil, fmt.Errorf("resolve %s: DNS lookup timed out after %s", host, timeout)
+			}
+			return nil, fmt.Errorf("resolve %s: %w", host, err)
+		}
+
+		var errs []error
+		for _, ip := range ips {
+			conn, err := dial(ctx, network, net.JoinHostPort(ip.Unmap().String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		return nil, errors.Join(errs...)
+	}
+}
+
+// ParseProxyURL parses and validates a proxy URL for the tunnel connections.
+// Supported schemes are http (CONNECT) and socks5.
+func ParseProxyURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q (use http or socks5)", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("proxy URL %q has no host", raw)
+	}
+	return u, nil
+}
+
+// ParseBindAddr parses and validates the source IP for outgoing tunnel
+// connections. It must be assigned to one of this machine's interfaces.
+func ParseBindAddr(raw string) (net.IP, error) {
+	ip := net.ParseIP(raw)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid bind address %q (must be an IP address)", raw)
+	}
+	if ip.IsUnspecified() {
+		return nil, fmt.Errorf("invalid bind address %s (must be a specific interface address)", raw)
+	}
+
+	addrs, err := interfaceAddrs()
+	if err != nil {
+		return nil, fmt.Errorf("list interface addresses: %w", err)
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return ip, nil
+		}
+	}
+	return nil, fmt.Errorf("bind address %s is not assigned to any interface", raw)
+}
+
+// interfaceAddrs lists the local interface addresses, swapped in tests.
+var interfaceAddrs = net.InterfaceAddrs
+
+// bindDialer returns a dialer whose connections originate from ip.
+func bindDialer(ip net.IP, timeout time.Duration) *net.Dialer {
+	return &net.Dialer{Timeout: timeout, LocalAddr: &net.TCPAddr{IP: ip}}
+}
+
+// viaProxy returns a DialFunc that reaches its target through the proxy at u,
+// using forward to connect to the proxy itself.
+func viaProxy(u *url.URL, forward DialFunc) DialFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		switch u.Scheme {
+		case "http":
+			return dialHTTPConnect(ctx, forward, proxyAddr(u, "80"), address, u.User)
+		case "socks5":
+			return dialSOCKS5(ctx, forward, proxyAddr(u, "1080"), address)
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+		}
+	}
+}
+
+// proxyAddr returns host:port of the proxy, falling back to defaultPort.
+func proxyAddr(u *url.URL, defaultPort string) string {
+	port := u.Port()
+	if port == "" {
+		port = defaultPort
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// dialHTTPConnect opens a tunnel to target through an HTTP proxy using CONNECT.
+func dialHTTPConnect(ctx context.Context, forward DialFunc, proxy, target string, user *url.Userinfo) (net.Conn, error) {
+	conn, err := forward(ctx, "tcp", proxy)
+	if err != nil {
+		return nil, fmt.Errorf("dial proxy: %w", err)
+	}
+
+	// bound the handshake by the context deadline
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: target},
+		Host:   target,
+		Header: make(http.Header),
+	}
+	if user != nil {
+		password, _ := user.Password()
+		req.SetBasicAuth(user.Username(), password)
+		req.Header.Set("Proxy-Authorization", req.Header.Get("Authorization"))
+		req.Header.Del("Authorization")
+	}
+
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("write CONNECT: %w", err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("read CONNECT response: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT to %s failed: %s", target, resp.Status)
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+
+	// the server may already have sent data after the CONNECT response
+	return &bufferedConn{Conn: conn, r: br}, nil
+}
+
+// bufferedConn is a net.Conn whose reads drain a bufio.Reader first.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// dialSOCKS5 opens a tunnel to target through a SOCKS5 proxy (no auth).
+func dialSOCKS5(ctx context.Context, forward DialFunc, proxy, target string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port in %q", target)
+	}
+	if len(host) > 255 {
+		return nil, fmt.Errorf("host name too long: %s", host)
+	}
+
+	conn, err := forward(ctx, "tcp", proxy)
+	if err != nil {
+		return nil, fmt.Errorf("dial proxy: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if err := socks5Handshake(conn, host, port); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("socks5 proxy: %w", err)
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// socks5Handshake negotiates no-auth and issues a CONNECT for host:port (RFC 1928).
+func socks5Handshake(conn net.Conn, host string, port int) error {
+	// greeting: version 5, one method, "no authentication"
+	if _, err := conn.Write([]byte{5, 1, 0}); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 5 || reply[1] != 0 {
+		return errors.New("no acceptable authentication method")
+	}
+
+	// connect request, the proxy resolves the domain name
+	req := []byte{5, 1, 0, 3, byte(len(host))}
+	req = append(req, host...)
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	// reply: VER REP RSV ATYP, then the bound address we don't need
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return err
+	}
+	if head[1] != 0 {
+		return fmt.Errorf("connect failed with code %d", head[1])
+	}
+
+	var addrLen int
+	switch head[3] {
+	case 1: // IPv4
+		addrLen = net.IPv4len
+	case 4: // IPv6
+		addrLen = net.IPv6len
+	case 3: // domain name, prefixed with its length
+		l := make([]byte, 1)
+		if _, err := io.ReadFull(conn, l); err != nil {
+			return err
+		}
+		addrLen = int(l[0])
+	default:
+		return fmt.Errorf("unknown address type %d", head[3])
+	}
+
+	// skip bound address and port
+	_, err := io.ReadFull(conn, make([]byte, addrLen+2))
+	return err
+}
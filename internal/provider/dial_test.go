@@ -0,0 +1,468 @@
+package provider
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// echoServer starts a TCP server that echoes everything back and returns its address.
+func echoServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// connectProxy starts a minimal HTTP CONNECT proxy and returns its address
+// and a channel receiving each requested target.
+func connectProxy(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	targets := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				req, err := http.ReadRequest(br)
+				if err != nil || req.Method != http.MethodConnect {
+					return
+				}
+				targets <- req.Host
+
+				upstream, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
+					return
+				}
+				defer upstream.Close()
+				conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+
+				go io.Copy(upstream, br)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+	return ln.Addr().String(), targets
+}
+
+// socks5Proxy starts a minimal no-auth SOCKS5 proxy and returns its address
+// and a channel receiving each requested target.
+func socks5Proxy(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	targets := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				greeting := make([]byte, 3)
+				if _, err := io.ReadFull(conn, greeting); err != nil {
+					return
+				}
+				conn.Write([]byte{5, 0})
+
+				head := make([]byte, 5)
+				if _, err := io.ReadFull(conn, head); err != nil || head[3] != 3 {
+					return
+				}
+				rest := make([]byte, int(head[4])+2)
+				if _, err := io.ReadFull(conn, rest); err != nil {
+					return
+				}
+				host := string(rest[:head[4]])
+				port := binary.BigEndian.Uint16(rest[head[4]:])
+				target := net.JoinHostPort(host, strconv.Itoa(int(port)))
+				targets <- target
+
+				upstream, err := net.Dial("tcp", target)
+				if err != nil {
+					conn.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer upstream.Close()
+				conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+
+				go io.Copy(upstream, conn)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+	return ln.Addr().String(), targets
+}
+
+// assertEcho writes through conn and expects the same bytes back.
+func assertEcho(t *testing.T, conn net.Conn) {
+	t.Helper()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if string(buf) != "ping" {
+		t.Errorf("expected echo 'ping', got %q", buf)
+	}
+}
+
+// fakeResolver returns a resolver answering every A query with ip, and the
+// names it was asked for.
+func fakeResolver(t *testing.T, ip net.IP) (*net.Resolver, <-chan string) {
+	t.Helper()
+	names := make(chan string, 16)
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			client, server := net.Pipe()
+			t.Cleanup(func() { server.Close() })
+			go serveDNS(server, ip, names)
+			return client, nil
+		},
+	}, names
+}
+
+// serveDNS answers length-prefixed DNS queries on conn, as over TCP: an A
+// record with ip for A queries, no records for anything else.
+func serveDNS(conn net.Conn, ip net.IP, names chan<- string) {
+	defer conn.Close()
+	for {
+		var size uint16
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			return
+		}
+		query := make([]byte, size)
+		if _, err := io.ReadFull(conn, query); err != nil || len(query) < 12 {
+			return
+		}
+
+		// the question follows the 12 byte header: labels, type and class
+		var labels []string
+		end := 12
+		for end < len(query) && query[end] != 0 {
+			n := int(query[end])
+			labels = append(labels, string(query[end+1:end+1+n]))
+			end += 1 + n
+		}
+		question := query[12 : end+5]
+		qtype := binary.BigEndian.Uint16(question[len(question)-4:])
+		select {
+		case names <- strings.Join(labels, "."):
+		default:
+		}
+
+		answers := uint16(0)
+		if qtype == 1 {
+			answers = 1
+		}
+		resp := binary.BigEndian.AppendUint16(nil, binary.BigEndian.Uint16(query)) // ID
+		resp = append(resp, 0x81, 0x80)                                            // response, no error
+		resp = binary.BigEndian.AppendUint16(resp, 1)
+		resp = binary.BigEndian.AppendUint16(resp, answers)
+		resp = append(resp, 0, 0, 0, 0)
+		resp = append(resp, question...)
+		if answers > 0 {
+			// name pointer to the question, A, IN, TTL 60, 4 byte address
+			resp = append(resp, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+			resp = append(resp, ip.To4()...)
+		}
+
+		frame := binary.BigEndian.AppendUint16(nil, uint16(len(resp)))
+		if _, err := conn.Write(append(frame, resp...)); err != nil {
+			return
+		}
+	}
+}
+
+func TestParseDNSServer(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{"1.1.1.1", "1.1.1.1:53", false},
+		{"10.0.0.2:5353", "10.0.0.2:5353", false},
+		{"[2606:4700::1111]:53", "[2606:4700::1111]:53", false},
+		{"2606:4700::1111", "[2606:4700::1111]:53", false},
+		{"dns.example.com", "", true},
+		{"1.1.1.1:0", "", true},
+		{"1.1.1.1:dns", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := ParseDNSServer(tt.raw)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestWithResolver verifies tunnel server names are looked up with the
+// configured resolver and its answer is dialed
+func TestWithResolver(t *testing.T) {
+	target := echoServer(t)
+	_, port, _ := net.SplitHostPort(target)
+	resolver, names := fakeResolver(t, net.ParseIP("127.0.0.1"))
+
+	lt := NewLocalTunnel(nil, WithResolver(resolver, time.Second)).(*localTunnel)
+	lt.tunnelHost = "tunnel.example.test"
+	lt.tunnelPort, _ = strconv.Atoi(port)
+
+	conn, err := lt.dialTunnel()
+	if err != nil {
+		t.Fatalf("dialTunnel() failed: %v", err)
+	}
+	defer conn.Close()
+
+	if got := <-names; got != "tunnel.example.test" {
+		t.Errorf("expected the resolver to be asked for tunnel.example.test, got %q", got)
+	}
+	assertEcho(t, conn)
+
+	// the tunnel API request resolves through it too, nothing else knows
+	// the name
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer api.Close()
+	_, apiPort, _ := net.SplitHostPort(api.Listener.Addr().String())
+	lt.httpClient.Transport.(*http.Transport).Proxy = nil // ignore HTTP_PROXY
+	resp, err := lt.httpClient.Get("http://api.example.test:" + apiPort + "/")
+	if err != nil {
+		t.Fatalf("API request failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+// TestWithResolver_Timeout verifies a DNS server that never answers fails
+// the dial after the timeout with an error naming the host
+func TestWithResolver_Timeout(t *testing.T) {
+	silent := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+
+	lt := NewLocalTunnel(nil, WithResolver(silent, 50*time.Millisecond)).(*localTunnel)
+	lt.tunnelHost = "tunnel.example.test"
+	lt.tunnelPort = 4242
+
+	start := time.Now()
+	_, err := lt.dialTunnel()
+	if err == nil || !strings.Contains(err.Error(), "resolve tunnel.example.test: DNS lookup timed out after 50ms") {
+		t.Errorf("expected a DNS timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the lookup to give up after the timeout, took %v", elapsed)
+	}
+}
+
+func TestParseProxyURL(t *testing.T) {
+	tests := []struct {
+		raw     string
+		wantErr bool
+	}{
+		{"http://proxy.local:8080", false},
+		{"socks5://127.0.0.1:1080", false},
+		{"ftp://proxy.local", true},
+		{"http://", true},
+		{"://bad", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			_, err := ParseProxyURL(tt.raw)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestViaProxy(t *testing.T) {
+	target := echoServer(t)
+
+	httpAddr, httpTargets := connectProxy(t)
+	socksAddr, socksTargets := socks5Proxy(t)
+
+	tests := []struct {
+		name    string
+		proxy   string
+		targets <-chan string
+	}{
+		{"http CONNECT", "http://" + httpAddr, httpTargets},
+		{"socks5", "socks5://" + socksAddr, socksTargets},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := ParseProxyURL(tt.proxy)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			conn, err := viaProxy(u, defaultDial)(ctx, "tcp", target)
+			if err != nil {
+				t.Fatalf("dial via proxy failed: %v", err)
+			}
+			defer conn.Close()
+
+			if got := <-tt.targets; got != target {
+				t.Errorf("proxy asked for %s, want %s", got, target)
+			}
+			assertEcho(t, conn)
+		})
+	}
+}
+
+func TestParseBindAddr(t *testing.T) {
+	orig := interfaceAddrs
+	defer func() { interfaceAddrs = orig }()
+	interfaceAddrs = func() ([]net.Addr, error) {
+		return []net.Addr{
+			&net.IPNet{IP: net.ParseIP("10.1.2.3"), Mask: net.CIDRMask(24, 32)},
+			&net.IPNet{IP: net.ParseIP("fd00::5"), Mask: net.CIDRMask(64, 128)},
+		}, nil
+	}
+
+	tests := []struct {
+		raw     string
+		wantErr bool
+	}{
+		{"10.1.2.3", false},
+		{"fd00::5", false},
+		{"10.1.2.4", true},
+		{"0.0.0.0", true},
+		{"10.1.2.3:80", true},
+		{"eth0", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			ip, err := ParseBindAddr(tt.raw)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && ip.String() != tt.raw {
+				t.Errorf("expected %s, got %s", tt.raw, ip)
+			}
+		})
+	}
+}
+
+// TestWithBindAddr verifies tunnel, API and local connections leave from the bind address
+func TestWithBindAddr(t *testing.T) {
+	bind := net.ParseIP("127.0.0.2")
+	if probe, err := net.Listen("tcp", "127.0.0.2:0"); err != nil {
+		t.Skipf("127.0.0.2 not usable here: %v", err)
+	} else {
+		probe.Close()
+	}
+
+	lt := NewLocalTunnel(nil, WithBindAddr(bind), WithKeepAlive(0)).(*localTunnel)
+
+	if addr, ok := lt.localDialer().LocalAddr.(*net.TCPAddr); !ok || !addr.IP.Equal(bind) {
+		t.Errorf("expected local dialer bound to %s, got %v", bind, lt.localDialer().LocalAddr)
+	}
+
+	// tunnel server connection
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	accepted := make(chan net.Addr, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		accepted <- conn.RemoteAddr()
+		conn.Close()
+	}()
+
+	conn, err := lt.dial(context.Background(), "tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if got := (<-accepted).(*net.TCPAddr).IP; !got.Equal(bind) {
+		t.Errorf("expected tunnel connection from %s, got %s", bind, got)
+	}
+
+	// tunnel API request
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.RemoteAddr))
+	}))
+	defer api.Close()
+
+	resp, err := lt.httpClient.Get(api.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if host, _, _ := net.SplitHostPort(string(remote)); host != bind.String() {
+		t.Errorf("expected API request from %s, got %s", bind, remote)
+	}
+}
+
+// TestWithBindAddr_IPv6LocalDial verifies an IPv6 bind address leaves the IPv4 loopback dial alone
+func TestWithBindAddr_IPv6LocalDial(t *testing.T) {
+	lt := NewLocalTunnel(nil, WithBindAddr(net.ParseIP("::1"))).(*localTunnel)
+	if addr := lt.localDialer().LocalAddr; addr != nil {
+		t.Errorf("expected unbound local dialer, got %v", addr)
+	}
+}
@@ -0,0 +1,40 @@
+package provider
+
+import (
+	"net"
+	"time"
+)
+
+// idleConn is a net.Conn whose deadline moves timeout ahead on every Read
+// and Write, so it only expires once the connection saw no activity for
+// that long. A deadline covers both directions, so data flowing one way
+// also keeps a Read waiting for the other way alive.
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+// withIdleTimeout returns conn closing on timeout of inactivity instead of
+// a fixed deadline. A timeout <= 0 returns conn unchanged.
+func withIdleTimeout(conn net.Conn, timeout time.Duration) net.Conn {
+	if timeout <= 0 {
+		return conn
+	}
+	c := &idleConn{Conn: conn, timeout: timeout}
+	c.extend()
+	return c
+}
+
+func (c *idleConn) extend() {
+	_ = c.Conn.SetDeadline(time.Now().Add(c.timeout))
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	c.extend()
+	return c.Conn.Read(b)
+}
+
+func (c *idleConn) Write(b []byte) (int, error) {
+	c.extend()
+	return c.Conn.Write(b)
+}
@@ -2,13 +2,21 @@ package provider
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"maps"
 	"net"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/kernelshard/expose/internal/tunnel"
@@ -21,13 +29,39 @@ const (
 	// maximum concurrent connections allowed for us,
 	// override if tunnel api sends their limit
 	clientMaxConn = 10
+	// server max_conn_count values above this are treated as bogus
+	serverMaxConnLimit = 1000
 
-	httpClientTimeout    = 10 * time.Second
-	tcpDialTimeout       = 10 * time.Second
-	localDialTimeOut     = 4 * time.Second
-	proxyDeadlineTimeOut = 30 * time.Second
+	// tunnel API requests are retried on network errors and 5xx responses
+	apiMaxAttempts  = 3
+	apiRetryBackoff = 500 * time.Millisecond
+
+	// dropped pool connections are re-dialed with backoff, see redial
+	redialAttempts   = 5
+	redialBackoff    = time.Second
+	redialMaxBackoff = 30 * time.Second
+
+	httpClientTimeout = 10 * time.Second
+	tcpDialTimeout    = 10 * time.Second
+	localDialTimeOut  = 4 * time.Second
+
+	// a proxied request must reach the local server within
+	// proxyConnectTimeout, then ends once neither side sent anything for
+	// proxyIdleTimeout, so long-lived streams aren't cut off
+	proxyConnectTimeout = 5 * time.Second
+	proxyIdleTimeout    = 30 * time.Second
+
+	// Close waits this long for the connection handlers to exit
+	handlerExitTimeout = 2 * time.Second
 )
 
+// errTunnelConnClosed reports a pool connection the tunnel server closed.
+var errTunnelConnClosed = errors.New("tunnel server closed the connection")
+
+// errRequestRejected reports a request answered with 503 because the
+// request queue was full or it waited too long, see WithRequestQueue.
+var errRequestRejected = errors.New("request rejected")
+
 // localTunnel implements the Provider interface for localtunnel.me
 // It manages the lifecycle of a tunnel connection.
 // It maintains a pool of TCP connections to handle incoming requests.
@@ -39,15 +73,138 @@ type localTunnel struct {
 	tunnelHost     string
 	connected      bool
 	mu             sync.RWMutex
-	connections    []net.Conn // connection pool
+	connections    []net.Conn                 // connection pool
+	alive          atomic.Int32               // pool connections still being served
+	redialing      atomic.Int32               // dropped pool connections being re-dialed
+	handlers       map[chan struct{}]struct{} // handleConnection goroutines running, closed on exit, see Close
+	handlersMu     sync.Mutex
 	maxConnections int
 	ctx            context.Context
 	cancel         context.CancelFunc
 
 	// HTTP client for API calls, reusable
 	httpClient *http.Client
-	// api endpoint string, it's configurable for testing
+	// tunnel server API, see WithAPIEndpoint
 	serverAPIEndpoint string
+	// host the pool connects to, "" for the API endpoint's host
+	serverTCPHost string
+	// attempts and initial backoff of tunnel API requests, see WithAPIRetries
+	apiAttempts int
+	apiBackoff  time.Duration
+	// retries of the whole Connect sequence, see WithConnectRetries
+	connectRetries int
+	// delay before re-dialing a dropped pool connection, doubled per attempt
+	redialBackoff time.Duration
+	// inactivity after which a proxied request is given up
+	idleTimeout time.Duration
+	// grow the pool as requests arrive instead of opening it upfront, see WithOnDemand
+	onDemand bool
+	standby  atomic.Int32 // on-demand pool connections waiting for a request
+	growing  int          // on-demand pool connections being dialed, guarded by mu
+	// requested subdomain, empty lets the server pick a random one
+	subdomain string
+	// subdomains tried in order instead, see WithSubdomainCandidates
+	candidates []string
+	// extra query parameters sent with the tunnel request
+	queryParams url.Values
+	// onURLChange is called whenever publicURL is updated
+	onURLChange func(url string)
+
+	// dial opens the TCP connections to the tunnel server
+	dial DialFunc
+	// proxyURL routes the tunnel connections through an HTTP/SOCKS proxy
+	proxyURL *url.URL
+	// tlsConfig enables TLS on the tunnel connections when set
+	tlsConfig *tls.Config
+	// TLS server name of the tunnel connections, see WithTunnelSNI
+	sni string
+	// inflight limits concurrent proxied requests, nil means unlimited
+	inflight chan struct{}
+	// requests waiting for an inflight slot, nil means unbounded, and how
+	// long each may wait, see WithRequestQueue
+	queue        chan struct{}
+	queueTimeout time.Duration
+	// TCP keep-alive period of tunnel and local connections, <= 0 disables it
+	keepAlive time.Duration
+
+	bindAddr net.IP // source IP of outgoing connections, nil lets the OS pick
+	// looks up the tunnel server's host names, nil leaves it to the dialer,
+	// and how long each lookup may take, see WithResolver
+	resolver   *net.Resolver
+	dnsTimeout time.Duration
+	// logs API retries and connection lifecycle events, see tunnel.LogEvent
+	logger *slog.Logger
+	// bytes received from and sent back through the tunnel
+	traffic tunnel.ByteCounter
+}
+
+// LocalTunnelOption configures optional localTunnel behaviour.
+type LocalTunnelOption func(*localTunnel)
+
+// WithSubdomain requests a specific subdomain from the localtunnel server.
+func WithSubdomain(subdomain string) LocalTunnelOption {
+	return func(lt *localTunnel) {
+		lt.subdomain = subdomain
+	}
+}
+
+// WithSubdomainCandidates requests the first of candidates the localtunnel
+// server grants, for preferred names that are sometimes taken. A name is
+// taken when the server refuses it or hands out another one instead. The
+// server already opened a tunnel for a name it handed out, so when every
+// candidate is taken the last one handed out is used rather than failing.
+// Candidates replace WithSubdomain.
+func WithSubdomainCandidates(candidates ...string) LocalTunnelOption {
+	return func(lt *localTunnel) {
+		lt.candidates = candidates
+	}
+}
+
+// WithAPIEndpoint requests tunnels from the localtunnel server at endpoint,
+// e.g. a self-hosted one at "https://tunnel.example.com", instead of
+// localtunnel.me. The pool connects to the same host unless WithTunnelHost
+// says otherwise.
+func WithAPIEndpoint(endpoint string) LocalTunnelOption {
+	return func(lt *localTunnel) {
+		lt.serverAPIEndpoint = endpoint
+	}
+}
+
+// ParseAPIEndpoint validates the URL of a localtunnel server for
+// WithAPIEndpoint.
+func ParseAPIEndpoint(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid tunnel server URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported tunnel server scheme %q (use http or https)", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("tunnel server URL %q has no host", raw)
+	}
+	return raw, nil
+}
+
+// WithTunnelHost connects the pool to host, for servers whose tunnel
+// ports are served from another host than their API.
+func WithTunnelHost(host string) LocalTunnelOption {
+	return func(lt *localTunnel) {
+		lt.serverTCPHost = host
+	}
+}
+
+// WithQueryParams adds params to the tunnel request query, for servers
+// that accept options beyond ?new. Later calls add to earlier ones.
+func WithQueryParams(params url.Values) LocalTunnelOption {
+	return func(lt *localTunnel) {
+		if lt.queryParams == nil {
+			lt.queryParams = url.Values{}
+		}
+		for key, values := range params {
+			lt.queryParams[key] = append(lt.queryParams[key], values...)
+		}
+	}
 }
 
 // TunnelInfo is the response model from localtunnel server when establishing a tunnel.
@@ -58,46 +215,332 @@ type TunnelInfo struct {
 	MaxConn int    `json:"max_conn_count"`
 }
 
+// WithDialer replaces the dialer used for the tunnel server connections.
+func WithDialer(dial DialFunc) LocalTunnelOption {
+	return func(lt *localTunnel) {
+		if dial != nil {
+			lt.dial = dial
+		}
+	}
+}
+
+// WithBindAddr makes the tunnel API request, the tunnel server connections
+// and the local server connections originate from ip, for multi-homed
+// machines. See ParseBindAddr. A later WithDialer replaces the tunnel dialer.
+func WithBindAddr(ip net.IP) LocalTunnelOption {
+	return func(lt *localTunnel) {
+		lt.bindAddr = ip
+		if ip != nil {
+			lt.dial = bindDialer(ip, 0).DialContext
+		}
+	}
+}
+
+// WithResolver looks up the tunnel API and tunnel server host names with
+// resolver, see NewResolver, each lookup failing after timeout unless it is
+// <= 0. A nil resolver with a timeout bounds the system resolver. Through
+// WithTunnelProxy only the proxy's own name is looked up here.
+func WithResolver(resolver *net.Resolver, timeout time.Duration) LocalTunnelOption {
+	return func(lt *localTunnel) {
+		if resolver == nil && timeout > 0 {
+			resolver = net.DefaultResolver
+		}
+		lt.resolver, lt.dnsTimeout = resolver, timeout
+	}
+}
+
+// WithTunnelProxy routes the tunnel server connections through the
+// HTTP or SOCKS5 proxy at u, see ParseProxyURL.
+func WithTunnelProxy(u *url.URL) LocalTunnelOption {
+	return func(lt *localTunnel) {
+		lt.proxyURL = u
+	}
+}
+
+// WithTunnelTLS enables TLS on the tunnel server connections, for servers
+// that serve the TCP port over TLS. An empty ServerName defaults to the tunnel host.
+func WithTunnelTLS(cfg *tls.Config) LocalTunnelOption {
+	return func(lt *localTunnel) {
+		lt.tlsConfig = cfg
+	}
+}
+
+// WithTunnelSNI sends name as the TLS server name of the tunnel
+// connections, for servers fronting several domains, see ParseServerName.
+// It takes precedence over the ServerName of WithTunnelTLS and only
+// applies with it.
+func WithTunnelSNI(name string) LocalTunnelOption {
+	return func(lt *localTunnel) {
+		lt.sni = name
+	}
+}
+
+// ParseServerName validates a TLS server name for WithTunnelSNI: a DNS
+// hostname, IP addresses aren't sent as SNI.
+func ParseServerName(raw string) (string, error) {
+	name := strings.ToLower(strings.TrimSuffix(raw, "."))
+	if net.ParseIP(name) != nil {
+		return "", fmt.Errorf("invalid TLS server name %q (must be a hostname, not an IP address)", raw)
+	}
+	if name == "" || len(name) > 253 {
+		return "", fmt.Errorf("invalid TLS server name %q", raw)
+	}
+	for label := range strings.SplitSeq(name, ".") {
+		if !validLabel(label) {
+			return "", fmt.Errorf("invalid TLS server name %q", raw)
+		}
+	}
+	return name, nil
+}
+
+// validLabel reports whether label is a valid DNS hostname label.
+func validLabel(label string) bool {
+	if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for _, c := range label {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// WithMaxConcurrency limits the number of requests proxied to the local
+// server at the same time; excess requests wait for a free slot.
+// Zero or negative means unlimited.
+func WithMaxConcurrency(n int) LocalTunnelOption {
+	return func(lt *localTunnel) {
+		if n > 0 {
+			lt.inflight = make(chan struct{}, n)
+		} else {
+			lt.inflight = nil
+		}
+	}
+}
+
+// WithRequestQueue bounds the requests waiting for a WithMaxConcurrency
+// slot to depth and the time each one waits to timeout. Requests that find
+// the queue full or time out are answered with 503 Service Unavailable.
+// Zero or negative values mean no limit.
+func WithRequestQueue(depth int, timeout time.Duration) LocalTunnelOption {
+	return func(lt *localTunnel) {
+		if depth > 0 {
+			lt.queue = make(chan struct{}, depth)
+		} else {
+			lt.queue = nil
+		}
+		lt.queueTimeout = max(timeout, 0)
+	}
+}
+
+// WithOnDemand opens a single tunnel connection upfront and another one
+// whenever a request takes the last waiting connection, up to the
+// server's limit, instead of opening the whole pool at once. The server
+// can only pass requests on over an open connection, so one always is.
+func WithOnDemand(enabled bool) LocalTunnelOption {
+	return func(lt *localTunnel) {
+		lt.onDemand = enabled
+	}
+}
+
+// connLimit returns the number of pool connections to open for the
+// server's max_conn_count, clamped to 1..clientMaxConn.
+func connLimit(serverMax int) int {
+	switch {
+	case serverMax == 0:
+		// server didn't specify, use our default
+		return clientMaxConn
+	case serverMax < 0 || serverMax > serverMaxConnLimit:
+		slog.Warn("ignoring invalid max_conn_count from tunnel server",
+			"max_conn_count", serverMax, "using", clientMaxConn)
+		return clientMaxConn
+	default:
+		// respect both server limit and our limit
+		return min(serverMax, clientMaxConn)
+	}
+}
+
+// WithLogger sets the logger for API retries and connection lifecycle
+// events such as a dropped pool connection.
+func WithLogger(logger *slog.Logger) LocalTunnelOption {
+	return func(lt *localTunnel) {
+		if logger != nil {
+			lt.logger = logger
+		}
+	}
+}
+
+// WithAPIRetries sets how many times the tunnel API request is attempted
+// when it fails with a network error or a 5xx response. Values below 1
+// mean a single attempt.
+func WithAPIRetries(attempts int) LocalTunnelOption {
+	return func(lt *localTunnel) {
+		lt.apiAttempts = attempts
+	}
+}
+
+// WithConnectRetries retries the whole Connect sequence, the tunnel API
+// request and opening the connection pool, up to retries times with
+// backoff. It replaces the API request retries of WithAPIRetries, so
+// retries bounds the total attempts. The final error lists every attempt.
+// Zero keeps the default: only the API request is retried.
+func WithConnectRetries(retries int) LocalTunnelOption {
+	return func(lt *localTunnel) {
+		lt.connectRetries = retries
+	}
+}
+
+// WithKeepAlive sets the TCP keep-alive period of the tunnel server and
+// local server connections. Zero or negative disables keep-alive.
+func WithKeepAlive(period time.Duration) LocalTunnelOption {
+	return func(lt *localTunnel) {
+		lt.keepAlive = period
+	}
+}
+
+// keepAliveDial returns a DialFunc that sets keep-alive on the connections
+// opened by dial, before any proxy handshake or TLS wraps them.
+func keepAliveDial(dial DialFunc, period time.Duration) DialFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		if err := tunnel.SetKeepAlive(conn, period); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("set keep-alive: %w", err)
+		}
+		return conn, nil
+	}
+}
+
 // NewLocalTunnel creates a new localTunnel provider instance.
-func NewLocalTunnel(httpClient *http.Client) tunnel.Provider {
-	if httpClient == nil {
+func NewLocalTunnel(httpClient *http.Client, opts ...LocalTunnelOption) tunnel.Provider {
+	ownClient := httpClient == nil
+	if ownClient {
 		httpClient = &http.Client{Timeout: httpClientTimeout}
 	}
 
-	return &localTunnel{
+	lt := &localTunnel{
 		connections:       make([]net.Conn, 0, clientMaxConn),
 		httpClient:        httpClient,
 		serverAPIEndpoint: localtunnelAPI,
+		dial:              defaultDial,
+		keepAlive:         tunnel.DefaultKeepAlive,
+		apiAttempts:       apiMaxAttempts,
+		apiBackoff:        apiRetryBackoff,
+		redialBackoff:     redialBackoff,
+		idleTimeout:       proxyIdleTimeout,
+		logger:            slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(lt)
+	}
+
+	// the API request leaves from the bind address and uses the resolver
+	// too, unless the caller brought their own client
+	if ownClient && (lt.bindAddr != nil || lt.resolver != nil) {
+		apiDial := (&net.Dialer{Timeout: tcpDialTimeout}).DialContext
+		if lt.bindAddr != nil {
+			apiDial = bindDialer(lt.bindAddr, tcpDialTimeout).DialContext
+		}
+		if lt.resolver != nil {
+			apiDial = resolvingDial(lt.resolver, lt.dnsTimeout, apiDial)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = apiDial
+		lt.httpClient.Transport = transport
+	}
+
+	// the connect retries own retrying, attempts don't multiply
+	if lt.connectRetries > 0 {
+		lt.apiAttempts = 1
 	}
+
+	// keep-alive applies to the raw TCP connection, the proxy dials through it
+	lt.dial = keepAliveDial(lt.dial, lt.keepAlive)
+
+	// names are resolved before dialing, with a proxy only the proxy's own
+	if lt.resolver != nil {
+		lt.dial = resolvingDial(lt.resolver, lt.dnsTimeout, lt.dial)
+	}
+
+	// the proxy wraps whichever dialer was configured
+	if lt.proxyURL != nil {
+		lt.dial = viaProxy(lt.proxyURL, lt.dial)
+	}
+	return lt
 }
 
-// Connect establishes tunnel to localtunnel.me
+// Connect establishes tunnel to localtunnel.me, retrying the whole
+// sequence as configured by WithConnectRetries.
 func (lt *localTunnel) Connect(ctx context.Context, localPort int) (string, error) {
 	lt.mu.Lock()
 	lt.localPort = localPort
-	lt.ctx, lt.cancel = context.WithCancel(ctx)
 	lt.mu.Unlock()
 
+	var failures []error
+	backoff := lt.apiBackoff
+	for attempt := 1; ; attempt++ {
+		url, err := lt.connectOnce(ctx)
+		if err == nil {
+			return url, nil
+		}
+		failures = append(failures, err)
+
+		var permanent permanentError
+		if attempt > lt.connectRetries || errors.As(err, &permanent) || ctx.Err() != nil {
+			if len(failures) == 1 {
+				return "", err
+			}
+			return "", &connectError{attempts: failures}
+		}
+
+		lt.logger.Warn("connecting the tunnel failed, retrying",
+			"attempt", attempt,
+			"max_attempts", lt.connectRetries+1,
+			"backoff", backoff,
+			"err", err,
+		)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return "", &connectError{attempts: append(failures, ctx.Err())}
+		}
+		backoff *= 2
+	}
+}
+
+// connectOnce requests a tunnel and opens its connection pool.
+func (lt *localTunnel) connectOnce(ctx context.Context) (_ string, err error) {
+	connCtx, cancel := context.WithCancel(ctx)
+	lt.mu.Lock()
+	lt.ctx, lt.cancel = connCtx, cancel
+	lt.mu.Unlock()
+	defer func() {
+		// stop the handlers of any pool connections that did open
+		if err != nil {
+			cancel()
+		}
+	}()
+
 	// Step 1: Request tunnel from the localtunnel.me
 	info, err := lt.requestTunnel(ctx)
 	if err != nil {
 		return "", fmt.Errorf("failed to request tunnel: %w", err)
 	}
 
+	// don't dial whatever a misbehaving server hands us
+	if info.Port < 1 || info.Port > 65535 {
+		return "", permanentError{fmt.Errorf("tunnel server returned invalid port %d", info.Port)}
+	}
+
 	lt.mu.Lock()
 	lt.publicURL = info.URL
 	lt.tunnelPort = info.Port
-	lt.tunnelHost = localTunnelTCPHost
-
-	// set maxConnections allowed to open
-	if info.MaxConn > 0 {
-		// Take minimum: respect both server limit and our limit
-		lt.maxConnections = min(info.MaxConn, clientMaxConn)
-	} else {
-		// Server didn't specify, use our default
-		lt.maxConnections = clientMaxConn
-	}
-
+	lt.tunnelHost = lt.tcpHost()
+	lt.maxConnections = connLimit(info.MaxConn)
 	lt.mu.Unlock()
 
 	// Step 2: Open TCP connection pool which
@@ -111,52 +554,245 @@ func (lt *localTunnel) Connect(ctx context.Context, localPort int) (string, erro
 
 	lt.mu.Lock()
 	lt.connected = true
+	notify := lt.onURLChange
 	lt.mu.Unlock()
 
+	if notify != nil {
+		notify(info.URL)
+	}
+
 	return info.URL, nil
+}
+
+// permanentError is a connect failure retrying won't fix, e.g. a 4xx
+// response from the tunnel API.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// connectError lists the failures of every attempt of a retried Connect.
+type connectError struct {
+	attempts []error
+}
+
+func (e *connectError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "giving up after %d attempts", len(e.attempts))
+	for i, err := range e.attempts {
+		fmt.Fprintf(&b, "; attempt %d: %v", i+1, err)
+	}
+	return b.String()
+}
+
+func (e *connectError) Unwrap() []error { return e.attempts }
+
+// Reconnect re-dials the connection pool to the tunnel the server already
+// assigned, keeping the public URL, and forwards it to localPort. When the
+// server no longer accepts connections for it, or none was assigned yet,
+// a new tunnel is requested like Connect does.
+func (lt *localTunnel) Reconnect(ctx context.Context, localPort int) (string, error) {
+	lt.mu.Lock()
+	if lt.cancel != nil {
+		lt.cancel()
+	}
+	lt.closeAllConnections()
+	lt.connected = false
+	lt.localPort = localPort
+	publicURL, assigned := lt.publicURL, lt.tunnelPort != 0
+	lt.ctx, lt.cancel = context.WithCancel(ctx)
+	lt.mu.Unlock()
+
+	if !assigned {
+		return lt.Connect(ctx, localPort)
+	}
 
+	if err := lt.openConnections(); err != nil {
+		lt.logger.Debug("re-dialing tunnel pool failed, requesting a new tunnel", "err", err)
+		// stop the handlers of the connections that did open
+		lt.mu.Lock()
+		lt.cancel()
+		lt.mu.Unlock()
+		return lt.Connect(ctx, localPort)
+	}
+
+	lt.mu.Lock()
+	lt.connected = true
+	lt.mu.Unlock()
+	return publicURL, nil
+}
+
+// OnURLChange registers fn to be called whenever the public URL changes.
+func (lt *localTunnel) OnURLChange(fn func(url string)) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	lt.onURLChange = fn
+}
+
+// tcpHost returns the host the pool connects to, see WithTunnelHost.
+func (lt *localTunnel) tcpHost() string {
+	if lt.serverTCPHost != "" {
+		return lt.serverTCPHost
+	}
+	if u, err := url.Parse(lt.serverAPIEndpoint); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return localTunnelTCPHost
 }
 
 // requestTunnel request a tunnel from localtunnel.me API and returns the TunnelInfo.
-// we make an HTTP GET request to localtunnel.me/?new
+// we make an HTTP GET request to localtunnel.me/?new, or localtunnel.me/<subdomain>
+// when a specific subdomain is requested.
 // localtunnel.me opens a tcp port for us and responds with the port
 // and url info(to be used for accessing the local server)
 func (lt *localTunnel) requestTunnel(ctx context.Context) (*TunnelInfo, error) {
-	localTunnelReqURL := lt.serverAPIEndpoint + "/?new"
+	if len(lt.candidates) == 0 {
+		return lt.requestSubdomain(ctx, lt.subdomain)
+	}
+
+	// only a refusal moves on to the next name, other failures end the search
+	var assigned *TunnelInfo
+	for i, name := range lt.candidates {
+		info, err := lt.requestSubdomain(ctx, name)
+		var permanent permanentError
+		if err != nil && !errors.As(err, &permanent) {
+			return nil, err
+		}
+		if err == nil && (info.ID == "" || strings.EqualFold(info.ID, name)) {
+			return info, nil
+		}
+		if err == nil {
+			assigned = info
+			err = fmt.Errorf("server assigned %q instead", info.ID)
+		}
+		if i < len(lt.candidates)-1 {
+			lt.logger.Info("subdomain taken, trying the next one",
+				"subdomain", name,
+				"next", lt.candidates[i+1],
+				"err", err,
+			)
+		}
+	}
+	if assigned != nil {
+		lt.logger.Warn("subdomains all taken, using the one the server assigned",
+			"subdomains", strings.Join(lt.candidates, ", "),
+			"subdomain", assigned.ID,
+		)
+		return assigned, nil
+	}
+	return nil, permanentError{fmt.Errorf("subdomains %s are all taken", strings.Join(lt.candidates, ", "))}
+}
+
+// requestSubdomain requests a tunnel on subdomain, or a random one when it
+// is empty, retrying transient failures.
+func (lt *localTunnel) requestSubdomain(ctx context.Context, subdomain string) (*TunnelInfo, error) {
+	attempts := max(lt.apiAttempts, 1)
+	backoff := lt.apiBackoff
+
+	for attempt := 1; ; attempt++ {
+		info, retry, err := lt.requestTunnelOnce(ctx, subdomain)
+		if err == nil {
+			return info, nil
+		}
+		if !retry {
+			return nil, permanentError{err}
+		}
+		if attempt >= attempts || ctx.Err() != nil {
+			return nil, err
+		}
+
+		lt.logger.Warn("tunnel API request failed, retrying",
+			"attempt", attempt,
+			"max_attempts", attempts,
+			"backoff", backoff,
+			"err", err,
+		)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// requestTunnelOnce asks the server for a new tunnel. retry reports whether
+// the failure is transient: a network error or a 5xx response.
+func (lt *localTunnel) requestTunnelOnce(ctx context.Context, subdomain string) (info *TunnelInfo, retry bool, err error) {
+	localTunnelReqURL, err := lt.tunnelRequestURL(subdomain)
+	if err != nil {
+		return nil, false, err
+	}
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, localTunnelReqURL, nil)
 
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	// Perform the HTTP request to localtunnel.me
 	resp, err := lt.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, true, err
 	}
 	defer resp.Body.Close()
 
 	// Check for non-200 status codes
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("status %d:%s", resp.StatusCode, string(body))
+		return nil, resp.StatusCode >= 500, fmt.Errorf("status %d:%s", resp.StatusCode, string(body))
 	}
 
 	// decode response body to TunnelInfo
-	var info TunnelInfo
-	err = json.NewDecoder(resp.Body).Decode(&info)
+	info = &TunnelInfo{}
+	err = json.NewDecoder(resp.Body).Decode(info)
 	if err != nil {
-		return nil, fmt.Errorf("decode error: %w", err)
+		return nil, false, fmt.Errorf("decode error: %w", err)
+	}
+	// the request URL may carry query parameters, only the answer is logged
+	lt.logger.Debug("tunnel API response",
+		"id", info.ID,
+		"url", info.URL,
+		"port", info.Port,
+		"max_conn_count", info.MaxConn,
+	)
+	return info, false, nil
+}
+
+// tunnelRequestURL builds the tunnel request URL: <endpoint>/?new, or
+// <endpoint>/<subdomain> when one is given, followed by queryParams.
+func (lt *localTunnel) tunnelRequestURL(subdomain string) (string, error) {
+	u, err := url.Parse(lt.serverAPIEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid API endpoint: %w", err)
+	}
+
+	// the subdomain is a single segment, a "/" in it must stay escaped
+	u.RawPath = strings.TrimSuffix(u.EscapedPath(), "/") + "/" + url.PathEscape(subdomain)
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + subdomain
+
+	var query []string
+	if subdomain == "" {
+		// the server only checks the key is present, keep the bare form
+		query = append(query, "new")
+	}
+	if len(lt.queryParams) > 0 {
+		query = append(query, lt.queryParams.Encode())
 	}
-	return &info, nil
+	u.RawQuery = strings.Join(query, "&")
+	return u.String(), nil
 }
 
-// openConnections opens a pool of TCP connections to the localtunnel server.
+// openConnections opens a pool of TCP connections to the localtunnel
+// server, only the first one with WithOnDemand, see growPool.
 func (lt *localTunnel) openConnections() error {
 	lt.mu.Lock()
 	defer lt.mu.Unlock()
 
-	for i := 0; i < lt.maxConnections; i++ {
+	size := lt.maxConnections
+	if lt.onDemand {
+		size = 1
+	}
+	for i := 0; i < size; i++ {
 		// create tunnel connection to the upstream server & store in pool
 		// each connection will handle incoming requests
 		conn, err := lt.dialTunnel()
@@ -170,23 +806,72 @@ func (lt *localTunnel) openConnections() error {
 		lt.connections = append(lt.connections, conn)
 
 		// Start handling this connection
-		go lt.handleConnection(conn)
+		lt.alive.Add(1)
+		lt.goHandleConnection(lt.ctx, conn)
 	}
 
 	return nil
 }
 
-// dialTunnel creates a single TCP connection to the localtunnel server.
+// dialTunnel creates a single TCP connection to the localtunnel server,
+// through the configured proxy and with TLS when enabled.
 func (lt *localTunnel) dialTunnel() (net.Conn, error) {
-	address := net.JoinHostPort(lt.tunnelHost, strconv.Itoa(lt.tunnelPort)) //IPv6 safe
-	conn, err := net.DialTimeout("tcp", address, localDialTimeOut)
+	parent := lt.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	return lt.dialTunnelServer(parent, lt.tunnelHost, lt.tunnelPort)
+}
 
+// dialTunnelServer is dialTunnel for an explicit server, so it can run
+// without holding mu.
+func (lt *localTunnel) dialTunnelServer(parent context.Context, host string, port int) (net.Conn, error) {
+	address := net.JoinHostPort(host, strconv.Itoa(port)) //IPv6 safe
+	start := time.Now()
+	conn, err := lt.dialTunnelAddr(parent, host, address)
 	if err != nil {
+		lt.logger.Debug("tunnel connection failed", "address", address, "elapsed", time.Since(start), "err", err)
 		return nil, err
 	}
+	lt.logger.Debug("tunnel connection opened", "address", address, "local", conn.LocalAddr(), "elapsed", time.Since(start))
 	return conn, nil
 }
 
+// dialTunnelAddr opens the connection of dialTunnelServer to address,
+// with TLS for host when enabled.
+func (lt *localTunnel) dialTunnelAddr(parent context.Context, host, address string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(parent, localDialTimeOut)
+	defer cancel()
+
+	dial := lt.dial
+	if dial == nil {
+		dial = defaultDial
+	}
+
+	conn, err := dial(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	if lt.tlsConfig == nil {
+		return conn, nil
+	}
+
+	cfg := lt.tlsConfig.Clone()
+	if lt.sni != "" {
+		cfg.ServerName = lt.sni
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("tls handshake: %w", err)
+	}
+	return tlsConn, nil
+}
+
 // closeAllConnections closes all existing TCP connections
 func (lt *localTunnel) closeAllConnections() {
 	for _, conn := range lt.connections {
@@ -198,46 +883,294 @@ func (lt *localTunnel) closeAllConnections() {
 	lt.connections = lt.connections[:0]
 }
 
-// handleConnection processes traffic from one tunnel connection
-func (lt *localTunnel) handleConnection(tunnelConn net.Conn) {
-	defer tunnelConn.Close()
+// goHandleConnection runs handleConnection in a goroutine tracked in
+// handlers, so Close can wait for it to exit.
+func (lt *localTunnel) goHandleConnection(ctx context.Context, tunnelConn net.Conn) {
+	done := make(chan struct{})
+	lt.handlersMu.Lock()
+	if lt.handlers == nil {
+		lt.handlers = make(map[chan struct{}]struct{})
+	}
+	lt.handlers[done] = struct{}{}
+	lt.handlersMu.Unlock()
+
+	go func() {
+		defer func() {
+			lt.handlersMu.Lock()
+			delete(lt.handlers, done)
+			lt.handlersMu.Unlock()
+			close(done)
+		}()
+		lt.handleConnection(ctx, tunnelConn)
+	}()
+}
+
+// handleConnection serves one pool connection until ctx is done. When the
+// connection drops it is re-dialed, see redial, so the pool heals itself
+// after the server closes idle connections.
+func (lt *localTunnel) handleConnection(ctx context.Context, tunnelConn net.Conn) {
+	for tunnelConn != nil {
+		err := lt.serveConnection(ctx, tunnelConn)
+		tunnelConn.Close()
+		alive := lt.alive.Add(-1)
+		lt.logger.Debug("tunnel connection closed", "local", tunnelConn.LocalAddr(), "alive", alive, "err", err)
+		if err == nil {
+			return // Shutting down
+		}
+
+		// a 503 closes the client's connection, the tunnel is fine:
+		// replace the connection at once, without a drop or a backoff
+		if errors.Is(err, errRequestRejected) {
+			lt.redialing.Add(1)
+			next := lt.replaceRejected(ctx, tunnelConn)
+			lt.redialing.Add(-1)
+			if next != nil {
+				tunnelConn = next
+				continue
+			}
+		}
+
+		tunnel.LogEvent(lt.logger, lt.Name(), tunnel.EventDropped, "err", err, "alive", alive)
+		lt.redialing.Add(1)
+		tunnelConn = lt.redial(ctx, tunnelConn)
+		lt.redialing.Add(-1)
+	}
+
+	// the tunnel counts as disconnected once the last pool connection is
+	// gone for good, so a supervisor can reconnect it
+	lt.mu.Lock()
+	if ctx.Err() == nil && lt.alive.Load() == 0 && lt.redialing.Load() == 0 {
+		lt.connected = false
+	}
+	lt.mu.Unlock()
+}
 
+// serveConnection proxies requests arriving on tunnelConn. It returns nil
+// once ctx is done and the error otherwise.
+func (lt *localTunnel) serveConnection(ctx context.Context, tunnelConn net.Conn) error {
+	// each proxyRequest blocks until a request arrives, and Close or
+	// Reconnect end that wait by cancelling ctx
 	for {
-		select {
-		// run until context is done means user does Ctrl+C or Close() is called
-		case <-lt.ctx.Done():
-			return
-		default:
-			// Read request from tunnel
-			// Forward to localhost
-			// Write response back
-			// TODO: Use connection pool instead of dialing on every request
-			if err := lt.proxyRequest(tunnelConn); err != nil {
-				if lt.ctx.Err() != nil {
-					return // Shutting down
-				}
-				// Connection closed or error, exit this handler
-				fmt.Printf("[localtunnel] connection error: %v\n", err)
-				return
+		conn, done := tunnelConn, func() {}
+		if lt.onDemand {
+			conn, done = lt.standbyConn(ctx, tunnelConn)
+		}
+		err := lt.proxyRequest(ctx, conn)
+		done()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// standbyConn counts tunnelConn as waiting for a request until the
+// returned conn reads the first bytes of one or done is called. When the
+// last waiting connection takes a request, the pool grows, see growPool.
+func (lt *localTunnel) standbyConn(ctx context.Context, tunnelConn net.Conn) (net.Conn, func()) {
+	lt.standby.Add(1)
+	var once sync.Once
+	conn := &notifyReadConn{Conn: tunnelConn, onRead: func() {
+		once.Do(func() {
+			if lt.standby.Add(-1) == 0 {
+				go lt.growPool(ctx)
 			}
+		})
+	}}
+	return conn, func() {
+		once.Do(func() { lt.standby.Add(-1) })
+	}
+}
+
+// growPool opens one more pool connection, unless the pool is full.
+func (lt *localTunnel) growPool(ctx context.Context) {
+	lt.mu.Lock()
+	if ctx.Err() != nil || len(lt.connections)+lt.growing >= lt.maxConnections {
+		lt.mu.Unlock()
+		return
+	}
+	lt.growing++
+	host, port := lt.tunnelHost, lt.tunnelPort
+	lt.mu.Unlock()
+
+	conn, err := lt.dialTunnelServer(ctx, host, port)
+
+	lt.mu.Lock()
+	lt.growing--
+	if err != nil || ctx.Err() != nil {
+		lt.mu.Unlock()
+		if conn != nil {
+			conn.Close()
+		}
+		lt.logger.Debug("growing tunnel pool failed", "err", err)
+		return
+	}
+	lt.connections = append(lt.connections, conn)
+	size, limit := len(lt.connections), lt.maxConnections
+	lt.alive.Add(1)
+	lt.mu.Unlock()
+
+	lt.logger.Debug("opened on-demand tunnel connection", "size", size, "max", limit)
+	lt.goHandleConnection(ctx, conn)
+}
+
+// notifyReadConn calls onRead whenever a Read returns data.
+type notifyReadConn struct {
+	net.Conn
+	onRead func()
+}
+
+func (c *notifyReadConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.onRead()
+	}
+	return n, err
+}
+
+// redial replaces the dropped pool connection old with a new one to the
+// tunnel server, retrying with backoff. It returns nil once ctx is done
+// or every attempt failed.
+func (lt *localTunnel) redial(ctx context.Context, old net.Conn) net.Conn {
+	lt.mu.RLock()
+	host, port, size := lt.tunnelHost, lt.tunnelPort, lt.maxConnections
+	lt.mu.RUnlock()
+
+	backoff := lt.redialBackoff
+	for attempt := 1; attempt <= redialAttempts; attempt++ {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
 		}
+		backoff = min(backoff*2, redialMaxBackoff)
+
+		conn, err := lt.dialTunnelServer(ctx, host, port)
+		if err != nil {
+			lt.logger.Debug("re-dialing tunnel connection failed",
+				"attempt", attempt,
+				"max_attempts", redialAttempts,
+				"err", err,
+			)
+			continue
+		}
+
+		alive, ok := lt.swapConn(ctx, old, conn)
+		if !ok {
+			return nil
+		}
+		tunnel.LogEvent(lt.logger, lt.Name(), tunnel.EventPoolReplenished, "alive", alive, "size", size)
+		return conn
+	}
+	return nil
+}
+
+// replaceRejected dials the replacement of old, which was closed after a
+// request was rejected, see WithRequestQueue. It returns nil when ctx is
+// done or the dial failed, redial takes over then.
+func (lt *localTunnel) replaceRejected(ctx context.Context, old net.Conn) net.Conn {
+	lt.mu.RLock()
+	host, port := lt.tunnelHost, lt.tunnelPort
+	lt.mu.RUnlock()
+
+	conn, err := lt.dialTunnelServer(ctx, host, port)
+	if err != nil {
+		return nil
+	}
+	if _, ok := lt.swapConn(ctx, old, conn); !ok {
+		return nil
+	}
+	return conn
+}
+
+// swapConn puts conn in old's place in the pool and returns the pool
+// connections alive. Close may have run meanwhile and closed what's in the
+// pool, then conn is closed too and ok is false.
+func (lt *localTunnel) swapConn(ctx context.Context, old, conn net.Conn) (alive int32, ok bool) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	if ctx.Err() != nil {
+		conn.Close()
+		return 0, false
 	}
+	if i := slices.Index(lt.connections, old); i >= 0 {
+		lt.connections[i] = conn
+	} else {
+		lt.connections = append(lt.connections, conn)
+	}
+	return lt.alive.Add(1), true
+}
+
+// localDialer returns the dialer for the local server. The server is
+// reached over IPv4 loopback, so only an IPv4 bind address applies.
+func (lt *localTunnel) localDialer() *net.Dialer {
+	if lt.bindAddr != nil && lt.bindAddr.To4() != nil {
+		return bindDialer(lt.bindAddr, proxyConnectTimeout)
+	}
+	return &net.Dialer{Timeout: proxyConnectTimeout}
 }
 
-// proxyRequest forwards data between the tunnel connection and the local server.
-func (lt *localTunnel) proxyRequest(tunnelConn net.Conn) error {
+// proxyRequest waits for a request on the tunnel connection, then forwards
+// data between it and the local server. ctx is the pool's, cancelled once
+// Close or Reconnect retires it.
+func (lt *localTunnel) proxyRequest(ctx context.Context, tunnelConn net.Conn) error {
+	// reads from the tunnel are bytes in, writes to it bytes out
+	tunnelConn = lt.traffic.Conn(tunnelConn)
+
+	head, err := readRequestHead(ctx, tunnelConn)
+	if err != nil {
+		return err
+	}
+
+	// wait for a free slot before touching the local server
+	if lt.inflight != nil {
+		if err := lt.acquireSlot(ctx); err != nil {
+			if errors.Is(err, errRequestRejected) {
+				_ = writeUnavailable(tunnelConn, err)
+			}
+			return err
+		}
+		defer func() { <-lt.inflight }()
+	}
+
+	lt.mu.RLock()
+	localPort := lt.localPort
+	lt.mu.RUnlock()
+
 	// connect to local server
-	localAddr := fmt.Sprintf("127.0.0.1:%d", lt.localPort)
-	localConn, err := net.DialTimeout("tcp", localAddr, 5*time.Second)
+	start := time.Now()
+	localAddr := net.JoinHostPort("127.0.0.1", strconv.Itoa(localPort))
+	localConn, err := lt.localDialer().Dial("tcp", localAddr)
 	if err != nil {
-		return fmt.Errorf("local dial failed: %w", err)
+		lt.logger.Debug("proxied request failed", "local", localAddr, "err", err)
+		return fmt.Errorf("%w: %w", tunnel.ErrLocalUnreachable, err)
 	}
 	defer localConn.Close()
+	lt.logger.Debug("proxying request", "local", localAddr, "tunnel", tunnelConn.LocalAddr())
+	defer func() {
+		lt.logger.Debug("proxied request done", "local", localAddr, "duration", time.Since(start))
+	}()
+	_ = tunnel.SetKeepAlive(localConn, lt.keepAlive)
 
-	// Set deadlines, it helps to avoid hanging connections
-	// e.g: if either side doesn't respond in time, the copy will end
-	_ = tunnelConn.SetDeadline(time.Now().Add(proxyDeadlineTimeOut))
-	_ = localConn.SetDeadline(time.Now().Add(proxyDeadlineTimeOut))
+	// Close retires the pool, closing both sides ends both copies at once
+	// instead of leaving them to the idle timeout
+	closeLocal, closeTunnel := localConn.Close, tunnelConn.Close
+	stop := context.AfterFunc(ctx, func() {
+		_ = closeLocal()
+		_ = closeTunnel()
+	})
+	defer stop()
+
+	// Idle deadlines avoid hanging connections: once neither side sent
+	// anything in time the copy ends, while active streams keep going
+	tunnelConn = withIdleTimeout(tunnelConn, lt.idleTimeout)
+	localConn = withIdleTimeout(localConn, lt.idleTimeout)
+
+	if _, err := localConn.Write(head); err != nil {
+		return fmt.Errorf("%w: %w", tunnel.ErrLocalUnreachable, err)
+	}
 
 	// Start bidirectional copy
 	// mental model: copy(blocking ops) the data from tunnel to local and
@@ -257,24 +1190,129 @@ func (lt *localTunnel) proxyRequest(tunnelConn net.Conn) error {
 
 	wg.Wait()
 	return nil
+}
+
+// acquireSlot takes an inflight slot, queueing behind the requests already
+// waiting for one; channel senders are served in order. It fails with
+// errRequestRejected when the queue is full or the wait times out.
+func (lt *localTunnel) acquireSlot(ctx context.Context) error {
+	select {
+	case lt.inflight <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if lt.queue != nil {
+		select {
+		case lt.queue <- struct{}{}:
+			defer func() { <-lt.queue }()
+		default:
+			return fmt.Errorf("%w: request queue is full (%d waiting)", errRequestRejected, cap(lt.queue))
+		}
+	}
+
+	var timeout <-chan time.Time
+	if lt.queueTimeout > 0 {
+		timer := time.NewTimer(lt.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case lt.inflight <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timeout:
+		return fmt.Errorf("%w: no free slot within %s", errRequestRejected, lt.queueTimeout)
+	}
+}
 
+// writeUnavailable answers the request on tunnelConn with 503. The caller
+// gives up the connection afterwards, the rest of the request is unread.
+func writeUnavailable(tunnelConn net.Conn, reason error) error {
+	body := "Service Unavailable: " + reason.Error() + "\n"
+	_, err := fmt.Fprintf(tunnelConn, "HTTP/1.1 503 Service Unavailable\r\n"+
+		"Content-Type: text/plain; charset=utf-8\r\n"+
+		"Content-Length: %d\r\n"+
+		"Connection: close\r\n\r\n%s", len(body), body)
+	return err
 }
 
-// Close terminates the tunnel
+// readRequestHead blocks until the first bytes of a request arrive on
+// tunnelConn or ctx is done, so the local server is only dialed for
+// actual traffic.
+func readRequestHead(ctx context.Context, tunnelConn net.Conn) ([]byte, error) {
+	// a previous request may have left an idle deadline behind
+	_ = tunnelConn.SetDeadline(time.Time{})
+	stop := context.AfterFunc(ctx, func() { _ = tunnelConn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	head := make([]byte, 4096)
+	for {
+		n, err := tunnelConn.Read(head)
+		if n > 0 {
+			return head[:n], nil
+		}
+		switch {
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case errors.Is(err, io.EOF):
+			return nil, errTunnelConnClosed
+		case err != nil:
+			return nil, err
+		}
+	}
+}
+
+// Close terminates the tunnel and waits up to handlerExitTimeout for the
+// connection handlers to exit.
 func (lt *localTunnel) Close() error {
 	lt.mu.Lock()
-	defer lt.mu.Unlock()
-
 	if lt.cancel != nil {
 		lt.cancel()
-
 	}
 
 	lt.closeAllConnections()
 	lt.connected = false
+	// the tunnel is given up, a later Reconnect requests a new one
+	lt.publicURL = ""
+	lt.tunnelPort = 0
+	lt.mu.Unlock()
+
+	// handlers take mu on their way out, so wait without holding it
+	if n := lt.waitHandlers(handlerExitTimeout); n > 0 {
+		lt.logger.Warn("tunnel connection handlers still running after close", "handlers", n)
+	}
 	return nil
 }
 
+// waitHandlers waits until the running handleConnection goroutines exited
+// or timeout passed, returning how many are still running.
+func (lt *localTunnel) waitHandlers(timeout time.Duration) int {
+	lt.handlersMu.Lock()
+	running := slices.Collect(maps.Keys(lt.handlers))
+	lt.handlersMu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for _, done := range running {
+		select {
+		case <-done:
+		case <-timer.C:
+			return lt.runningHandlers()
+		}
+	}
+	return 0
+}
+
+// runningHandlers returns how many handleConnection goroutines are running.
+func (lt *localTunnel) runningHandlers() int {
+	lt.handlersMu.Lock()
+	defer lt.handlersMu.Unlock()
+	return len(lt.handlers)
+}
+
 // IsConnected returns true if tunnel is active
 func (lt *localTunnel) IsConnected() bool {
 	lt.mu.RLock()
@@ -282,6 +1320,27 @@ func (lt *localTunnel) IsConnected() bool {
 	return lt.connected
 }
 
+// HealthCheck reports whether the tunnel still has pool connections to
+// serve requests on; each one closes for good on a connection error.
+func (lt *localTunnel) HealthCheck(ctx context.Context) error {
+	lt.mu.RLock()
+	connected, pool := lt.connected, lt.maxConnections
+	lt.mu.RUnlock()
+
+	if !connected {
+		return tunnel.ErrNotConnected
+	}
+	if lt.alive.Load() == 0 {
+		return fmt.Errorf("%w: all %d tunnel connections are closed", tunnel.ErrNotConnected, pool)
+	}
+	return nil
+}
+
+// Traffic returns the bytes received from and sent back through the tunnel.
+func (lt *localTunnel) Traffic() (in, out int64) {
+	return lt.traffic.BytesIn(), lt.traffic.BytesOut()
+}
+
 func (lt *localTunnel) PublicURL() string {
 	lt.mu.RLock()
 	defer lt.mu.RUnlock()
@@ -291,3 +1350,10 @@ func (lt *localTunnel) PublicURL() string {
 func (lt *localTunnel) Name() string {
 	return localTunnelProviderName
 }
+
+// Capabilities reports the optional features supported by localtunnel.
+func (lt *localTunnel) Capabilities() tunnel.Capabilities {
+	return tunnel.Capabilities{
+		SupportsSubdomain: true,
+	}
+}
@@ -1,14 +1,28 @@
 package provider
 
 import (
+	"bufio"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/kernelshard/expose/internal/tunnel"
 )
 
 func Test_NewLocalTunnel(t *testing.T) {
@@ -51,6 +65,86 @@ func Test_NewLocalTunnel(t *testing.T) {
 
 }
 
+// TestWithAPIEndpoint verifies the endpoint option and the tunnel host it
+// implies, which WithTunnelHost overrides
+func TestWithAPIEndpoint(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         []LocalTunnelOption
+		wantEndpoint string
+		wantHost     string
+	}{
+		{"default", nil, localtunnelAPI, localTunnelTCPHost},
+		{"self-hosted", []LocalTunnelOption{WithAPIEndpoint("https://lt.example.com:8443/api")}, "https://lt.example.com:8443/api", "lt.example.com"},
+		{"tunnel host", []LocalTunnelOption{WithAPIEndpoint("https://api.example.com"), WithTunnelHost("tcp.example.com")}, "https://api.example.com", "tcp.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lt := NewLocalTunnel(nil, tt.opts...).(*localTunnel)
+			if lt.serverAPIEndpoint != tt.wantEndpoint {
+				t.Errorf("expected endpoint %s, got %s", tt.wantEndpoint, lt.serverAPIEndpoint)
+			}
+			if got := lt.tcpHost(); got != tt.wantHost {
+				t.Errorf("expected tunnel host %s, got %s", tt.wantHost, got)
+			}
+		})
+	}
+}
+
+func TestParseAPIEndpoint(t *testing.T) {
+	tests := []struct {
+		raw     string
+		wantErr bool
+	}{
+		{"https://lt.example.com", false},
+		{"http://127.0.0.1:3000/api", false},
+		{"ftp://lt.example.com", true},
+		{"https://", true},
+		{"://bad", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			_, err := ParseAPIEndpoint(tt.raw)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestWithAPIEndpoint_Connect verifies Connect requests the tunnel from the
+// configured endpoint and dials the pool on the configured host
+func TestWithAPIEndpoint_Connect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":"abc","url":"https://abc.lt.example.com","port":4321,"max_conn_count":1}`)
+	}))
+	defer server.Close()
+
+	dialed := make(chan string, 1)
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		select {
+		case dialed <- address:
+		default:
+		}
+		return nil, errors.New("no tunnel server")
+	}
+	lt := NewLocalTunnel(server.Client(), WithAPIEndpoint(server.URL), WithTunnelHost("tcp.example.com"), WithDialer(dial)).(*localTunnel)
+	defer lt.Close()
+
+	// the pool fails to connect, the dial is all that matters
+	_, _ = lt.Connect(context.Background(), 3000)
+	select {
+	case addr := <-dialed:
+		if addr != "tcp.example.com:4321" {
+			t.Errorf("expected the pool to dial tcp.example.com:4321, got %s", addr)
+		}
+	default:
+		t.Fatal("expected the pool to dial the tunnel host")
+	}
+}
+
 // Test_requestTunnel tests the API call
 func Test_requestTunnel(t *testing.T) {
 	t.Run("successful API call", func(t *testing.T) {
@@ -80,10 +174,7 @@ func Test_requestTunnel(t *testing.T) {
 
 		defer server.Close()
 
-		lt := localTunnel{
-			httpClient:        server.Client(),
-			serverAPIEndpoint: server.URL,
-		}
+		lt := NewLocalTunnel(server.Client(), WithAPIEndpoint(server.URL)).(*localTunnel)
 
 		ctx := context.Background()
 		info, err := lt.requestTunnel(ctx)
@@ -113,7 +204,7 @@ func Test_requestTunnel(t *testing.T) {
 
 		defer server.Close()
 
-		lt := localTunnel{httpClient: http.DefaultClient, serverAPIEndpoint: server.URL}
+		lt := NewLocalTunnel(http.DefaultClient, WithAPIEndpoint(server.URL), WithAPIRetries(1)).(*localTunnel)
 
 		ctx := context.Background()
 		_, err := lt.requestTunnel(ctx)
@@ -134,10 +225,7 @@ func Test_requestTunnel(t *testing.T) {
 
 		defer server.Close()
 
-		lt := &localTunnel{
-			httpClient:        http.DefaultClient,
-			serverAPIEndpoint: server.URL,
-		}
+		lt := NewLocalTunnel(http.DefaultClient, WithAPIEndpoint(server.URL)).(*localTunnel)
 
 		ctx := context.Background()
 		_, err := lt.requestTunnel(ctx)
@@ -159,10 +247,7 @@ func Test_requestTunnel(t *testing.T) {
 
 		defer server.Close()
 
-		lt := &localTunnel{
-			httpClient:        http.DefaultClient,
-			serverAPIEndpoint: server.URL,
-		}
+		lt := NewLocalTunnel(http.DefaultClient, WithAPIEndpoint(server.URL)).(*localTunnel)
 
 		ctx, cancel := context.WithCancel(context.Background())
 		cancel() // cancel immediately
@@ -175,6 +260,142 @@ func Test_requestTunnel(t *testing.T) {
 	})
 }
 
+// Test_tunnelRequestURL verifies the subdomain is path-escaped and extra params are kept
+func Test_tunnelRequestURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoint  string
+		subdomain string
+		params    url.Values
+		want      string
+	}{
+		{name: "default", endpoint: "https://lt.example.com", want: "https://lt.example.com/?new"},
+		{name: "trailing slash", endpoint: "https://lt.example.com/", want: "https://lt.example.com/?new"},
+		{name: "subdomain", endpoint: "https://lt.example.com", subdomain: "my-app", want: "https://lt.example.com/my-app"},
+		{name: "subdomain escaped", endpoint: "https://lt.example.com", subdomain: "a b/c?d", want: "https://lt.example.com/a%20b%2Fc%3Fd"},
+		{
+			name:     "params",
+			endpoint: "https://lt.example.com",
+			params:   url.Values{"region": {"eu"}, "note": {"a&b"}},
+			want:     "https://lt.example.com/?new&note=a%26b&region=eu",
+		},
+		{
+			name:      "subdomain with params",
+			endpoint:  "https://lt.example.com/api",
+			subdomain: "my-app",
+			params:    url.Values{"region": {"eu"}},
+			want:      "https://lt.example.com/api/my-app?region=eu",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lt := NewLocalTunnel(nil, WithAPIEndpoint(tt.endpoint), WithQueryParams(tt.params)).(*localTunnel)
+
+			got, err := lt.tunnelRequestURL(tt.subdomain)
+			if err != nil {
+				t.Fatalf("tunnelRequestURL() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("tunnelRequestURL() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// Test_requestTunnel_QueryParams verifies the server receives the extra params
+func Test_requestTunnel_QueryParams(t *testing.T) {
+	var got *url.URL
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL
+		json.NewEncoder(w).Encode(TunnelInfo{ID: "abc", URL: "https://abc.example.com", Port: 1234})
+	}))
+	defer server.Close()
+
+	lt := NewLocalTunnel(server.Client(),
+		WithAPIEndpoint(server.URL),
+		WithQueryParams(url.Values{"region": {"eu"}}),
+		WithQueryParams(url.Values{"region": {"us"}}),
+	).(*localTunnel)
+
+	if _, err := lt.requestTunnel(context.Background()); err != nil {
+		t.Fatalf("requestTunnel() error = %v", err)
+	}
+	if got.Path != "/" || !got.Query().Has("new") {
+		t.Errorf("expected /?new to be kept, got %s", got)
+	}
+	if regions := got.Query()["region"]; !slices.Equal(regions, []string{"eu", "us"}) {
+		t.Errorf("expected both region params, got %v", regions)
+	}
+}
+
+// Test_requestTunnel_Retry verifies transient API failures are retried and client errors are not
+func Test_requestTunnel_Retry(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int // responses with status before succeeding
+		status    int
+		attempts  int
+		wantCalls int32
+		wantErr   bool
+	}{
+		{"503 twice then 200", 2, http.StatusServiceUnavailable, 3, 3, false},
+		{"5xx beyond max attempts", 5, http.StatusBadGateway, 3, 3, true},
+		{"4xx is not retried", 5, http.StatusForbidden, 3, 1, true},
+		{"retries disabled", 5, http.StatusServiceUnavailable, 1, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if int(calls.Add(1)) <= tt.failures {
+					w.WriteHeader(tt.status)
+					return
+				}
+				json.NewEncoder(w).Encode(TunnelInfo{URL: "https://abc.example.com"})
+			}))
+			defer server.Close()
+
+			lt := NewLocalTunnel(server.Client(), WithAPIEndpoint(server.URL), WithAPIRetries(tt.attempts)).(*localTunnel)
+			lt.apiBackoff = time.Millisecond
+
+			info, err := lt.requestTunnel(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && info.URL != "https://abc.example.com" {
+				t.Errorf("unexpected URL %q", info.URL)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("expected %d API calls, got %d", tt.wantCalls, got)
+			}
+		})
+	}
+}
+
+// Test_requestTunnel_RetryHonoursContext verifies cancelling stops the backoff wait
+func Test_requestTunnel_RetryHonoursContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	lt := NewLocalTunnel(server.Client(), WithAPIEndpoint(server.URL)).(*localTunnel)
+	lt.apiBackoff = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := lt.requestTunnel(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected backoff to be cut short, took %s", elapsed)
+	}
+}
+
 // TestLocalTunnel_Name
 func TestLocalTunnel_Name(t *testing.T) {
 	provider := NewLocalTunnel(nil)
@@ -287,6 +508,9 @@ func TestLocalTunnel_Close(t *testing.T) {
 	if len(lt.connections) != 0 {
 		t.Errorf("expected connections to be cleared, got %d", len(lt.connections))
 	}
+	if url := lt.PublicURL(); url != "" {
+		t.Errorf("expected no public URL after Close, got %s", url)
+	}
 
 	// verify ctx was canceled
 	select {
@@ -297,3 +521,1380 @@ func TestLocalTunnel_Close(t *testing.T) {
 	}
 
 }
+
+// TestLocalTunnel_Capabilities verifies the features advertised by localtunnel
+func TestLocalTunnel_Capabilities(t *testing.T) {
+	caps := tunnel.CapabilitiesOf(NewLocalTunnel(nil))
+
+	want := tunnel.Capabilities{SupportsSubdomain: true}
+	if caps != want {
+		t.Errorf("expected capabilities %+v, got %+v", want, caps)
+	}
+}
+
+// Test_requestTunnel_Subdomain verifies a requested subdomain is used as the API path
+func Test_requestTunnel_Subdomain(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/myapp" {
+			t.Errorf("expected /myapp path, got %s", r.URL.Path)
+		}
+		if _, ok := r.URL.Query()["new"]; ok {
+			t.Error("did not expect ?new when requesting a subdomain")
+		}
+		json.NewEncoder(w).Encode(TunnelInfo{URL: "https://myapp.example.com"})
+	}))
+	defer server.Close()
+
+	lt := NewLocalTunnel(server.Client(), WithAPIEndpoint(server.URL), WithSubdomain("myapp")).(*localTunnel)
+
+	info, err := lt.requestTunnel(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.URL != "https://myapp.example.com" {
+		t.Errorf("expected subdomain URL, got %s", info.URL)
+	}
+}
+
+// Test_requestTunnel_SubdomainCandidates verifies candidates are tried in
+// order and the first one granted is used, or else the name the server
+// assigned instead
+func Test_requestTunnel_SubdomainCandidates(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []string
+		wantID     string
+		wantErr    bool
+	}{
+		{name: "first free", candidates: []string{"free", "other"}, wantID: "free"},
+		{name: "refused then free", candidates: []string{"refused", "free", "other"}, wantID: "free"},
+		{name: "reassigned then free", candidates: []string{"reassigned", "refused", "free"}, wantID: "free"},
+		{name: "all taken", candidates: []string{"refused", "reassigned"}, wantID: "random-words"},
+		{name: "all refused", candidates: []string{"refused", "refused"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var tried []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				name := strings.TrimPrefix(r.URL.Path, "/")
+				mu.Lock()
+				tried = append(tried, name)
+				mu.Unlock()
+				switch name {
+				case "refused":
+					http.Error(w, "subdomain is taken", http.StatusConflict)
+				case "reassigned":
+					// the upstream server hands out a random name instead
+					json.NewEncoder(w).Encode(TunnelInfo{ID: "random-words", URL: "https://random-words.example.com"})
+				default:
+					json.NewEncoder(w).Encode(TunnelInfo{ID: name, URL: "https://" + name + ".example.com"})
+				}
+			}))
+			defer server.Close()
+
+			lt := NewLocalTunnel(server.Client(), WithAPIEndpoint(server.URL), WithSubdomainCandidates(tt.candidates...)).(*localTunnel)
+
+			info, err := lt.requestTunnel(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", info)
+				}
+				if !slices.Equal(tried, tt.candidates) {
+					t.Errorf("expected every candidate tried, got %v", tried)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if info.ID != tt.wantID {
+				t.Errorf("expected subdomain %s, got %s", tt.wantID, info.ID)
+			}
+			// a name the server assigned is only taken once the others are tried
+			want := tt.candidates
+			if i := slices.Index(tt.candidates, tt.wantID); i >= 0 {
+				want = tt.candidates[:i+1]
+			}
+			if !slices.Equal(tried, want) {
+				t.Errorf("expected %v tried, got %v", want, tried)
+			}
+		})
+	}
+}
+
+// TestLocalTunnel_dialTunnel_UsesDialer verifies the injected dialer is used for tunnel connections
+func TestLocalTunnel_dialTunnel_UsesDialer(t *testing.T) {
+	var dialed string
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialed = address
+		client, server := net.Pipe()
+		t.Cleanup(func() { server.Close() })
+		return client, nil
+	}
+
+	lt := NewLocalTunnel(nil, WithDialer(dial)).(*localTunnel)
+	lt.tunnelHost = "tunnel.example.com"
+	lt.tunnelPort = 4242
+
+	conn, err := lt.dialTunnel()
+	if err != nil {
+		t.Fatalf("dialTunnel() failed: %v", err)
+	}
+	conn.Close()
+
+	if dialed != "tunnel.example.com:4242" {
+		t.Errorf("expected dialer to be called for tunnel.example.com:4242, got %q", dialed)
+	}
+}
+
+// TestLocalTunnel_dialTunnel_ViaProxy verifies tunnel connections go through the configured proxy
+func TestLocalTunnel_dialTunnel_ViaProxy(t *testing.T) {
+	target := echoServer(t)
+	proxyAddr, targets := connectProxy(t)
+
+	u, _ := ParseProxyURL("http://" + proxyAddr)
+	lt := NewLocalTunnel(nil, WithTunnelProxy(u)).(*localTunnel)
+
+	host, portStr, _ := net.SplitHostPort(target)
+	lt.tunnelHost = host
+	lt.tunnelPort, _ = strconv.Atoi(portStr)
+
+	conn, err := lt.dialTunnel()
+	if err != nil {
+		t.Fatalf("dialTunnel() failed: %v", err)
+	}
+	defer conn.Close()
+
+	if got := <-targets; got != target {
+		t.Errorf("expected proxy CONNECT to %s, got %s", target, got)
+	}
+	assertEcho(t, conn)
+}
+
+// TestLocalTunnel_dialTunnel_TLS verifies the TLS handshake on tunnel connections
+func TestLocalTunnel_dialTunnel_TLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	lt := NewLocalTunnel(nil, WithTunnelTLS(&tls.Config{RootCAs: pool})).(*localTunnel)
+	addr := server.Listener.Addr().(*net.TCPAddr)
+	lt.tunnelHost = addr.IP.String()
+	lt.tunnelPort = addr.Port
+
+	conn, err := lt.dialTunnel()
+	if err != nil {
+		t.Fatalf("dialTunnel() failed: %v", err)
+	}
+	defer conn.Close()
+
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		t.Fatalf("expected *tls.Conn, got %T", conn)
+	}
+	// verification without ServerName fails, so a completed handshake
+	// also proves it defaulted to the tunnel host
+	if !tlsConn.ConnectionState().HandshakeComplete {
+		t.Error("expected completed TLS handshake")
+	}
+}
+
+// TestLocalTunnel_dialTunnel_SNI verifies the configured server name is
+// sent in the TLS handshake instead of the tunnel host
+func TestLocalTunnel_dialTunnel_SNI(t *testing.T) {
+	sni := make(chan string, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		sni <- hello.ServerName
+		return nil, nil
+	}}
+	server.StartTLS()
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	// the test certificate is valid for example.com
+	lt := NewLocalTunnel(nil,
+		WithTunnelTLS(&tls.Config{RootCAs: pool, ServerName: "ignored.test"}),
+		WithTunnelSNI("example.com"),
+	).(*localTunnel)
+	addr := server.Listener.Addr().(*net.TCPAddr)
+	lt.tunnelHost = addr.IP.String()
+	lt.tunnelPort = addr.Port
+
+	conn, err := lt.dialTunnel()
+	if err != nil {
+		t.Fatalf("dialTunnel() failed: %v", err)
+	}
+	defer conn.Close()
+
+	if got := <-sni; got != "example.com" {
+		t.Errorf("expected SNI example.com, got %q", got)
+	}
+	if got := conn.(*tls.Conn).ConnectionState().ServerName; got != "example.com" {
+		t.Errorf("expected the connection for example.com, got %q", got)
+	}
+}
+
+// TestParseServerName checks TLS server names are validated as hostnames
+func TestParseServerName(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{raw: "tunnel.example.com", want: "tunnel.example.com"},
+		{raw: "Tunnel.Example.COM.", want: "tunnel.example.com"},
+		{raw: "localhost", want: "localhost"},
+		{raw: "xn--bcher-kva.example", want: "xn--bcher-kva.example"},
+		{raw: "", wantErr: true},
+		{raw: "127.0.0.1", wantErr: true},
+		{raw: "::1", wantErr: true},
+		{raw: "-bad.example.com", wantErr: true},
+		{raw: "bad..example.com", wantErr: true},
+		{raw: "under_score.example.com", wantErr: true},
+		{raw: "host:443", wantErr: true},
+		{raw: strings.Repeat("a", 64) + ".com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := ParseServerName(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseServerName(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestLocalTunnel_proxyRequest_MaxConcurrency verifies local dials never exceed the cap
+func TestLocalTunnel_proxyRequest_MaxConcurrency(t *testing.T) {
+	const limit = 2
+
+	// local server answering "ok" after a short delay, tracking concurrent connections
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	var current, peak atomic.Int64
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				n := current.Add(1)
+				defer current.Add(-1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(30 * time.Millisecond)
+				conn.Write([]byte("ok"))
+			}()
+		}
+	}()
+
+	lt := NewLocalTunnel(nil, WithMaxConcurrency(limit)).(*localTunnel)
+	lt.ctx, lt.cancel = context.WithCancel(context.Background())
+	defer lt.cancel()
+	lt.localPort = ln.Addr().(*net.TCPAddr).Port
+
+	var wg sync.WaitGroup
+	for range 6 {
+		tunnelSide, remote := net.Pipe()
+		wg.Go(func() {
+			if err := lt.proxyRequest(lt.ctx, tunnelSide); err != nil {
+				t.Errorf("proxyRequest failed: %v", err)
+			}
+		})
+		// the remote tunnel end sends a request, reads the answer and hangs up
+		wg.Go(func() {
+			defer remote.Close()
+			remote.Write([]byte("x"))
+			io.ReadFull(remote, make([]byte, 2))
+		})
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got > limit {
+		t.Errorf("concurrency exceeded cap: peak %d > %d", got, limit)
+	}
+}
+
+// TestLocalTunnel_proxyRequest_Queue verifies requests beyond the
+// WithMaxConcurrency slots and WithRequestQueue depth get a 503, and queued
+// ones proceed once a slot frees up or get a 503 after the queue timeout
+func TestLocalTunnel_proxyRequest_Queue(t *testing.T) {
+	tests := []struct {
+		name     string
+		depth    int
+		timeout  time.Duration
+		requests int
+		wantOK   int
+	}{
+		{name: "queue full", depth: 2, requests: 5, wantOK: 3},
+		{name: "unbounded queue", depth: 0, requests: 5, wantOK: 5},
+		{name: "queue timeout", depth: 2, timeout: 20 * time.Millisecond, requests: 3, wantOK: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// local server answering "ok" once released
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+			release := make(chan struct{})
+			go func() {
+				for {
+					conn, err := ln.Accept()
+					if err != nil {
+						return
+					}
+					go func() {
+						defer conn.Close()
+						<-release
+						conn.Write([]byte("ok"))
+					}()
+				}
+			}()
+
+			lt := NewLocalTunnel(nil, WithMaxConcurrency(1), WithRequestQueue(tt.depth, tt.timeout)).(*localTunnel)
+			lt.ctx, lt.cancel = context.WithCancel(context.Background())
+			defer lt.cancel()
+			lt.localPort = ln.Addr().(*net.TCPAddr).Port
+
+			var (
+				wg       sync.WaitGroup
+				mu       sync.Mutex
+				ok       int
+				rejected int
+			)
+			for i := range tt.requests {
+				tunnelSide, remote := net.Pipe()
+				wg.Go(func() {
+					err := lt.proxyRequest(lt.ctx, tunnelSide)
+					tunnelSide.Close()
+					if err != nil && !errors.Is(err, errRequestRejected) {
+						t.Errorf("proxyRequest failed: %v", err)
+					}
+				})
+				wg.Go(func() {
+					defer remote.Close()
+					remote.Write([]byte("x"))
+					// "ok" from the local server, or a 503 up to EOF
+					answer := make([]byte, 2)
+					io.ReadFull(remote, answer)
+					if string(answer) != "ok" {
+						rest, _ := io.ReadAll(remote)
+						answer = append(answer, rest...)
+					}
+					mu.Lock()
+					defer mu.Unlock()
+					switch {
+					case string(answer) == "ok":
+						ok++
+					case strings.HasPrefix(string(answer), "HTTP/1.1 503 "):
+						rejected++
+					default:
+						t.Errorf("unexpected answer %q", answer)
+					}
+				})
+
+				// let the request take the slot or a queue place before the
+				// next one arrives, so the last ones find the queue full
+				waiting := min(i+1, 1+tt.depth)
+				for deadline := time.Now().Add(2 * time.Second); tt.depth > 0 && time.Now().Before(deadline); {
+					if len(lt.inflight)+len(lt.queue) >= waiting {
+						break
+					}
+					time.Sleep(time.Millisecond)
+				}
+			}
+
+			if tt.timeout > 0 {
+				time.Sleep(2 * tt.timeout)
+			}
+			close(release)
+			wg.Wait()
+
+			if ok != tt.wantOK || ok+rejected != tt.requests {
+				t.Errorf("expected %d of %d requests answered, got %d with %d rejected", tt.wantOK, tt.requests, ok, rejected)
+			}
+		})
+	}
+}
+
+// TestLocalTunnel_proxyRequest_Traffic verifies the bytes copied through the
+// tunnel connection are counted
+func TestLocalTunnel_proxyRequest_Traffic(t *testing.T) {
+	request, response := []byte("ping"), []byte("hello world")
+
+	// local server reading the request and answering once
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.ReadFull(conn, make([]byte, len(request)))
+		conn.Write(response)
+	}()
+
+	lt := NewLocalTunnel(nil).(*localTunnel)
+	lt.ctx, lt.cancel = context.WithCancel(context.Background())
+	defer lt.cancel()
+	lt.localPort = ln.Addr().(*net.TCPAddr).Port
+
+	tunnelSide, remote := net.Pipe()
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		if err := lt.proxyRequest(lt.ctx, tunnelSide); err != nil {
+			t.Errorf("proxyRequest failed: %v", err)
+		}
+	})
+	wg.Go(func() {
+		defer remote.Close()
+		remote.Write(request)
+		io.ReadFull(remote, make([]byte, len(response)))
+	})
+	wg.Wait()
+
+	in, out := lt.Traffic()
+	if in != int64(len(request)) || out != int64(len(response)) {
+		t.Errorf("expected %d in / %d out, got %d / %d", len(request), len(response), in, out)
+	}
+}
+
+// TestLocalTunnel_proxyRequest_ActiveStream verifies a stream that keeps
+// sending survives well past the idle timeout
+func TestLocalTunnel_proxyRequest_ActiveStream(t *testing.T) {
+	const chunks = 15
+
+	// local server streaming a chunk every 20ms, like server-sent events
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.ReadFull(conn, make([]byte, 1))
+		for range chunks {
+			time.Sleep(20 * time.Millisecond)
+			conn.Write([]byte("."))
+		}
+	}()
+
+	lt := NewLocalTunnel(nil).(*localTunnel)
+	lt.ctx, lt.cancel = context.WithCancel(context.Background())
+	defer lt.cancel()
+	lt.localPort = ln.Addr().(*net.TCPAddr).Port
+	lt.idleTimeout = 100 * time.Millisecond
+
+	tunnelSide, remote := net.Pipe()
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		if err := lt.proxyRequest(lt.ctx, tunnelSide); err != nil {
+			t.Errorf("proxyRequest failed: %v", err)
+		}
+	})
+	start := time.Now()
+	remote.Write([]byte("x"))
+	if n, err := io.ReadFull(remote, make([]byte, chunks)); err != nil {
+		t.Errorf("expected all %d chunks, got %d: %v", chunks, n, err)
+	}
+	if elapsed := time.Since(start); elapsed < 3*lt.idleTimeout {
+		t.Errorf("expected the stream to outlast the idle timeout, took %v", elapsed)
+	}
+	remote.Close()
+	wg.Wait()
+}
+
+// TestLocalTunnel_proxyRequest_Idle verifies a request on which nothing
+// happens is given up after the idle timeout
+func TestLocalTunnel_proxyRequest_Idle(t *testing.T) {
+	// local server that never answers
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(io.Discard, conn)
+	}()
+
+	lt := NewLocalTunnel(nil).(*localTunnel)
+	lt.ctx, lt.cancel = context.WithCancel(context.Background())
+	defer lt.cancel()
+	lt.localPort = ln.Addr().(*net.TCPAddr).Port
+	lt.idleTimeout = 100 * time.Millisecond
+
+	tunnelSide, remote := net.Pipe()
+	defer remote.Close()
+	done := make(chan struct{})
+	start := time.Now()
+	go func() {
+		defer close(done)
+		lt.proxyRequest(lt.ctx, tunnelSide)
+	}()
+	remote.Write([]byte("x"))
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the idle request to be given up")
+	}
+	if elapsed := time.Since(start); elapsed < lt.idleTimeout {
+		t.Errorf("expected the request to last the idle timeout, ended after %v", elapsed)
+	}
+}
+
+// TestLocalTunnel_proxyRequest_Cancel verifies cancelling the pool's
+// context ends a request mid-copy at once, not after the idle timeout
+func TestLocalTunnel_proxyRequest_Cancel(t *testing.T) {
+	// local server that reads the request and never answers
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	accepted := make(chan struct{})
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		close(accepted)
+		io.Copy(io.Discard, conn)
+	}()
+
+	lt := NewLocalTunnel(nil).(*localTunnel)
+	lt.ctx, lt.cancel = context.WithCancel(context.Background())
+	defer lt.cancel()
+	lt.localPort = ln.Addr().(*net.TCPAddr).Port
+
+	// the tunnel server side stays open and quiet
+	tunnelSide, remote := net.Pipe()
+	defer remote.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lt.proxyRequest(lt.ctx, tunnelSide)
+	}()
+	remote.Write([]byte("x"))
+	<-accepted
+
+	lt.cancel()
+	select {
+	case <-done:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("expected proxyRequest to return promptly once cancelled")
+	}
+}
+
+// Test_connLimit checks the server's max_conn_count is clamped to a sane pool size
+func Test_connLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		serverMax int
+		want      int
+	}{
+		{"zero uses default", 0, clientMaxConn},
+		{"negative uses default", -5, clientMaxConn},
+		{"absurdly large uses default", 1 << 30, clientMaxConn},
+		{"above our limit is clamped", 50, clientMaxConn},
+		{"below our limit is respected", 3, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := connLimit(tt.serverMax); got != tt.want {
+				t.Errorf("connLimit(%d) = %d, want %d", tt.serverMax, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLocalTunnel_Connect_InvalidPort checks a bogus port is rejected before dialing
+func TestLocalTunnel_Connect_InvalidPort(t *testing.T) {
+	for _, port := range []int{0, -1, 70000} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"id":"abc","url":"https://abc.loca.lt","port":%d,"max_conn_count":10}`, port)
+		}))
+
+		dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+			t.Errorf("port %d: unexpected dial to %s", port, address)
+			return nil, errors.New("unexpected dial")
+		}
+		lt := NewLocalTunnel(server.Client(), WithAPIEndpoint(server.URL), WithDialer(dial)).(*localTunnel)
+
+		_, err := lt.Connect(context.Background(), 3000)
+		if err == nil || !strings.Contains(err.Error(), "invalid port") {
+			t.Errorf("port %d: expected invalid port error, got %v", port, err)
+		}
+		server.Close()
+	}
+}
+
+// keepAliveConn records the keep-alive settings applied to it.
+type keepAliveConn struct {
+	net.Conn
+	enabled bool
+	period  time.Duration
+}
+
+func (c *keepAliveConn) SetKeepAlive(keepalive bool) error {
+	c.enabled = keepalive
+	return nil
+}
+
+func (c *keepAliveConn) SetKeepAlivePeriod(d time.Duration) error {
+	c.period = d
+	return nil
+}
+
+// TestLocalTunnel_dialTunnel_KeepAlive checks keep-alive is enabled on tunnel connections
+func TestLocalTunnel_dialTunnel_KeepAlive(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []LocalTunnelOption
+		wantEnabled bool
+		wantPeriod  time.Duration
+	}{
+		{"default", nil, true, tunnel.DefaultKeepAlive},
+		{"custom period", []LocalTunnelOption{WithKeepAlive(time.Minute)}, true, time.Minute},
+		{"disabled", []LocalTunnelOption{WithKeepAlive(0)}, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dialed *keepAliveConn
+			dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+				client, server := net.Pipe()
+				t.Cleanup(func() { server.Close() })
+				dialed = &keepAliveConn{Conn: client, enabled: true}
+				return dialed, nil
+			}
+
+			lt := NewLocalTunnel(nil, append(tt.opts, WithDialer(dial))...).(*localTunnel)
+			lt.tunnelHost = "tunnel.example.com"
+			lt.tunnelPort = 4242
+
+			conn, err := lt.dialTunnel()
+			if err != nil {
+				t.Fatalf("dialTunnel() failed: %v", err)
+			}
+			conn.Close()
+
+			if dialed.enabled != tt.wantEnabled || dialed.period != tt.wantPeriod {
+				t.Errorf("expected enabled=%v period=%v, got enabled=%v period=%v",
+					tt.wantEnabled, tt.wantPeriod, dialed.enabled, dialed.period)
+			}
+		})
+	}
+}
+
+// TestLocalTunnel_HealthCheck checks health follows the live pool connections
+func TestLocalTunnel_HealthCheck(t *testing.T) {
+	lt := &localTunnel{maxConnections: 2}
+	if err := lt.HealthCheck(context.Background()); !errors.Is(err, tunnel.ErrNotConnected) {
+		t.Errorf("expected a disconnected tunnel to be unhealthy, got %v", err)
+	}
+
+	lt.connected = true
+	if err := lt.HealthCheck(context.Background()); !errors.Is(err, tunnel.ErrNotConnected) || !strings.Contains(err.Error(), "all 2 tunnel connections") {
+		t.Errorf("expected drained pool to be unhealthy, got %v", err)
+	}
+
+	lt.alive.Store(1)
+	if err := lt.HealthCheck(context.Background()); err != nil {
+		t.Errorf("expected a tunnel with a live connection to be healthy, got %v", err)
+	}
+}
+
+// fakeTunnelServer is a localtunnel server: an API that hands out a tunnel
+// of maxConn connections and a listener accepting them.
+type fakeTunnelServer struct {
+	api   *httptest.Server
+	ln    net.Listener
+	conns chan net.Conn
+	down  atomic.Bool  // refuses tunnel connections while set
+	calls atomic.Int32 // tunnel API requests served
+	// the next apiErrors API requests are answered with apiStatus
+	apiErrors atomic.Int32
+	apiStatus atomic.Int32
+}
+
+func newFakeTunnelServer(t *testing.T, maxConn int) *fakeTunnelServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeTunnelServer{ln: ln, conns: make(chan net.Conn, 64)}
+	s.api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.calls.Add(1)
+		if s.apiErrors.Add(-1) >= 0 {
+			w.WriteHeader(int(s.apiStatus.Load()))
+			return
+		}
+		fmt.Fprintf(w, `{"id":"abc","url":"https://abc.loca.lt","port":%d,"max_conn_count":%d}`,
+			ln.Addr().(*net.TCPAddr).Port, maxConn)
+	}))
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.conns <- conn
+		}
+	}()
+	t.Cleanup(func() {
+		s.api.Close()
+		ln.Close()
+	})
+	return s
+}
+
+// provider returns a localTunnel that talks to the fake server only and
+// re-dials dropped connections right away.
+func (s *fakeTunnelServer) provider(opts ...LocalTunnelOption) *localTunnel {
+	dial := func(ctx context.Context, network, _ string) (net.Conn, error) {
+		if s.down.Load() {
+			return nil, errors.New("connection refused")
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, network, s.ln.Addr().String())
+	}
+	lt := NewLocalTunnel(s.api.Client(), append([]LocalTunnelOption{WithDialer(dial), WithAPIEndpoint(s.api.URL)}, opts...)...).(*localTunnel)
+	lt.redialBackoff = time.Millisecond
+	return lt
+}
+
+// accept returns the next n tunnel connections opened by the client.
+func (s *fakeTunnelServer) accept(t *testing.T, n int) []net.Conn {
+	t.Helper()
+	var conns []net.Conn
+	for range n {
+		select {
+		case conn := <-s.conns:
+			conns = append(conns, conn)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected %d tunnel connections, got %d", n, len(conns))
+		}
+	}
+	return conns
+}
+
+// eventRecorder is a slog.Handler keeping the tunnel lifecycle events and
+// the messages of debug records.
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []string
+	debug  []string
+}
+
+func (r *eventRecorder) Enabled(context.Context, slog.Level) bool { return true }
+func (r *eventRecorder) WithAttrs([]slog.Attr) slog.Handler       { return r }
+func (r *eventRecorder) WithGroup(string) slog.Handler            { return r }
+
+func (r *eventRecorder) Handle(_ context.Context, rec slog.Record) error {
+	if rec.Level == slog.LevelDebug {
+		r.mu.Lock()
+		r.debug = append(r.debug, rec.Message)
+		r.mu.Unlock()
+	}
+	rec.Attrs(func(a slog.Attr) bool {
+		if a.Key == "event" {
+			r.mu.Lock()
+			r.events = append(r.events, a.Value.String())
+			r.mu.Unlock()
+			return false
+		}
+		return true
+	})
+	return nil
+}
+
+// waitFor returns the recorded events once there are at least n of them.
+func (r *eventRecorder) waitFor(t *testing.T, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		r.mu.Lock()
+		events := slices.Clone(r.events)
+		r.mu.Unlock()
+		if len(events) >= n || time.Now().After(deadline) {
+			return events
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// waitForDebug returns the recorded debug messages once message is among them.
+func (r *eventRecorder) waitForDebug(t *testing.T, message string) []string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		r.mu.Lock()
+		messages := slices.Clone(r.debug)
+		r.mu.Unlock()
+		if slices.Contains(messages, message) || time.Now().After(deadline) {
+			return messages
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestLocalTunnel_ReconnectEvents verifies a dropped pool and the
+// supervisor's reconnect are logged as the standard event sequence
+func TestLocalTunnel_ReconnectEvents(t *testing.T) {
+	server := newFakeTunnelServer(t, 2)
+	events := &eventRecorder{}
+	logger := slog.New(events)
+
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer local.Close()
+	localPort := local.Listener.Addr().(*net.TCPAddr).Port
+
+	lt := server.provider(WithLogger(logger))
+	svc := tunnel.NewService(lt, tunnel.WithServiceLogger(logger))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := svc.Start(ctx, localPort); err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Close()
+
+	// the server goes away and drops the whole pool
+	server.down.Store(true)
+	for _, conn := range server.accept(t, 2) {
+		conn.Close()
+	}
+	events.waitFor(t, 3)
+	deadline := time.Now().Add(2 * time.Second)
+	for lt.IsConnected() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the tunnel to be disconnected once the pool is gone")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	server.down.Store(false)
+	go svc.Supervise(ctx, tunnel.ReconnectPolicy{CheckInterval: 10 * time.Millisecond})
+	reconnected := server.accept(t, 2)
+
+	want := []string{
+		tunnel.EventConnected,
+		tunnel.EventDropped, tunnel.EventDropped, // both pool connections
+		tunnel.EventDropped, // noticed by the supervisor
+		tunnel.EventReconnectAttempt,
+		tunnel.EventReconnected,
+	}
+	if got := events.waitFor(t, len(want)); !slices.Equal(got, want) {
+		t.Errorf("expected events %v, got %v", want, got)
+	}
+	for _, conn := range reconnected {
+		conn.Close()
+	}
+}
+
+// TestLocalTunnel_DebugLog verifies a connect and one request are logged
+// at debug level: the API answer, the pool connection, the request and
+// the connection closing
+func TestLocalTunnel_DebugLog(t *testing.T) {
+	server := newFakeTunnelServer(t, 1)
+	debug := &eventRecorder{}
+
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer local.Close()
+
+	lt := server.provider(WithLogger(slog.New(debug)))
+	if _, err := lt.Connect(context.Background(), local.Listener.Addr().(*net.TCPAddr).Port); err != nil {
+		t.Fatal(err)
+	}
+	defer lt.Close()
+
+	conn := server.accept(t, 1)[0]
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: abc.loca.lt\r\nConnection: close\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(resp.Body)
+	// the server hanging up ends the request and the pool connection
+	conn.Close()
+
+	want := []string{
+		"tunnel API response",
+		"tunnel connection opened",
+		"proxying request",
+		"proxied request done",
+		"tunnel connection closed",
+	}
+	got := debug.waitForDebug(t, want[len(want)-1])
+	// each wanted message in order, others may come in between
+	rest := got
+	for _, message := range want {
+		i := slices.Index(rest, message)
+		if i < 0 {
+			t.Fatalf("expected debug messages %v in order, got %v", want, got)
+		}
+		rest = rest[i+1:]
+	}
+}
+
+// TestLocalTunnel_RejectionKeepsPool verifies the pool connection a 503
+// closed is replaced at once, not counted as dropped and re-dialed later
+func TestLocalTunnel_RejectionKeepsPool(t *testing.T) {
+	server := newFakeTunnelServer(t, 2)
+	events := &eventRecorder{}
+
+	// local server holding the only slot until released
+	release := make(chan struct{})
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer local.Close()
+	defer close(release)
+
+	lt := server.provider(WithLogger(slog.New(events)), WithMaxConcurrency(1), WithRequestQueue(1, 20*time.Millisecond))
+	// a replacement waiting for the backoff would miss the deadline below
+	lt.redialBackoff = time.Minute
+	if _, err := lt.Connect(context.Background(), local.Listener.Addr().(*net.TCPAddr).Port); err != nil {
+		t.Fatal(err)
+	}
+	defer lt.Close()
+	pool := server.accept(t, 2)
+	defer pool[0].Close()
+
+	io.WriteString(pool[0], "GET /slow HTTP/1.1\r\nHost: abc.loca.lt\r\n\r\n")
+	for deadline := time.Now().Add(2 * time.Second); len(lt.inflight) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the first request to take the slot")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	io.WriteString(pool[1], "GET /rejected HTTP/1.1\r\nHost: abc.loca.lt\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(pool[1]), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	pool[1].Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", resp.StatusCode)
+	}
+
+	replacement := server.accept(t, 1)[0]
+	defer replacement.Close()
+	for deadline := time.Now().Add(time.Second); lt.alive.Load() != 2; {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a pool of 2 after the rejection, got %d alive", lt.alive.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := events.waitFor(t, 0); len(got) != 0 {
+		t.Errorf("expected no lifecycle events for a rejection, got %v", got)
+	}
+}
+
+// TestLocalTunnel_PoolSelfHeals verifies a connection the server closes
+// while idle is re-dialed and keeps serving requests
+func TestLocalTunnel_PoolSelfHeals(t *testing.T) {
+	server := newFakeTunnelServer(t, 2)
+	events := &eventRecorder{}
+
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "healed")
+	}))
+	defer local.Close()
+
+	lt := server.provider(WithLogger(slog.New(events)))
+	if _, err := lt.Connect(context.Background(), local.Listener.Addr().(*net.TCPAddr).Port); err != nil {
+		t.Fatal(err)
+	}
+	defer lt.Close()
+
+	pool := server.accept(t, 2)
+	defer pool[1].Close()
+
+	// the server drops an idle connection, the client dials a replacement
+	pool[0].Close()
+	replacement := server.accept(t, 1)[0]
+	defer replacement.Close()
+
+	want := []string{tunnel.EventDropped, tunnel.EventPoolReplenished}
+	if got := events.waitFor(t, len(want)); !slices.Equal(got, want) {
+		t.Errorf("expected events %v, got %v", want, got)
+	}
+	if !lt.IsConnected() || lt.alive.Load() != 2 {
+		t.Errorf("expected a full, connected pool, got %d alive", lt.alive.Load())
+	}
+
+	// the replacement serves requests like any pool connection
+	io.WriteString(replacement, "GET / HTTP/1.1\r\nHost: abc.loca.lt\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(replacement), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "healed" {
+		t.Errorf("expected the local response, got %q", body)
+	}
+}
+
+// TestLocalTunnel_CloseClearsURL verifies a closed tunnel reports no URL,
+// also to concurrent readers, and Reconnect then requests a new tunnel
+func TestLocalTunnel_CloseClearsURL(t *testing.T) {
+	server := newFakeTunnelServer(t, 1)
+	lt := server.provider()
+	if _, err := lt.Connect(context.Background(), 3000); err != nil {
+		t.Fatal(err)
+	}
+	defer lt.Close()
+	server.accept(t, 1)[0].Close()
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Go(func() {
+			for range 100 {
+				_ = lt.PublicURL()
+				_ = lt.IsConnected()
+			}
+		})
+	}
+	if err := lt.Close(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	if lt.IsConnected() || lt.PublicURL() != "" {
+		t.Errorf("expected no connection or URL after Close, got %v %q", lt.IsConnected(), lt.PublicURL())
+	}
+
+	calls := server.calls.Load()
+	url, err := lt.Reconnect(context.Background(), 3000)
+	if err != nil {
+		t.Fatalf("Reconnect() error = %v", err)
+	}
+	server.accept(t, 1)[0].Close()
+	if server.calls.Load() != calls+1 || url == "" || lt.PublicURL() != url {
+		t.Errorf("expected Reconnect after Close to request a new tunnel, got %q after %d API calls", url, server.calls.Load()-calls)
+	}
+}
+
+// TestLocalTunnel_ConnectRetries verifies WithConnectRetries bounds the
+// attempts at the whole connect sequence and reports each failed one
+func TestLocalTunnel_ConnectRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		retries   int
+		apiErrors int32
+		apiStatus int32
+		poolDown  bool
+		wantCalls int32
+		wantErr   []string // "" entries just count as attempts
+	}{
+		{name: "recovers", retries: 2, apiErrors: 2, apiStatus: 503, wantCalls: 3},
+		{name: "api keeps failing", retries: 2, apiErrors: 100, apiStatus: 503, wantCalls: 3,
+			wantErr: []string{"giving up after 3 attempts", "attempt 1: failed to request tunnel: status 503", "attempt 3: failed to request tunnel: status 503"}},
+		{name: "pool keeps failing", retries: 1, poolDown: true, wantCalls: 2,
+			wantErr: []string{"giving up after 2 attempts", "attempt 1: failed to open connections", "attempt 2: failed to open connections"}},
+		{name: "client error is not retried", retries: 3, apiErrors: 100, apiStatus: 409, wantCalls: 1,
+			wantErr: []string{"failed to request tunnel: status 409"}},
+		{name: "no retries keeps the API retries", retries: 0, apiErrors: 100, apiStatus: 503, wantCalls: apiMaxAttempts,
+			wantErr: []string{"failed to request tunnel: status 503"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeTunnelServer(t, 1)
+			server.apiErrors.Store(tt.apiErrors)
+			server.apiStatus.Store(tt.apiStatus)
+			server.down.Store(tt.poolDown)
+
+			lt := server.provider(WithConnectRetries(tt.retries))
+			lt.apiBackoff = time.Millisecond
+			defer lt.Close()
+
+			url, err := lt.Connect(context.Background(), 3000)
+			if got := server.calls.Load(); got != tt.wantCalls {
+				t.Errorf("expected %d API calls, got %d", tt.wantCalls, got)
+			}
+			if tt.wantErr == nil {
+				if err != nil || url == "" {
+					t.Fatalf("expected a tunnel after retrying, got %q, %v", url, err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected Connect to fail")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error containing %q, got %v", want, err)
+				}
+			}
+			if tt.retries == 0 || tt.apiStatus == 409 {
+				if strings.Contains(err.Error(), "giving up") {
+					t.Errorf("expected the single attempt's error, got %v", err)
+				}
+			}
+		})
+	}
+}
+
+// TestLocalTunnel_ConnectRetriesCancel verifies the retry backoff ends with ctx
+func TestLocalTunnel_ConnectRetriesCancel(t *testing.T) {
+	server := newFakeTunnelServer(t, 1)
+	server.apiErrors.Store(100)
+	server.apiStatus.Store(503)
+
+	lt := server.provider(WithConnectRetries(5))
+	lt.apiBackoff = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := lt.Connect(ctx, 3000)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "status 503") {
+		t.Errorf("expected the attempts so far and deadline exceeded, got %v", err)
+	}
+}
+
+// TestLocalTunnel_Reconnect verifies Reconnect re-dials the pool of the
+// assigned tunnel and only requests a new one when that fails
+func TestLocalTunnel_Reconnect(t *testing.T) {
+	server := newFakeTunnelServer(t, 2)
+	lt := server.provider()
+	if _, err := lt.Connect(context.Background(), 3000); err != nil {
+		t.Fatal(err)
+	}
+	defer lt.Close()
+	for _, conn := range server.accept(t, 2) {
+		defer conn.Close()
+	}
+
+	url, err := lt.Reconnect(context.Background(), 4000)
+	if err != nil {
+		t.Fatalf("Reconnect() error = %v", err)
+	}
+	for _, conn := range server.accept(t, 2) {
+		defer conn.Close()
+	}
+	if url != "https://abc.loca.lt" || !lt.IsConnected() {
+		t.Errorf("expected the same URL and a connected tunnel, got %s (connected=%v)", url, lt.IsConnected())
+	}
+	lt.mu.RLock()
+	port := lt.localPort
+	lt.mu.RUnlock()
+	if port != 4000 {
+		t.Errorf("expected requests forwarded to the new local port 4000, got %d", port)
+	}
+	if calls := server.calls.Load(); calls != 1 {
+		t.Errorf("expected the pool re-dialed without an API request, got %d requests", calls)
+	}
+
+	// the server forgot the tunnel, a new one is requested
+	server.down.Store(true)
+	if _, err := lt.Reconnect(context.Background(), 4000); err == nil {
+		t.Error("expected an error while the server is down")
+	}
+	if calls := server.calls.Load(); calls != 2 {
+		t.Errorf("expected a new tunnel requested after the re-dial failed, got %d requests", calls)
+	}
+}
+
+// TestLocalTunnel_OnDemand verifies only one tunnel connection is open
+// until a request arrives, and the pool then grows up to the server's limit
+func TestLocalTunnel_OnDemand(t *testing.T) {
+	server := newFakeTunnelServer(t, 3)
+
+	// local server swallowing every request
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(io.Discard, conn)
+		}
+	}()
+
+	lt := server.provider(WithOnDemand(true))
+	if _, err := lt.Connect(context.Background(), ln.Addr().(*net.TCPAddr).Port); err != nil {
+		t.Fatal(err)
+	}
+	defer lt.Close()
+
+	noMoreConns := func() {
+		t.Helper()
+		select {
+		case <-server.conns:
+			t.Fatal("expected no further tunnel connection")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	conns := server.accept(t, 1)
+	noMoreConns()
+
+	// each request takes the only waiting connection, so another is opened
+	for i := range 2 {
+		io.WriteString(conns[i], "GET / HTTP/1.1\r\n\r\n")
+		conns = append(conns, server.accept(t, 1)...)
+	}
+
+	// the pool is full
+	io.WriteString(conns[2], "GET / HTTP/1.1\r\n\r\n")
+	noMoreConns()
+	if alive := lt.alive.Load(); alive != 3 {
+		t.Errorf("expected 3 pool connections, got %d", alive)
+	}
+}
+
+// TestLocalTunnel_CloseReapsHandlers verifies Close returns only once every
+// connection handler exited, also those waiting on an unresponsive local
+// server
+func TestLocalTunnel_CloseReapsHandlers(t *testing.T) {
+	server := newFakeTunnelServer(t, 2)
+
+	// local server reading requests but never answering
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan struct{}, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 512)
+				if n, _ := conn.Read(buf); n > 0 {
+					received <- struct{}{}
+				}
+				io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	lt := server.provider()
+	if _, err := lt.Connect(context.Background(), ln.Addr().(*net.TCPAddr).Port); err != nil {
+		t.Fatal(err)
+	}
+	pool := server.accept(t, 2)
+	for _, conn := range pool {
+		defer conn.Close()
+	}
+	if n := lt.runningHandlers(); n != 2 {
+		t.Fatalf("expected 2 connection handlers, got %d", n)
+	}
+
+	io.WriteString(pool[0], "GET /slow HTTP/1.1\r\nHost: abc.loca.lt\r\n\r\n")
+	select {
+	case <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("request didn't reach the local server")
+	}
+
+	start := time.Now()
+	if err := lt.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := lt.runningHandlers(); n != 0 {
+		t.Errorf("expected no connection handlers after Close, got %d", n)
+	}
+	if elapsed := time.Since(start); elapsed >= handlerExitTimeout {
+		t.Errorf("expected Close to return once the handlers exited, took %v", elapsed)
+	}
+}
+
+// TestLocalTunnel_NoLocalDialsWhenIdle verifies pool connections wait for a
+// request before dialing the local server, once per request
+func TestLocalTunnel_NoLocalDialsWhenIdle(t *testing.T) {
+	server := newFakeTunnelServer(t, 3)
+
+	var dials atomic.Int32
+	local := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	local.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			dials.Add(1)
+		}
+	}
+	local.Start()
+	defer local.Close()
+
+	lt := server.provider()
+	if _, err := lt.Connect(context.Background(), local.Listener.Addr().(*net.TCPAddr).Port); err != nil {
+		t.Fatal(err)
+	}
+	defer lt.Close()
+	pool := server.accept(t, 3)
+	for _, conn := range pool {
+		defer conn.Close()
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if n := dials.Load(); n != 0 {
+		t.Fatalf("expected no local dials without traffic, got %d", n)
+	}
+
+	io.WriteString(pool[1], "GET / HTTP/1.1\r\nHost: abc.loca.lt\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(pool[1]), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if n := dials.Load(); n != 1 {
+		t.Errorf("expected one local dial for one request, got %d", n)
+	}
+}
@@ -0,0 +1,337 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/kernelshard/expose/internal/tunnel"
+)
+
+const (
+	loopbackProviderName = "Loopback"
+
+	// loopbackHost is the public host of an in-memory loopback, only
+	// reachable through Loopback.Dial and Loopback.Client
+	loopbackHost = "loopback.invalid"
+)
+
+// Loopback is an in-process provider for tests and offline development.
+// Its public side is a listener inside the process that forwards every
+// connection to the local port, so the full Service and Manager flow runs
+// without a tunnel server or network access.
+//
+// By default the listener is in memory; use Dial or Client to reach it.
+// WithLoopbackTCP serves it on a real address instead.
+type Loopback struct {
+	mu        sync.RWMutex
+	listener  net.Listener
+	publicURL string
+	localPort int
+	connected bool
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+
+	// tcpAddr serves the public side on a TCP address, "" keeps it in memory
+	tcpAddr string
+	// workers holds a slot per forwarded connection, nil is unbounded
+	workers chan struct{}
+
+	traffic tunnel.ByteCounter
+}
+
+// LoopbackOption configures a Loopback provider.
+type LoopbackOption func(*Loopback)
+
+// WithLoopbackTCP serves the public side on a TCP address, e.g.
+// "127.0.0.1:0", so it can be reached from outside the process.
+func WithLoopbackTCP(addr string) LoopbackOption {
+	return func(lb *Loopback) {
+		lb.tcpAddr = addr
+	}
+}
+
+// WithLoopbackWorkers bounds the connections forwarded at once to n.
+// Further connections are only accepted once one of them closes, until
+// then they wait in the listener's backlog. Zero or negative means
+// unlimited.
+func WithLoopbackWorkers(n int) LoopbackOption {
+	return func(lb *Loopback) {
+		if n > 0 {
+			lb.workers = make(chan struct{}, n)
+		} else {
+			lb.workers = nil
+		}
+	}
+}
+
+// NewLoopback creates an in-process loopback provider.
+func NewLoopback(opts ...LoopbackOption) *Loopback {
+	lb := &Loopback{}
+	for _, opt := range opts {
+		opt(lb)
+	}
+	return lb
+}
+
+// Connect starts forwarding the public side to localPort.
+func (lb *Loopback) Connect(ctx context.Context, localPort int) (string, error) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	if lb.connected {
+		return "", errors.New("loopback already connected")
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	var (
+		ln        net.Listener
+		publicURL string
+	)
+	if lb.tcpAddr != "" {
+		tcp, err := net.Listen("tcp", lb.tcpAddr)
+		if err != nil {
+			return "", fmt.Errorf("loopback listen: %w", err)
+		}
+		ln, publicURL = tcp, "http://"+tcp.Addr().String()
+	} else {
+		ln, publicURL = newMemListener(), "http://"+loopbackHost
+	}
+
+	lb.listener = ln
+	lb.publicURL = publicURL
+	lb.localPort = localPort
+	lb.connected = true
+	lb.ctx, lb.cancel = context.WithCancel(context.Background())
+
+	lb.wg.Add(1)
+	go lb.serve(lb.ctx, ln)
+
+	return publicURL, nil
+}
+
+// Reconnect closes the public side and opens a fresh one to localPort.
+// With WithLoopbackTCP on port 0 it comes back on a new URL.
+func (lb *Loopback) Reconnect(ctx context.Context, localPort int) (string, error) {
+	if err := lb.Close(); err != nil {
+		return "", fmt.Errorf("loopback close: %w", err)
+	}
+	return lb.Connect(ctx, localPort)
+}
+
+// serve accepts public connections until the listener is closed. With
+// WithLoopbackWorkers it waits for a free slot before each Accept.
+func (lb *Loopback) serve(ctx context.Context, ln net.Listener) {
+	defer lb.wg.Done()
+	for {
+		if lb.workers != nil {
+			select {
+			case lb.workers <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		}
+		conn, err := ln.Accept()
+		if err != nil {
+			lb.release()
+			return
+		}
+		lb.wg.Add(1)
+		go func() {
+			defer lb.wg.Done()
+			defer lb.release()
+			lb.forward(conn)
+		}()
+	}
+}
+
+// release frees the worker slot of a forwarded connection.
+func (lb *Loopback) release() {
+	if lb.workers != nil {
+		<-lb.workers
+	}
+}
+
+// forward copies bytes between a public connection and the local server,
+// until either side closes or the provider does.
+func (lb *Loopback) forward(publicConn net.Conn) {
+	defer publicConn.Close()
+
+	lb.mu.RLock()
+	ctx, localPort := lb.ctx, lb.localPort
+	lb.mu.RUnlock()
+
+	d := net.Dialer{Timeout: localDialTimeOut}
+	localConn, err := d.DialContext(ctx, "tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(localPort)))
+	if err != nil {
+		return
+	}
+	defer localConn.Close()
+
+	// reads from the public side are bytes in, writes to it bytes out
+	publicConn = lb.traffic.Conn(publicConn)
+
+	// closing either side ends both copies
+	stop := context.AfterFunc(ctx, func() {
+		publicConn.Close()
+		localConn.Close()
+	})
+	defer stop()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(localConn, publicConn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(publicConn, localConn)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// Dial opens a connection to the public side, as a tunnel client would.
+func (lb *Loopback) Dial(ctx context.Context) (net.Conn, error) {
+	lb.mu.RLock()
+	ln := lb.listener
+	connected := lb.connected
+	lb.mu.RUnlock()
+
+	if !connected {
+		return nil, fmt.Errorf("loopback: %w", tunnel.ErrNotConnected)
+	}
+	if mem, ok := ln.(*memListener); ok {
+		return mem.dial(ctx)
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", ln.Addr().String())
+}
+
+// Client returns an HTTP client whose requests reach the public side
+// through Dial, whatever host the request URL names.
+func (lb *Loopback) Client() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return lb.Dial(ctx)
+			},
+		},
+		Timeout: httpClientTimeout,
+	}
+}
+
+// Close stops the listener and drops every forwarded connection.
+func (lb *Loopback) Close() error {
+	lb.mu.Lock()
+	if !lb.connected {
+		lb.mu.Unlock()
+		return nil
+	}
+	lb.connected = false
+	lb.publicURL = ""
+	lb.cancel()
+	err := lb.listener.Close()
+	lb.mu.Unlock()
+
+	lb.wg.Wait()
+	return err
+}
+
+// IsConnected returns true between Connect and Close.
+func (lb *Loopback) IsConnected() bool {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+	return lb.connected
+}
+
+// PublicURL returns the URL of the public side, "" when not connected.
+func (lb *Loopback) PublicURL() string {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+	return lb.publicURL
+}
+
+// Name returns the provider name.
+func (lb *Loopback) Name() string {
+	return loopbackProviderName
+}
+
+// Capabilities reports that the loopback forwards raw TCP.
+func (lb *Loopback) Capabilities() tunnel.Capabilities {
+	return tunnel.Capabilities{SupportsTCP: true}
+}
+
+// Traffic returns the bytes received from and sent to the public side.
+func (lb *Loopback) Traffic() (in, out int64) {
+	return lb.traffic.BytesIn(), lb.traffic.BytesOut()
+}
+
+// memListener is an in-memory net.Listener, connections are net.Pipe pairs.
+type memListener struct {
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newMemListener() *memListener {
+	return &memListener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+// dial hands the server end of a new pipe to Accept and returns the client end.
+func (l *memListener) dial(ctx context.Context) (net.Conn, error) {
+	client, server := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+	case <-ctx.Done():
+		client.Close()
+		server.Close()
+		return nil, ctx.Err()
+	}
+	client.Close()
+	server.Close()
+	return nil, fmt.Errorf("dial %s: %w", loopbackHost, net.ErrClosed)
+}
+
+func (l *memListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *memListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *memListener) Addr() net.Addr {
+	return memAddr{}
+}
+
+// memAddr is the address of a memListener.
+type memAddr struct{}
+
+func (memAddr) Network() string { return "memory" }
+func (memAddr) String() string  { return loopbackHost }
+
+// compile-time checks of the optional interfaces
+var (
+	_ tunnel.Provider           = (*Loopback)(nil)
+	_ tunnel.CapabilityReporter = (*Loopback)(nil)
+	_ tunnel.TrafficReporter    = (*Loopback)(nil)
+)
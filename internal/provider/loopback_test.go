@@ -0,0 +1,255 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kernelshard/expose/internal/tunnel"
+)
+
+// localPort returns the port of a httptest server.
+func localPort(t *testing.T, srv *httptest.Server) int {
+	t.Helper()
+	_, portStr, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return port
+}
+
+// TestLoopback_RoundTrip verifies a request through the in-memory public
+// side reaches the local server and its response comes back
+func TestLoopback_RoundTrip(t *testing.T) {
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(r.Method + " " + r.URL.Path + " " + string(body)))
+	}))
+	defer local.Close()
+
+	lb := NewLoopback()
+	url, err := lb.Connect(context.Background(), localPort(t, local))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lb.Close()
+
+	if url != "http://"+loopbackHost || lb.PublicURL() != url || !lb.IsConnected() {
+		t.Fatalf("unexpected state after Connect: url %q, connected %v", url, lb.IsConnected())
+	}
+
+	resp, err := lb.Client().Post(url+"/hook", "text/plain", strings.NewReader("ping"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "POST /hook ping" {
+		t.Errorf("expected the local server's echo, got %q", body)
+	}
+
+	// Close waits for the forwarded copies, so the counts are final
+	lb.Close()
+	if in, out := lb.Traffic(); in == 0 || out == 0 {
+		t.Errorf("expected traffic in both directions, got in %d out %d", in, out)
+	}
+}
+
+// TestLoopback_Service verifies the full Service and Manager flow over the loopback
+func TestLoopback_Service(t *testing.T) {
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello from local"))
+	}))
+	defer local.Close()
+
+	lb := NewLoopback()
+	svc := tunnel.NewService(lb, tunnel.WithProxy())
+	if err := svc.Start(context.Background(), localPort(t, local)); err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Close()
+
+	resp, err := lb.Client().Get(svc.PublicURL() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || string(body) != "hello from local" {
+		t.Errorf("expected 200 from the local server, got %d %q", resp.StatusCode, body)
+	}
+	if stats := svc.Stats(); stats.Requests != 1 {
+		t.Errorf("expected the proxy to count 1 request, got %d", stats.Requests)
+	}
+}
+
+// TestLoopback_TCP verifies WithLoopbackTCP serves the public side on a real address
+func TestLoopback_TCP(t *testing.T) {
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer local.Close()
+
+	lb := NewLoopback(WithLoopbackTCP("127.0.0.1:0"))
+	url, err := lb.Connect(context.Background(), localPort(t, local))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lb.Close()
+
+	if !strings.HasPrefix(url, "http://127.0.0.1:") {
+		t.Fatalf("expected a 127.0.0.1 URL, got %q", url)
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ok" {
+		t.Errorf("expected ok, got %q", body)
+	}
+}
+
+// TestLoopback_Workers verifies a flood of connections never has more
+// than the configured number forwarded at once, and the rest get their
+// turn as earlier ones close
+func TestLoopback_Workers(t *testing.T) {
+	const workers, clients = 3, 20
+
+	local, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Close()
+
+	var active, peak, served atomic.Int64
+	release := make(chan struct{})
+	go func() {
+		for {
+			conn, err := local.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				n := active.Add(1)
+				for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+				}
+				<-release
+				active.Add(-1)
+				served.Add(1)
+			}()
+		}
+	}()
+
+	lb := NewLoopback(WithLoopbackTCP("127.0.0.1:0"), WithLoopbackWorkers(workers))
+	url, err := lb.Connect(context.Background(), local.Addr().(*net.TCPAddr).Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lb.Close()
+
+	addr := strings.TrimPrefix(url, "http://")
+	for range clients {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for active.Load() < workers {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d forwarded connections, got %d", workers, active.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// give any connection slipping past the bound time to show up
+	time.Sleep(100 * time.Millisecond)
+	if got := peak.Load(); got > workers {
+		t.Fatalf("expected at most %d forwarded connections, saw %d", workers, got)
+	}
+
+	close(release)
+	deadline = time.Now().Add(5 * time.Second)
+	for served.Load() < clients {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected all %d connections to be forwarded, got %d", clients, served.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := peak.Load(); got > workers {
+		t.Errorf("expected at most %d forwarded connections, saw %d", workers, got)
+	}
+}
+
+// TestLoopback_Close verifies Close stops accepting and allows reconnecting
+func TestLoopback_Close(t *testing.T) {
+	lb := NewLoopback()
+	if _, err := lb.Connect(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lb.Connect(context.Background(), 1); err == nil {
+		t.Error("expected a second Connect to fail")
+	}
+
+	if err := lb.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if lb.IsConnected() || lb.PublicURL() != "" {
+		t.Error("expected no connection or URL after Close")
+	}
+	if _, err := lb.Dial(context.Background()); err == nil {
+		t.Error("expected Dial to fail after Close")
+	}
+
+	if _, err := lb.Connect(context.Background(), 1); err != nil {
+		t.Errorf("expected Connect after Close to succeed, got %v", err)
+	}
+	lb.Close()
+}
+
+// TestLoopback_Reconnect verifies Reconnect opens a fresh public side to the same local port
+func TestLoopback_Reconnect(t *testing.T) {
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer local.Close()
+
+	lb := NewLoopback(WithLoopbackTCP("127.0.0.1:0"))
+	first, err := lb.Connect(context.Background(), localPort(t, local))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lb.Close()
+
+	url, err := lb.Reconnect(context.Background(), localPort(t, local))
+	if err != nil {
+		t.Fatalf("Reconnect() error = %v", err)
+	}
+	if url == first || lb.PublicURL() != url {
+		t.Errorf("expected a fresh URL, got %s (was %s)", url, first)
+	}
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ok" {
+		t.Errorf("expected the local server behind the new URL, got %q", body)
+	}
+}
@@ -0,0 +1,297 @@
+package provider
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/kernelshard/expose/internal/tunnel"
+)
+
+// defaultProcessTimeout bounds the wait for a command to announce its URL.
+const defaultProcessTimeout = 30 * time.Second
+
+// ProcessConfig describes a provider that runs a command which announces
+// its public URL in its output, e.g. cloudflared, ngrok, bore or ssh -R.
+type ProcessConfig struct {
+	// Name of the provider, see tunnel.Provider
+	Name string
+	// Command is the binary to run, looked up in PATH
+	Command string
+	// Args returns the command arguments exposing localPort
+	Args func(localPort int) []string
+	// Env is added to the environment of the command, e.g. credentials
+	// that must not show up in `ps`
+	Env []string
+
+	// URL matches the public URL in the command's stdout and stderr
+	URL *regexp.Regexp
+	// MatchURL extracts the public URL from an output line, "" when there
+	// is none. It takes precedence over URL for commands that need more
+	// than a regex.
+	MatchURL func(line string) string
+
+	// Timeout bounds the wait for the URL, zero means 30s
+	Timeout time.Duration
+	// Output receives the command's output lines, nil discards them
+	Output io.Writer
+}
+
+// ProcessProvider is a tunnel.Provider running a command per tunnel. The
+// first URL the command prints is the public URL, later ones update it.
+// The command runs in its own process group, Close kills the whole group.
+type ProcessProvider struct {
+	cfg ProcessConfig
+
+	mu        sync.RWMutex
+	cmd       *exec.Cmd
+	publicURL string
+	// localPort of the last Connect, Reconnect restarts the command for it
+	localPort int
+	// exited is the last command seen exiting
+	exited *exec.Cmd
+
+	// execCommand builds the command, swapped in tests
+	execCommand func(ctx context.Context, name string, args ...string) *exec.Cmd
+	// lookPath resolves the command, swapped in tests
+	lookPath func(file string) (string, error)
+
+	// onURLChange is called whenever publicURL is updated
+	onURLChange func(url string)
+}
+
+// NewProcessProvider creates a provider running the command described by cfg.
+func NewProcessProvider(cfg ProcessConfig) *ProcessProvider {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultProcessTimeout
+	}
+	return &ProcessProvider{
+		cfg:         cfg,
+		execCommand: exec.CommandContext,
+		lookPath:    exec.LookPath,
+	}
+}
+
+// Connect starts the command for localPort and returns the URL it announces.
+func (p *ProcessProvider) Connect(ctx context.Context, localPort int) (string, error) {
+	url, cmd, err := p.start(ctx, localPort, p.cfg.Timeout)
+	if err != nil {
+		return "", err
+	}
+	p.connected(cmd, localPort, url)
+	return url, nil
+}
+
+// connected records the running cmd and the URL it announced.
+func (p *ProcessProvider) connected(cmd *exec.Cmd, localPort int, url string) {
+	p.mu.Lock()
+	p.cmd = cmd
+	p.localPort = localPort
+	p.mu.Unlock()
+
+	p.setPublicURL(url)
+}
+
+// Reconnect restarts the command for localPort.
+func (p *ProcessProvider) Reconnect(ctx context.Context, localPort int) (string, error) {
+	// a dead process can't be killed, that's not a reason to give up
+	_ = p.Close()
+	return p.Connect(ctx, localPort)
+}
+
+// setPublicURL updates the public URL and notifies the OnURLChange
+// callback if it changed. Safe for concurrent use.
+func (p *ProcessProvider) setPublicURL(url string) {
+	p.mu.Lock()
+	if p.publicURL == url {
+		p.mu.Unlock()
+		return
+	}
+	p.publicURL = url
+	notify := p.onURLChange
+	p.mu.Unlock()
+
+	if notify != nil {
+		notify(url)
+	}
+}
+
+// OnURLChange registers fn to be called whenever the public URL changes.
+func (p *ProcessProvider) OnURLChange(fn func(url string)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onURLChange = fn
+}
+
+// Close kills the command's process group.
+func (p *ProcessProvider) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cmd == nil || p.cmd.Process == nil {
+		return nil
+	}
+	err := killProcess(p.cmd)
+	p.cmd = nil
+	p.publicURL = ""
+	// cancelling Connect's context already killed it
+	if errors.Is(err, os.ErrProcessDone) {
+		return nil
+	}
+	return err
+}
+
+// PublicURL returns the URL the command announced.
+func (p *ProcessProvider) PublicURL() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.publicURL
+}
+
+// IsConnected reports whether the command is still running.
+func (p *ProcessProvider) IsConnected() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.cmd != nil && p.cmd != p.exited
+}
+
+// HealthCheck reports whether the command is still running.
+func (p *ProcessProvider) HealthCheck(ctx context.Context) error {
+	if !p.IsConnected() {
+		return fmt.Errorf("%w: %s is not running", tunnel.ErrNotConnected, p.cfg.Command)
+	}
+	return nil
+}
+
+// processExited records that cmd has exited and been reaped.
+func (p *ProcessProvider) processExited(cmd *exec.Cmd) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.exited = cmd
+}
+
+// Name returns the configured provider name.
+func (p *ProcessProvider) Name() string {
+	return p.cfg.Name
+}
+
+// Available checks that the command is installed.
+func (p *ProcessProvider) Available() error {
+	if _, err := p.lookPath(p.cfg.Command); err != nil {
+		return fmt.Errorf("%w: %s not found in PATH: %w", tunnel.ErrProviderUnavailable, p.cfg.Command, err)
+	}
+	return nil
+}
+
+// matchURL returns the public URL in line, "" when there is none.
+func (p *ProcessProvider) matchURL(line string) string {
+	if p.cfg.MatchURL != nil {
+		return p.cfg.MatchURL(line)
+	}
+	if p.cfg.URL != nil {
+		return p.cfg.URL.FindString(line)
+	}
+	return ""
+}
+
+// start runs the command for port and waits for it to announce the URL.
+// The command keeps running afterwards, its output is read for its whole
+// lifetime so it never blocks on a full pipe. It fails when the command
+// exits first, timeout passes or ctx is done, killing the process group.
+func (p *ProcessProvider) start(ctx context.Context, port int, timeout time.Duration) (string, *exec.Cmd, error) {
+	var args []string
+	if p.cfg.Args != nil {
+		args = p.cfg.Args(port)
+	}
+
+	cmd := p.execCommand(ctx, p.cfg.Command, args...)
+	if len(p.cfg.Env) > 0 {
+		env := cmd.Env
+		if env == nil {
+			env = os.Environ()
+		}
+		cmd.Env = append(env, p.cfg.Env...)
+	}
+	setProcessGroup(cmd)
+	if cmd.Cancel != nil {
+		// ctx cancellation takes the children down too
+		cmd.Cancel = func() error { return killProcess(cmd) }
+	}
+
+	// stdout and stderr share a pipe, tools differ in where they print
+	r, w, err := os.Pipe()
+	if err != nil {
+		return "", nil, fmt.Errorf("create output pipe: %w", err)
+	}
+	cmd.Stdout, cmd.Stderr = w, w
+	err = cmd.Start()
+	w.Close() // the child holds its own copy
+	if err != nil {
+		r.Close()
+		return "", nil, fmt.Errorf("start %s: %w", p.cfg.Command, err)
+	}
+
+	urlCh := make(chan string, 1)
+	errCh := make(chan error, 1)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer r.Close()
+		scanner := bufio.NewScanner(r)
+		announced := false
+		for scanner.Scan() {
+			line := scanner.Text()
+			if p.cfg.Output != nil {
+				fmt.Fprintln(p.cfg.Output, line)
+			}
+
+			url := p.matchURL(line)
+			switch {
+			case url == "":
+			case !announced:
+				announced = true
+				urlCh <- url
+			default:
+				// some commands re-announce a new URL, keep PublicURL current
+				p.setPublicURL(url)
+			}
+		}
+		// the output closed, so the process is gone: reap it
+		_ = cmd.Wait()
+		if announced {
+			p.processExited(cmd)
+			return
+		}
+
+		if err := scanner.Err(); err != nil {
+			errCh <- fmt.Errorf("read %s output: %w", p.cfg.Command, err)
+		} else {
+			errCh <- fmt.Errorf("%s exited without providing URL", p.cfg.Command)
+		}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case url := <-urlCh:
+		return url, cmd, nil
+
+	case err = <-errCh:
+	case <-timer.C:
+		err = fmt.Errorf("timeout waiting for %s URL", p.cfg.Command)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	_ = killProcess(cmd)
+	<-done
+	return "", nil, err
+}
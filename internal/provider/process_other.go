@@ -0,0 +1,13 @@
+//go:build !unix
+
+package provider
+
+import "os/exec"
+
+// setProcessGroup is a no-op, process groups are a unix feature.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcess kills cmd itself; children it spawned are left running.
+func killProcess(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,207 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kernelshard/expose/internal/tunnel"
+)
+
+var testURLRegex = regexp.MustCompile(`https://[a-z]+\.tunnel\.test`)
+
+// TestProcessHelper is not a real test, it stands in for a tunnel command
+// when re-executed by helperCommand. It prints PROCESS_HELPER_OUTPUT to
+// stdout and then behaves as PROCESS_HELPER_MODE says.
+func TestProcessHelper(t *testing.T) {
+	mode := os.Getenv("PROCESS_HELPER_MODE")
+	if mode == "" {
+		return
+	}
+	if mode == "spawn" {
+		// a child sharing our output, like ssh or a wrapper script would
+		child := exec.Command(os.Args[0], "-test.run=TestProcessHelper")
+		child.Env = append(os.Environ(), "PROCESS_HELPER_MODE=run", "PROCESS_HELPER_OUTPUT=")
+		child.Stdout = os.Stdout
+		if err := child.Start(); err != nil {
+			os.Exit(2)
+		}
+	}
+	if out := os.Getenv("PROCESS_HELPER_OUTPUT"); out != "" {
+		fmt.Println(out)
+	}
+	if mode == "exit" {
+		os.Exit(1)
+	}
+	// keep running like a tunnel command until killed
+	time.Sleep(10 * time.Second)
+	os.Exit(0)
+}
+
+// helperCommand returns an execCommand replacement running TestProcessHelper.
+func helperCommand(mode, output string) func(context.Context, string, ...string) *exec.Cmd {
+	return func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		cmd := exec.CommandContext(ctx, os.Args[0], "-test.run=TestProcessHelper")
+		cmd.Env = append(os.Environ(), "PROCESS_HELPER_MODE="+mode, "PROCESS_HELPER_OUTPUT="+output)
+		return cmd
+	}
+}
+
+// newTestProcess returns a ProcessProvider running TestProcessHelper.
+func newTestProcess(mode, output string, timeout time.Duration) *ProcessProvider {
+	p := NewProcessProvider(ProcessConfig{
+		Name:    "Test",
+		Command: "tunnel-test",
+		Args:    func(port int) []string { return []string{"--port", fmt.Sprint(port)} },
+		URL:     testURLRegex,
+		Timeout: timeout,
+	})
+	p.execCommand = helperCommand(mode, output)
+	return p
+}
+
+// TestProcessProvider_URLFound verifies the URL printed on stdout becomes
+// the public URL and Close stops the command
+func TestProcessProvider_URLFound(t *testing.T) {
+	p := newTestProcess("run", "ready at https://abc.tunnel.test", 5*time.Second)
+
+	url, err := p.Connect(context.Background(), 3000)
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	if url != "https://abc.tunnel.test" || p.PublicURL() != url {
+		t.Errorf("expected the announced URL, got %s (PublicURL %s)", url, p.PublicURL())
+	}
+	if err := tunnel.HealthCheck(context.Background(), p); err != nil {
+		t.Errorf("expected a running command to be healthy, got %v", err)
+	}
+
+	if err := p.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if p.IsConnected() || p.PublicURL() != "" {
+		t.Error("expected no connection or URL after Close")
+	}
+}
+
+// TestProcessProvider_Failures verifies Connect gives up, killing the
+// command, when it times out, exits early or ctx is cancelled
+func TestProcessProvider_Failures(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		timeout time.Duration
+		ctx     func() (context.Context, context.CancelFunc)
+		want    string
+	}{
+		{
+			name:    "timeout",
+			mode:    "run",
+			timeout: 100 * time.Millisecond,
+			want:    "timeout waiting for tunnel-test URL",
+		},
+		{
+			name:    "early exit",
+			mode:    "exit",
+			timeout: 5 * time.Second,
+			want:    "tunnel-test exited without providing URL",
+		},
+		{
+			name:    "context cancel",
+			mode:    "run",
+			timeout: 5 * time.Second,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 100*time.Millisecond)
+			},
+			want: context.DeadlineExceeded.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProcess(tt.mode, "no url here", tt.timeout)
+			ctx, cancel := context.Background(), context.CancelFunc(func() {})
+			if tt.ctx != nil {
+				ctx, cancel = tt.ctx()
+			}
+			defer cancel()
+
+			start := time.Now()
+			_, err := p.Connect(ctx, 3000)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected %q error, got %v", tt.want, err)
+			}
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("expected Connect to give up promptly, took %v", elapsed)
+			}
+			if p.IsConnected() {
+				t.Error("expected no connection after a failed Connect")
+			}
+		})
+	}
+}
+
+// TestProcessProvider_KillsProcessGroup verifies Close also stops the
+// children of the command: its output only closes once they are all gone
+func TestProcessProvider_KillsProcessGroup(t *testing.T) {
+	p := newTestProcess("spawn", "https://group.tunnel.test", 5*time.Second)
+	if _, err := p.Connect(context.Background(), 3000); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	p.mu.RLock()
+	cmd := p.cmd
+	p.mu.RUnlock()
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		p.mu.RLock()
+		reaped := p.exited == cmd
+		p.mu.RUnlock()
+		if reaped {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the command and its child to be gone after Close")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestProcessProvider_Env verifies Env is added to the command environment
+func TestProcessProvider_Env(t *testing.T) {
+	p := newTestProcess("run", "https://env.tunnel.test", 5*time.Second)
+	p.cfg.Env = []string{"TUNNEL_SECRET=s3cret"}
+
+	if _, err := p.Connect(context.Background(), 3000); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer p.Close()
+
+	p.mu.RLock()
+	env := p.cmd.Env
+	p.mu.RUnlock()
+	if env[len(env)-1] != "TUNNEL_SECRET=s3cret" {
+		t.Errorf("expected TUNNEL_SECRET in the environment, got %v", env[len(env)-1])
+	}
+}
+
+// TestProcessProvider_Available verifies a missing command is reported as unavailable
+func TestProcessProvider_Available(t *testing.T) {
+	p := newTestProcess("run", "", time.Second)
+	p.lookPath = func(file string) (string, error) { return "", exec.ErrNotFound }
+
+	err := tunnel.Available(p)
+	if !errors.Is(err, tunnel.ErrProviderUnavailable) || !strings.Contains(err.Error(), "tunnel-test not found") {
+		t.Errorf("expected ErrProviderUnavailable naming the command, got %v", err)
+	}
+}
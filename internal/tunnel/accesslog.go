@@ -0,0 +1,153 @@
+package tunnel
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AccessLogFormat selects the Apache-style access log line format.
+type AccessLogFormat string
+
+const (
+	// AccessLogCommon is the NCSA common log format.
+	AccessLogCommon AccessLogFormat = "common"
+	// AccessLogCombined is the common format plus referer and user agent.
+	AccessLogCombined AccessLogFormat = "combined"
+)
+
+// accessLogTime is the timestamp layout of Apache access logs.
+const accessLogTime = "02/Jan/2006:15:04:05 -0700"
+
+// ParseAccessLogFormat validates an access log format name.
+func ParseAccessLogFormat(name string) (AccessLogFormat, error) {
+	switch f := AccessLogFormat(name); f {
+	case AccessLogCommon, AccessLogCombined:
+		return f, nil
+	default:
+		return "", fmt.Errorf("invalid access log format %q (must be common or combined)", name)
+	}
+}
+
+// WithAccessLog writes one Apache-style line per proxied request to w.
+func WithAccessLog(w io.Writer, format AccessLogFormat) ManagerOption {
+	return func(m *Manager) {
+		m.accessLog = w
+		m.accessLogFormat = format
+	}
+}
+
+// responseTracker records the status code and body size of a response.
+type responseTracker struct {
+	http.ResponseWriter
+	status int // 0 until the headers are sent
+	size   int64
+}
+
+func (t *responseTracker) WriteHeader(code int) {
+	// an interim 1xx such as 100 Continue is followed by the real status
+	if t.status == 0 && (code >= 200 || code == http.StatusSwitchingProtocols) {
+		t.status = code
+	}
+	t.ResponseWriter.WriteHeader(code)
+}
+
+func (t *responseTracker) Write(p []byte) (int, error) {
+	if t.status == 0 {
+		t.status = http.StatusOK
+	}
+	n, err := t.ResponseWriter.Write(p)
+	t.size += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (t *responseTracker) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+// logAccess wraps next with the access log, if one is configured.
+// Aborted responses are logged too, with the status sent so far.
+func (m *Manager) logAccess(next http.Handler) http.Handler {
+	if m.accessLog == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &responseTracker{ResponseWriter: w}
+		defer func() {
+			m.writeAccessLog(formatAccessLog(m.accessLogFormat, r, rw.status, rw.size, start))
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// writeAccessLog writes a single line, serialised across requests.
+func (m *Manager) writeAccessLog(line string) {
+	m.accessLogMu.Lock()
+	defer m.accessLogMu.Unlock()
+	if _, err := io.WriteString(m.accessLog, line); err != nil {
+		m.logger.Debug("failed to write access log", "err", err)
+	}
+}
+
+// formatAccessLog renders a request as an access log line, e.g.
+//
+//	203.0.113.7 - - [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.1" 200 2326 "http://example.com/" "curl/8.0"
+//
+// The client is the last X-Forwarded-For entry when the tunnel provides one.
+func formatAccessLog(format AccessLogFormat, r *http.Request, status int, size int64, start time.Time) string {
+	bytes := "-"
+	if size > 0 {
+		bytes = strconv.FormatInt(size, 10)
+	}
+
+	user := "-"
+	if u, _, ok := r.BasicAuth(); ok && u != "" {
+		user = quoteEscape(u)
+	}
+
+	line := fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %s`,
+		clientHost(r), user, start.Format(accessLogTime),
+		r.Method, quoteEscape(r.RequestURI), r.Proto, status, bytes)
+
+	if format == AccessLogCombined {
+		line += fmt.Sprintf(` "%s" "%s"`, orDash(quoteEscape(r.Referer())), orDash(quoteEscape(r.UserAgent())))
+	}
+	return line + "\n"
+}
+
+// clientHost returns the originating client address of r. Earlier
+// X-Forwarded-For entries come from the client and can't be trusted, only
+// the last one, appended by the tunnel server, is used.
+func clientHost(r *http.Request) string {
+	if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+		last := fwd[len(fwd)-1]
+		if i := strings.LastIndex(last, ","); i >= 0 {
+			last = last[i+1:]
+		}
+		if last = strings.TrimSpace(last); last != "" {
+			return last
+		}
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return orDash(r.RemoteAddr)
+}
+
+// quoteEscape escapes characters that would break a quoted log field.
+func quoteEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
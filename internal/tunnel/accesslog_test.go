@@ -0,0 +1,86 @@
+package tunnel
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestManager_AccessLog_Combined(t *testing.T) {
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}))
+	defer localServer.Close()
+
+	var logs bytes.Buffer
+	m := NewManager(serverPort(t, localServer), WithAccessLog(&logs, AccessLogCombined))
+
+	req := httptest.NewRequest("POST", "/items?id=1", nil)
+	// the client's own entry is ignored, the tunnel server appended the last one
+	req.Header.Set("X-Forwarded-For", "10.0.0.1, 203.0.113.7")
+	req.Header.Set("Referer", "https://example.com/")
+	req.Header.Set("User-Agent", `curl/8.0 "quoted"`)
+	m.logAccess(http.HandlerFunc(m.proxyHandler)).ServeHTTP(httptest.NewRecorder(), req)
+
+	want := regexp.MustCompile(`^203\.0\.113\.7 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] ` +
+		`"POST /items\?id=1 HTTP/1\.1" 201 5 "https://example\.com/" "curl/8\.0 \\"quoted\\""\n$`)
+	if !want.MatchString(logs.String()) {
+		t.Errorf("unexpected combined log line %q", logs.String())
+	}
+}
+
+func TestFormatAccessLog_Common(t *testing.T) {
+	start := time.Date(2000, time.October, 10, 13, 55, 36, 0, time.FixedZone("", -7*3600))
+	req := httptest.NewRequest("GET", "/a.gif", nil)
+	req.RemoteAddr = "192.0.2.1:5000"
+	req.SetBasicAuth("frank", "secret")
+
+	got := formatAccessLog(AccessLogCommon, req, http.StatusNotFound, 0, start)
+	want := `192.0.2.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.1" 404 -` + "\n"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestParseAccessLogFormat(t *testing.T) {
+	for _, name := range []string{"common", "combined"} {
+		if _, err := ParseAccessLogFormat(name); err != nil {
+			t.Errorf("expected %q to be valid, got %v", name, err)
+		}
+	}
+	if _, err := ParseAccessLogFormat("json"); err == nil {
+		t.Error("expected unknown format to be rejected")
+	}
+}
+
+// TestClientHost verifies only the X-Forwarded-For entry appended by the
+// tunnel server names the client, whatever the client sent before it
+func TestClientHost(t *testing.T) {
+	tests := []struct {
+		name string
+		fwd  []string
+		want string
+	}{
+		{"remote address", nil, "192.0.2.1"},
+		{"single entry", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"spoofed entries", []string{"10.0.0.1, 198.51.100.9,203.0.113.7"}, "203.0.113.7"},
+		{"several headers", []string{"10.0.0.1", "203.0.113.7"}, "203.0.113.7"},
+		{"empty last entry", []string{"10.0.0.1, "}, "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = "192.0.2.1:5000"
+			for _, v := range tt.fwd {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if got := clientHost(req); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package tunnel
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// Benchmarks of the proxy hot path against in-memory local servers, no
+// network beyond loopback. Run with
+//
+//	go test -run '^$' -bench . -benchmem ./internal/tunnel
+
+// benchSizes are the response body sizes the benchmarks proxy.
+var benchSizes = []int{1 << 10, 64 << 10, 1 << 20}
+
+// benchLocalServer starts a local server answering every request with a
+// body of size bytes, over h2c when http2 is set. dials counts the
+// connections it accepts.
+func benchLocalServer(b *testing.B, size int, http2 bool) (srv *httptest.Server, dials *atomic.Int64) {
+	b.Helper()
+	body := bytes.Repeat([]byte("x"), size)
+	srv = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(body)
+	}))
+	dials = new(atomic.Int64)
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			dials.Add(1)
+		}
+	}
+	if http2 {
+		srv.Config.Protocols = new(http.Protocols)
+		srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	}
+	srv.Start()
+	b.Cleanup(srv.Close)
+	return srv, dials
+}
+
+// discardResponseWriter is a http.ResponseWriter dropping the body, so
+// the benchmarks measure the proxy rather than a recorder's buffer.
+type discardResponseWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *discardResponseWriter) Header() http.Header         { return w.header }
+func (w *discardResponseWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *discardResponseWriter) WriteHeader(status int)      { w.status = status }
+
+// benchServe runs handler for b.N GET requests, reporting the body size
+// as the bytes processed per request.
+func benchServe(b *testing.B, handler http.Handler, size int) {
+	b.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/bench", nil)
+	req.Header.Set("User-Agent", "bench")
+
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		w := &discardResponseWriter{header: make(http.Header)}
+		handler.ServeHTTP(w, req)
+		if w.status != http.StatusOK {
+			b.Fatalf("expected 200, got %d", w.status)
+		}
+	}
+}
+
+// BenchmarkProxyHandler measures proxyHandler throughput over pooled
+// HTTP/1.1 connections, one shared HTTP/2 connection and a new connection
+// per request from a local server without keep-alive, reporting the local
+// connections opened per request as dials/op.
+func BenchmarkProxyHandler(b *testing.B) {
+	for _, mode := range []struct {
+		name        string
+		http2       bool
+		noKeepAlive bool
+	}{
+		{name: "dial per request", noKeepAlive: true},
+		{name: "pooled http1 connections"},
+		{name: "shared http2 connection", http2: true},
+	} {
+		for _, size := range benchSizes {
+			b.Run(fmt.Sprintf("%s/%dKB", mode.name, size>>10), func(b *testing.B) {
+				local, dials := benchLocalServer(b, size, mode.http2)
+				local.Config.SetKeepAlivesEnabled(!mode.noKeepAlive)
+				m := NewManager(serverPort(b, local), WithLocalHTTP2(mode.http2), WithLogger(slog.New(slog.DiscardHandler)))
+				b.Cleanup(func() { m.Close() })
+
+				benchServe(b, http.HandlerFunc(m.proxyHandler), size)
+				b.ReportMetric(float64(dials.Load())/float64(b.N), "dials/op")
+			})
+		}
+	}
+}
+
+// BenchmarkProxyHandler_Parallel measures proxyHandler under concurrent
+// requests, as a tunnel serving several clients sees them.
+func BenchmarkProxyHandler_Parallel(b *testing.B) {
+	const size = 64 << 10
+	local, _ := benchLocalServer(b, size, false)
+	m := NewManager(serverPort(b, local), WithLogger(slog.New(slog.DiscardHandler)))
+	b.Cleanup(func() { m.Close() })
+
+	b.SetBytes(size)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		req := httptest.NewRequest(http.MethodGet, "/bench", nil)
+		for pb.Next() {
+			w := &discardResponseWriter{header: make(http.Header)}
+			m.proxyHandler(w, req)
+			if w.status != http.StatusOK {
+				b.Errorf("expected 200, got %d", w.status)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkAccessLog measures the overhead of the access log on the
+// handler chain the proxy server runs.
+func BenchmarkAccessLog(b *testing.B) {
+	const size = 1 << 10
+	for _, format := range []AccessLogFormat{"", AccessLogCommon, AccessLogCombined} {
+		name := string(format)
+		if name == "" {
+			name = "off"
+		}
+		b.Run(name, func(b *testing.B) {
+			local, _ := benchLocalServer(b, size, false)
+			opts := []ManagerOption{WithLogger(slog.New(slog.DiscardHandler))}
+			if format != "" {
+				opts = append(opts, WithAccessLog(io.Discard, format))
+			}
+			m := NewManager(serverPort(b, local), opts...)
+			b.Cleanup(func() { m.Close() })
+
+			benchServe(b, m.logAccess(http.HandlerFunc(m.proxyHandler)), size)
+		})
+	}
+}
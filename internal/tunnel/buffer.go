@@ -0,0 +1,49 @@
+package tunnel
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+// DefaultBufferLimit caps a buffered response body, see WithBufferResponses.
+const DefaultBufferLimit = 10 << 20
+
+// errBufferLimit marks a response body larger than the buffer limit.
+var errBufferLimit = errors.New("response exceeds the buffer limit")
+
+// WithBufferResponses reads each response body from the local server fully,
+// up to limit bytes, before sending it with an exact Content-Length. An
+// upstream failure midway then gets a clean 502 instead of a truncated
+// response; bodies over the limit get a 502 too. Zero or negative streams
+// responses as they arrive, the default.
+func WithBufferResponses(limit int64) ManagerOption {
+	return func(m *Manager) {
+		m.bufferLimit = max(limit, 0)
+	}
+}
+
+// bufferBody reads all of body, failing with errBufferLimit as soon as
+// more than limit bytes are announced or received.
+func bufferBody(body io.Reader, declared, limit int64) ([]byte, error) {
+	if declared > limit {
+		return nil, errBufferLimit
+	}
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, errBufferLimit
+	}
+	return data, nil
+}
+
+// bodyAllowed reports whether a response to r with status may carry a body,
+// and so a Content-Length describing it.
+func bodyAllowed(r *http.Request, status int) bool {
+	if r.Method == http.MethodHead {
+		return false
+	}
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
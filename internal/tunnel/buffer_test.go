@@ -0,0 +1,210 @@
+package tunnel
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// chunkedServer answers with body in two flushed chunks and no Content-Length.
+func chunkedServer(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		half := len(body) / 2
+		io.WriteString(w, body[:half])
+		w.(http.Flusher).Flush()
+		io.WriteString(w, body[half:])
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// proxyGet starts m and sends a GET through it.
+func proxyGet(t *testing.T, m *Manager) (*http.Response, string) {
+	t.Helper()
+	startManager(t, m)
+
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/", m.ListenPort()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+// TestManager_StreamsByDefault verifies responses are streamed without a Content-Length
+func TestManager_StreamsByDefault(t *testing.T) {
+	// bigger than the proxy server's write buffer, so it can't size the body itself
+	srv := chunkedServer(t, strings.Repeat("x", 8<<10))
+
+	resp, body := proxyGet(t, NewManager(serverPort(t, srv)))
+	if body != strings.Repeat("x", 8<<10) {
+		t.Errorf("unexpected body %q", body)
+	}
+	if resp.ContentLength != -1 {
+		t.Errorf("expected a streamed response without Content-Length, got %d", resp.ContentLength)
+	}
+}
+
+// TestManager_BufferResponses verifies buffered responses get an exact Content-Length
+func TestManager_BufferResponses(t *testing.T) {
+	srv := chunkedServer(t, strings.Repeat("x", 8<<10))
+
+	resp, body := proxyGet(t, NewManager(serverPort(t, srv), WithBufferResponses(16<<10)))
+	if resp.StatusCode != http.StatusOK || body != strings.Repeat("x", 8<<10) {
+		t.Fatalf("unexpected response %d, %d bytes", resp.StatusCode, len(body))
+	}
+	if resp.ContentLength != 8<<10 || len(resp.TransferEncoding) != 0 {
+		t.Errorf("expected Content-Length %d and no chunking, got %d %v", 8<<10, resp.ContentLength, resp.TransferEncoding)
+	}
+}
+
+// TestManager_BufferLimit verifies bodies over the cap get a 502, announced or not
+func TestManager_BufferLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"chunked", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, strings.Repeat("x", 50))
+			w.(http.Flusher).Flush()
+			io.WriteString(w, strings.Repeat("x", 50))
+		}},
+		{"content-length", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", "100")
+			io.WriteString(w, strings.Repeat("x", 100))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+
+			resp, body := proxyGet(t, NewManager(serverPort(t, srv), WithBufferResponses(64)))
+			if resp.StatusCode != http.StatusBadGateway || !strings.Contains(body, "64 byte buffer limit") {
+				t.Errorf("expected 502 naming the limit, got %d %q", resp.StatusCode, body)
+			}
+		})
+	}
+}
+
+// TestManager_BufferUpstreamFailure verifies a body cut off midway gets a clean 502 when buffering
+func TestManager_BufferUpstreamFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		io.WriteString(w, "partial")
+		w.(http.Flusher).Flush()
+		conn, _, _ := http.NewResponseController(w).Hijack()
+		conn.Close()
+	}))
+	defer srv.Close()
+
+	resp, _ := proxyGet(t, NewManager(serverPort(t, srv), WithBufferResponses(1024)))
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("expected 502, got %d", resp.StatusCode)
+	}
+}
+
+// TestManager_BodylessResponses verifies a 204, a 304 and the answer to a
+// HEAD reach the client without a body or a made-up Content-Length, with
+// their headers intact, streamed or buffered
+func TestManager_BodylessResponses(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		response string
+		wantHead []string // header lines expected
+		noLength bool
+	}{
+		{
+			name:     "204",
+			method:   http.MethodDelete,
+			response: "HTTP/1.1 204 No Content\r\nX-Deleted: 1\r\n\r\n",
+			wantHead: []string{"HTTP/1.1 204 No Content", "X-Deleted: 1"},
+			noLength: true,
+		},
+		{
+			name:     "304",
+			method:   http.MethodGet,
+			response: "HTTP/1.1 304 Not Modified\r\nEtag: \"v1\"\r\nCache-Control: max-age=60\r\n\r\n",
+			wantHead: []string{"HTTP/1.1 304 Not Modified", `Etag: "v1"`, "Cache-Control: max-age=60"},
+			noLength: true,
+		},
+		{
+			name:     "HEAD of a large resource",
+			method:   http.MethodHead,
+			response: "HTTP/1.1 200 OK\r\nContent-Length: 4096\r\n\r\n",
+			wantHead: []string{"HTTP/1.1 200 OK", "Content-Length: 4096"},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, buffer := range []int64{0, 1024} {
+			t.Run(fmt.Sprintf("%s/buffer=%d", tt.name, buffer), func(t *testing.T) {
+				m := NewManager(rawUpstream(t, tt.response), WithBufferResponses(buffer))
+				startManager(t, m)
+
+				conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", m.ListenPort()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(5 * time.Second))
+				fmt.Fprintf(conn, "%s / HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n", tt.method)
+
+				raw, err := io.ReadAll(conn)
+				if err != nil {
+					t.Fatal(err)
+				}
+				head, body, _ := strings.Cut(string(raw), "\r\n\r\n")
+				if body != "" {
+					t.Errorf("expected no body, got %q", body)
+				}
+				for _, line := range tt.wantHead {
+					if !strings.Contains(head, line) {
+						t.Errorf("expected %q in the response head, got:\n%s", line, head)
+					}
+				}
+				if tt.noLength && strings.Contains(head, "Content-Length") {
+					t.Errorf("expected no Content-Length, got:\n%s", head)
+				}
+			})
+		}
+	}
+}
+
+func TestBodyAllowed(t *testing.T) {
+	get := httptest.NewRequest(http.MethodGet, "/", nil)
+	head := httptest.NewRequest(http.MethodHead, "/", nil)
+
+	tests := []struct {
+		name   string
+		r      *http.Request
+		status int
+		want   bool
+	}{
+		{"GET 200", get, http.StatusOK, true},
+		{"GET 404", get, http.StatusNotFound, true},
+		{"HEAD 200", head, http.StatusOK, false},
+		{"GET 204", get, http.StatusNoContent, false},
+		{"GET 304", get, http.StatusNotModified, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bodyAllowed(tt.r, tt.status); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package tunnel
+
+import (
+	"container/list"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheHeader reports whether a response was served from the cache.
+const CacheHeader = "X-Expose-Cache"
+
+// DefaultCacheSize is the default memory budget of the response cache.
+const DefaultCacheSize = 32 << 20
+
+// responseCache is a small in-memory LRU cache of GET responses,
+// bounded by total body size and entry age.
+type responseCache struct {
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	lru      *list.List // front is most recently used
+	size     int64
+	maxBytes int64
+	ttl      time.Duration
+	now      func() time.Time
+}
+
+// cachedResponse is a stored response, the body is kept in full.
+type cachedResponse struct {
+	key     string
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+func newResponseCache(maxBytes int64, ttl time.Duration) *responseCache {
+	return &responseCache{
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		now:      time.Now,
+	}
+}
+
+// cacheKey identifies a request in the cache. Accept-Encoding is part of
+// the key so a compressed body is never served to a client that can't read it.
+func cacheKey(r *http.Request) string {
+	return r.Method + " " + r.URL.RequestURI() + "\x00" + r.Header.Get("Accept-Encoding")
+}
+
+// cacheableRequest reports whether r may be answered from or stored in the cache.
+func cacheableRequest(r *http.Request) bool {
+	if r.Method != http.MethodGet || r.Header.Get("Authorization") != "" {
+		return false
+	}
+	cc := parseCacheControl(r.Header)
+	_, noStore := cc["no-store"]
+	_, noCache := cc["no-cache"]
+	return !noStore && !noCache
+}
+
+// cacheTTL returns how long resp may be cached for, 0 means not at all.
+func (c *responseCache) cacheTTL(resp *http.Response) time.Duration {
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Set-Cookie") != "" {
+		return 0
+	}
+
+	// the key only varies on Accept-Encoding
+	for _, v := range resp.Header.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			if f := strings.TrimSpace(field); f != "" && !strings.EqualFold(f, "Accept-Encoding") {
+				return 0
+			}
+		}
+	}
+
+	cc := parseCacheControl(resp.Header)
+	for _, directive := range []string{"no-store", "private", "no-cache"} {
+		if _, ok := cc[directive]; ok {
+			return 0
+		}
+	}
+
+	ttl := c.ttl
+	if v, ok := cc["max-age"]; ok {
+		age, err := strconv.Atoi(v)
+		if err != nil || age <= 0 {
+			return 0
+		}
+		ttl = min(ttl, time.Duration(age)*time.Second)
+	}
+	return ttl
+}
+
+// parseCacheControl returns the Cache-Control directives in h, lower-cased.
+func parseCacheControl(h http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, v := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(v, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name != "" {
+				directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+			}
+		}
+	}
+	return directives
+}
+
+// get returns the fresh entry for key, if any.
+func (c *responseCache) get(key string) (*cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*cachedResponse)
+	if c.now().After(entry.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return entry, true
+}
+
+// put stores a response for ttl, evicting the least recently used
+// entries to stay within maxBytes. Bodies larger than maxBytes are skipped.
+func (c *responseCache) put(key string, status int, header http.Header, body []byte, ttl time.Duration) {
+	size := int64(len(body))
+	if size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	for c.size+size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+
+	entry := &cachedResponse{
+		key:     key,
+		status:  status,
+		header:  header.Clone(),
+		body:    body,
+		expires: c.now().Add(ttl),
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	c.size += size
+}
+
+// remove drops el from the cache, the caller holds mu.
+func (c *responseCache) remove(el *list.Element) {
+	entry := c.lru.Remove(el).(*cachedResponse)
+	delete(c.entries, entry.key)
+	c.size -= int64(len(entry.body))
+}
+
+// limitedBuffer collects up to max bytes and reports overflow,
+// so a huge response is streamed but never cached.
+type limitedBuffer struct {
+	buf      []byte
+	max      int64
+	overflow bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if !b.overflow {
+		if int64(len(b.buf)+len(p)) > b.max {
+			b.overflow = true
+			b.buf = nil
+		} else {
+			b.buf = append(b.buf, p...)
+		}
+	}
+	return len(p), nil
+}
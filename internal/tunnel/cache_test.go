@@ -0,0 +1,116 @@
+package tunnel
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingServer answers every request with body and cacheControl, counting hits.
+func countingServer(t *testing.T, cacheControl string) (int, *atomic.Int64) {
+	t.Helper()
+	var hits atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if cacheControl != "" {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+		w.Write([]byte("hello"))
+	}))
+	t.Cleanup(srv.Close)
+	return serverPort(t, srv), &hits
+}
+
+// get proxies a GET for path through m and returns the recorded response.
+func get(m *Manager, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	m.proxyHandler(w, httptest.NewRequest("GET", path, nil))
+	return w
+}
+
+func TestManager_Cache_Hit(t *testing.T) {
+	port, hits := countingServer(t, "max-age=60")
+	m := NewManager(port, WithCache(DefaultCacheSize, time.Minute))
+
+	first := get(m, "/page")
+	if got := first.Header().Get(CacheHeader); got != "MISS" {
+		t.Errorf("expected MISS on first request, got %q", got)
+	}
+
+	second := get(m, "/page")
+	if got := second.Header().Get(CacheHeader); got != "HIT" {
+		t.Errorf("expected HIT on second request, got %q", got)
+	}
+	if second.Code != http.StatusOK || second.Body.String() != "hello" {
+		t.Errorf("expected cached 200 hello, got %d %q", second.Code, second.Body.String())
+	}
+	if hits.Load() != 1 {
+		t.Errorf("expected local server to be hit once, got %d", hits.Load())
+	}
+
+	// a different path is a different entry
+	get(m, "/other")
+	if hits.Load() != 2 {
+		t.Errorf("expected a miss for another path, got %d hits", hits.Load())
+	}
+}
+
+func TestManager_Cache_Bypass(t *testing.T) {
+	for _, cc := range []string{"no-store", "private, max-age=60", "max-age=0"} {
+		t.Run(cc, func(t *testing.T) {
+			port, hits := countingServer(t, cc)
+			m := NewManager(port, WithCache(DefaultCacheSize, time.Minute))
+
+			get(m, "/")
+			if got := get(m, "/").Header().Get(CacheHeader); got != "MISS" {
+				t.Errorf("expected MISS, got %q", got)
+			}
+			if hits.Load() != 2 {
+				t.Errorf("expected every request to reach the local server, got %d hits", hits.Load())
+			}
+		})
+	}
+}
+
+func TestManager_Cache_Disabled(t *testing.T) {
+	port, hits := countingServer(t, "max-age=60")
+	m := NewManager(port)
+
+	get(m, "/")
+	if got := get(m, "/").Header().Get(CacheHeader); got != "" {
+		t.Errorf("expected no cache header when disabled, got %q", got)
+	}
+	if hits.Load() != 2 {
+		t.Errorf("expected no caching, got %d hits", hits.Load())
+	}
+}
+
+func TestResponseCache_ExpiryAndEviction(t *testing.T) {
+	now := time.Now()
+	c := newResponseCache(10, time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.put("a", 200, http.Header{}, []byte("12345"), time.Second)
+	c.put("b", 200, http.Header{}, []byte("12345"), time.Minute)
+
+	// touch a so b becomes the least recently used
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("expected a to be cached")
+	}
+	c.put("c", 200, http.Header{}, []byte("123"), time.Minute)
+	if _, ok := c.get("b"); ok {
+		t.Error("expected b to be evicted to stay within the size cap")
+	}
+
+	now = now.Add(2 * time.Second)
+	if _, ok := c.get("a"); ok {
+		t.Error("expected a to expire after its ttl")
+	}
+
+	c.put("huge", 200, http.Header{}, make([]byte, 11), time.Minute)
+	if _, ok := c.get("huge"); ok {
+		t.Error("expected bodies over the size cap not to be cached")
+	}
+}
@@ -0,0 +1,39 @@
+package tunnel
+
+import "sync"
+
+// clientLimiter caps the concurrent requests of each client.
+type clientLimiter struct {
+	max    int
+	mu     sync.Mutex
+	active map[string]int
+}
+
+func newClientLimiter(max int) *clientLimiter {
+	return &clientLimiter{max: max, active: make(map[string]int)}
+}
+
+// acquire takes a slot for client, reporting false if it is at the cap.
+func (l *clientLimiter) acquire(client string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.active[client] >= l.max {
+		return false
+	}
+	l.active[client]++
+	return true
+}
+
+// release frees a slot taken by acquire.
+func (l *clientLimiter) release(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// drop idle clients so the map doesn't grow with every address seen
+	if l.active[client] <= 1 {
+		delete(l.active, client)
+		return
+	}
+	l.active[client]--
+}
@@ -0,0 +1,75 @@
+package tunnel
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// TestManager_MaxConnsPerClient verifies one client can't exceed its cap
+// while other clients are still served
+func TestManager_MaxConnsPerClient(t *testing.T) {
+	const limit = 2
+
+	// local server holding requests until released
+	entered := make(chan struct{}, 10)
+	release := make(chan struct{})
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+	}))
+	defer localServer.Close()
+
+	m := NewManager(serverPort(t, localServer), WithMaxConnsPerClient(limit))
+
+	request := func(client string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Forwarded-For", client)
+		w := httptest.NewRecorder()
+		m.proxyHandler(w, req)
+		return w
+	}
+
+	// fill the greedy client's slots
+	var wg sync.WaitGroup
+	codes := make(chan int, limit)
+	for range limit {
+		wg.Go(func() { codes <- request("203.0.113.7").Code })
+	}
+	for range limit {
+		<-entered
+	}
+
+	// one more from the same client is refused straight away
+	if w := request("203.0.113.7"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 for the excess request, got %d", w.Code)
+	} else if w.Header().Get("Retry-After") == "" {
+		t.Error("expected a Retry-After header")
+	}
+
+	// another client is unaffected
+	wg.Go(func() {
+		if w := request("198.51.100.1"); w.Code != http.StatusOK {
+			t.Errorf("expected other client to be served, got %d", w.Code)
+		}
+	})
+	<-entered
+
+	close(release)
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("expected requests within the cap to succeed, got %d", code)
+		}
+	}
+
+	// slots are freed once requests finish
+	if w := request("203.0.113.7"); w.Code != http.StatusOK {
+		t.Errorf("expected client to be served again, got %d", w.Code)
+	}
+	if n := len(m.perClient.active); n != 0 {
+		t.Errorf("expected idle clients to be forgotten, %d left", n)
+	}
+}
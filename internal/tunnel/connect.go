@@ -0,0 +1,120 @@
+package tunnel
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// WithConnect lets CONNECT requests open a raw TCP tunnel to the local
+// server. The requested authority is ignored, so the proxy can never be
+// used to reach other hosts. Without it CONNECT gets 405 Method Not Allowed.
+func WithConnect(enabled bool) ManagerOption {
+	return func(m *Manager) {
+		m.connect = enabled
+	}
+}
+
+// handleConnect answers a CONNECT request, tunneling it to the local
+// server when enabled by WithConnect.
+func (m *Manager) handleConnect(w http.ResponseWriter, r *http.Request) {
+	if !m.connect {
+		http.Error(w, "CONNECT is not supported by this tunnel (enable it with --allow-connect)", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// a tunnel holds its client's and an in-flight slot while it's open
+	release, ok := m.admit(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	releaseSlot, ok := m.acquireSlot(w, r)
+	if !ok {
+		return
+	}
+	defer releaseSlot()
+
+	// plain TCP, the client speaks whatever protocol it tunnels itself
+	local, err := m.dialLocalTCP(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to connect %s - is your server running?", m.localName()), http.StatusBadGateway)
+		return
+	}
+	defer local.Close()
+	if err := m.writeProxyHeader(local, r); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to announce the client to %s: %v", m.localName(), err), http.StatusBadGateway)
+		return
+	}
+
+	client, buf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "CONNECT tunneling is not supported on this connection", http.StatusInternalServerError)
+		return
+	}
+	defer client.Close()
+	// the http.Server no longer knows the connection, Close ends it
+	if !m.trackHijacked(client) {
+		return
+	}
+	defer m.untrackHijacked(client)
+
+	if _, err := io.WriteString(client, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		return
+	}
+
+	// bytes the client sent right after the request may already be buffered
+	var clientReader io.Reader = client
+	if n := buf.Reader.Buffered(); n > 0 {
+		clientReader = io.MultiReader(io.LimitReader(buf.Reader, int64(n)), client)
+	}
+
+	m.logger.Debug("CONNECT tunnel opened", "client", clientHost(r), "request_id", m.requestID(r))
+	pipe(client, clientReader, local)
+}
+
+// pipe copies between client and local until either side is done, then
+// closes both so the other copy ends too.
+func pipe(client net.Conn, clientReader io.Reader, local net.Conn) {
+	var once sync.Once
+	closeBoth := func() {
+		once.Do(func() {
+			client.Close()
+			local.Close()
+		})
+	}
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		defer closeBoth()
+		io.Copy(local, clientReader)
+	})
+	wg.Go(func() {
+		defer closeBoth()
+		io.Copy(client, local)
+	})
+	wg.Wait()
+}
+
+// trackHijacked registers a hijacked client connection to be closed by
+// Close. It reports false once the manager is closed.
+func (m *Manager) trackHijacked(conn net.Conn) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return false
+	}
+	if m.hijacked == nil {
+		m.hijacked = make(map[net.Conn]struct{})
+	}
+	m.hijacked[conn] = struct{}{}
+	return true
+}
+
+func (m *Manager) untrackHijacked(conn net.Conn) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.hijacked, conn)
+}
@@ -0,0 +1,168 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestManager_ConnectDisabled verifies CONNECT is refused by default
+func TestManager_ConnectDisabled(t *testing.T) {
+	m := NewManager(65000)
+	w := httptest.NewRecorder()
+	m.proxyHandler(w, httptest.NewRequest(http.MethodConnect, "http://example.com:443", nil))
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", w.Code)
+	}
+	if m.Stats().Requests != 0 {
+		t.Error("expected CONNECT to stay out of the request stats")
+	}
+}
+
+// TestManager_ConnectTunnel verifies an enabled CONNECT pipes bytes to the local server
+func TestManager_ConnectTunnel(t *testing.T) {
+	// local TCP echo server
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	m := NewManager(ln.Addr().(*net.TCPAddr).Port, WithConnect(true))
+	startManager(t, m)
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", m.ListenPort()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	// the requested authority is ignored, traffic always goes to the local server
+	if _, err := io.WriteString(conn, "CONNECT elsewhere.example:443 HTTP/1.1\r\nHost: elsewhere.example:443\r\n\r\nping"); err != nil {
+		t.Fatal(err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 Connection Established, got %d", resp.StatusCode)
+	}
+
+	// bytes sent along with the request and afterwards both arrive
+	if _, err := io.WriteString(conn, "pong"); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, len("pingpong"))
+	if _, err := io.ReadFull(br, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "pingpong" {
+		t.Errorf("expected echo %q, got %q", "pingpong", got)
+	}
+}
+
+// TestManager_ConnectLimits verifies CONNECT goes through the header size
+// and per-client limits and holds its slot while the tunnel is open
+func TestManager_ConnectLimits(t *testing.T) {
+	m := NewManager(65000, WithConnect(true), WithMaxHeaderBytes(64))
+
+	req := httptest.NewRequest(http.MethodConnect, "http://example.com:443", nil)
+	req.Header.Set("X-Padding", strings.Repeat("x", 100))
+	w := httptest.NewRecorder()
+	m.proxyHandler(w, req)
+	if w.Code != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("expected 431 for large headers, got %d", w.Code)
+	}
+
+	// an open tunnel takes the client's only slot
+	m = NewManager(65000, WithConnect(true), WithMaxConnsPerClient(1))
+	m.perClient.acquire("192.0.2.1")
+	w = httptest.NewRecorder()
+	m.proxyHandler(w, httptest.NewRequest(http.MethodConnect, "http://example.com:443", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 over the per-client limit, got %d", w.Code)
+	}
+}
+
+// TestManager_ConnectInflight verifies a CONNECT tunnel waits for an
+// in-flight slot like any other request
+func TestManager_ConnectInflight(t *testing.T) {
+	m := NewManager(65000, WithConnect(true), WithMaxConcurrency(1))
+	m.inflight <- struct{}{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	w := httptest.NewRecorder()
+	m.proxyHandler(w, httptest.NewRequest(http.MethodConnect, "http://example.com:443", nil).WithContext(ctx))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 without a free slot, got %d", w.Code)
+	}
+}
+
+// TestManager_CloseEndsConnect verifies Close ends open CONNECT tunnels,
+// which the http.Server no longer tracks
+func TestManager_CloseEndsConnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	m := NewManager(ln.Addr().(*net.TCPAddr).Port, WithConnect(true))
+	startManager(t, m)
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", m.ListenPort()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.WriteString(conn, "CONNECT local:1 HTTP/1.1\r\nHost: local:1\r\n\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	if resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect}); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected CONNECT to be established, got %v", err)
+	}
+
+	m.Close()
+	if _, err := br.ReadByte(); err != io.EOF {
+		t.Errorf("expected the tunnel to be closed, got %v", err)
+	}
+}
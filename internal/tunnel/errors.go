@@ -0,0 +1,30 @@
+package tunnel
+
+import "errors"
+
+// Errors returned, usually wrapped, by the Service, the Manager and the
+// providers. Match them with errors.Is.
+var (
+	// ErrAlreadyStarted is returned by a second Service.Start.
+	ErrAlreadyStarted = errors.New("tunnel already started")
+
+	// ErrNotStarted is returned when a Service is restarted before Start.
+	ErrNotStarted = errors.New("tunnel not started")
+
+	// ErrServiceClosed is returned once Service.Close was called.
+	ErrServiceClosed = errors.New("service is closed")
+
+	// ErrNotConnected reports a provider without a live tunnel.
+	ErrNotConnected = errors.New("tunnel is not connected")
+
+	// ErrProviderUnavailable reports a provider that can't be used here,
+	// e.g. because a binary it needs isn't installed. See Available.
+	ErrProviderUnavailable = errors.New("provider unavailable")
+
+	// ErrLocalUnreachable reports that the local server couldn't be dialed.
+	ErrLocalUnreachable = errors.New("local server unreachable")
+
+	// ErrSelfForward reports a proxy listening where the local server is
+	// expected, so it would forward requests to itself. See CheckSelfForward.
+	ErrSelfForward = errors.New("proxy would forward to itself")
+)
@@ -0,0 +1,86 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestService_SentinelErrors tests that the Service's lifecycle errors
+// match their sentinels.
+func TestService_SentinelErrors(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		run  func(s *Service) error
+		want error
+	}{
+		{"second start", func(s *Service) error {
+			if err := s.Start(ctx, 3000); err != nil {
+				t.Fatal(err)
+			}
+			return s.Start(ctx, 3000)
+		}, ErrAlreadyStarted},
+		{"start after close", func(s *Service) error {
+			s.Close()
+			return s.Start(ctx, 3000)
+		}, ErrServiceClosed},
+		{"restart before start", func(s *Service) error {
+			return s.Restart(ctx)
+		}, ErrNotStarted},
+		{"reconfigure after close", func(s *Service) error {
+			if err := s.Start(ctx, 3000); err != nil {
+				t.Fatal(err)
+			}
+			s.Close()
+			return s.Reconfigure(ctx, 4000, nil)
+		}, ErrServiceClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewService(&MockProvider{})
+			defer s.Close()
+
+			if err := tt.run(s); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestHealthCheck_NotConnected tests that a provider without a tunnel
+// reports ErrNotConnected.
+func TestHealthCheck_NotConnected(t *testing.T) {
+	if err := HealthCheck(context.Background(), &MockProvider{}); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("HealthCheck() = %v, want ErrNotConnected", err)
+	}
+}
+
+// TestFirstAvailable_Unavailable tests that running out of providers
+// reports ErrProviderUnavailable.
+func TestFirstAvailable_Unavailable(t *testing.T) {
+	if _, err := FirstAvailable(&unavailableProvider{}); !errors.Is(err, ErrProviderUnavailable) {
+		t.Errorf("FirstAvailable() = %v, want ErrProviderUnavailable", err)
+	}
+}
+
+// TestManager_LocalUnreachable tests that a refused dial to the local
+// server reports ErrLocalUnreachable.
+func TestManager_LocalUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	m := NewManager(port)
+	_, err = m.exchangeLocal(httptest.NewRequest("GET", "/", nil))
+	if !errors.Is(err, ErrLocalUnreachable) {
+		t.Errorf("exchangeLocal() = %v, want ErrLocalUnreachable", err)
+	}
+}
@@ -0,0 +1,46 @@
+package tunnel
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Connection lifecycle events, logged with LogEvent under the same names
+// and fields by the Service and every provider so a flaky tunnel reads the
+// same whichever provider runs it.
+const (
+	// EventConnected: the tunnel came up. Fields: url.
+	EventConnected = "connected"
+	// EventDropped: the tunnel, or one of its connections, was lost.
+	// Fields: err, plus alive for pooled providers.
+	EventDropped = "dropped"
+	// EventReconnectAttempt: a reconnect is starting. Fields: attempt, and
+	// err of the previous attempt after the first.
+	EventReconnectAttempt = "reconnect_attempt"
+	// EventReconnected: a reconnect succeeded. Fields: attempt, url.
+	EventReconnected = "reconnected"
+	// EventPoolReplenished: a pooled provider replaced lost connections.
+	// Fields: alive, size.
+	EventPoolReplenished = "pool_replenished"
+)
+
+// eventLevels are the log levels of the lifecycle events. The first
+// connect is already reported by the CLI, drops are what needs attention.
+var eventLevels = map[string]slog.Level{
+	EventConnected:        slog.LevelDebug,
+	EventDropped:          slog.LevelWarn,
+	EventReconnectAttempt: slog.LevelInfo,
+	EventReconnected:      slog.LevelInfo,
+	EventPoolReplenished:  slog.LevelInfo,
+}
+
+// LogEvent logs the lifecycle event of provider to logger as a "tunnel
+// event" record with event and provider fields, followed by args.
+func LogEvent(logger *slog.Logger, provider, event string, args ...any) {
+	level, ok := eventLevels[event]
+	if !ok {
+		level = slog.LevelInfo
+	}
+	args = append([]any{"event", event, "provider", provider}, args...)
+	logger.Log(context.Background(), level, "tunnel event", args...)
+}
@@ -0,0 +1,64 @@
+package tunnel
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLogEvent verifies the standard fields and per-event levels
+func TestLogEvent(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	LogEvent(logger, "fake", EventDropped, "alive", 3)
+	LogEvent(logger, "fake", EventConnected, "url", "https://a.example.com")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{
+		`level=WARN msg="tunnel event" event=dropped provider=fake alive=3`,
+		`level=DEBUG msg="tunnel event" event=connected provider=fake url=https://a.example.com`,
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("expected %d lines, got %q", len(want), lines)
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, want[i]) {
+			t.Errorf("line %d = %q, want suffix %q", i, line, want[i])
+		}
+	}
+}
+
+// TestService_Supervise_Events verifies the drop and every reconnect
+// attempt are logged, later attempts with the previous error
+func TestService_Supervise_Events(t *testing.T) {
+	var buf syncBuffer
+	p := &flakyProvider{failAfter: 1}
+	svc := NewService(p, WithServiceLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+
+	if err := svc.Start(t.Context(), 3000); err != nil {
+		t.Fatal(err)
+	}
+	p.drop()
+
+	policy := ReconnectPolicy{CheckInterval: 5 * time.Millisecond, Backoff: time.Millisecond, MaxRetries: 2}
+	select {
+	case <-supervise(svc, policy):
+	case <-time.After(time.Second):
+		t.Fatal("Supervise did not give up")
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		"event=connected provider=flaky url=https://session-1.example.com",
+		`event=dropped provider=flaky err="tunnel is not connected"`,
+		"event=reconnect_attempt provider=flaky attempt=1\n",
+		`event=reconnect_attempt provider=flaky attempt=2 err="failed to reconnect flaky provider tunnel: network down"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected log to contain %q, got:\n%s", want, out)
+		}
+	}
+}
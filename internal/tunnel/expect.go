@@ -0,0 +1,57 @@
+package tunnel
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// expectContinueTimeout is how long the body of an Expect: 100-continue
+// request is held back for the local server's interim response. Servers
+// that ignore Expect get the body after that, as with net/http's Transport.
+const expectContinueTimeout = time.Second
+
+// errExpectationDeclined aborts the body of an Expect: 100-continue
+// request the local server answered without asking for it.
+var errExpectationDeclined = errors.New("local server answered before asking for the request body")
+
+// expectsContinue reports whether the client waits for 100 Continue
+// before sending the body of r.
+func expectsContinue(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Expect"), "100-continue") &&
+		r.ProtoAtLeast(1, 1) && r.ContentLength != 0 &&
+		r.Body != nil && r.Body != http.NoBody
+}
+
+// continueBody holds back a request body until open decides whether it
+// is sent to the local server or dropped.
+type continueBody struct {
+	io.ReadCloser
+	gate chan struct{}
+	once sync.Once
+	send bool
+}
+
+func newContinueBody(body io.ReadCloser) *continueBody {
+	return &continueBody{ReadCloser: body, gate: make(chan struct{})}
+}
+
+// open releases the body, or aborts it when send is false. Only the
+// first call counts.
+func (b *continueBody) open(send bool) {
+	b.once.Do(func() {
+		b.send = send
+		close(b.gate)
+	})
+}
+
+func (b *continueBody) Read(p []byte) (int, error) {
+	<-b.gate
+	if !b.send {
+		return 0, errExpectationDeclined
+	}
+	return b.ReadCloser.Read(p)
+}
@@ -0,0 +1,91 @@
+package tunnel
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// WithAllowedMethods rejects requests whose method isn't one of methods
+// with 405 Method Not Allowed, e.g. GET and HEAD for a read-only demo.
+// The check runs before anything is forwarded. No methods allows all.
+func WithAllowedMethods(methods ...string) ManagerOption {
+	return func(m *Manager) {
+		m.allowedMethods = nil
+		for _, method := range methods {
+			m.allowedMethods = append(m.allowedMethods, strings.ToUpper(strings.TrimSpace(method)))
+		}
+	}
+}
+
+// PathRule matches request paths, see ParsePathRule.
+type PathRule struct {
+	prefix string
+	re     *regexp.Regexp
+}
+
+// ParsePathRule parses an allowed path: a rule starting with ^ is a
+// regular expression matched against the path, anything else a prefix.
+func ParsePathRule(raw string) (PathRule, error) {
+	if !strings.HasPrefix(raw, "^") {
+		return PathRule{prefix: raw}, nil
+	}
+	re, err := regexp.Compile(raw)
+	if err != nil {
+		return PathRule{}, fmt.Errorf("invalid path pattern %q: %w", raw, err)
+	}
+	return PathRule{re: re}, nil
+}
+
+// Match reports whether path is allowed by the rule.
+func (p PathRule) Match(path string) bool {
+	if p.re != nil {
+		return p.re.MatchString(path)
+	}
+	return strings.HasPrefix(path, p.prefix)
+}
+
+// String returns the rule as given to ParsePathRule.
+func (p PathRule) String() string {
+	if p.re != nil {
+		return p.re.String()
+	}
+	return p.prefix
+}
+
+// WithAllowedPaths rejects requests whose path, as received from the
+// tunnel, matches none of rules with 403 Forbidden. The check runs before
+// anything is forwarded. No rules allows all paths.
+func WithAllowedPaths(rules ...PathRule) ManagerOption {
+	return func(m *Manager) {
+		m.allowedPaths = rules
+	}
+}
+
+// filterRequest answers r with an error and returns false when the
+// method or path filters reject it.
+func (m *Manager) filterRequest(w http.ResponseWriter, r *http.Request) bool {
+	if len(m.allowedMethods) > 0 && !slices.Contains(m.allowedMethods, r.Method) {
+		m.logger.Warn("request method not allowed",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"request_id", m.requestID(r),
+		)
+		w.Header().Set("Allow", strings.Join(m.allowedMethods, ", "))
+		http.Error(w, fmt.Sprintf("Method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+		return false
+	}
+
+	if len(m.allowedPaths) > 0 && !slices.ContainsFunc(m.allowedPaths, func(p PathRule) bool { return p.Match(r.URL.Path) }) {
+		m.logger.Warn("request path not allowed",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"request_id", m.requestID(r),
+		)
+		http.Error(w, "Path not allowed", http.StatusForbidden)
+		return false
+	}
+	return true
+}
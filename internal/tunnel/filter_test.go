@@ -0,0 +1,97 @@
+package tunnel
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// TestManager_AllowedMethods verifies allowed methods reach the local
+// server and the rest get a 405 listing the allowed ones
+func TestManager_AllowedMethods(t *testing.T) {
+	var forwarded atomic.Int32
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded.Add(1)
+	}))
+	defer local.Close()
+	m := NewManager(serverPort(t, local), WithAllowedMethods("get", "HEAD"))
+
+	tests := []struct {
+		method string
+		want   int
+	}{
+		{"GET", http.StatusOK},
+		{"HEAD", http.StatusOK},
+		{"POST", http.StatusMethodNotAllowed},
+		{"DELETE", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			m.proxyHandler(w, httptest.NewRequest(tt.method, "/", nil))
+			if w.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, w.Code)
+			}
+			if tt.want == http.StatusMethodNotAllowed && w.Header().Get("Allow") != "GET, HEAD" {
+				t.Errorf("expected Allow: GET, HEAD, got %q", w.Header().Get("Allow"))
+			}
+		})
+	}
+
+	if got := forwarded.Load(); got != 2 {
+		t.Errorf("expected only the allowed requests forwarded, got %d", got)
+	}
+}
+
+// TestManager_AllowedPaths verifies paths matching no rule get a 403
+func TestManager_AllowedPaths(t *testing.T) {
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer local.Close()
+
+	var rules []PathRule
+	for _, raw := range []string{"/public/", `^/api/v[0-9]+/`} {
+		rule, err := ParsePathRule(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, rule)
+	}
+	m := NewManager(serverPort(t, local), WithAllowedPaths(rules...))
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/public/logo.png", http.StatusOK},
+		{"/api/v2/users", http.StatusOK},
+		{"/api/internal", http.StatusForbidden},
+		{"/admin", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			m.proxyHandler(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestParsePathRule(t *testing.T) {
+	if _, err := ParsePathRule("^/api/("); err == nil || !strings.Contains(err.Error(), "invalid path pattern") {
+		t.Errorf("expected an invalid pattern error, got %v", err)
+	}
+
+	rule, err := ParsePathRule("/docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rule.Match("/docs/intro") || rule.Match("/api") || rule.String() != "/docs" {
+		t.Errorf("unexpected prefix rule behaviour for %v", rule)
+	}
+}
@@ -0,0 +1,41 @@
+package tunnel
+
+import (
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// WithStripResponseHeaders removes the named headers from the local
+// server's responses before they reach the client, e.g. Server or
+// X-Powered-By. A name ending in * removes every header starting with the
+// rest, e.g. X-Internal-*. Names are case-insensitive. Headers expose adds
+// itself, like the request ID, are kept.
+func WithStripResponseHeaders(names ...string) ManagerOption {
+	return func(m *Manager) {
+		m.stripHeaders = nil
+		for _, name := range names {
+			if name = strings.TrimSpace(name); name != "" {
+				m.stripHeaders = append(m.stripHeaders, textproto.CanonicalMIMEHeaderKey(name))
+			}
+		}
+	}
+}
+
+// stripResponseHeaders removes the headers configured by
+// WithStripResponseHeaders from h.
+func (m *Manager) stripResponseHeaders(h http.Header) {
+	if len(m.stripHeaders) == 0 {
+		return
+	}
+	for key := range h {
+		for _, name := range m.stripHeaders {
+			prefix, isPrefix := strings.CutSuffix(name, "*")
+			if isPrefix && len(key) >= len(prefix) && strings.EqualFold(key[:len(prefix)], prefix) ||
+				!isPrefix && strings.EqualFold(key, name) {
+				delete(h, key)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package tunnel
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestManager_StripResponseHeaders verifies the named and prefixed headers
+// are removed from responses while the others pass through
+func TestManager_StripResponseHeaders(t *testing.T) {
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx/1.25.3")
+		w.Header().Set("X-Powered-By", "Express")
+		w.Header().Set("X-Internal-Trace", "abc")
+		w.Header().Set("X-Internal-Db-Time", "3ms")
+		w.Header().Set("X-Internals", "kept, no dash")
+		w.Header().Set("X-Request-Id", "from-local")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("ok"))
+	}))
+	defer local.Close()
+	m := NewManager(serverPort(t, local),
+		WithStripResponseHeaders("server", " X-Powered-By ", "x-internal-*", "X-Request-ID"),
+		WithRequestIDHeader("X-Request-ID"),
+	)
+
+	w := httptest.NewRecorder()
+	m.proxyHandler(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Fatalf("expected 200 ok, got %d %q", w.Code, w.Body.String())
+	}
+
+	for _, name := range []string{"Server", "X-Powered-By", "X-Internal-Trace", "X-Internal-Db-Time"} {
+		if got := w.Header().Get(name); got != "" {
+			t.Errorf("expected %s to be stripped, got %q", name, got)
+		}
+	}
+	for name, want := range map[string]string{"X-Internals": "kept, no dash", "Content-Type": "text/plain"} {
+		if got := w.Header().Get(name); got != want {
+			t.Errorf("expected %s: %s, got %q", name, want, got)
+		}
+	}
+	// the ID expose sets itself survives, the local server's copy doesn't
+	if got := w.Header().Values("X-Request-Id"); len(got) != 1 || got[0] == "from-local" {
+		t.Errorf("expected only expose's request ID, got %q", got)
+	}
+}
@@ -0,0 +1,88 @@
+package tunnel
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// HealthState is the provider health last observed by MonitorHealth.
+type HealthState string
+
+const (
+	HealthUnknown   HealthState = "" // not checked yet
+	HealthHealthy   HealthState = "healthy"
+	HealthUnhealthy HealthState = "unhealthy"
+)
+
+// DefaultHealthInterval is how often MonitorHealth probes the provider.
+const DefaultHealthInterval = 30 * time.Second
+
+// WithServiceLogger sets the logger used for service events such as
+// health transitions.
+func WithServiceLogger(logger *slog.Logger) ServiceOption {
+	return func(s *Service) {
+		if logger != nil {
+			s.logger = logger
+		}
+	}
+}
+
+// MonitorHealth probes the provider every interval until ctx is done,
+// see HealthCheck. The result is reported in Stats and transitions are
+// logged. Each probe is bounded by the interval.
+func (s *Service) MonitorHealth(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultHealthInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.checkHealth(ctx, interval)
+		}
+	}
+}
+
+// checkHealth runs a single probe and records the outcome.
+func (s *Service) checkHealth(ctx context.Context, timeout time.Duration) {
+	p := s.currentProvider()
+	probeCtx, cancel := context.WithTimeout(ctx, timeout)
+	err := HealthCheck(probeCtx, p)
+	cancel()
+
+	// a probe cut short by shutdown says nothing about the tunnel
+	if ctx.Err() != nil {
+		return
+	}
+
+	state := HealthHealthy
+	if err != nil {
+		state = HealthUnhealthy
+	}
+
+	s.mu.Lock()
+	previous := s.health
+	s.health = state
+	s.mu.Unlock()
+
+	switch {
+	case state == previous:
+	case state == HealthUnhealthy:
+		s.logger.Warn("tunnel unhealthy", "provider", p.Name(), "err", err)
+	case previous == HealthUnhealthy:
+		s.logger.Info("tunnel healthy again", "provider", p.Name())
+	}
+}
+
+// Health returns the provider health last observed by MonitorHealth.
+func (s *Service) Health() HealthState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.health
+}
@@ -0,0 +1,106 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// healthProvider is a mock provider whose health can be toggled.
+type healthProvider struct {
+	MockProvider
+	mu  sync.Mutex
+	err error
+}
+
+func (p *healthProvider) setHealth(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+func (p *healthProvider) HealthCheck(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// waitHealth polls svc until it reports want.
+func waitHealth(t *testing.T, svc *Service, want HealthState) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for svc.Stats().Health != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected health %q, got %q", want, svc.Stats().Health)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestService_MonitorHealth_Transitions(t *testing.T) {
+	p := &healthProvider{}
+	var logs syncBuffer
+	svc := NewService(p, WithServiceLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+
+	if got := svc.Stats().Health; got != HealthUnknown {
+		t.Errorf("expected unknown health before the first probe, got %q", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go svc.MonitorHealth(ctx, 10*time.Millisecond)
+
+	waitHealth(t, svc, HealthHealthy)
+
+	p.setHealth(errors.New("pool drained"))
+	waitHealth(t, svc, HealthUnhealthy)
+
+	p.setHealth(nil)
+	waitHealth(t, svc, HealthHealthy)
+
+	out := logs.String()
+	if !strings.Contains(out, "tunnel unhealthy") || !strings.Contains(out, "pool drained") {
+		t.Errorf("expected unhealthy transition to be logged, got %q", out)
+	}
+	if !strings.Contains(out, "tunnel healthy again") {
+		t.Errorf("expected recovery to be logged, got %q", out)
+	}
+	if strings.Count(out, "tunnel unhealthy") != 1 {
+		t.Errorf("expected a single log line per transition, got %q", out)
+	}
+}
+
+func TestHealthCheck_FallsBackToIsConnected(t *testing.T) {
+	p := &MockProvider{}
+	if err := HealthCheck(context.Background(), p); err == nil {
+		t.Error("expected a disconnected provider to be unhealthy")
+	}
+
+	p.connectedCalled = true
+	if err := HealthCheck(context.Background(), p); err != nil {
+		t.Errorf("expected a connected provider to be healthy, got %v", err)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent writes and reads.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
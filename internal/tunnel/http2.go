@@ -0,0 +1,66 @@
+package tunnel
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// hopHeaders are connection-specific headers that HTTP/2 forbids and a
+// proxy doesn't forward.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// removeHopHeaders deletes hopHeaders and the headers the Connection
+// header names from h.
+func removeHopHeaders(h http.Header) {
+	for _, field := range h.Values("Connection") {
+		for name := range strings.SplitSeq(field, ",") {
+			if name = textproto.TrimString(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+// WithLocalHTTP2 forwards requests to the local server over HTTP/2, for
+// servers that only speak h2 such as gRPC-web backends: negotiated via
+// ALPN with WithLocalTLS, cleartext h2c otherwise. HTTP/1.1 is the default.
+func WithLocalHTTP2(enabled bool) ManagerOption {
+	return func(m *Manager) {
+		m.localHTTP2 = enabled
+	}
+}
+
+// newLocalHTTP2Transport returns a transport that only speaks HTTP/2 to
+// the local server, reusing connections across requests.
+func (m *Manager) newLocalHTTP2Transport() *http.Transport {
+	t := &http.Transport{
+		// every request goes to the local server, whatever its URL says
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return m.dialLocalTCP(ctx)
+		},
+		IdleConnTimeout: 90 * time.Second,
+	}
+
+	var protocols http.Protocols
+	if m.localTLS != nil {
+		t.TLSClientConfig = m.localTLS.Clone()
+		protocols.SetHTTP2(true)
+	} else {
+		protocols.SetUnencryptedHTTP2(true)
+	}
+	t.Protocols = &protocols
+	return t
+}
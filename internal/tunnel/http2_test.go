@@ -0,0 +1,75 @@
+package tunnel
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// protoHandler answers with the protocol the request arrived over.
+var protoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(r.Proto))
+})
+
+// TestManager_LocalHTTP2_TLS verifies h2 is negotiated with an HTTPS local server
+func TestManager_LocalHTTP2_TLS(t *testing.T) {
+	localServer := httptest.NewUnstartedServer(protoHandler)
+	localServer.EnableHTTP2 = true
+	localServer.StartTLS()
+	defer localServer.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(localServer.Certificate())
+
+	// httptest certificates are issued for example.com
+	m := NewManager(serverPort(t, localServer),
+		WithLocalTLS(&tls.Config{RootCAs: pool, ServerName: "example.com"}),
+		WithLocalHTTP2(true),
+	)
+	defer m.Close()
+
+	w := httptest.NewRecorder()
+	m.proxyHandler(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != http.StatusOK || w.Body.String() != "HTTP/2.0" {
+		t.Errorf("expected 200 over HTTP/2.0, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+// TestManager_LocalHTTP2_Cleartext verifies h2c with a plain local server
+func TestManager_LocalHTTP2_Cleartext(t *testing.T) {
+	localServer := httptest.NewUnstartedServer(protoHandler)
+	localServer.Config.Protocols = new(http.Protocols)
+	localServer.Config.Protocols.SetUnencryptedHTTP2(true)
+	localServer.Start()
+	defer localServer.Close()
+
+	m := NewManager(serverPort(t, localServer), WithLocalHTTP2(true))
+	defer m.Close()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	// hop-by-hop headers must not break the HTTP/2 request
+	req.Header.Set("Connection", "keep-alive, X-Custom")
+	w := httptest.NewRecorder()
+	m.proxyHandler(w, req)
+
+	if w.Code != http.StatusOK || w.Body.String() != "HTTP/2.0" {
+		t.Errorf("expected 200 over HTTP/2.0, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+// TestManager_LocalHTTP1ByDefault verifies HTTP/1.1 stays the default
+func TestManager_LocalHTTP1ByDefault(t *testing.T) {
+	localServer := httptest.NewServer(protoHandler)
+	defer localServer.Close()
+
+	m := NewManager(serverPort(t, localServer))
+	w := httptest.NewRecorder()
+	m.proxyHandler(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Body.String() != "HTTP/1.1" {
+		t.Errorf("expected HTTP/1.1, got %q", w.Body.String())
+	}
+}
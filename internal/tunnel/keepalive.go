@@ -0,0 +1,33 @@
+package tunnel
+
+import (
+	"net"
+	"time"
+)
+
+// DefaultKeepAlive is the TCP keep-alive period for tunnel and local
+// connections, short enough to keep idle connections alive behind NATs.
+const DefaultKeepAlive = 30 * time.Second
+
+// keepAliver is implemented by *net.TCPConn.
+type keepAliver interface {
+	SetKeepAlive(keepalive bool) error
+	SetKeepAlivePeriod(d time.Duration) error
+}
+
+// SetKeepAlive enables TCP keep-alive probes every period on conn, or
+// disables them if period is zero or negative. Connections that don't
+// support keep-alive, e.g. unix sockets, are left alone.
+func SetKeepAlive(conn net.Conn, period time.Duration) error {
+	ka, ok := conn.(keepAliver)
+	if !ok {
+		return nil
+	}
+	if period <= 0 {
+		return ka.SetKeepAlive(false)
+	}
+	if err := ka.SetKeepAlive(true); err != nil {
+		return err
+	}
+	return ka.SetKeepAlivePeriod(period)
+}
@@ -0,0 +1,71 @@
+package tunnel
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// keepAliveConn records the keep-alive settings applied to it.
+type keepAliveConn struct {
+	net.Conn
+	enabled bool
+	period  time.Duration
+}
+
+func (c *keepAliveConn) SetKeepAlive(keepalive bool) error {
+	c.enabled = keepalive
+	return nil
+}
+
+func (c *keepAliveConn) SetKeepAlivePeriod(d time.Duration) error {
+	c.period = d
+	return nil
+}
+
+func TestSetKeepAlive(t *testing.T) {
+	conn := &keepAliveConn{enabled: true}
+	if err := SetKeepAlive(conn, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if !conn.enabled || conn.period != time.Minute {
+		t.Errorf("expected keep-alive every minute, got enabled=%v period=%v", conn.enabled, conn.period)
+	}
+
+	if err := SetKeepAlive(conn, 0); err != nil {
+		t.Fatal(err)
+	}
+	if conn.enabled {
+		t.Error("expected keep-alive to be disabled for a zero period")
+	}
+
+	// connections without keep-alive support are ignored
+	client, server := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	if err := SetKeepAlive(client, time.Minute); err != nil {
+		t.Errorf("expected non-TCP connection to be ignored, got %v", err)
+	}
+}
+
+func TestManager_dialLocal_KeepAlive(t *testing.T) {
+	var dialed *keepAliveConn
+	m := NewManager(3000, WithKeepAlive(42*time.Second))
+	m.dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+		client, server := net.Pipe()
+		t.Cleanup(func() { server.Close() })
+		dialed = &keepAliveConn{Conn: client}
+		return dialed, nil
+	}
+
+	conn, err := m.dialLocal(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("dialLocal failed: %v", err)
+	}
+	conn.Close()
+
+	if !dialed.enabled || dialed.period != 42*time.Second {
+		t.Errorf("expected keep-alive every 42s, got enabled=%v period=%v", dialed.enabled, dialed.period)
+	}
+}
@@ -0,0 +1,34 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// listen opens a TCP listener on addr. Go sets SO_REUSEADDR on Unix, so a
+// fixed --listen port can be rebound right after a restart, while a port
+// another listener still holds fails with "address already in use".
+func listen(ctx context.Context, addr string) (net.Listener, error) {
+	var lc net.ListenConfig
+	return lc.Listen(ctx, "tcp", addr)
+}
+
+// CheckSelfForward returns ErrSelfForward when a proxy listening on
+// listenAddr would accept the connections it dials to the local server on
+// localhost:localPort, forwarding every request back to itself.
+func CheckSelfForward(listenAddr string, localPort int) error {
+	host, portStr, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return nil // ValidateListenAddr reports it
+	}
+	if port, _ := strconv.Atoi(portStr); port == 0 || port != localPort {
+		return nil
+	}
+	// an unspecified host listens on loopback too
+	if ip := net.ParseIP(host); host == "" || host == "localhost" || (ip != nil && (ip.IsUnspecified() || ip.IsLoopback())) {
+		return fmt.Errorf("%w: listen address %s is the local server's port %d", ErrSelfForward, listenAddr, localPort)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"syscall"
+	"testing"
+)
+
+// TestListen_SuccessiveOnSamePort verifies a fixed port can be rebound
+// right after the previous listener served a connection and closed.
+func TestListen_SuccessiveOnSamePort(t *testing.T) {
+	first, err := listen(context.Background(), "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("first listen failed: %v", err)
+	}
+	addr := first.Addr().String()
+
+	// serve one request so the closed side leaves a TIME_WAIT socket
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	go srv.Serve(first)
+	resp, err := http.Get(fmt.Sprintf("http://%s/", addr))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	srv.Close()
+
+	second, err := listen(context.Background(), addr)
+	if err != nil {
+		t.Fatalf("second listen on %s failed: %v", addr, err)
+	}
+	second.Close()
+}
+
+// TestListen_ConcurrentOnSamePort verifies a port a live listener holds
+// can't be bound a second time, so two proxies never share --listen
+func TestListen_ConcurrentOnSamePort(t *testing.T) {
+	first, err := listen(context.Background(), "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("first listen failed: %v", err)
+	}
+	defer first.Close()
+
+	second, err := listen(context.Background(), first.Addr().String())
+	if err == nil {
+		second.Close()
+		t.Fatal("expected the second listen on a live port to fail")
+	}
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		t.Errorf("expected address already in use, got %v", err)
+	}
+}
+
+// TestCheckSelfForward verifies a listen address that accepts the proxy's
+// own connections to the local server is detected
+func TestCheckSelfForward(t *testing.T) {
+	tests := []struct {
+		listen string
+		self   bool
+	}{
+		{listen: ":3000", self: true},
+		{listen: "0.0.0.0:3000", self: true},
+		{listen: "127.0.0.1:3000", self: true},
+		{listen: "[::]:3000", self: true},
+		{listen: "[::1]:3000", self: true},
+		{listen: "localhost:3000", self: true},
+		{listen: ":0"},
+		{listen: ":8000"},
+		{listen: "192.168.1.10:3000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.listen, func(t *testing.T) {
+			err := CheckSelfForward(tt.listen, 3000)
+			if got := errors.Is(err, ErrSelfForward); got != tt.self {
+				t.Errorf("CheckSelfForward(%q, 3000) = %v, want self-forward %v", tt.listen, err, tt.self)
+			}
+		})
+	}
+}
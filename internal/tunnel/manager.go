@@ -1,14 +1,23 @@
 package tunnel
 
 import (
-	"bufio"
 	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"runtime/debug"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -23,23 +32,391 @@ type Tunneler interface {
 
 // Manager manages the lifecycle of a tunneler.
 type Manager struct {
-	localPort int
-	publicURL string
-	listener  net.Listener
-	server    *http.Server
-	ready     chan struct{}
-	mu        sync.RWMutex
+	localPort  atomic.Int32 // see SetLocalPort
+	listenAddr string
+	publicURL  string
+	listener   net.Listener
+	server     *http.Server
+	ready      chan struct{}
+	closed     bool // server or listener closed, see Close
+	mu         sync.RWMutex
+
+	logger        *slog.Logger
+	slowThreshold time.Duration // 0 disables slow-request warnings
+	largePayload  int64         // bodies above this many bytes are logged, 0 disables it
+
+	// limits in-flight requests to the local server, nil means unlimited
+	inflight chan struct{}
+	// limits in-flight requests per client, nil means unlimited
+	perClient *clientLimiter
+
+	// tunnel CONNECT requests to the local server, see WithConnect
+	connect bool
+	// open CONNECT tunnels, the http.Server can't close them, see Close
+	hijacked map[net.Conn]struct{}
+
+	// resend idempotent requests the local server dropped, see WithRetrySafeRequests
+	retrySafe bool
+	// largest response body read fully before sending it, 0 streams responses
+	bufferLimit int64
+
+	// TLS settings for HTTPS local servers, nil means plain HTTP
+	localTLS *tls.Config
+	// speak HTTP/2 to the local server through localH2, see WithLocalHTTP2
+	localHTTP2 bool
+	localH2    *http.Transport
+	// pooled HTTP/1.1 connections to the local server, nil with
+	// WithProxyProtocol, whose header is sent once per client connection
+	localH1 *http.Transport
+	// forwards requests to the local server, see newReverseProxy
+	proxy *httputil.ReverseProxy
+
+	// dial opens the TCP connection to the local server
+	dial func(ctx context.Context, network, address string) (net.Conn, error)
+	// "tcp4" or "tcp6" pins the local server's IP family, see WithLocalNetwork
+	localNetwork string
+	// TCP keep-alive period of local connections, <= 0 disables it
+	keepAlive time.Duration
+	// Unix socket of the local server, "" dials localPort over TCP
+	localSocket string
+	// PROXY protocol version announcing clients to the local server, 0 disables it
+	proxyProtocol int
+
+	// header carrying the request correlation ID, empty disables it
+	requestIDHeader string
+
+	// expose version announced via Via/X-Expose-Version, empty disables it
+	identifyVersion string
+
+	// timeouts of the proxy's http.Server
+	timeouts ServerTimeouts
+
+	// largest request header forwarded to the local server, <= 0 disables the check
+	maxHeaderBytes int
+
+	// access log destination and format, nil writer disables it
+	accessLog       io.Writer
+	accessLogFormat AccessLogFormat
+	accessLogMu     sync.Mutex
+
+	// caches GET responses, nil disables caching
+	cache *responseCache
+
+	// path prefixes removed from / added to forwarded requests
+	stripPrefix string
+	addPrefix   string
+	// forward the public Host instead of localhost:port, see WithPreserveHost
+	preserveHost bool
+
+	// requests outside these are rejected, empty allows all, see filter.go
+	allowedMethods []string
+	allowedPaths   []PathRule
+	// response headers dropped before the client sees them, see headers.go
+	stripHeaders []string
+
+	// bandwidth limits to and from the local server, nil means unlimited
+	throttleUp   *bandwidthLimiter
+	throttleDown *bandwidthLimiter
+
+	// request accounting, see Stats()
+	requests     atomic.Int64
+	active       atomic.Int64
+	slowRequests atomic.Int64
+	failed       atomic.Int64
+	latency      latencyTracker
+	traffic      ByteCounter
 }
 
+// errLocalTLS marks a failed TLS handshake with an HTTPS local server.
+var errLocalTLS = errors.New("local tls handshake failed")
+
 // Ensure Manager implements Tunneler
 var _ Tunneler = (*Manager)(nil)
 
+// ManagerOption configures optional Manager behaviour.
+type ManagerOption func(*Manager)
+
+// WithLogger sets the logger used for proxy warnings and errors.
+func WithLogger(logger *slog.Logger) ManagerOption {
+	return func(m *Manager) {
+		if logger != nil {
+			m.logger = logger
+		}
+	}
+}
+
+// WithSlowThreshold logs a warning for every proxied request
+// that takes longer than d. Zero disables the warning.
+func WithSlowThreshold(d time.Duration) ManagerOption {
+	return func(m *Manager) {
+		m.slowThreshold = d
+	}
+}
+
+// WithMaxConcurrency limits the number of requests forwarded to the local
+// server at the same time; excess requests wait for a free slot.
+// Zero or negative means unlimited.
+func WithMaxConcurrency(n int) ManagerOption {
+	return func(m *Manager) {
+		if n > 0 {
+			m.inflight = make(chan struct{}, n)
+		} else {
+			m.inflight = nil
+		}
+	}
+}
+
+// WithMaxConnsPerClient limits the concurrent requests of a single client,
+// identified by the last X-Forwarded-For entry or the remote address, so
+// one client can't take every slot. Requests over the cap get 429 Too Many
+// Requests. Zero or negative means unlimited.
+func WithMaxConnsPerClient(n int) ManagerOption {
+	return func(m *Manager) {
+		if n > 0 {
+			m.perClient = newClientLimiter(n)
+		} else {
+			m.perClient = nil
+		}
+	}
+}
+
+// WithLocalTLS makes the proxy speak HTTPS to the local server using cfg.
+// An empty ServerName defaults to "localhost". Nil keeps plain HTTP.
+func WithLocalTLS(cfg *tls.Config) ManagerOption {
+	return func(m *Manager) {
+		m.localTLS = cfg
+	}
+}
+
+// DefaultRequestIDHeader is the header used for request correlation IDs.
+const DefaultRequestIDHeader = "X-Request-ID"
+
+// WithRequestIDHeader sets the header used to correlate requests across
+// the proxy and the local server. An empty name disables request IDs.
+func WithRequestIDHeader(name string) ManagerOption {
+	return func(m *Manager) {
+		m.requestIDHeader = http.CanonicalHeaderKey(name)
+	}
+}
+
+// ExposeVersionHeader carries the expose version when identification is on.
+const ExposeVersionHeader = "X-Expose-Version"
+
+// WithIdentify adds a Via header and X-Expose-Version: version to forwarded
+// requests and responses, so backend operators can tell traffic came
+// through expose. An empty version disables identification.
+func WithIdentify(version string) ManagerOption {
+	return func(m *Manager) {
+		m.identifyVersion = version
+	}
+}
+
+// WithCache caches cacheable GET responses in memory for up to ttl,
+// keeping at most maxBytes of response bodies. Responses marked no-store,
+// private or no-cache are never cached. A zero size or ttl disables caching.
+func WithCache(maxBytes int64, ttl time.Duration) ManagerOption {
+	return func(m *Manager) {
+		if maxBytes > 0 && ttl > 0 {
+			m.cache = newResponseCache(maxBytes, ttl)
+		} else {
+			m.cache = nil
+		}
+	}
+}
+
+// WithStripPrefix removes prefix from request paths before forwarding,
+// e.g. "/api" forwards /api/users as /users. Other paths are unchanged.
+func WithStripPrefix(prefix string) ManagerOption {
+	return func(m *Manager) {
+		m.stripPrefix = normalizePrefix(prefix)
+	}
+}
+
+// WithAddPrefix prepends prefix to request paths before forwarding,
+// e.g. "/api" forwards /users as /api/users. It's applied after WithStripPrefix.
+func WithAddPrefix(prefix string) ManagerOption {
+	return func(m *Manager) {
+		m.addPrefix = normalizePrefix(prefix)
+	}
+}
+
+// normalizePrefix returns prefix with a leading and no trailing slash,
+// "" and "/" both mean no prefix.
+func normalizePrefix(prefix string) string {
+	prefix = strings.TrimRight(prefix, "/")
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	return prefix
+}
+
+// rewritePath applies the configured prefixes to an escaped request path.
+func (m *Manager) rewritePath(path string) string {
+	if m.stripPrefix != "" {
+		if path == m.stripPrefix {
+			path = "/"
+		} else if strings.HasPrefix(path, m.stripPrefix+"/") {
+			path = path[len(m.stripPrefix):]
+		}
+	}
+	if m.addPrefix != "" {
+		path = m.addPrefix + path
+	}
+	return path
+}
+
+// WithPreserveHost forwards the Host the client sent, i.e. the public
+// hostname. By default the local server sees Host: localhost:<port> and
+// the public one in X-Forwarded-Host, which suits dev servers that check
+// the Host they are served on.
+func WithPreserveHost(enabled bool) ManagerOption {
+	return func(m *Manager) {
+		m.preserveHost = enabled
+	}
+}
+
+// forwardedRequest returns r as it should be sent to the local server,
+// with its Host and path rewritten. r itself is left untouched for logging.
+func (m *Manager) forwardedRequest(r *http.Request) *http.Request {
+	if m.preserveHost && m.stripPrefix == "" && m.addPrefix == "" {
+		return r
+	}
+
+	out := *r
+
+	if !m.preserveHost {
+		out.Host = m.localHost()
+		if r.Host != "" && r.Header.Get("X-Forwarded-Host") == "" {
+			out.Header = r.Header.Clone()
+			out.Header.Set("X-Forwarded-Host", r.Host)
+		}
+	}
+
+	if m.stripPrefix == "" && m.addPrefix == "" {
+		return &out
+	}
+
+	escaped := m.rewritePath(r.URL.EscapedPath())
+	path, err := url.PathUnescape(escaped)
+	if err != nil {
+		return &out
+	}
+
+	u := *r.URL
+	u.Path, u.RawPath = path, escaped
+	out.URL = &u
+	return &out
+}
+
+// WithKeepAlive sets the TCP keep-alive period of connections to the
+// local server. Zero or negative disables keep-alive.
+func WithKeepAlive(period time.Duration) ManagerOption {
+	return func(m *Manager) {
+		m.keepAlive = period
+	}
+}
+
+// ServerTimeouts bounds how long the proxy waits on clients, zero disables
+// a timeout. Read and Write also cover request and response bodies, so
+// they cut off long uploads and streamed responses when set.
+type ServerTimeouts struct {
+	ReadHeader time.Duration
+	Read       time.Duration
+	Write      time.Duration
+	Idle       time.Duration
+}
+
+// DefaultServerTimeouts stops slow-header (slowloris) clients and idle
+// keep-alive connections without limiting long-running requests.
+var DefaultServerTimeouts = ServerTimeouts{
+	ReadHeader: 10 * time.Second,
+	Idle:       2 * time.Minute,
+}
+
+// WithServerTimeouts sets the timeouts of the proxy's HTTP server.
+func WithServerTimeouts(t ServerTimeouts) ManagerOption {
+	return func(m *Manager) {
+		m.timeouts = t
+	}
+}
+
+// DefaultMaxHeaderBytes is the default request header limit. It is well
+// below net/http's 1 MB so oversized headers get a clear 431 from the proxy
+// instead of an opaque failure from a stricter local server.
+const DefaultMaxHeaderBytes = 64 << 10
+
+// WithMaxHeaderBytes sets the largest request header, in bytes, that is
+// forwarded to the local server. Larger requests are answered with
+// 431 Request Header Fields Too Large. Zero or negative disables the check.
+func WithMaxHeaderBytes(n int) ManagerOption {
+	return func(m *Manager) {
+		m.maxHeaderBytes = n
+	}
+}
+
+// headerSize approximates the wire size of r's request line and headers.
+func headerSize(r *http.Request) int {
+	// "GET /path HTTP/1.1\r\n" and "Host: example.com\r\n"
+	n := len(r.Method) + len(r.RequestURI) + len(r.Proto) + 4
+	n += len("Host: ") + len(r.Host) + 2
+	for key, values := range r.Header {
+		for _, value := range values {
+			// "Key: value\r\n"
+			n += len(key) + len(value) + 4
+		}
+	}
+	return n
+}
+
+// DefaultListenAddr lets the proxy listen on a random free port.
+const DefaultListenAddr = ":0"
+
+// WithListenAddr sets the host:port the proxy listens on, e.g. ":8000"
+// for a predictable port behind a firewall or docker port mapping.
+// The address is validated by Start, see ValidateListenAddr.
+func WithListenAddr(addr string) ManagerOption {
+	return func(m *Manager) {
+		m.listenAddr = addr
+	}
+}
+
+// ValidateListenAddr reports whether addr is a usable host:port listen
+// address. The host may be empty, the port must be 0-65535.
+func ValidateListenAddr(addr string) error {
+	_, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", addr, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 65535 {
+		return fmt.Errorf("invalid listen address %q: port must be 0-65535", addr)
+	}
+	return nil
+}
+
 // NewManager creates a new Manager instance.
-func NewManager(port int) *Manager {
-	return &Manager{
-		localPort: port,
-		ready:     make(chan struct{}),
+func NewManager(port int, opts ...ManagerOption) *Manager {
+	m := &Manager{
+		listenAddr:      DefaultListenAddr,
+		dial:            dialContext,
+		keepAlive:       DefaultKeepAlive,
+		timeouts:        DefaultServerTimeouts,
+		maxHeaderBytes:  DefaultMaxHeaderBytes,
+		ready:           make(chan struct{}),
+		logger:          slog.Default(),
+		requestIDHeader: DefaultRequestIDHeader,
+	}
+	m.localPort.Store(int32(port))
+	for _, opt := range opts {
+		opt(m)
 	}
+	m.proxy = m.newReverseProxy()
+	if m.localHTTP2 {
+		m.localH2 = m.newLocalHTTP2Transport()
+	} else if m.proxyProtocol == 0 {
+		m.localH1 = m.newLocalTransport()
+	}
+	return m
 }
 
 // Start initializes the tunnel and begins listening for incoming connections.
@@ -51,8 +428,15 @@ func (m *Manager) Start(ctx context.Context) error {
 	default:
 	}
 
-	// Create a Listener
-	listener, err := net.Listen("tcp", ":0") // Listen on any random available port
+	if err := ValidateListenAddr(m.listenAddr); err != nil {
+		return err
+	}
+	if err := m.checkSelfForward(int(m.localPort.Load())); err != nil {
+		return err
+	}
+
+	// Create a Listener, ":0" picks any random available port
+	listener, err := listen(ctx, m.listenAddr)
 	if err != nil {
 		return fmt.Errorf("failed to create listener: %w", err)
 	}
@@ -73,7 +457,15 @@ func (m *Manager) Start(ctx context.Context) error {
 
 	// Create HTTP server to handle incoming requests
 	server := &http.Server{
-		Handler: http.HandlerFunc(m.proxyHandler),
+		Handler:           m.logAccess(m.recoverPanics(m.logLargePayloads(http.HandlerFunc(m.proxyHandler)))),
+		ReadHeaderTimeout: m.timeouts.ReadHeader,
+		ReadTimeout:       m.timeouts.Read,
+		WriteTimeout:      m.timeouts.Write,
+		IdleTimeout:       m.timeouts.Idle,
+	}
+	// let headers above net/http's default through to our own 431 check
+	if m.maxHeaderBytes > http.DefaultMaxHeaderBytes {
+		server.MaxHeaderBytes = m.maxHeaderBytes
 	}
 
 	// Set server (concurrency-safe)
@@ -89,7 +481,8 @@ func (m *Manager) Start(ctx context.Context) error {
 
 	// Serve incoming connections(blocking call)
 	// ends when closed from outside (e.g., via m.Close()) or context cancellation
-	if err := m.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	// a Close that ran before the server was set closed just the listener
+	if err := m.server.Serve(m.traffic.Listener(listener)); err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
 		return fmt.Errorf("server error: %w", err)
 	}
 
@@ -102,22 +495,90 @@ func (m *Manager) Ready() <-chan struct{} {
 	return m.ready
 }
 
-// Close shuts down the tunnel and cleans up resources.
+// Close shuts down the tunnel and cleans up resources. Only the first call
+// does anything, later ones return nil.
 func (m *Manager) Close() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	// both the context watcher in Start and the owner close the manager
+	if m.closed {
+		return nil
+	}
+
 	var err error
 
+	m.closeIdleLocal()
+
 	// Shutdown the http server if it's running
 	if m.server != nil {
 		err = m.server.Close()
+		m.closed = true
 	} else if m.listener != nil {
 		err = m.listener.Close()
+		m.closed = true
+	}
+
+	// CONNECT tunnels outlive the server
+	for conn := range m.hijacked {
+		conn.Close()
 	}
 
+	// the listener is gone either way
+	if errors.Is(err, net.ErrClosed) {
+		err = nil
+	}
 	return err
+}
+
+// checkSelfForward is CheckSelfForward for forwarding to localPort, against
+// the address the proxy listens on once it does.
+func (m *Manager) checkSelfForward(localPort int) error {
+	// a Unix socket can't be the proxy's own listener
+	if m.localSocket != "" {
+		return nil
+	}
+	m.mu.RLock()
+	addr := m.listenAddr
+	if m.listener != nil {
+		addr = m.listener.Addr().String()
+	}
+	m.mu.RUnlock()
+	return CheckSelfForward(addr, localPort)
+}
+
+// LocalPort returns the port of the local server requests are forwarded to.
+func (m *Manager) LocalPort() int {
+	return int(m.localPort.Load())
+}
+
+// SetLocalPort forwards new requests to port, e.g. after a config reload.
+// Requests already in flight finish against the old port.
+func (m *Manager) SetLocalPort(port int) {
+	m.localPort.Store(int32(port))
+	// pooled connections still lead to the old port
+	m.closeIdleLocal()
+}
+
+// closeIdleLocal closes the idle pooled connections to the local server.
+func (m *Manager) closeIdleLocal() {
+	if m.localH1 != nil {
+		m.localH1.CloseIdleConnections()
+	}
+	if m.localH2 != nil {
+		m.localH2.CloseIdleConnections()
+	}
+}
+
+// ListenPort returns the port the proxy is listening on, or 0 before Start.
+func (m *Manager) ListenPort() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
+	if m.listener == nil {
+		return 0
+	}
+	return m.listener.Addr().(*net.TCPAddr).Port
 }
 
 // PublicURL returns the public URL of the tunnel.
@@ -128,46 +589,300 @@ func (m *Manager) PublicURL() string {
 	return m.publicURL
 }
 
+// Stats returns a snapshot of the request statistics collected by the proxy.
+func (m *Manager) Stats() Stats {
+	p50, p95 := m.latency.percentiles()
+	return Stats{
+		Requests:     m.requests.Load(),
+		Active:       m.active.Load(),
+		SlowRequests: m.slowRequests.Load(),
+		Errors:       m.failed.Load(),
+		P50:          p50,
+		P95:          p95,
+		BytesIn:      m.traffic.BytesIn(),
+		BytesOut:     m.traffic.BytesOut(),
+	}
+}
+
+// observe records the outcome of a proxied request and warns when it was slow.
+func (m *Manager) observe(r *http.Request, status int, elapsed time.Duration) {
+	m.requests.Add(1)
+	m.latency.observe(elapsed)
+	if status >= 500 {
+		m.failed.Add(1)
+	}
+
+	m.logger.Debug("proxied request",
+		"method", r.Method,
+		"path", r.URL.Path,
+		"duration", elapsed,
+		"request_id", m.requestID(r),
+	)
+
+	if m.slowThreshold > 0 && elapsed > m.slowThreshold {
+		m.slowRequests.Add(1)
+		m.logger.Warn("slow request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"duration", elapsed,
+			"request_id", m.requestID(r),
+		)
+	}
+}
+
+// requestID returns the correlation ID of r, empty when disabled.
+func (m *Manager) requestID(r *http.Request) string {
+	if m.requestIDHeader == "" {
+		return ""
+	}
+	return r.Header.Get(m.requestIDHeader)
+}
+
+// ensureRequestID keeps the incoming correlation ID or generates one,
+// and echoes it on the response.
+func (m *Manager) ensureRequestID(w http.ResponseWriter, r *http.Request) {
+	if m.requestIDHeader == "" {
+		return
+	}
+
+	id := r.Header.Get(m.requestIDHeader)
+	if id == "" {
+		id = newRequestID()
+		r.Header.Set(m.requestIDHeader, id)
+	}
+	w.Header().Set(m.requestIDHeader, id)
+}
+
+// newRequestID returns a random 128-bit hex ID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b) // never fails, see crypto/rand.Read
+	return hex.EncodeToString(b)
+}
+
+// localDialTimeout bounds connecting to the local server, on top of
+// the request context.
+const localDialTimeout = 5 * time.Second
+
+// dialContext dials address, giving up when ctx is done or after
+// localDialTimeout, whichever comes first.
+func dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d := net.Dialer{Timeout: localDialTimeout}
+	return d.DialContext(ctx, network, address)
+}
+
+// dialLocalTCP opens a plain TCP connection to the local server.
+func (m *Manager) dialLocalTCP(ctx context.Context) (net.Conn, error) {
+	network, addr := m.localTarget()
+	conn, err := m.dial(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrLocalUnreachable, err)
+	}
+	if err := SetKeepAlive(conn, m.keepAlive); err != nil {
+		m.logger.Debug("failed to set keep-alive on local connection", "err", err)
+	}
+	return conn, nil
+}
+
+// dialLocal connects to the local server for r, with a TLS handshake for
+// HTTPS servers. r's client is announced first, see WithProxyProtocol.
+func (m *Manager) dialLocal(ctx context.Context, r *http.Request) (net.Conn, error) {
+	conn, err := m.dialLocalTCP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.writeProxyHeader(conn, r); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %w", ErrLocalUnreachable, err)
+	}
+
+	if m.localTLS == nil {
+		return conn, nil
+	}
+
+	cfg := m.localTLS.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName = "localhost"
+	}
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %w", errLocalTLS, err)
+	}
+	return tlsConn, nil
+}
+
+// serveCached answers r from a cached response.
+func (m *Manager) serveCached(w http.ResponseWriter, r *http.Request, entry *cachedResponse) {
+	for key, values := range entry.header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	if id := m.requestID(r); id != "" {
+		w.Header().Set(m.requestIDHeader, id)
+	}
+	m.identify(w.Header(), 1, 1)
+	w.Header().Set(CacheHeader, "HIT")
+
+	w.WriteHeader(entry.status)
+	_, _ = w.Write(entry.body)
+}
+
+// identify adds the Via and X-Expose-Version headers to h, if enabled.
+// major and minor are the HTTP version of the message being forwarded.
+func (m *Manager) identify(h http.Header, major, minor int) {
+	if m.identifyVersion == "" {
+		return
+	}
+	h.Add("Via", fmt.Sprintf("%d.%d expose", major, minor))
+	h.Set(ExposeVersionHeader, m.identifyVersion)
+}
+
+// recoverPanics turns a panic in next into a logged 500 so one bad request
+// can't take in-flight requests down with it. http.ErrAbortHandler is
+// re-raised, it's the deliberate way to abort a response.
+func (m *Manager) recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &responseTracker{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			m.logger.Error("panic in proxy handler",
+				"panic", v,
+				"method", r.Method,
+				"path", r.URL.Path,
+				"request_id", m.requestID(r),
+				"stack", string(debug.Stack()),
+			)
+
+			// too late for a 500, abort so the client sees the failure
+			if rw.status != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			http.Error(w, "Internal proxy error", http.StatusInternalServerError)
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
 // proxyHandler forwards incoming HTTP requests to the local server.
 // It dials the local server, forwards the request, and writes back the response.
 // If any step fails, it responds with an appropriate HTTP error.
 func (m *Manager) proxyHandler(w http.ResponseWriter, r *http.Request) {
+	m.ensureRequestID(w, r)
 
-	// create connection to local server
-	target := fmt.Sprintf("localhost:%d", m.localPort)
-	conn, err := net.DialTimeout("tcp", target, 5*time.Second)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to connect localhost:%d - is your server running?", m.localPort), http.StatusBadGateway)
+	if !m.filterRequest(w, r) {
 		return
 	}
 
-	defer conn.Close()
+	// CONNECT can't be forwarded as a request, and a long-lived tunnel
+	// would skew the latency stats
+	if r.Method == http.MethodConnect {
+		m.handleConnect(w, r)
+		return
+	}
 
-	// Send request to local server
-	if err := r.Write(conn); err != nil {
-		http.Error(w, "Failed to forward request", http.StatusBadGateway)
+	start := time.Now()
+	rw := &responseTracker{ResponseWriter: w}
+	w = rw
+	m.active.Add(1)
+	defer func() {
+		m.active.Add(-1)
+		m.observe(r, rw.status, time.Since(start))
+	}()
+
+	release, ok := m.admit(w, r)
+	if !ok {
 		return
 	}
+	defer release()
 
-	// Read response from local server
-	resp, err := http.ReadResponse(bufio.NewReader(conn), r)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to read response from local server: %v", err), http.StatusBadGateway)
+	// cache hits never reach the local server
+	cacheable := m.cache != nil && cacheableRequest(r)
+	var key string
+	if cacheable {
+		key = cacheKey(r)
+		if entry, ok := m.cache.get(key); ok {
+			m.serveCached(w, r, entry)
+			return
+		}
+	}
+
+	releaseSlot, ok := m.acquireSlot(w, r)
+	if !ok {
 		return
 	}
-	defer resp.Body.Close()
+	defer releaseSlot()
 
-	// Copy response headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
+	m.identify(r.Header, r.ProtoMajor, r.ProtoMinor)
+	if m.throttleUp != nil && r.Body != nil && r.Body != http.NoBody {
+		r.Body = throttledBody{Reader: m.throttleUp.reader(r.Context(), r.Body), Closer: r.Body}
+	}
+
+	if m.retrySafe && m.localH2 == nil {
+		if _, err := prepareRetry(r); err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
 		}
 	}
 
-	// Copy response status code and body
-	w.WriteHeader(resp.StatusCode)
+	m.proxy.ServeHTTP(w, withProxyState(w, r, key))
+}
 
-	// partial response sent anyway as headers are already written
-	io.Copy(w, resp.Body) // nolint:errcheck
+// admit applies the header size and per-client limits to r, answering it
+// when they refuse it. release frees the client's slot once r is done.
+func (m *Manager) admit(w http.ResponseWriter, r *http.Request) (release func(), ok bool) {
+	if m.maxHeaderBytes > 0 {
+		if size := headerSize(r); size > m.maxHeaderBytes {
+			m.logger.Warn("request headers too large",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"request_id", m.requestID(r),
+				"size", size,
+				"limit", m.maxHeaderBytes,
+			)
+			http.Error(w, fmt.Sprintf("Request headers too large (%d bytes, limit %d)", size, m.maxHeaderBytes), http.StatusRequestHeaderFieldsTooLarge)
+			return nil, false
+		}
+	}
 
+	if m.perClient != nil {
+		client := clientHost(r)
+		if !m.perClient.acquire(client) {
+			m.logger.Warn("too many concurrent requests from client",
+				"client", client,
+				"method", r.Method,
+				"path", r.URL.Path,
+				"request_id", m.requestID(r),
+			)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Too many concurrent requests from this client", http.StatusTooManyRequests)
+			return nil, false
+		}
+		return func() { m.perClient.release(client) }, true
+	}
+	return func() {}, true
+}
+
+// acquireSlot waits for a free in-flight slot, giving up if the client
+// goes away. release frees the slot.
+func (m *Manager) acquireSlot(w http.ResponseWriter, r *http.Request) (release func(), ok bool) {
+	if m.inflight == nil {
+		return func() {}, true
+	}
+	select {
+	case m.inflight <- struct{}{}:
+		return func() { <-m.inflight }, true
+	case <-r.Context().Done():
+		http.Error(w, "Request cancelled while waiting for a free slot", http.StatusServiceUnavailable)
+		return nil, false
+	}
 }
@@ -1,13 +1,22 @@
 package tunnel
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -20,8 +29,8 @@ func TestManager(t *testing.T) {
 		t.Fatal("Expected Manager instance, got nil")
 	}
 
-	if m.localPort != port {
-		t.Fatalf("Expected localPort to be %d, got %d", port, m.localPort)
+	if m.LocalPort() != port {
+		t.Fatalf("Expected localPort to be %d, got %d", port, m.LocalPort())
 	}
 
 	if m.ready == nil {
@@ -138,6 +147,20 @@ func TestManager_Start_PreCancelledContext(t *testing.T) {
 	}
 }
 
+// TestManager_Start_SelfForward verifies the proxy refuses to listen on the
+// local server's port instead of forwarding requests to itself
+func TestManager_Start_SelfForward(t *testing.T) {
+	m := NewManager(3000, WithListenAddr("127.0.0.1:3000"))
+	if err := m.Start(context.Background()); !errors.Is(err, ErrSelfForward) {
+		t.Fatalf("expected ErrSelfForward, got %v", err)
+	}
+	select {
+	case <-m.Ready():
+		t.Error("expected the proxy not to become ready")
+	default:
+	}
+}
+
 // TestManager_Close verifies resource cleanup on Close.
 func TestManager_Close(t *testing.T) {
 	m := NewManager(3000)
@@ -161,6 +184,25 @@ func TestManager_Close(t *testing.T) {
 
 }
 
+// TestManager_CloseAfterCancel verifies closing a manager its context
+// already shut down reports no closed-listener error
+func TestManager_CloseAfterCancel(t *testing.T) {
+	m := NewManager(3000)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.Start(ctx) }()
+	<-m.Ready()
+
+	// races the context watcher's own Close
+	cancel()
+	if err := m.Close(); err != nil {
+		t.Errorf("expected nil from Close after cancellation, got %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("expected Start to return nil on cancellation, got %v", err)
+	}
+}
+
 // TestManager_Close_BeforeStart verifies close is safe before Start is called.
 func TestManager_Close_BeforeStart(t *testing.T) {
 	m := NewManager(3000)
@@ -302,10 +344,1117 @@ func TestManager_FullLifeCycle(t *testing.T) {
 	// }
 	err := m.Close()
 
-	// Note: Close() may return "use of closed network connection"
-	// because server.Close() already closed the listener.
-	// This is expected behavior in errors.Join()
+	// Close suppresses "use of closed network connection" from a
+	// listener the context watcher already closed
 	if err != nil {
 		t.Errorf("unexpected error on Close(): %v", err)
 	}
 }
+
+// TestManager_SlowRequestWarning verifies slow requests are logged and counted.
+func TestManager_SlowRequestWarning(t *testing.T) {
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer localServer.Close()
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+
+	m := NewManager(serverPort(t, localServer), WithLogger(logger), WithSlowThreshold(10*time.Millisecond))
+
+	req := httptest.NewRequest("GET", "/slow", nil)
+	w := httptest.NewRecorder()
+	m.proxyHandler(w, req)
+
+	out := logs.String()
+	if !strings.Contains(out, "slow request") {
+		t.Fatalf("expected slow request warning, got %q", out)
+	}
+	if !strings.Contains(out, "method=GET") || !strings.Contains(out, "path=/slow") {
+		t.Errorf("expected method and path in warning, got %q", out)
+	}
+
+	stats := m.Stats()
+	if stats.Requests != 1 || stats.SlowRequests != 1 {
+		t.Errorf("expected 1 request and 1 slow request, got %+v", stats)
+	}
+	if stats.P50 < 50*time.Millisecond || stats.P95 < stats.P50 {
+		t.Errorf("unexpected latency estimates: p50=%v p95=%v", stats.P50, stats.P95)
+	}
+	if stats.Active != 0 {
+		t.Errorf("expected no active requests, got %d", stats.Active)
+	}
+}
+
+// TestManager_SlowRequestWarning_Disabled verifies no warning without a threshold.
+func TestManager_SlowRequestWarning_Disabled(t *testing.T) {
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer localServer.Close()
+
+	var logs bytes.Buffer
+	m := NewManager(serverPort(t, localServer), WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+
+	m.proxyHandler(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if logs.Len() != 0 {
+		t.Errorf("expected no logs, got %q", logs.String())
+	}
+	if got := m.Stats().SlowRequests; got != 0 {
+		t.Errorf("expected 0 slow requests, got %d", got)
+	}
+}
+
+// TestManager_LargePayloadWarning verifies bodies are logged with method,
+// path and size only above the threshold
+func TestManager_LargePayloadWarning(t *testing.T) {
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		size, _ := strconv.Atoi(r.URL.Query().Get("size"))
+		w.Write(bytes.Repeat([]byte("x"), size))
+	}))
+	defer localServer.Close()
+
+	tests := []struct {
+		name     string
+		request  int
+		response int
+		want     []string
+	}{
+		{name: "small", request: 100, response: 100},
+		{name: "at threshold", request: 1024, response: 1024},
+		{name: "large request", request: 4096, response: 100, want: []string{"direction=request", "bytes=4096"}},
+		{name: "large response", request: 0, response: 2048, want: []string{"direction=response", "bytes=2048"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			m := NewManager(serverPort(t, localServer),
+				WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+				WithLargePayloadThreshold(1024),
+			)
+			h := m.logLargePayloads(http.HandlerFunc(m.proxyHandler))
+
+			var body io.Reader = http.NoBody
+			if tt.request > 0 {
+				body = bytes.NewReader(bytes.Repeat([]byte("y"), tt.request))
+			}
+			req := httptest.NewRequest("POST", fmt.Sprintf("/upload?size=%d", tt.response), body)
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			out := logs.String()
+			if len(tt.want) == 0 {
+				if strings.Contains(out, "large payload") {
+					t.Errorf("expected no large payload warning, got %q", out)
+				}
+				return
+			}
+			if c := strings.Count(out, "large payload"); c != 1 {
+				t.Fatalf("expected one large payload warning, got %q", out)
+			}
+			for _, want := range append(tt.want, "method=POST", "path=/upload") {
+				if !strings.Contains(out, want) {
+					t.Errorf("expected %q in the warning, got %q", want, out)
+				}
+			}
+		})
+	}
+}
+
+// serverPort extracts the port of a httptest server.
+func serverPort(t testing.TB, s *httptest.Server) int {
+	t.Helper()
+	return s.Listener.Addr().(*net.TCPAddr).Port
+}
+
+// rawUpstream starts a TCP server that answers every request with the raw
+// response bytes and then closes the connection. It returns the port.
+func rawUpstream(t *testing.T, response string) int {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				// consume the request before answering
+				if _, err := http.ReadRequest(bufio.NewReader(conn)); err != nil {
+					return
+				}
+				conn.Write([]byte(response))
+			}()
+		}
+	}()
+
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// TestManager_ProxyHandler_UpstreamClosesBeforeBody verifies a 502 when no body was sent yet.
+func TestManager_ProxyHandler_UpstreamClosesBeforeBody(t *testing.T) {
+	port := rawUpstream(t, "HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\n")
+	m := NewManager(port, WithLogger(slog.New(slog.DiscardHandler)))
+
+	w := httptest.NewRecorder()
+	m.proxyHandler(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("expected 502 Bad Gateway, got %d", w.Code)
+	}
+}
+
+// TestManager_ProxyHandler_UpstreamClosesMidBody verifies the client connection
+// is aborted rather than ending with a silently truncated body.
+func TestManager_ProxyHandler_UpstreamClosesMidBody(t *testing.T) {
+	port := rawUpstream(t, "HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\npartial")
+
+	var logs bytes.Buffer
+	m := NewManager(port, WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+
+	proxy := httptest.NewServer(http.HandlerFunc(m.proxyHandler))
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL)
+	if err != nil {
+		t.Fatalf("unexpected request error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.ReadAll(resp.Body); err == nil {
+		t.Error("expected error reading truncated body, got nil")
+	}
+
+	if !strings.Contains(logs.String(), "proxied response truncated") {
+		t.Errorf("expected truncation to be logged, got %q", logs.String())
+	}
+}
+
+// TestManager_ProxyHandler_Chunked verifies a chunked local response
+// reaches the client complete and framed by the proxy's own server,
+// without the local connection's framing and hop-by-hop headers
+func TestManager_ProxyHandler_Chunked(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{name: "chunked", header: "Transfer-Encoding: chunked\r\n"},
+		{name: "chunked with a length", header: "Transfer-Encoding: chunked\r\nContent-Length: 3\r\n"},
+		{name: "hop-by-hop headers", header: "Transfer-Encoding: chunked\r\nConnection: keep-alive, X-Local\r\nX-Local: 1\r\nKeep-Alive: timeout=5\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := rawUpstream(t, "HTTP/1.1 200 OK\r\n"+tt.header+"\r\n5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n")
+			m := NewManager(port)
+			startManager(t, m)
+
+			conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", m.ListenPort()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+			io.WriteString(conn, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil || string(body) != "hello world" {
+				t.Errorf("expected the full body, got %q (%v)", body, err)
+			}
+			if resp.ContentLength != -1 && resp.ContentLength != int64(len(body)) {
+				t.Errorf("expected a length matching the body, got %d", resp.ContentLength)
+			}
+			for _, h := range []string{"Connection", "Keep-Alive", "X-Local"} {
+				if v := resp.Header.Get(h); v != "" {
+					t.Errorf("expected no %s header, got %q", h, v)
+				}
+			}
+		})
+	}
+}
+
+// TestManager_MaxConcurrency verifies in-flight requests never exceed the configured cap.
+func TestManager_MaxConcurrency(t *testing.T) {
+	const limit = 2
+
+	var current, peak atomic.Int64
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := current.Add(1)
+		defer current.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(30 * time.Millisecond)
+	}))
+	defer localServer.Close()
+
+	m := NewManager(serverPort(t, localServer), WithMaxConcurrency(limit))
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			w := httptest.NewRecorder()
+			m.proxyHandler(w, httptest.NewRequest("GET", "/", nil))
+			if w.Code != http.StatusOK {
+				t.Errorf("expected 200, got %d", w.Code)
+			}
+		})
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got > limit {
+		t.Errorf("concurrency exceeded cap: peak %d > %d", got, limit)
+	}
+	if got := m.Stats().Requests; got != 8 {
+		t.Errorf("expected all 8 requests to complete, got %d", got)
+	}
+}
+
+// TestManager_MaxConcurrency_ClientGone verifies waiting requests give up with the client.
+func TestManager_MaxConcurrency_ClientGone(t *testing.T) {
+	m := NewManager(65000, WithMaxConcurrency(1))
+	m.inflight <- struct{}{} // occupy the only slot
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	w := httptest.NewRecorder()
+	m.proxyHandler(w, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", w.Code)
+	}
+}
+
+// TestManager_ProxyHandler_LocalTLS verifies the proxy reaches an HTTPS local server.
+func TestManager_ProxyHandler_LocalTLS(t *testing.T) {
+	localServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello over tls"))
+	}))
+	defer localServer.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(localServer.Certificate())
+
+	tests := []struct {
+		name     string
+		cfg      *tls.Config
+		wantCode int
+	}{
+		// httptest certificates are issued for example.com
+		{"verified with trusted CA", &tls.Config{RootCAs: pool, ServerName: "example.com"}, http.StatusOK},
+		{"self-signed with skip verify", &tls.Config{InsecureSkipVerify: true}, http.StatusOK},
+		{"untrusted certificate", &tls.Config{}, http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager(serverPort(t, localServer), WithLocalTLS(tt.cfg))
+
+			w := httptest.NewRecorder()
+			m.proxyHandler(w, httptest.NewRequest("GET", "/", nil))
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if tt.wantCode == http.StatusOK && w.Body.String() != "hello over tls" {
+				t.Errorf("unexpected body %q", w.Body.String())
+			}
+			if tt.wantCode == http.StatusBadGateway && !strings.Contains(w.Body.String(), "TLS handshake") {
+				t.Errorf("expected TLS handshake error, got %q", w.Body.String())
+			}
+		})
+	}
+}
+
+// TestManager_RequestID verifies correlation IDs are generated, preserved and echoed.
+func TestManager_RequestID(t *testing.T) {
+	// the local server reports the ID it received in the body
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Request-ID") + "|" + r.Header.Get("X-Correlation-ID")))
+	}))
+	defer localServer.Close()
+	port := serverPort(t, localServer)
+
+	t.Run("generated when missing", func(t *testing.T) {
+		m := NewManager(port)
+		w := httptest.NewRecorder()
+		m.proxyHandler(w, httptest.NewRequest("GET", "/", nil))
+
+		id := w.Header().Get("X-Request-ID")
+		if len(id) != 32 {
+			t.Fatalf("expected generated 32 char ID, got %q", id)
+		}
+		if w.Body.String() != id+"|" {
+			t.Errorf("expected local server to receive %s, got %q", id, w.Body.String())
+		}
+	})
+
+	t.Run("preserved when present", func(t *testing.T) {
+		m := NewManager(port)
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Request-ID", "abc-123")
+		w := httptest.NewRecorder()
+		m.proxyHandler(w, req)
+
+		if got := w.Header().Values("X-Request-ID"); len(got) != 1 || got[0] != "abc-123" {
+			t.Errorf("expected single preserved ID, got %v", got)
+		}
+		if w.Body.String() != "abc-123|" {
+			t.Errorf("expected local server to receive abc-123, got %q", w.Body.String())
+		}
+	})
+
+	t.Run("custom header name", func(t *testing.T) {
+		m := NewManager(port, WithRequestIDHeader("x-correlation-id"))
+		w := httptest.NewRecorder()
+		m.proxyHandler(w, httptest.NewRequest("GET", "/", nil))
+
+		id := w.Header().Get("X-Correlation-ID")
+		if id == "" || w.Body.String() != "|"+id {
+			t.Errorf("expected custom header to carry the ID, got header %q body %q", id, w.Body.String())
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		m := NewManager(port, WithRequestIDHeader(""))
+		w := httptest.NewRecorder()
+		m.proxyHandler(w, httptest.NewRequest("GET", "/", nil))
+
+		if id := w.Header().Get("X-Request-ID"); id != "" {
+			t.Errorf("expected no request ID, got %q", id)
+		}
+	})
+}
+
+// TestManager_RequestID_InLogs verifies the ID appears in the request log line.
+func TestManager_RequestID_InLogs(t *testing.T) {
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer localServer.Close()
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	m := NewManager(serverPort(t, localServer), WithLogger(logger))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "trace-me")
+	m.proxyHandler(httptest.NewRecorder(), req)
+
+	if !strings.Contains(logs.String(), "request_id=trace-me") {
+		t.Errorf("expected request ID in log line, got %q", logs.String())
+	}
+}
+
+// TestManager_ProxyHandler_Trailers verifies announced and unannounced
+// trailers of the local server reach the client after the body
+func TestManager_ProxyHandler_Trailers(t *testing.T) {
+	for _, http2 := range []bool{false, true} {
+		t.Run(fmt.Sprintf("http2=%v", http2), func(t *testing.T) {
+			localServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Trailer", "Grpc-Status")
+				w.Write([]byte("body"))
+				w.Header().Set("Grpc-Status", "0")
+				w.Header().Set(http.TrailerPrefix+"X-Checksum", "abc")
+			}))
+			if http2 {
+				localServer.Config.Protocols = new(http.Protocols)
+				localServer.Config.Protocols.SetUnencryptedHTTP2(true)
+			}
+			localServer.Start()
+			defer localServer.Close()
+
+			m := NewManager(serverPort(t, localServer), WithLocalHTTP2(http2))
+			startManager(t, m)
+
+			resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/", m.ListenPort()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if _, ok := resp.Trailer["Grpc-Status"]; !ok {
+				t.Errorf("expected Grpc-Status to be announced, got %v", resp.Trailer)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != "body" {
+				t.Errorf("expected the body, got %q", body)
+			}
+			if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+				t.Errorf("expected Grpc-Status trailer 0, got %q", got)
+			}
+			if got := resp.Trailer.Get("X-Checksum"); got != "abc" {
+				t.Errorf("expected X-Checksum trailer abc, got %q", got)
+			}
+		})
+	}
+}
+
+// startManager starts m in the background and waits until it's ready.
+func startManager(t *testing.T, m *Manager) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- m.Start(ctx) }()
+
+	select {
+	case <-m.Ready():
+	case err := <-errCh:
+		t.Fatalf("Start failed: %v", err)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for Ready")
+	}
+}
+
+// TestManager_ListenAddr verifies a configured port is used and ":0" stays random
+func TestManager_ListenAddr(t *testing.T) {
+	// grab a free port and release it for the manager
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	m := NewManager(3000, WithListenAddr(fmt.Sprintf("127.0.0.1:%d", want)))
+	startManager(t, m)
+	if got := m.ListenPort(); got != want {
+		t.Errorf("expected listen port %d, got %d", want, got)
+	}
+
+	random := NewManager(3000)
+	startManager(t, random)
+	if random.ListenPort() == 0 {
+		t.Error("expected default listen address to pick a free port")
+	}
+}
+
+// TestManager_ListenAddr_Invalid verifies Start rejects bad listen addresses
+func TestManager_ListenAddr_Invalid(t *testing.T) {
+	for _, addr := range []string{"8000", "localhost:http-alt", ":70000", ":-1"} {
+		if err := ValidateListenAddr(addr); err == nil {
+			t.Errorf("expected %q to be rejected", addr)
+		}
+
+		m := NewManager(3000, WithListenAddr(addr))
+		if err := m.Start(context.Background()); err == nil {
+			t.Errorf("expected Start to fail for %q", addr)
+		}
+	}
+
+	for _, addr := range []string{":0", ":8000", "127.0.0.1:8000", "[::1]:0"} {
+		if err := ValidateListenAddr(addr); err != nil {
+			t.Errorf("expected %q to be valid, got %v", addr, err)
+		}
+	}
+}
+
+// TestManager_RecoverPanics verifies a panic becomes a logged 500 and the server keeps serving
+func TestManager_RecoverPanics(t *testing.T) {
+	var logs bytes.Buffer
+	m := NewManager(3000, WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+
+	srv := httptest.NewServer(m.recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/boom" {
+			panic("boom")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/boom")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(logs.String(), "panic in proxy handler") || !strings.Contains(logs.String(), "stack=") {
+		t.Errorf("expected panic logged with stack, got %q", logs.String())
+	}
+
+	// the server must still be up
+	resp, err = http.Get(srv.URL + "/ok")
+	if err != nil {
+		t.Fatalf("server down after panic: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected 204 after recovery, got %d", resp.StatusCode)
+	}
+}
+
+// TestManager_RecoverPanics_AbortHandler verifies http.ErrAbortHandler still aborts the response
+func TestManager_RecoverPanics_AbortHandler(t *testing.T) {
+	var logs bytes.Buffer
+	m := NewManager(3000, WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+
+	srv := httptest.NewServer(m.recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatalf("expected aborted connection, got status %d", resp.StatusCode)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("expected abort not to be logged as a panic, got %q", logs.String())
+	}
+}
+
+// TestManager_Identify verifies Via and X-Expose-Version on both directions when enabled
+func TestManager_Identify(t *testing.T) {
+	// the local server reports the identification headers it received
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Via") + "|" + r.Header.Get("X-Expose-Version")))
+	}))
+	defer localServer.Close()
+	port := serverPort(t, localServer)
+
+	t.Run("enabled", func(t *testing.T) {
+		m := NewManager(port, WithIdentify("v1.2.3"))
+		w := httptest.NewRecorder()
+		m.proxyHandler(w, httptest.NewRequest("GET", "/", nil))
+
+		if w.Body.String() != "1.1 expose|v1.2.3" {
+			t.Errorf("expected local server to receive identification, got %q", w.Body.String())
+		}
+		if got := w.Header().Get("Via"); got != "1.1 expose" {
+			t.Errorf("expected response Via '1.1 expose', got %q", got)
+		}
+		if got := w.Header().Get(ExposeVersionHeader); got != "v1.2.3" {
+			t.Errorf("expected response version v1.2.3, got %q", got)
+		}
+	})
+
+	t.Run("appends to existing Via", func(t *testing.T) {
+		m := NewManager(port, WithIdentify("v1.2.3"))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Via", "1.1 cdn")
+		w := httptest.NewRecorder()
+		m.proxyHandler(w, req)
+
+		if !strings.HasPrefix(w.Body.String(), "1.1 cdn") {
+			t.Errorf("expected upstream Via to be kept first, got %q", w.Body.String())
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		m := NewManager(port)
+		w := httptest.NewRecorder()
+		m.proxyHandler(w, httptest.NewRequest("GET", "/", nil))
+
+		if w.Body.String() != "|" {
+			t.Errorf("expected no identification upstream, got %q", w.Body.String())
+		}
+		if w.Header().Get("Via") != "" || w.Header().Get(ExposeVersionHeader) != "" {
+			t.Errorf("expected no identification headers, got %v", w.Header())
+		}
+	})
+}
+
+// TestManager_PathPrefix verifies prefixes are stripped/added before forwarding
+func TestManager_PathPrefix(t *testing.T) {
+	// the local server reports the request URI it received
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.RequestURI))
+	}))
+	defer localServer.Close()
+	port := serverPort(t, localServer)
+
+	tests := []struct {
+		name string
+		opts []ManagerOption
+		path string
+		want string
+	}{
+		{"no-op default", nil, "/api/users?id=1", "/api/users?id=1"},
+		{"strip", []ManagerOption{WithStripPrefix("/api")}, "/api/users?id=1", "/users?id=1"},
+		{"strip exact match", []ManagerOption{WithStripPrefix("/api/")}, "/api", "/"},
+		{"strip only on segment boundary", []ManagerOption{WithStripPrefix("/api")}, "/apiary", "/apiary"},
+		{"add", []ManagerOption{WithAddPrefix("api")}, "/users", "/api/users"},
+		{"strip then add", []ManagerOption{WithStripPrefix("/v1"), WithAddPrefix("/api")}, "/v1/users", "/api/users"},
+		{"escaping preserved", []ManagerOption{WithStripPrefix("/api")}, "/api/a%2Fb", "/a%2Fb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager(port, tt.opts...)
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", tt.path, nil)
+			m.proxyHandler(w, req)
+
+			if w.Body.String() != tt.want {
+				t.Errorf("expected local server to receive %q, got %q", tt.want, w.Body.String())
+			}
+			if req.URL.RequestURI() != tt.path {
+				t.Errorf("expected original request to be untouched, got %q", req.URL.RequestURI())
+			}
+		})
+	}
+}
+
+// TestManager_Host verifies the local server sees localhost:<port> by
+// default and the public Host with WithPreserveHost, over HTTP/1.1 and h2c
+func TestManager_Host(t *testing.T) {
+	hostHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s|%s", r.Host, r.Header.Get("X-Forwarded-Host"))
+	})
+	local := httptest.NewUnstartedServer(hostHandler)
+	local.Config.Protocols = new(http.Protocols)
+	local.Config.Protocols.SetHTTP1(true)
+	local.Config.Protocols.SetUnencryptedHTTP2(true)
+	local.Start()
+	defer local.Close()
+	port := serverPort(t, local)
+	localHost := fmt.Sprintf("localhost:%d", port)
+
+	tests := []struct {
+		name string
+		opts []ManagerOption
+		want string
+	}{
+		{"rewritten by default", nil, localHost + "|abc.loca.lt"},
+		{"preserved", []ManagerOption{WithPreserveHost(true)}, "abc.loca.lt|"},
+		{"rewritten over h2c", []ManagerOption{WithLocalHTTP2(true)}, localHost + "|abc.loca.lt"},
+		{"preserved over h2c", []ManagerOption{WithLocalHTTP2(true), WithPreserveHost(true)}, "abc.loca.lt|"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager(port, tt.opts...)
+			defer m.Close()
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "http://abc.loca.lt/", nil)
+			m.proxyHandler(w, req)
+
+			if w.Body.String() != tt.want {
+				t.Errorf("expected local server to see %q, got %q", tt.want, w.Body.String())
+			}
+			if req.Host != "abc.loca.lt" || req.Header.Get("X-Forwarded-Host") != "" {
+				t.Errorf("expected original request to be untouched, got %q %v", req.Host, req.Header)
+			}
+		})
+	}
+
+	// an X-Forwarded-Host set by the tunnel server is kept
+	m := NewManager(port)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://abc.loca.lt/", nil)
+	req.Header.Set("X-Forwarded-Host", "edge.example.com")
+	m.proxyHandler(w, req)
+	if want := localHost + "|edge.example.com"; w.Body.String() != want {
+		t.Errorf("expected %q, got %q", want, w.Body.String())
+	}
+}
+
+// TestManager_ReadHeaderTimeout verifies a client that never finishes its headers is dropped
+func TestManager_ReadHeaderTimeout(t *testing.T) {
+	m := NewManager(3000, WithServerTimeouts(ServerTimeouts{ReadHeader: 100 * time.Millisecond}))
+	startManager(t, m)
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", m.ListenPort()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// start a request but never finish the headers
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.ReadAll(conn); err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			t.Fatal("expected the server to drop the slow client, connection still open")
+		}
+	}
+}
+
+func TestManager_DefaultServerTimeouts(t *testing.T) {
+	m := NewManager(3000)
+	if m.timeouts.ReadHeader == 0 {
+		t.Error("expected a default ReadHeader timeout against slowloris")
+	}
+}
+
+// TestManager_MaxHeaderBytes verifies oversized request headers get a 431
+// without reaching the local server
+func TestManager_MaxHeaderBytes(t *testing.T) {
+	var hits atomic.Int32
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer localServer.Close()
+	port := serverPort(t, localServer)
+
+	tests := []struct {
+		name       string
+		limit      int
+		headerSize int
+		wantStatus int
+	}{
+		{"small headers pass", 1024, 100, http.StatusOK},
+		{"oversized headers rejected", 1024, 2048, http.StatusRequestHeaderFieldsTooLarge},
+		{"check disabled", 0, 2048, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits.Store(0)
+			m := NewManager(port, WithMaxHeaderBytes(tt.limit))
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("X-Big", strings.Repeat("a", tt.headerSize))
+			m.proxyHandler(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if forwarded := hits.Load() == 1; forwarded != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("unexpected local server hits %d", hits.Load())
+			}
+		})
+	}
+}
+
+// TestManager_MaxHeaderBytesAboveServerDefault verifies a limit above
+// net/http's default is honoured end to end
+func TestManager_MaxHeaderBytesAboveServerDefault(t *testing.T) {
+	localServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	localServer.Config.MaxHeaderBytes = 4 << 20
+	localServer.Start()
+	defer localServer.Close()
+
+	m := NewManager(serverPort(t, localServer), WithMaxHeaderBytes(2<<20))
+	startManager(t, m)
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("http://127.0.0.1:%d/", m.ListenPort()), nil)
+	req.Header.Set("X-Big", strings.Repeat("a", 3<<20/2))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 1.5 MB headers under a 2 MB limit to pass, got %d", resp.StatusCode)
+	}
+}
+
+// TestManager_DialHonoursContext verifies a cancelled request never waits on the local dial
+func TestManager_DialHonoursContext(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	m := NewManager(ln.Addr().(*net.TCPAddr).Port)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	conn, err := m.dialLocal(ctx, nil)
+	if err == nil {
+		conn.Close()
+		t.Fatal("expected the dial to fail with a cancelled context")
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the dial to abort promptly, took %s", elapsed)
+	}
+}
+
+// TestManager_ClientCancelAbortsCopy verifies a client that goes away frees
+// the handler while the local server is still streaming
+func TestManager_ClientCancelAbortsCopy(t *testing.T) {
+	streaming := make(chan struct{})
+	done := make(chan struct{})
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first chunk"))
+		w.(http.Flusher).Flush()
+		close(streaming)
+		<-done // never finish the body
+	}))
+	defer localServer.Close()
+	defer close(done)
+
+	m := NewManager(serverPort(t, localServer))
+	startManager(t, m)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("http://127.0.0.1:%d/", m.ListenPort()), nil)
+	go func() {
+		<-streaming
+		cancel()
+	}()
+	if resp, err := http.DefaultClient.Do(req); err == nil {
+		resp.Body.Close()
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for m.Stats().Active != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("handler still copying after the client went away")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestManager_ExpectContinue verifies the local server's 100 Continue is
+// relayed to a client sending Expect: 100-continue, and that the body
+// is held back until then or dropped when the local server refuses it
+func TestManager_ExpectContinue(t *testing.T) {
+	tests := []struct {
+		name       string
+		accept     bool
+		wantStatus int
+	}{
+		{name: "continue", accept: true, wantStatus: http.StatusOK},
+		{name: "refused", accept: false, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+
+			upstreamErr := make(chan error, 1)
+			go func() {
+				conn, err := ln.Accept()
+				if err != nil {
+					upstreamErr <- err
+					return
+				}
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				req, err := http.ReadRequest(br)
+				if err != nil {
+					upstreamErr <- err
+					return
+				}
+				if got := req.Header.Get("Expect"); got != "100-continue" {
+					upstreamErr <- fmt.Errorf("local server got Expect %q", got)
+					return
+				}
+				// nothing of the body may arrive before the go-ahead
+				conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+				if _, err := br.Peek(1); err == nil {
+					upstreamErr <- errors.New("body sent before 100 Continue")
+					return
+				}
+				conn.SetReadDeadline(time.Time{})
+
+				if !tt.accept {
+					conn.Write([]byte("HTTP/1.1 401 Unauthorized\r\nContent-Length: 0\r\n\r\n"))
+					upstreamErr <- nil
+					return
+				}
+				conn.Write([]byte("HTTP/1.1 100 Continue\r\n\r\n"))
+				body, err := io.ReadAll(req.Body)
+				if err != nil {
+					upstreamErr <- err
+					return
+				}
+				fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+				upstreamErr <- nil
+			}()
+
+			m := NewManager(ln.Addr().(*net.TCPAddr).Port, WithLogger(slog.New(slog.DiscardHandler)))
+			startManager(t, m)
+
+			client, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", m.ListenPort()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			client.SetDeadline(time.Now().Add(5 * time.Second))
+
+			fmt.Fprint(client, "POST /upload HTTP/1.1\r\nHost: example.com\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n")
+			br := bufio.NewReader(client)
+			resp, err := http.ReadResponse(br, nil)
+			if err != nil {
+				t.Fatalf("reading the first response: %v", err)
+			}
+			if tt.accept {
+				if resp.StatusCode != http.StatusContinue {
+					t.Fatalf("expected 100 Continue first, got %d", resp.StatusCode)
+				}
+				fmt.Fprint(client, "hello")
+				if resp, err = http.ReadResponse(br, nil); err != nil {
+					t.Fatalf("reading the final response: %v", err)
+				}
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("expected %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+			if body, _ := io.ReadAll(resp.Body); tt.accept && string(body) != "hello" {
+				t.Errorf("expected the body echoed, got %q", body)
+			}
+			if err := <-upstreamErr; err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestManager_ReusesLocalConnections verifies consecutive requests share
+// one connection to the local server and each gets its own response
+func TestManager_ReusesLocalConnections(t *testing.T) {
+	var dials atomic.Int32
+	local := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s", r.Method, r.URL.Path, body)
+	}))
+	local.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			dials.Add(1)
+		}
+	}
+	local.Start()
+	defer local.Close()
+
+	m := NewManager(serverPort(t, local), WithLogger(slog.New(slog.DiscardHandler)))
+	defer m.Close()
+
+	for i := range 5 {
+		path := fmt.Sprintf("/item/%d", i)
+		w := httptest.NewRecorder()
+		m.proxyHandler(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(strconv.Itoa(i))))
+
+		if want := fmt.Sprintf("POST %s %d", path, i); w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("request %d: expected 200 %q, got %d %q", i, want, w.Code, w.Body.String())
+		}
+	}
+	if got := dials.Load(); got != 1 {
+		t.Errorf("expected a single local connection, got %d", got)
+	}
+}
+
+// TestManager_StreamsResponses verifies a response of unknown length
+// reaches the client as the local server flushes it, not once it ends
+func TestManager_StreamsResponses(t *testing.T) {
+	next := make(chan struct{})
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "first\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-next:
+		case <-time.After(5 * time.Second):
+		}
+		io.WriteString(w, "second\n")
+	}))
+	defer local.Close()
+
+	m := NewManager(serverPort(t, local), WithLogger(slog.New(slog.DiscardHandler)))
+	startManager(t, m)
+
+	// the response head is held back with the first line if nothing flushes
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/events", m.ListenPort()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	lines := make(chan string)
+	go func() {
+		br := bufio.NewReader(resp.Body)
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- line
+		}
+	}()
+
+	select {
+	case line := <-lines:
+		if line != "first\n" {
+			t.Fatalf("expected the first line, got %q", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("first line not streamed before the response ended")
+	}
+	close(next)
+	if line := <-lines; line != "second\n" {
+		t.Errorf("expected the second line, got %q", line)
+	}
+}
+
+// TestManager_HopByHopRequestHeaders verifies headers meant for the proxy
+// don't reach the local server while what the tunnel server said about the
+// original request does
+func TestManager_HopByHopRequestHeaders(t *testing.T) {
+	got := make(chan http.Header, 1)
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- r.Header.Clone()
+	}))
+	defer local.Close()
+
+	m := NewManager(serverPort(t, local), WithLogger(slog.New(slog.DiscardHandler)))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Connection", "X-Tunnel-Hop")
+	r.Header.Set("X-Tunnel-Hop", "1")
+	r.Header.Set("Keep-Alive", "timeout=5")
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	r.Header.Set("X-Forwarded-Proto", "https")
+	r.Header.Set("Forwarded", "for=203.0.113.7;proto=https")
+	w := httptest.NewRecorder()
+	m.proxyHandler(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	h := <-got
+	for _, name := range []string{"Connection", "X-Tunnel-Hop", "Keep-Alive"} {
+		if v, ok := h[name]; ok {
+			t.Errorf("expected %s to be dropped, got %q", name, v)
+		}
+	}
+	if v := h.Get("X-Forwarded-For"); v != "203.0.113.7" {
+		t.Errorf("expected X-Forwarded-For passed on as sent, got %q", v)
+	}
+	if v := h.Get("X-Forwarded-Proto"); v != "https" {
+		t.Errorf("expected X-Forwarded-Proto passed on, got %q", v)
+	}
+	if v := h.Get("Forwarded"); v != "for=203.0.113.7;proto=https" {
+		t.Errorf("expected Forwarded passed on, got %q", v)
+	}
+}
@@ -0,0 +1,73 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// WithLocalNetwork pins the IP family used to reach the local server:
+// "tcp4" dials 127.0.0.1 and "tcp6" dials ::1. Anything else dials
+// localhost over "tcp", the default, and whichever address the resolver
+// returns first wins, which fails confusingly for servers bound to only
+// one stack.
+func WithLocalNetwork(network string) ManagerOption {
+	return func(m *Manager) {
+		m.localNetwork = network
+	}
+}
+
+// WithUnixSocket reaches the local server on the Unix domain socket at
+// path instead of a TCP port, for servers like Docker that only listen on
+// one. The local port is then only used in messages. "" keeps TCP.
+func WithUnixSocket(path string) ManagerOption {
+	return func(m *Manager) {
+		m.localSocket = path
+	}
+}
+
+// ValidateUnixSocket checks that path is an existing Unix domain socket.
+func ValidateUnixSocket(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("invalid unix socket: %w", err)
+	}
+	if info.Mode().Type() != os.ModeSocket {
+		return fmt.Errorf("invalid unix socket %s: not a socket", path)
+	}
+	return nil
+}
+
+// localTarget returns the network and address of the local server.
+func (m *Manager) localTarget() (network, address string) {
+	if m.localSocket != "" {
+		return "unix", m.localSocket
+	}
+	port := strconv.Itoa(m.LocalPort())
+	switch m.localNetwork {
+	case "tcp4":
+		return "tcp4", net.JoinHostPort("127.0.0.1", port)
+	case "tcp6":
+		return "tcp6", net.JoinHostPort("::1", port)
+	}
+	return "tcp", net.JoinHostPort("localhost", port)
+}
+
+// localName names the local server in messages, "localhost:<port>" or
+// "unix:<path>".
+func (m *Manager) localName() string {
+	if m.localSocket != "" {
+		return "unix:" + m.localSocket
+	}
+	return net.JoinHostPort("localhost", strconv.Itoa(m.LocalPort()))
+}
+
+// localHost is the Host header the local server sees by default, see
+// WithPreserveHost. A socket has no port to put in it.
+func (m *Manager) localHost() string {
+	if m.localSocket != "" {
+		return "localhost"
+	}
+	return net.JoinHostPort("localhost", strconv.Itoa(m.LocalPort()))
+}
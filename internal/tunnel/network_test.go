@@ -0,0 +1,162 @@
+package tunnel
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestManager_LocalTarget tests the dial network and address per preference.
+func TestManager_LocalTarget(t *testing.T) {
+	tests := []struct {
+		network     string
+		wantNetwork string
+		wantAddr    string
+	}{
+		{"", "tcp", "localhost:3000"},
+		{"tcp4", "tcp4", "127.0.0.1:3000"},
+		{"tcp6", "tcp6", "[::1]:3000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantNetwork, func(t *testing.T) {
+			m := NewManager(3000, WithLocalNetwork(tt.network))
+			network, addr := m.localTarget()
+			if network != tt.wantNetwork || addr != tt.wantAddr {
+				t.Errorf("localTarget() = %s %s, want %s %s", network, addr, tt.wantNetwork, tt.wantAddr)
+			}
+		})
+	}
+}
+
+// familyServer starts a test server listening on host only, skipping the
+// test when the host has no such loopback address.
+func familyServer(t *testing.T, host string) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		t.Skipf("no %s loopback: %v", host, err)
+	}
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	s.Listener.Close()
+	s.Listener = ln
+	s.Start()
+	t.Cleanup(s.Close)
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// TestManager_LocalNetwork tests that each preference dials only its
+// family, so a server bound to one stack is reached or refused as pinned.
+func TestManager_LocalNetwork(t *testing.T) {
+	tests := []struct {
+		name    string
+		host    string
+		network string
+		want    int
+	}{
+		{"ipv4 server, tcp4", "127.0.0.1", "tcp4", http.StatusOK},
+		{"ipv4 server, tcp6", "127.0.0.1", "tcp6", http.StatusBadGateway},
+		{"ipv6 server, tcp6", "::1", "tcp6", http.StatusOK},
+		{"ipv6 server, tcp4", "::1", "tcp4", http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := familyServer(t, tt.host)
+			m := NewManager(port, WithLocalNetwork(tt.network))
+
+			w := httptest.NewRecorder()
+			m.proxyHandler(w, httptest.NewRequest("GET", "/", nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+// unixServer starts a test server on a Unix socket echoing the Host it was
+// sent, returning the socket path.
+func unixServer(t *testing.T) string {
+	t.Helper()
+	// socket paths are limited to ~100 bytes, t.TempDir can be longer
+	dir, err := os.MkdirTemp("", "expose")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "app.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("no unix sockets: %v", err)
+	}
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("host " + r.Host))
+	}))
+	s.Listener.Close()
+	s.Listener = ln
+	s.Start()
+	t.Cleanup(s.Close)
+	return path
+}
+
+// TestManager_UnixSocket tests requests reach a server on a Unix socket,
+// with Host: localhost as there is no port
+func TestManager_UnixSocket(t *testing.T) {
+	path := unixServer(t)
+	m := NewManager(3000, WithUnixSocket(path))
+	if network, addr := m.localTarget(); network != "unix" || addr != path {
+		t.Errorf("localTarget() = %s %s, want unix %s", network, addr, path)
+	}
+
+	w := httptest.NewRecorder()
+	m.proxyHandler(w, httptest.NewRequest("GET", "http://example.loca.lt/", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "host localhost" {
+		t.Errorf("expected 200 host localhost, got %d %q", w.Code, w.Body)
+	}
+
+	// a server that went away is reported by its socket
+	m = NewManager(3000, WithUnixSocket(path+".gone"))
+	w = httptest.NewRecorder()
+	m.proxyHandler(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "unix:"+path+".gone") {
+		t.Errorf("expected 502 naming the socket, got %d %q", w.Code, w.Body)
+	}
+}
+
+// TestValidateUnixSocket tests only existing sockets are accepted
+func TestValidateUnixSocket(t *testing.T) {
+	path := unixServer(t)
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr string
+	}{
+		{"socket", path, ""},
+		{"regular file", file, "not a socket"},
+		{"missing", path + ".gone", "no such file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateUnixSocket(tt.path)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
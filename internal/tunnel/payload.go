@@ -0,0 +1,64 @@
+package tunnel
+
+import (
+	"io"
+	"net/http"
+)
+
+// WithLargePayloadThreshold logs a warning with the method, path and size
+// of every request or response body larger than n bytes, to find the
+// endpoints behind memory spikes. Bodies are counted as they stream, never
+// buffered. Zero or negative disables it.
+func WithLargePayloadThreshold(n int64) ManagerOption {
+	return func(m *Manager) {
+		m.largePayload = max(n, 0)
+	}
+}
+
+// countingBody counts the bytes read from a request body.
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// logLargePayloads wraps next with the large payload warning, if a
+// threshold is configured.
+func (m *Manager) logLargePayloads(next http.Handler) http.Handler {
+	if m.largePayload == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body *countingBody
+		if r.Body != nil && r.Body != http.NoBody {
+			body = &countingBody{ReadCloser: r.Body}
+			r.Body = body
+		}
+		rw := &responseTracker{ResponseWriter: w}
+		defer func() {
+			if body != nil && body.n > m.largePayload {
+				m.warnLargePayload(r, "request", body.n)
+			}
+			if rw.size > m.largePayload {
+				m.warnLargePayload(r, "response", rw.size)
+			}
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// warnLargePayload logs a body of size bytes sent in direction.
+func (m *Manager) warnLargePayload(r *http.Request, direction string, size int64) {
+	m.logger.Warn("large payload",
+		"direction", direction,
+		"method", r.Method,
+		"path", r.URL.Path,
+		"bytes", size,
+		"request_id", m.requestID(r),
+	)
+}
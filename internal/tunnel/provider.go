@@ -1,6 +1,10 @@
 package tunnel
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+)
 
 // Provider is an interface for tunnel service providers.
 // It defines the methods required to establish and manage a tunnel.
@@ -20,3 +24,113 @@ type Provider interface {
 	// Name of the provider (metadata)
 	Name() string // "localtunnel", "ngrok", etc.
 }
+
+// Capabilities describes the optional features a provider supports.
+// The CLI uses it to reject flags a provider cannot honour before starting.
+type Capabilities struct {
+	SupportsTCP          bool // raw TCP tunnels, not just HTTP
+	SupportsSubdomain    bool // requesting a specific subdomain
+	SupportsRegion       bool // selecting the edge region
+	SupportsCustomDomain bool // serving on a user-owned hostname
+}
+
+// CapabilityReporter is implemented by providers that advertise their Capabilities.
+type CapabilityReporter interface {
+	Capabilities() Capabilities
+}
+
+// CapabilitiesOf returns the capabilities of p.
+// Providers that don't implement CapabilityReporter support no optional features.
+func CapabilitiesOf(p Provider) Capabilities {
+	if cr, ok := p.(CapabilityReporter); ok {
+		return cr.Capabilities()
+	}
+	return Capabilities{}
+}
+
+// URLNotifier is implemented by providers whose public URL can change
+// after the initial Connect, e.g. when they reconnect.
+type URLNotifier interface {
+	// OnURLChange registers fn to be called with the new public URL
+	// every time the provider updates it.
+	OnURLChange(fn func(url string))
+}
+
+// AvailabilityChecker is implemented by providers that depend on something
+// outside the process, e.g. an installed binary.
+type AvailabilityChecker interface {
+	// Available returns an error wrapping ErrProviderUnavailable that
+	// explains why the provider can't be used, or nil when it is ready to
+	// Connect.
+	Available() error
+}
+
+// Available reports whether p can be used. Providers that don't implement
+// AvailabilityChecker are always available.
+func Available(p Provider) error {
+	if ac, ok := p.(AvailabilityChecker); ok {
+		return ac.Available()
+	}
+	return nil
+}
+
+// FirstAvailable returns the first of providers, in priority order, that is
+// Available. If none is, the error wraps ErrProviderUnavailable and lists
+// why each was skipped.
+func FirstAvailable(providers ...Provider) (Provider, error) {
+	var errs []error
+	for _, p := range providers {
+		err := Available(p)
+		if err == nil {
+			return p, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+	}
+	return nil, fmt.Errorf("%w: %w", ErrProviderUnavailable, errors.Join(errs...))
+}
+
+// TrafficReporter is implemented by providers that count the bytes they
+// move between the tunnel and the local server.
+type TrafficReporter interface {
+	Traffic() (in, out int64)
+}
+
+// HealthChecker is implemented by providers that can probe their tunnel
+// beyond IsConnected, e.g. the state of a connection pool or a process.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// HealthCheck probes p, falling back to IsConnected for providers that
+// don't implement HealthChecker.
+func HealthCheck(ctx context.Context, p Provider) error {
+	if hc, ok := p.(HealthChecker); ok {
+		return hc.HealthCheck(ctx)
+	}
+	if !p.IsConnected() {
+		return ErrNotConnected
+	}
+	return nil
+}
+
+// Reconnector is implemented by providers that can re-establish their
+// tunnel more cheaply than Close and Connect, e.g. by re-dialing a
+// connection pool while keeping the public URL.
+type Reconnector interface {
+	// Reconnect re-establishes the tunnel to localPort and returns the
+	// public URL, which may have changed. The provider may never have been
+	// connected, e.g. when it was just swapped in by Service.Reconfigure.
+	Reconnect(ctx context.Context, localPort int) (string, error)
+}
+
+// Reconnect re-establishes p's tunnel to localPort through its Reconnector,
+// falling back to Close and Connect for providers that don't implement it.
+func Reconnect(ctx context.Context, p Provider, localPort int) (string, error) {
+	if r, ok := p.(Reconnector); ok {
+		return r.Reconnect(ctx, localPort)
+	}
+
+	// the old connection may be half-dead, close it before reconnecting
+	_ = p.Close()
+	return p.Connect(ctx, localPort)
+}
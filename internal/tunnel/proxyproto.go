@@ -0,0 +1,120 @@
+package tunnel
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+)
+
+// PROXY protocol versions for WithProxyProtocol.
+const (
+	ProxyProtocolV1 = 1 // human readable header line
+	ProxyProtocolV2 = 2 // binary header
+)
+
+// proxyV2Signature starts every PROXY protocol v2 header.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// WithProxyProtocol starts every connection to the local server with a
+// PROXY protocol header of the given version, so the server sees the real
+// client address at the TCP layer. The server must be configured to expect
+// it. 0 disables it. Connections shared between clients can't carry it, so
+// it doesn't apply with WithLocalHTTP2, and HTTP/1.1 requests get a new
+// connection each instead of a pooled one.
+func WithProxyProtocol(version int) ManagerOption {
+	return func(m *Manager) {
+		m.proxyProtocol = version
+	}
+}
+
+// writeProxyHeader announces r's client on conn, a new connection to the
+// local server, when WithProxyProtocol is enabled.
+func (m *Manager) writeProxyHeader(conn net.Conn, r *http.Request) error {
+	if m.proxyProtocol == 0 || r == nil {
+		return nil
+	}
+
+	// the tunnel forwards to our listener, the client is in X-Forwarded-For
+	src := requestClientAddr(r)
+	dst := addrPort(conn.RemoteAddr())
+	if local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		dst = addrPort(local)
+	}
+
+	if _, err := conn.Write(proxyHeader(m.proxyProtocol, src, dst)); err != nil {
+		return fmt.Errorf("write PROXY protocol header: %w", err)
+	}
+	return nil
+}
+
+// requestClientAddr returns the address of r's client, see clientHost. The
+// port is only known when the client connected directly.
+func requestClientAddr(r *http.Request) netip.AddrPort {
+	ip, err := netip.ParseAddr(clientHost(r))
+	if err != nil {
+		return netip.AddrPort{}
+	}
+	if remote, err := netip.ParseAddrPort(r.RemoteAddr); err == nil && remote.Addr() == ip {
+		return remote
+	}
+	return netip.AddrPortFrom(ip, 0)
+}
+
+// addrPort converts a TCP address, the zero AddrPort for anything else.
+func addrPort(addr net.Addr) netip.AddrPort {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		return tcp.AddrPort()
+	}
+	return netip.AddrPort{}
+}
+
+// proxyHeader returns the PROXY protocol header for a connection from src
+// to dst. Addresses of different families are both sent as IPv6; an
+// unknown address yields the header for an unknown connection.
+func proxyHeader(version int, src, dst netip.AddrPort) []byte {
+	known := src.IsValid() && dst.IsValid()
+	srcIP, dstIP := src.Addr().Unmap(), dst.Addr().Unmap()
+	if known && srcIP.Is4() != dstIP.Is4() {
+		srcIP, dstIP = netip.AddrFrom16(srcIP.As16()), netip.AddrFrom16(dstIP.As16())
+	}
+
+	if version == ProxyProtocolV1 {
+		if !known {
+			return []byte("PROXY UNKNOWN\r\n")
+		}
+		family := "TCP6"
+		if srcIP.Is4() {
+			family = "TCP4"
+		}
+		return fmt.Appendf(nil, "PROXY %s %s %s %d %d\r\n", family, srcIP, dstIP, src.Port(), dst.Port())
+	}
+
+	var buf bytes.Buffer
+	buf.Write(proxyV2Signature)
+	if !known {
+		// LOCAL command, no address block
+		buf.Write([]byte{0x20, 0x00, 0x00, 0x00})
+		return buf.Bytes()
+	}
+
+	var addrs []byte
+	family := byte(0x21) // TCP over IPv6
+	if srcIP.Is4() {
+		family = 0x11 // TCP over IPv4
+		s, d := srcIP.As4(), dstIP.As4()
+		addrs = append(s[:], d[:]...)
+	} else {
+		s, d := srcIP.As16(), dstIP.As16()
+		addrs = append(s[:], d[:]...)
+	}
+	addrs = binary.BigEndian.AppendUint16(addrs, src.Port())
+	addrs = binary.BigEndian.AppendUint16(addrs, dst.Port())
+
+	buf.Write([]byte{0x21, family}) // version 2, PROXY command
+	binary.Write(&buf, binary.BigEndian, uint16(len(addrs)))
+	buf.Write(addrs)
+	return buf.Bytes()
+}
@@ -0,0 +1,228 @@
+package tunnel
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readProxyHeader reads a PROXY protocol header from br and returns its
+// fields in v1 form, "TCP4 src dst sport dport", for either version.
+func readProxyHeader(br *bufio.Reader) (string, error) {
+	sig, err := br.Peek(len(proxyV2Signature))
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Equal(sig, proxyV2Signature) {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if !strings.HasPrefix(line, "PROXY ") || !strings.HasSuffix(line, "\r\n") {
+			return "", fmt.Errorf("malformed v1 header %q", line)
+		}
+		return strings.TrimSuffix(strings.TrimPrefix(line, "PROXY "), "\r\n"), nil
+	}
+
+	head := make([]byte, len(proxyV2Signature)+4)
+	if _, err := io.ReadFull(br, head); err != nil {
+		return "", err
+	}
+	addrs := make([]byte, binary.BigEndian.Uint16(head[len(head)-2:]))
+	if _, err := io.ReadFull(br, addrs); err != nil {
+		return "", err
+	}
+	verCmd, family := head[len(proxyV2Signature)], head[len(proxyV2Signature)+1]
+	if verCmd == 0x20 {
+		return "UNKNOWN", nil
+	}
+
+	size, name := 4, "TCP4"
+	if family == 0x21 {
+		size, name = 16, "TCP6"
+	} else if family != 0x11 {
+		return "", fmt.Errorf("unexpected v2 family %#x", family)
+	}
+	src, _ := netip.AddrFromSlice(addrs[:size])
+	dst, _ := netip.AddrFromSlice(addrs[size : 2*size])
+	ports := addrs[2*size:]
+	return fmt.Sprintf("%s %s %s %d %d", name, src, dst,
+		binary.BigEndian.Uint16(ports), binary.BigEndian.Uint16(ports[2:])), nil
+}
+
+// TestProxyHeader verifies both header versions for the address families
+func TestProxyHeader(t *testing.T) {
+	v4 := netip.MustParseAddrPort("203.0.113.7:41234")
+	v4Local := netip.MustParseAddrPort("127.0.0.1:8080")
+	v6 := netip.MustParseAddrPort("[2001:db8::1]:443")
+
+	tests := []struct {
+		name     string
+		src, dst netip.AddrPort
+		want     string
+	}{
+		{name: "ipv4", src: v4, dst: v4Local, want: "TCP4 203.0.113.7 127.0.0.1 41234 8080"},
+		{name: "ipv6", src: v6, dst: netip.MustParseAddrPort("[::1]:8080"), want: "TCP6 2001:db8::1 ::1 443 8080"},
+		{name: "mixed families", src: v6, dst: v4Local, want: "TCP6 2001:db8::1 ::ffff:127.0.0.1 443 8080"},
+		{name: "unknown client", dst: v4Local, want: "UNKNOWN"},
+	}
+
+	for _, tt := range tests {
+		for _, version := range []int{ProxyProtocolV1, ProxyProtocolV2} {
+			t.Run(fmt.Sprintf("%s v%d", tt.name, version), func(t *testing.T) {
+				header := proxyHeader(version, tt.src, tt.dst)
+				got, err := readProxyHeader(bufio.NewReader(bytes.NewReader(header)))
+				if err != nil {
+					t.Fatalf("unreadable header %q: %v", header, err)
+				}
+				if got != tt.want {
+					t.Errorf("expected %q, got %q", tt.want, got)
+				}
+			})
+		}
+	}
+}
+
+// proxyProtocolServer is a local server recording the PROXY header and
+// first payload bytes of each connection.
+type proxyProtocolServer struct {
+	ln       net.Listener
+	received chan string
+}
+
+// newProxyProtocolServer starts a local server answering HTTP requests, or
+// echoing "ping" for raw connections, after reading the PROXY header.
+func newProxyProtocolServer(t *testing.T) *proxyProtocolServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	s := &proxyProtocolServer{ln: ln, received: make(chan string, 10)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *proxyProtocolServer) serve(conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+	br := bufio.NewReader(conn)
+
+	header, err := readProxyHeader(br)
+	if err != nil {
+		s.received <- "error: " + err.Error()
+		return
+	}
+	payload, err := br.Peek(4)
+	if err != nil {
+		s.received <- "error: " + err.Error()
+		return
+	}
+	s.received <- header + " | " + string(payload)
+
+	if string(payload) == "ping" {
+		io.WriteString(conn, "pong")
+		return
+	}
+	if _, err := http.ReadRequest(br); err == nil {
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok")
+	}
+}
+
+// TestManager_ProxyProtocol verifies the PROXY header is written before the
+// payload of HTTP and CONNECT requests, naming the client and our listener
+func TestManager_ProxyProtocol(t *testing.T) {
+	for _, version := range []int{ProxyProtocolV1, ProxyProtocolV2} {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			local := newProxyProtocolServer(t)
+			m := NewManager(local.ln.Addr().(*net.TCPAddr).Port, WithProxyProtocol(version), WithConnect(true))
+			startManager(t, m)
+
+			// the tunnel server appends the client to X-Forwarded-For,
+			// after anything the client sent itself
+			req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/", m.ListenPort()), nil)
+			req.Header.Set("X-Forwarded-For", "10.0.0.1, 203.0.113.7")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected 200 through the tunnel, got %d", resp.StatusCode)
+			}
+			if got, want := <-local.received, fmt.Sprintf("TCP4 203.0.113.7 127.0.0.1 0 %d | GET ", m.ListenPort()); got != want {
+				t.Errorf("HTTP: expected %q, got %q", want, got)
+			}
+
+			// a direct client is announced with its own address and port
+			conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", m.ListenPort()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+			if _, err := io.WriteString(conn, "CONNECT local:1 HTTP/1.1\r\nHost: local:1\r\n\r\nping"); err != nil {
+				t.Fatal(err)
+			}
+			br := bufio.NewReader(conn)
+			if resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect}); err != nil || resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected CONNECT to be established, got %v", err)
+			}
+			clientPort := conn.LocalAddr().(*net.TCPAddr).Port
+			if got, want := <-local.received, fmt.Sprintf("TCP4 127.0.0.1 127.0.0.1 %d %d | ping", clientPort, m.ListenPort()); got != want {
+				t.Errorf("CONNECT: expected %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+// TestManager_ProxyProtocolDisabled verifies no header is sent by default
+func TestManager_ProxyProtocolDisabled(t *testing.T) {
+	var got []byte
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		got = make([]byte, 4)
+		io.ReadFull(conn, got)
+	}()
+
+	m := NewManager(ln.Addr().(*net.TCPAddr).Port)
+	conn, err := m.dialLocal(t.Context(), &http.Request{RemoteAddr: "203.0.113.7:1234"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(conn, "GET ")
+	conn.Close()
+	<-done
+	if string(got) != "GET " {
+		t.Errorf("expected the payload first, got %q", got)
+	}
+}
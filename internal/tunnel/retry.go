@@ -0,0 +1,185 @@
+package tunnel
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"time"
+)
+
+// retryBodyLimit is the largest request body buffered so it can be sent
+// again; requests with bigger or unknown-length bodies are never retried.
+const retryBodyLimit = 64 << 10
+
+// WithRetrySafeRequests retries idempotent requests (GET, HEAD, OPTIONS,
+// TRACE, PUT, DELETE) once when the local server drops the connection
+// before sending any response bytes, e.g. while a dev server restarts.
+// Request bodies up to 64 KB are buffered so they can be resent. Other
+// methods and partially received responses are never retried.
+// It applies to HTTP/1 forwarding only, see WithLocalHTTP2.
+func WithRetrySafeRequests(enabled bool) ManagerOption {
+	return func(m *Manager) {
+		m.retrySafe = enabled
+	}
+}
+
+// idempotentMethod reports whether sending a request with method twice has
+// the same effect as sending it once (RFC 9110, section 9.2.2).
+func idempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// prepareRetry reports whether r may be sent to the local server a second
+// time, buffering its body so GetBody can replay it. It fails only when the
+// client's body can't be read.
+func prepareRetry(r *http.Request) (bool, error) {
+	if !idempotentMethod(r.Method) {
+		return false, nil
+	}
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		r.GetBody = func() (io.ReadCloser, error) { return http.NoBody, nil }
+		return true, nil
+	}
+	if r.ContentLength < 0 || r.ContentLength > retryBodyLimit {
+		return false, nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return false, err
+	}
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	r.Body, _ = r.GetBody()
+	return true, nil
+}
+
+// localExchangeError is a failed HTTP/1 exchange with the local server,
+// its message is the body of the 502 sent to the client.
+type localExchangeError struct {
+	msg string
+	err error
+	// nothing was received from the local server, so the request may be sent again
+	noResponse bool
+}
+
+func (e *localExchangeError) Error() string { return e.msg }
+func (e *localExchangeError) Unwrap() error { return e.err }
+
+// retryableExchange reports whether err left the request unanswered.
+func retryableExchange(err error) bool {
+	var exErr *localExchangeError
+	return errors.As(err, &exErr) && exErr.noResponse
+}
+
+// exchangeLocal sends r to the local server over a new connection and reads
+// the response head. Closing the response body closes the connection.
+//
+// The body of an Expect: 100-continue request is only sent once the local
+// server asks for it. Interim 1xx responses are passed to the client trace
+// of r, as http.Transport does.
+func (m *Manager) exchangeLocal(r *http.Request) (*http.Response, error) {
+	conn, err := m.dialLocal(r.Context(), r)
+	if errors.Is(err, errLocalTLS) {
+		return nil, &localExchangeError{
+			msg: fmt.Sprintf("TLS handshake with %s failed - is it serving HTTPS?", m.localName()),
+			err: err,
+		}
+	}
+	if err != nil {
+		return nil, &localExchangeError{
+			msg:        fmt.Sprintf("Failed to connect %s - is your server running?", m.localName()),
+			err:        err,
+			noResponse: true,
+		}
+	}
+
+	// a client that goes away aborts the exchange with the local server
+	stop := context.AfterFunc(r.Context(), func() { conn.Close() })
+	release := func() {
+		stop()
+		conn.Close()
+	}
+
+	// Send request to local server. With Expect: 100-continue the head goes
+	// out first and the body waits in the background for the go-ahead.
+	var body *continueBody
+	if expectsContinue(r) {
+		body = newContinueBody(r.Body)
+		held := *r
+		held.Body = body
+		wrote := make(chan struct{})
+		go func() {
+			defer close(wrote)
+			_ = held.Write(conn)
+		}()
+		timer := time.AfterFunc(expectContinueTimeout, func() { body.open(true) })
+		// the body is dropped if the final response comes first
+		defer body.open(false)
+		// the body must not be read from r once the handler returns
+		release = func() {
+			timer.Stop()
+			body.open(false)
+			stop()
+			conn.Close()
+			<-wrote
+		}
+	} else if err := r.Write(conn); err != nil {
+		release()
+		return nil, &localExchangeError{msg: "Failed to forward request", err: err, noResponse: true}
+	}
+
+	// Read response from local server, counting what arrives so a reset
+	// before the first byte can be told apart from a broken response
+	var received ByteCounter
+	br := bufio.NewReader(received.Conn(conn))
+	trace := httptrace.ContextClientTrace(r.Context())
+	for {
+		resp, err := http.ReadResponse(br, r)
+		if err != nil {
+			release()
+			return nil, &localExchangeError{
+				msg:        fmt.Sprintf("Failed to read response from local server: %v", err),
+				err:        err,
+				noResponse: received.BytesIn() == 0,
+			}
+		}
+		if resp.StatusCode < 100 || resp.StatusCode > 199 || resp.StatusCode == http.StatusSwitchingProtocols {
+			resp.Body = releasingBody{ReadCloser: resp.Body, release: release}
+			return resp, nil
+		}
+		if resp.StatusCode == http.StatusContinue && body != nil {
+			body.open(true)
+		}
+		if trace != nil && trace.Got1xxResponse != nil {
+			if err := trace.Got1xxResponse(resp.StatusCode, textproto.MIMEHeader(resp.Header)); err != nil {
+				release()
+				return nil, &localExchangeError{msg: "Failed to forward request", err: err}
+			}
+		}
+	}
+}
+
+// releasingBody is a response body that closes its connection with it.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
@@ -0,0 +1,192 @@
+package tunnel
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// flakyServer is a local server that resets its first `drops` connections
+// after reading the request, then echoes the method and body. It returns
+// its port and the number of connections accepted.
+func flakyServer(t *testing.T, drops int32) (int, *atomic.Int32) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	var accepted atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			n := accepted.Add(1)
+			go func() {
+				defer conn.Close()
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil {
+					return
+				}
+				body, _ := io.ReadAll(req.Body)
+				if n <= drops {
+					// reset instead of a clean close, like a restarting server
+					conn.(*net.TCPConn).SetLinger(0)
+					return
+				}
+				resp := &http.Response{
+					StatusCode:    http.StatusOK,
+					ProtoMajor:    1,
+					ProtoMinor:    1,
+					ContentLength: int64(len(req.Method) + 1 + len(body)),
+					Body:          io.NopCloser(strings.NewReader(req.Method + " " + string(body))),
+				}
+				resp.Write(conn)
+			}()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, &accepted
+}
+
+func TestManager_RetrySafeRequests(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		body         string
+		retry        bool
+		wantCode     int
+		wantBody     string
+		wantAccepted int32
+	}{
+		{"GET retried", http.MethodGet, "", true, http.StatusOK, "GET ", 2},
+		{"PUT body resent", http.MethodPut, "payload", true, http.StatusOK, "PUT payload", 2},
+		{"POST not retried", http.MethodPost, "payload", true, http.StatusBadGateway, "", 1},
+		{"GET without the option", http.MethodGet, "", false, http.StatusBadGateway, "", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port, accepted := flakyServer(t, 1)
+			m := NewManager(port, WithRetrySafeRequests(tt.retry))
+
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			w := httptest.NewRecorder()
+			m.proxyHandler(w, httptest.NewRequest(tt.method, "/", body))
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if tt.wantCode == http.StatusOK && w.Body.String() != tt.wantBody {
+				t.Errorf("expected body %q, got %q", tt.wantBody, w.Body.String())
+			}
+			if got := accepted.Load(); got != tt.wantAccepted {
+				t.Errorf("expected %d local connections, got %d", tt.wantAccepted, got)
+			}
+		})
+	}
+}
+
+// TestManager_RetryOnlyOnce verifies a second drop is reported, not retried again
+func TestManager_RetryOnlyOnce(t *testing.T) {
+	port, accepted := flakyServer(t, 2)
+	m := NewManager(port, WithRetrySafeRequests(true))
+
+	w := httptest.NewRecorder()
+	m.proxyHandler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("expected 502, got %d", w.Code)
+	}
+	if got := accepted.Load(); got != 2 {
+		t.Errorf("expected 2 local connections, got %d", got)
+	}
+}
+
+// TestManager_NoRetryAfterResponseBytes verifies a response cut off midway is not retried
+func TestManager_NoRetryAfterResponseBytes(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	var accepted atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			http.ReadRequest(bufio.NewReader(conn))
+			io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-")
+			conn.Close()
+		}
+	}()
+
+	m := NewManager(ln.Addr().(*net.TCPAddr).Port, WithRetrySafeRequests(true))
+	w := httptest.NewRecorder()
+	m.proxyHandler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("expected 502, got %d", w.Code)
+	}
+	if got := accepted.Load(); got != 1 {
+		t.Errorf("expected a single local connection, got %d", got)
+	}
+}
+
+func TestPrepareRetry(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		length int64
+		want   bool
+	}{
+		{"GET", http.MethodGet, "", 0, true},
+		{"small PUT", http.MethodPut, "data", 4, true},
+		{"POST", http.MethodPost, "data", 4, false},
+		{"chunked PUT", http.MethodPut, "data", -1, false},
+		{"large PUT", http.MethodPut, "data", retryBodyLimit + 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body))
+			r.ContentLength = tt.length
+
+			got, err := prepareRetry(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+			if !got {
+				return
+			}
+			// the body can be read now and replayed later
+			for range 2 {
+				body, _ := r.GetBody()
+				if data, _ := io.ReadAll(body); string(data) != tt.body {
+					t.Errorf("expected replayed body %q, got %q", tt.body, data)
+				}
+			}
+			if data, _ := io.ReadAll(r.Body); string(data) != tt.body {
+				t.Errorf("expected request body %q, got %q", tt.body, data)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package tunnel
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+)
+
+// forwardedHeaders are set by the tunnel server about the original request.
+// httputil.ReverseProxy drops them from the outgoing request, expose passes
+// them on as they came.
+var forwardedHeaders = []string{"Forwarded", "X-Forwarded-For", "X-Forwarded-Host", "X-Forwarded-Proto"}
+
+// newReverseProxy returns the proxy forwarding requests to the local
+// server, shared by all requests. Their own state reaches prepareResponse
+// through the request context, see withProxyState.
+func (m *Manager) newReverseProxy() *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite:   m.rewriteLocal,
+		Transport: localRoundTripper{m},
+		ModifyResponse: func(resp *http.Response) error {
+			st := resp.Request.Context().Value(proxyStateKey{}).(*proxyState)
+			return m.prepareResponse(st.w, st.r, resp, st.key)
+		},
+		ErrorHandler: m.proxyError,
+		// ReverseProxy's own errors, e.g. a failed protocol upgrade, at debug level
+		ErrorLog: slog.NewLogLogger(m.logger.Handler(), slog.LevelDebug),
+	}
+}
+
+// proxyStateKey is the context key of a request's proxyState.
+type proxyStateKey struct{}
+
+// proxyState is what prepareResponse needs about a proxied request: the
+// client's writer, flushed when a response is cut short, the incoming
+// request and its cache key, empty when it isn't cacheable.
+type proxyState struct {
+	w   http.ResponseWriter
+	r   *http.Request
+	key string
+}
+
+// withProxyState returns r carrying its proxyState for the reverse proxy.
+func withProxyState(w http.ResponseWriter, r *http.Request, key string) *http.Request {
+	st := &proxyState{w: w, key: key}
+	st.r = r.WithContext(context.WithValue(r.Context(), proxyStateKey{}, st))
+	return st.r
+}
+
+// rewriteLocal points the outgoing request at the local server, see
+// forwardedRequest.
+func (m *Manager) rewriteLocal(pr *httputil.ProxyRequest) {
+	for _, name := range forwardedHeaders {
+		if values, ok := pr.In.Header[name]; ok {
+			pr.Out.Header[name] = values
+		}
+	}
+
+	out := m.forwardedRequest(pr.Out)
+	out.URL.Scheme, out.URL.Host = "http", m.localHost()
+	if m.localTLS != nil {
+		out.URL.Scheme = "https"
+	}
+	pr.Out = out
+}
+
+// localRoundTripper sends the reverse proxy's requests to the local server.
+type localRoundTripper struct{ m *Manager }
+
+func (t localRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	m := t.m
+	if m.localH2 != nil {
+		// HTTP/2 to the local server, see WithLocalHTTP2
+		out := r.Clone(r.Context())
+		for _, h := range hopHeaders {
+			out.Header.Del(h)
+		}
+		resp, err := m.localH2.RoundTrip(out)
+		if err != nil {
+			return nil, &localExchangeError{
+				msg: fmt.Sprintf("Failed to forward request to %s over HTTP/2: %v", m.localName(), err),
+				err: err,
+			}
+		}
+		return resp, nil
+	}
+
+	// connections are pooled unless each needs its own PROXY header
+	exchange := m.exchangeLocal
+	if m.localH1 != nil {
+		exchange = m.roundTripLocal
+	}
+
+	resp, err := exchange(r)
+	// prepareRetry only lets idempotent requests be replayed
+	if err != nil && m.retrySafe && r.GetBody != nil && retryableExchange(err) && r.Context().Err() == nil {
+		m.logger.Warn("local server dropped the request, retrying once",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"request_id", m.requestID(r),
+			"error", errors.Unwrap(err),
+		)
+		retry := r.WithContext(r.Context())
+		retry.Body, _ = r.GetBody()
+		resp, err = exchange(retry)
+	}
+	return resp, err
+}
+
+// prepareResponse readies the local server's response to r before the
+// reverse proxy sends it to w: the status waits for the first body byte,
+// the body is buffered, cached and throttled as configured, and the
+// request ID and Via headers are set. An error answers 502 instead.
+func (m *Manager) prepareResponse(w http.ResponseWriter, r *http.Request, resp *http.Response, key string) error {
+	// a 204, a 304 or the answer to a HEAD has no body to wait for or
+	// buffer, a Content-Length it carries describes the resource
+	bodyless := !bodyAllowed(r, resp.StatusCode)
+
+	// Wait for the first body byte before committing the status code,
+	// so an upstream that dies before sending any body still gets a clean 502.
+	body := bufio.NewReader(resp.Body)
+	if !bodyless {
+		if _, err := body.Peek(1); err != nil && !errors.Is(err, io.EOF) {
+			return &localExchangeError{msg: fmt.Sprintf("Failed to read response from local server: %v", err), err: err}
+		}
+	}
+
+	// in buffered mode the whole body must arrive before anything is sent
+	var src io.Reader = body
+	var buffered []byte
+	if m.bufferLimit > 0 && !bodyless {
+		var err error
+		buffered, err = bufferBody(body, resp.ContentLength, m.bufferLimit)
+		if errors.Is(err, errBufferLimit) {
+			m.logger.Warn("response too large to buffer",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"request_id", m.requestID(r),
+				"limit", m.bufferLimit,
+			)
+			return &localExchangeError{msg: fmt.Sprintf("Response from local server exceeds the %d byte buffer limit", m.bufferLimit), err: err}
+		}
+		if err != nil {
+			return &localExchangeError{msg: fmt.Sprintf("Failed to read response from local server: %v", err), err: err}
+		}
+		src = bytes.NewReader(buffered)
+	}
+
+	// the cache keeps the local server's headers, not the ones added here,
+	// but never the stripped ones
+	m.stripResponseHeaders(resp.Header)
+	cacheHeader := resp.Header.Clone()
+
+	// a chunked body has no length, the client's connection frames it,
+	// and trailers such as gRPC's status follow a body of unfixed length
+	if len(resp.TransferEncoding) > 0 || len(resp.Trailer) > 0 {
+		resp.Header.Del("Content-Length")
+	}
+	// don't duplicate the ID if the local server echoed it as well
+	if id := m.requestID(r); id != "" {
+		w.Header().Del(m.requestIDHeader)
+		resp.Header.Set(m.requestIDHeader, id)
+	}
+	m.identify(resp.Header, resp.ProtoMajor, resp.ProtoMinor)
+	if m.bufferLimit > 0 && !bodyless {
+		resp.Header.Set("Content-Length", strconv.Itoa(len(buffered)))
+		resp.ContentLength = int64(len(buffered))
+	}
+
+	proxied := &proxiedBody{Closer: resp.Body}
+
+	// keep a copy of cacheable bodies while streaming them
+	if key != "" {
+		resp.Header.Set(CacheHeader, "MISS")
+		if ttl := m.cache.cacheTTL(resp); ttl > 0 {
+			captured := &limitedBuffer{max: m.cache.maxBytes}
+			src = io.TeeReader(src, captured)
+			status := resp.StatusCode
+			proxied.done = func() {
+				if !captured.overflow {
+					m.cache.put(key, status, cacheHeader, captured.buf, ttl)
+				}
+			}
+		}
+	}
+
+	if m.throttleDown != nil {
+		src = m.throttleDown.reader(r.Context(), src)
+	}
+
+	proxied.Reader = src
+	proxied.failed = func(err error) {
+		// the client went away, there is nobody left to tell
+		if r.Context().Err() != nil {
+			return
+		}
+		// Headers and part of the body are already sent, flush what we have,
+		// the reverse proxy then aborts the connection so the client sees a
+		// broken response instead of a silently truncated one.
+		m.logger.Error("proxied response truncated",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"request_id", m.requestID(r),
+			"err", err,
+		)
+		_ = http.NewResponseController(w).Flush()
+	}
+	resp.Body = proxied
+	return nil
+}
+
+// proxyError answers a request the local server couldn't, with the reason
+// as the body of a 502.
+func (m *Manager) proxyError(w http.ResponseWriter, r *http.Request, err error) {
+	var exErr *localExchangeError
+	if errors.As(err, &exErr) {
+		http.Error(w, exErr.msg, http.StatusBadGateway)
+		return
+	}
+	http.Error(w, fmt.Sprintf("Failed to forward request to %s: %v", m.localName(), err), http.StatusBadGateway)
+}
+
+// proxiedBody is the response body the reverse proxy sends on. done runs
+// once it was read to the end, failed when reading it broke off.
+type proxiedBody struct {
+	io.Reader
+	io.Closer
+	done   func()
+	failed func(err error)
+}
+
+func (b *proxiedBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	switch {
+	case err == io.EOF:
+		if b.done != nil {
+			b.done()
+			b.done = nil
+		}
+	case err != nil:
+		if b.failed != nil {
+			b.failed(err)
+			b.failed = nil
+		}
+	}
+	return n, err
+}
@@ -2,8 +2,11 @@ package tunnel
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -11,66 +14,364 @@ import (
 // It provides a uniform interface for all tunnel providers(localtunnel, ngrok etc.)
 type Service struct {
 	provider Provider
-	ready    chan struct{}
 	mu       sync.RWMutex
 	started  bool
 	closed   bool
+
+	// closed once the tunnel first comes up, see markReady
+	ready     chan struct{}
+	readyOnce sync.Once
+
+	// public URL change notifications, see URLChanges
+	urlChanges chan string
+	lastURL    string
+
+	// port the provider forwards to, reused by Restart
+	targetPort int
+	// Restart and Reconfigure calls in progress, see Supervise
+	restarting atomic.Int32
+	// when Start brought the tunnel up, see Stats
+	readyAt time.Time
+
+	// optional local proxy in front of the provider, see WithProxy
+	useProxy  bool
+	proxyOpts []ManagerOption
+	proxy     *Manager
+
+	// outlives the callers' contexts, the provider and the proxy run under
+	// it until Close, see runContext
+	life    context.Context
+	endLife context.CancelFunc
+
+	logger *slog.Logger
+	// provider health from MonitorHealth
+	health HealthState
+}
+
+// ServiceOption configures optional Service behaviour.
+type ServiceOption func(*Service)
+
+// WithProxy routes tunnel traffic through a local Manager proxy,
+// configured with opts, instead of pointing the provider at the local
+// port directly. This enables request stats and proxy features.
+func WithProxy(opts ...ManagerOption) ServiceOption {
+	return func(s *Service) {
+		s.useProxy = true
+		s.proxyOpts = opts
+	}
 }
 
 // NewService creates a new Service instance with the given Provider.
-func NewService(p Provider) *Service {
-	return &Service{
-		provider: p,
-		ready:    make(chan struct{}),
+func NewService(p Provider, opts ...ServiceOption) *Service {
+	s := &Service{
+		provider:   p,
+		ready:      make(chan struct{}),
+		urlChanges: make(chan string, 1),
+		logger:     slog.Default(),
+	}
+	s.life, s.endLife = context.WithCancel(context.Background())
+	for _, opt := range opts {
+		opt(s)
 	}
+
+	// providers that can change URL after connecting report it back to us
+	if n, ok := p.(URLNotifier); ok {
+		n.OnURLChange(s.notifyURLChange)
+	}
+	return s
 }
 
-// Start initializes the tunnel provider and signals when ready.
-func (s *Service) Start(ctx context.Context, localPort int) error {
+// Start initializes the tunnel provider and signals when ready. A failed
+// Start may be retried. ctx bounds the start only, the tunnel then runs
+// until Close.
+func (s *Service) Start(ctx context.Context, localPort int) (err error) {
 	s.mu.Lock()
 	if s.started {
 		s.mu.Unlock()
-		return fmt.Errorf("tunnel already started")
+		return ErrAlreadyStarted
 	}
 
 	if s.closed {
 		s.mu.Unlock()
-		return fmt.Errorf("service is closed")
+		return ErrServiceClosed
 	}
 	s.started = true
 	s.mu.Unlock()
 
-	_, err := s.provider.Connect(ctx, localPort)
+	defer func() {
+		if err != nil {
+			s.mu.Lock()
+			s.started = false
+			s.mu.Unlock()
+		}
+	}()
+
+	// the provider forwards to the proxy, which forwards to localPort
+	targetPort := localPort
+	if s.useProxy {
+		port, err := s.startProxy(ctx, localPort)
+		if err != nil {
+			return err
+		}
+		targetPort = port
+	}
+
+	p := s.currentProvider()
+	run, started := s.runContext(ctx)
+	url, err := p.Connect(run, targetPort)
+	started(err)
 	if err != nil {
-		return fmt.Errorf("failed to connect %s provider tunnel: %w", s.provider.Name(), err)
+		s.closeProxy()
+		return fmt.Errorf("failed to connect %s provider tunnel: %w", p.Name(), err)
 	}
 
+	// the initial URL is reported via PublicURL, only later changes are notified
+	s.mu.Lock()
+	s.lastURL = url
+	s.targetPort = targetPort
+	s.readyAt = time.Now()
+	s.mu.Unlock()
+	LogEvent(s.logger, p.Name(), EventConnected, "url", url)
+
 	// signal that tunnel is ready to use
-	close(s.ready)
+	s.markReady()
+	return nil
+}
+
+// Restart reconnects the provider to the same target, e.g. after the
+// tunnel dropped, see Reconnect. A new public URL is reported through
+// URLChanges.
+func (s *Service) Restart(ctx context.Context) error {
+	s.restarting.Add(1)
+	defer s.restarting.Add(-1)
+
+	s.mu.RLock()
+	started, closed, port := s.started, s.closed, s.targetPort
+	s.mu.RUnlock()
+
+	if closed {
+		return ErrServiceClosed
+	}
+	if !started {
+		return ErrNotStarted
+	}
+
+	p := s.currentProvider()
+	run, reconnected := s.runContext(ctx)
+	url, err := Reconnect(run, p, port)
+	reconnected(err)
+	if err != nil {
+		return fmt.Errorf("failed to reconnect %s provider tunnel: %w", p.Name(), err)
+	}
+
+	s.notifyURLChange(url)
+	s.markReady()
 	return nil
+}
+
+// Reconfigure points the running tunnel at localPort and, unless p is nil,
+// swaps in p for the current provider, then reconnects like Restart. It's
+// used to apply a reloaded config without stopping the process. A new
+// public URL is reported through URLChanges. Behind a proxy a port change
+// alone only moves the proxy, the provider and its URL stay as they are. Like Start it returns
+// ErrSelfForward, changing nothing, when localPort is the proxy's own port.
+func (s *Service) Reconfigure(ctx context.Context, localPort int, p Provider) error {
+	s.restarting.Add(1)
+	defer s.restarting.Add(-1)
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServiceClosed
+	}
+	if !s.started {
+		s.mu.Unlock()
+		return ErrNotStarted
+	}
+
+	// with a proxy the provider keeps forwarding to it, only the proxy moves
+	if s.proxy != nil {
+		if err := s.proxy.checkSelfForward(localPort); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		s.proxy.SetLocalPort(localPort)
+		if p == nil {
+			s.mu.Unlock()
+			return nil
+		}
+	} else {
+		s.targetPort = localPort
+	}
+
+	var old Provider
+	if p != nil {
+		old, s.provider = s.provider, p
+	}
+	s.mu.Unlock()
+
+	if old != nil {
+		_ = old.Close()
+		if n, ok := p.(URLNotifier); ok {
+			n.OnURLChange(s.notifyURLChange)
+		}
+	}
+	return s.Restart(ctx)
+}
+
+// runContext returns the context the provider or the proxy is started
+// under. ctx only bounds the start, once started is called without an
+// error the run lasts until Close, so a caller whose context ends first,
+// e.g. on Ctrl+C, can still run its on-close hooks against a live tunnel.
+func (s *Service) runContext(ctx context.Context) (run context.Context, started func(err error)) {
+	run, cancel := context.WithCancel(s.life)
+	stop := context.AfterFunc(ctx, cancel)
+	return run, func(err error) {
+		stop()
+		if err != nil {
+			cancel()
+		}
+	}
+}
+
+// LocalPort returns the port of the local server the tunnel forwards to,
+// also after Reconfigure moved it, or 0 before Start.
+func (s *Service) LocalPort() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.proxy != nil {
+		return s.proxy.LocalPort()
+	}
+	return s.targetPort
+}
+
+// currentProvider returns the provider, which Reconfigure may replace.
+func (s *Service) currentProvider() Provider {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.provider
+}
+
+// startProxy starts the local proxy for localPort and returns the port it listens on.
+func (s *Service) startProxy(ctx context.Context, localPort int) (int, error) {
+	m := NewManager(localPort, s.proxyOpts...)
+
+	run, started := s.runContext(ctx)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- m.Start(run)
+	}()
+
+	select {
+	case <-m.Ready():
+		started(nil)
+	case err := <-errCh:
+		if err == nil {
+			err = errors.New("proxy stopped before ready")
+		}
+		started(err)
+		return 0, fmt.Errorf("failed to start proxy: %w", err)
+	}
+
+	s.mu.Lock()
+	s.proxy = m
+	s.mu.Unlock()
+
+	return m.ListenPort(), nil
+}
+
+// closeProxy shuts down the local proxy if one is running.
+func (s *Service) closeProxy() error {
+	s.mu.RLock()
+	m := s.proxy
+	s.mu.RUnlock()
+
+	if m == nil {
+		return nil
+	}
+	return m.Close()
+}
+
+// Stats returns request statistics from the local proxy, also after Close,
+// the provider health and the uptime. Without WithProxy the request counters are zero
+// and the byte counters come from providers implementing TrafficReporter.
+func (s *Service) Stats() Stats {
+	s.mu.RLock()
+	m, readyAt := s.proxy, s.readyAt
+	s.mu.RUnlock()
+
+	var st Stats
+	if m != nil {
+		st = m.Stats()
+	} else if tr, ok := s.currentProvider().(TrafficReporter); ok {
+		st.BytesIn, st.BytesOut = tr.Traffic()
+	}
+	st.Health = s.Health()
+	if !readyAt.IsZero() {
+		st.Uptime = time.Since(readyAt)
+	}
+	return st
+}
 
+// URLChanges returns a channel that receives the new public URL whenever
+// it changes after the tunnel became ready. Only the latest pending URL
+// is kept, so slow readers never see stale values.
+func (s *Service) URLChanges() <-chan string {
+	return s.urlChanges
+}
+
+// notifyURLChange publishes url on the URLChanges channel if it differs
+// from the last known URL. It never blocks the calling provider.
+func (s *Service) notifyURLChange(url string) {
+	// the initial URL from Connect is not a change
+	select {
+	case <-s.ready:
+	default:
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if url == "" || url == s.lastURL {
+		return
+	}
+	s.lastURL = url
+
+	// replace any unread URL with the newer one
+	select {
+	case <-s.urlChanges:
+	default:
+	}
+	s.urlChanges <- url
 }
 
 // Ready returns a channel that closes when the tunnel is ready.
 // Useful for waiting in CLI: <-service.Ready()
+// It stays closed across Restart and Reconfigure.
 func (s *Service) Ready() <-chan struct{} {
 	return s.ready
 }
 
+// markReady closes the ready channel, only the first call has an effect.
+func (s *Service) markReady() {
+	s.readyOnce.Do(func() { close(s.ready) })
+}
+
 // PublicURL returns the tunnel's public URL.
 // Returns empty string if not connected.
 func (s *Service) PublicURL() string {
-	return s.provider.PublicURL()
+	return s.currentProvider().PublicURL()
 }
 
 // ProviderName returns the name of the tunnel provider.
 func (s *Service) ProviderName() string {
-	return s.provider.Name()
+	return s.currentProvider().Name()
 }
 
 // IsConnected returns true if tunnel is active
 func (s *Service) IsConnected() bool {
-	return s.provider.IsConnected()
+	return s.currentProvider().IsConnected()
 }
 
 // Close terminates the tunnel and cleans up resources.
@@ -83,16 +384,13 @@ func (s *Service) Close() error {
 	s.closed = true
 	s.mu.Unlock()
 
-	return s.provider.Close()
+	defer s.endLife()
+	return errors.Join(s.currentProvider().Close(), s.closeProxy())
 }
 
 // WaitReady waits for the tunnel to be ready with a timeout.
-// Returns error if timeout exceeded or service closes
+// Returns error if timeout exceeded
 func (s *Service) WaitReady(timeout time.Duration) error {
-	if s.provider.IsConnected() {
-		return nil
-	}
-
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
@@ -2,13 +2,20 @@ package tunnel
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 // MockProvider implements Provider interface for testing purposes.
 type MockProvider struct {
 	connectedCalled bool
+	connects        int
 	connectPort     int
 	closeCalled     bool
 }
@@ -16,6 +23,7 @@ type MockProvider struct {
 // implement Provider interface
 func (m *MockProvider) Connect(ctx context.Context, localPort int) (string, error) {
 	m.connectedCalled = true
+	m.connects++
 	m.connectPort = localPort
 	return "https://abc123.example.com", nil
 }
@@ -168,3 +176,362 @@ func TestService_Providername(t *testing.T) {
 		t.Errorf("ProviderName() = %s, want MockProvider", got)
 	}
 }
+
+func TestService_WithProxy(t *testing.T) {
+	mock := &MockProvider{}
+	svc := NewService(mock, WithProxy())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := svc.Start(ctx, 3000); err != nil {
+		t.Fatalf("Start() error = %v, want nil", err)
+	}
+	defer svc.Close()
+
+	// the provider must be pointed at the proxy, not the local port
+	if mock.connectPort == 3000 || mock.connectPort == 0 {
+		t.Errorf("expected provider to connect to proxy port, got %d", mock.connectPort)
+	}
+
+	if svc.proxy == nil || svc.proxy.ListenPort() != mock.connectPort {
+		t.Error("expected proxy to listen on the port the provider connected to")
+	}
+}
+
+func TestCapabilitiesOf(t *testing.T) {
+	// MockProvider doesn't implement CapabilityReporter
+	if caps := CapabilitiesOf(&MockProvider{}); caps != (Capabilities{}) {
+		t.Errorf("expected zero capabilities, got %+v", caps)
+	}
+}
+
+// unavailableProvider is a MockProvider whose dependency is missing.
+type unavailableProvider struct {
+	MockProvider
+}
+
+func (u *unavailableProvider) Available() error {
+	return errors.New("binary not found")
+}
+
+func (u *unavailableProvider) Name() string {
+	return "Unavailable"
+}
+
+func TestFirstAvailable(t *testing.T) {
+	missing, present := &unavailableProvider{}, &MockProvider{}
+
+	p, err := FirstAvailable(missing, present)
+	if err != nil || p != present {
+		t.Errorf("expected the available provider, got %v, %v", p, err)
+	}
+
+	p, err = FirstAvailable(present, missing)
+	if err != nil || p != present {
+		t.Errorf("expected priority order to be kept, got %v, %v", p, err)
+	}
+
+	if _, err := FirstAvailable(missing); err == nil || !strings.Contains(err.Error(), "Unavailable: binary not found") {
+		t.Errorf("expected error naming the skipped provider, got %v", err)
+	}
+}
+
+// notifyingProvider is a MockProvider that can change its URL after Connect.
+type notifyingProvider struct {
+	MockProvider
+	onChange func(url string)
+}
+
+func (n *notifyingProvider) OnURLChange(fn func(url string)) {
+	n.onChange = fn
+}
+
+func (n *notifyingProvider) Connect(ctx context.Context, localPort int) (string, error) {
+	url, err := n.MockProvider.Connect(ctx, localPort)
+	// providers report the initial URL too, it must not count as a change
+	n.onChange(url)
+	return url, err
+}
+
+func TestService_URLChanges(t *testing.T) {
+	p := &notifyingProvider{}
+	svc := NewService(p)
+
+	if p.onChange == nil {
+		t.Fatal("expected Service to register a URL change handler")
+	}
+
+	if err := svc.Start(context.Background(), 3000); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	select {
+	case url := <-svc.URLChanges():
+		t.Fatalf("initial URL must not be reported as a change, got %s", url)
+	default:
+	}
+
+	p.onChange("https://new.example.com")
+
+	select {
+	case url := <-svc.URLChanges():
+		if url != "https://new.example.com" {
+			t.Errorf("expected new URL, got %s", url)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for URL change")
+	}
+
+	// the same URL again is not a change
+	p.onChange("https://new.example.com")
+	select {
+	case url := <-svc.URLChanges():
+		t.Errorf("unexpected duplicate change %s", url)
+	default:
+	}
+}
+
+func TestService_URLChanges_LatestWins(t *testing.T) {
+	p := &notifyingProvider{}
+	svc := NewService(p)
+	if err := svc.Start(context.Background(), 3000); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	// nobody reads in between, the provider must not block
+	p.onChange("https://one.example.com")
+	p.onChange("https://two.example.com")
+
+	if url := <-svc.URLChanges(); url != "https://two.example.com" {
+		t.Errorf("expected latest URL, got %s", url)
+	}
+}
+
+// TestService_Reconfigure verifies a new local port reconnects the provider to it
+func TestService_Reconfigure(t *testing.T) {
+	mock := &MockProvider{}
+	svc := NewService(mock)
+	if err := svc.Start(context.Background(), 3000); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.Reconfigure(context.Background(), 4000, nil); err != nil {
+		t.Fatalf("Reconfigure() error = %v", err)
+	}
+	if mock.connectPort != 4000 {
+		t.Errorf("expected provider reconnected to 4000, got %d", mock.connectPort)
+	}
+}
+
+// TestService_ReconfigureProvider verifies a new provider replaces and closes the old one
+func TestService_ReconfigureProvider(t *testing.T) {
+	old, next := &MockProvider{}, &unavailableProvider{}
+	svc := NewService(old)
+	if err := svc.Start(context.Background(), 3000); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.Reconfigure(context.Background(), 3000, next); err != nil {
+		t.Fatalf("Reconfigure() error = %v", err)
+	}
+	if !old.closeCalled {
+		t.Error("expected the old provider to be closed")
+	}
+	if next.connectPort != 3000 || svc.ProviderName() != "Unavailable" {
+		t.Errorf("expected the new provider connected to 3000, got %d (%s)", next.connectPort, svc.ProviderName())
+	}
+}
+
+// TestService_ReconfigureProxy verifies the proxy forwards to the new port
+// and keeps its own, without reconnecting the provider
+func TestService_ReconfigureProxy(t *testing.T) {
+	serve := func(name string) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, name)
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	first, second := serve("first"), serve("second")
+
+	mock := &MockProvider{}
+	svc := NewService(mock, WithProxy())
+	if err := svc.Start(context.Background(), serverPort(t, first)); err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Close()
+	proxyPort := mock.connectPort
+
+	if err := svc.Reconfigure(context.Background(), serverPort(t, second), nil); err != nil {
+		t.Fatal(err)
+	}
+	if mock.connectPort != proxyPort {
+		t.Errorf("expected the provider to stay on proxy port %d, got %d", proxyPort, mock.connectPort)
+	}
+	if mock.connects != 1 {
+		t.Errorf("expected no reconnect for a port change behind the proxy, got %d connects", mock.connects)
+	}
+
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/", proxyPort))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "second" {
+		t.Errorf("expected the new local server to answer, got %q", body)
+	}
+}
+
+// TestService_ReconfigureSelfForward verifies a reload can't point the
+// proxy at its own port
+func TestService_ReconfigureSelfForward(t *testing.T) {
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer local.Close()
+
+	mock := &MockProvider{}
+	svc := NewService(mock, WithProxy())
+	if err := svc.Start(context.Background(), serverPort(t, local)); err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Close()
+	proxyPort := mock.connectPort
+
+	if err := svc.Reconfigure(context.Background(), proxyPort, nil); !errors.Is(err, ErrSelfForward) {
+		t.Fatalf("expected ErrSelfForward, got %v", err)
+	}
+	if got := svc.proxy.LocalPort(); got != serverPort(t, local) {
+		t.Errorf("expected the proxy to keep forwarding to %d, got %d", serverPort(t, local), got)
+	}
+}
+
+// TestService_ReconfigureReconnector verifies providers that reconnect
+// themselves are handed the new port, and a swapped-in one that never
+// connected is reconnected to the current port
+func TestService_ReconfigureReconnector(t *testing.T) {
+	first := &resumingProvider{}
+	svc := NewService(first)
+	if err := svc.Start(context.Background(), 3000); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.Reconfigure(context.Background(), 4000, nil); err != nil {
+		t.Fatalf("Reconfigure() error = %v", err)
+	}
+	first.mu.Lock()
+	if first.reconnectPort != 4000 {
+		t.Errorf("expected the provider reconnected to 4000, got %d", first.reconnectPort)
+	}
+	first.mu.Unlock()
+
+	next := &resumingProvider{}
+	if err := svc.Reconfigure(context.Background(), 4000, next); err != nil {
+		t.Fatalf("Reconfigure() error = %v", err)
+	}
+	next.mu.Lock()
+	defer next.mu.Unlock()
+	if next.reconnectPort != 4000 {
+		t.Errorf("expected the new provider connected to 4000, got %d", next.reconnectPort)
+	}
+}
+
+func TestService_Reconfigure_NotStarted(t *testing.T) {
+	svc := NewService(&MockProvider{})
+	if err := svc.Reconfigure(context.Background(), 4000, nil); err == nil {
+		t.Error("expected error reconfiguring a service that was never started")
+	}
+}
+
+// TestService_StartRestartStart verifies a failed Start can be retried and
+// readiness survives Restart and further Start calls without a double close
+func TestService_StartRestartStart(t *testing.T) {
+	isReady := func(svc *Service) bool {
+		select {
+		case <-svc.Ready():
+			return true
+		default:
+			return false
+		}
+	}
+
+	// the first Connect fails
+	p := &flakyProvider{connects: 1, failAfter: 1}
+	svc := NewService(p)
+	if err := svc.Start(context.Background(), 3000); err == nil {
+		t.Fatal("expected the first Start to fail")
+	}
+	if isReady(svc) {
+		t.Fatal("expected not ready after a failed Start")
+	}
+
+	p.failAfter = 0
+	if err := svc.Start(context.Background(), 3000); err != nil {
+		t.Fatalf("expected a retried Start to succeed, got %v", err)
+	}
+	if !isReady(svc) {
+		t.Fatal("expected ready after Start")
+	}
+
+	if err := svc.Restart(context.Background()); err != nil {
+		t.Fatalf("Restart() error = %v", err)
+	}
+	if !isReady(svc) {
+		t.Error("expected still ready after Restart")
+	}
+	if url := <-svc.URLChanges(); url != p.PublicURL() {
+		t.Errorf("expected the restarted URL %s, got %s", p.PublicURL(), url)
+	}
+
+	if err := svc.Start(context.Background(), 3000); !errors.Is(err, ErrAlreadyStarted) {
+		t.Errorf("expected ErrAlreadyStarted, got %v", err)
+	}
+	if !isReady(svc) {
+		t.Error("expected still ready after a second Start")
+	}
+	if err := svc.WaitReady(time.Second); err != nil {
+		t.Errorf("WaitReady() error = %v", err)
+	}
+}
+
+// ctxProvider is a MockProvider keeping the context it connected under.
+type ctxProvider struct {
+	MockProvider
+	ctx context.Context
+}
+
+func (p *ctxProvider) Connect(ctx context.Context, localPort int) (string, error) {
+	p.ctx = ctx
+	return p.MockProvider.Connect(ctx, localPort)
+}
+
+// TestService_OutlivesStartContext verifies the provider and the proxy keep
+// running when the context given to Start ends, until Close
+func TestService_OutlivesStartContext(t *testing.T) {
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer local.Close()
+
+	p := &ctxProvider{}
+	svc := NewService(p, WithProxy())
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := svc.Start(ctx, serverPort(t, local)); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	if err := p.ctx.Err(); err != nil {
+		t.Errorf("expected the provider's context to outlive Start's, got %v", err)
+	}
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/", p.connectPort))
+	if err != nil {
+		t.Fatalf("expected the proxy to keep serving, got %v", err)
+	}
+	resp.Body.Close()
+
+	svc.Close()
+	if p.ctx.Err() == nil {
+		t.Error("expected Close to end the provider's context")
+	}
+}
@@ -0,0 +1,65 @@
+package tunnel
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// latencyWindow is the number of recent samples used for percentile estimates.
+const latencyWindow = 1024
+
+// Stats is a point-in-time snapshot of proxy activity.
+type Stats struct {
+	Requests     int64         // total proxied requests
+	Active       int64         // requests currently in flight
+	SlowRequests int64         // requests slower than the slow threshold
+	Errors       int64         // requests answered with a 5xx status, the proxy's own 502s included
+	P50          time.Duration // median latency over the recent window
+	P95          time.Duration // 95th percentile latency over the recent window
+	BytesIn      int64         // bytes received from tunnel clients
+	BytesOut     int64         // bytes sent back to tunnel clients
+	Health       HealthState   // provider health, set by Service.Stats
+	Uptime       time.Duration // time since the tunnel came up, set by Service.Stats
+}
+
+// latencyTracker keeps a ring buffer of recent request durations
+// to estimate percentiles cheaply.
+type latencyTracker struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+// observe records a single request duration.
+func (lt *latencyTracker) observe(d time.Duration) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	if len(lt.samples) < latencyWindow {
+		lt.samples = append(lt.samples, d)
+		return
+	}
+	// window is full, overwrite the oldest sample
+	lt.samples[lt.next] = d
+	lt.next = (lt.next + 1) % latencyWindow
+}
+
+// percentiles returns the p50 and p95 of the recorded samples.
+func (lt *latencyTracker) percentiles() (p50, p95 time.Duration) {
+	lt.mu.Lock()
+	sorted := slices.Clone(lt.samples)
+	lt.mu.Unlock()
+
+	if len(sorted) == 0 {
+		return 0, 0
+	}
+	slices.Sort(sorted)
+	return sorted[percentileIndex(len(sorted), 50)], sorted[percentileIndex(len(sorted), 95)]
+}
+
+// percentileIndex returns the nearest-rank index of the p-th percentile.
+func percentileIndex(n, p int) int {
+	idx := (n*p+99)/100 - 1
+	return max(idx, 0)
+}
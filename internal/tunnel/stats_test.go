@@ -0,0 +1,99 @@
+package tunnel
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLatencyTracker_Percentiles(t *testing.T) {
+	var lt latencyTracker
+
+	if p50, p95 := lt.percentiles(); p50 != 0 || p95 != 0 {
+		t.Errorf("expected zero percentiles without samples, got %v %v", p50, p95)
+	}
+
+	for i := 1; i <= 100; i++ {
+		lt.observe(time.Duration(i) * time.Millisecond)
+	}
+
+	p50, p95 := lt.percentiles()
+	if p50 != 50*time.Millisecond {
+		t.Errorf("p50 = %v, want 50ms", p50)
+	}
+	if p95 != 95*time.Millisecond {
+		t.Errorf("p95 = %v, want 95ms", p95)
+	}
+}
+
+func TestLatencyTracker_WindowWraps(t *testing.T) {
+	var lt latencyTracker
+
+	// fill the window with slow samples, then overwrite it with fast ones
+	for range latencyWindow {
+		lt.observe(time.Second)
+	}
+	for range latencyWindow {
+		lt.observe(time.Millisecond)
+	}
+
+	if len(lt.samples) != latencyWindow {
+		t.Fatalf("expected %d samples, got %d", latencyWindow, len(lt.samples))
+	}
+	if _, p95 := lt.percentiles(); p95 != time.Millisecond {
+		t.Errorf("expected old samples to be evicted, p95 = %v", p95)
+	}
+}
+
+// TestManager_StatsErrors verifies 5xx responses are counted as errors
+func TestManager_StatsErrors(t *testing.T) {
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer local.Close()
+	m := NewManager(serverPort(t, local))
+
+	for _, path := range []string{"/", "/fail", "/"} {
+		m.proxyHandler(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	if st := m.Stats(); st.Requests != 3 || st.Errors != 1 {
+		t.Errorf("expected 3 requests with 1 error, got %d with %d", st.Requests, st.Errors)
+	}
+}
+
+// TestManager_StatsProxyErrors verifies the proxy's own 502s count as errors
+func TestManager_StatsProxyErrors(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	m := NewManager(port)
+	m.proxyHandler(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if got := m.Stats().Errors; got != 1 {
+		t.Errorf("expected the 502 to count as an error, got %d", got)
+	}
+}
+
+// TestService_StatsUptime verifies uptime counts from Start
+func TestService_StatsUptime(t *testing.T) {
+	svc := NewService(&MockProvider{})
+	if got := svc.Stats().Uptime; got != 0 {
+		t.Errorf("expected no uptime before Start, got %v", got)
+	}
+	if err := svc.Start(context.Background(), 3000); err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Close()
+	if got := svc.Stats().Uptime; got <= 0 {
+		t.Errorf("expected uptime after Start, got %v", got)
+	}
+}
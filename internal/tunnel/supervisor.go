@@ -0,0 +1,110 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ReconnectPolicy controls how Supervise reacts to a dropped tunnel.
+// Zero fields fall back to DefaultReconnectPolicy.
+type ReconnectPolicy struct {
+	CheckInterval time.Duration // how often the provider's IsConnected is polled
+	MaxRetries    int           // consecutive failed attempts before giving up, 0 = unlimited
+	Backoff       time.Duration // delay after the first failed attempt, doubled each time
+	MaxBackoff    time.Duration // upper bound for the delay between attempts
+	FailFast      bool          // give up on the first drop instead of reconnecting
+}
+
+// DefaultReconnectPolicy is used for unset ReconnectPolicy fields.
+var DefaultReconnectPolicy = ReconnectPolicy{
+	CheckInterval: 5 * time.Second,
+	MaxRetries:    0,
+	Backoff:       time.Second,
+	MaxBackoff:    30 * time.Second,
+}
+
+// withDefaults fills unset fields from DefaultReconnectPolicy.
+func (p ReconnectPolicy) withDefaults() ReconnectPolicy {
+	if p.CheckInterval <= 0 {
+		p.CheckInterval = DefaultReconnectPolicy.CheckInterval
+	}
+	if p.Backoff <= 0 {
+		p.Backoff = DefaultReconnectPolicy.Backoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultReconnectPolicy.MaxBackoff
+	}
+	return p
+}
+
+// Supervise watches the started tunnel and restarts it whenever the
+// provider reports it is no longer connected. It blocks until ctx is done
+// (returning nil) or a reconnect gives up after policy.MaxRetries attempts.
+// With policy.FailFast it returns an error on the first drop instead.
+func (s *Service) Supervise(ctx context.Context, policy ReconnectPolicy) error {
+	policy = policy.withDefaults()
+
+	ticker := time.NewTicker(policy.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		// a Restart or Reconfigure in progress is no drop
+		p := s.currentProvider()
+		if p.IsConnected() || s.restarting.Load() > 0 {
+			continue
+		}
+		LogEvent(s.logger, p.Name(), EventDropped, "err", ErrNotConnected)
+
+		if policy.FailFast {
+			return fmt.Errorf("%s tunnel dropped: %w", p.Name(), ErrNotConnected)
+		}
+
+		if err := s.reconnect(ctx, policy); err != nil {
+			return err
+		}
+	}
+}
+
+// reconnect restarts the tunnel with exponential backoff between attempts.
+func (s *Service) reconnect(ctx context.Context, policy ReconnectPolicy) error {
+	delay := policy.Backoff
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		name := s.ProviderName()
+		if err != nil {
+			LogEvent(s.logger, name, EventReconnectAttempt, "attempt", attempt, "err", err)
+		} else {
+			LogEvent(s.logger, name, EventReconnectAttempt, "attempt", attempt)
+		}
+
+		err = s.Restart(ctx)
+		if err == nil {
+			LogEvent(s.logger, name, EventReconnected, "attempt", attempt, "url", s.PublicURL())
+			return nil
+		}
+
+		// shutting down, not a reconnect failure
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if policy.MaxRetries > 0 && attempt >= policy.MaxRetries {
+			return fmt.Errorf("reconnect gave up after %d attempts: %w", attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, policy.MaxBackoff)
+	}
+}
@@ -0,0 +1,246 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyProvider drops its connection on demand and hands out a new URL
+// on every Connect. failAfter makes Connect fail once it's called that many times.
+type flakyProvider struct {
+	mu        sync.Mutex
+	connected bool
+	connects  int
+	failAfter int
+}
+
+func (f *flakyProvider) Connect(ctx context.Context, localPort int) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.connects++
+	if f.failAfter > 0 && f.connects > f.failAfter {
+		return "", errors.New("network down")
+	}
+	f.connected = true
+	return f.url(), nil
+}
+
+func (f *flakyProvider) url() string {
+	return fmt.Sprintf("https://session-%d.example.com", f.connects)
+}
+
+func (f *flakyProvider) drop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.connected = false
+}
+
+func (f *flakyProvider) Close() error {
+	f.drop()
+	return nil
+}
+
+func (f *flakyProvider) IsConnected() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.connected
+}
+
+func (f *flakyProvider) PublicURL() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.url()
+}
+
+func (f *flakyProvider) Name() string { return "flaky" }
+
+func TestService_Supervise_Reconnects(t *testing.T) {
+	p := &flakyProvider{}
+	svc := NewService(p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := svc.Start(ctx, 3000); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- svc.Supervise(ctx, ReconnectPolicy{CheckInterval: 5 * time.Millisecond, Backoff: time.Millisecond})
+	}()
+
+	p.drop()
+
+	select {
+	case url := <-svc.URLChanges():
+		if url != "https://session-2.example.com" {
+			t.Errorf("expected URL from the second session, got %s", url)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for reconnect")
+	}
+
+	if !p.IsConnected() {
+		t.Error("expected provider to be connected again")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("expected nil on cancellation, got %v", err)
+	}
+}
+
+func TestService_Supervise_GivesUp(t *testing.T) {
+	p := &flakyProvider{failAfter: 1}
+	svc := NewService(p)
+
+	if err := svc.Start(context.Background(), 3000); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	p.drop()
+
+	policy := ReconnectPolicy{CheckInterval: 5 * time.Millisecond, Backoff: time.Millisecond, MaxRetries: 3}
+
+	select {
+	case err := <-supervise(svc, policy):
+		if err == nil || !strings.Contains(err.Error(), "after 3 attempts") {
+			t.Errorf("expected give-up error after 3 attempts, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Supervise did not give up")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.connects != 4 { // initial connect + 3 retries
+		t.Errorf("expected 4 connect calls, got %d", p.connects)
+	}
+}
+
+// TestService_Supervise_FailFast verifies the first drop ends Supervise
+// without a reconnect attempt
+func TestService_Supervise_FailFast(t *testing.T) {
+	p := &flakyProvider{}
+	svc := NewService(p)
+	if err := svc.Start(context.Background(), 3000); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	p.drop()
+
+	select {
+	case err := <-supervise(svc, ReconnectPolicy{CheckInterval: 5 * time.Millisecond, FailFast: true}):
+		if !errors.Is(err, ErrNotConnected) {
+			t.Errorf("expected ErrNotConnected, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Supervise did not give up on the drop")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.connects != 1 {
+		t.Errorf("expected no reconnect, got %d connect calls", p.connects)
+	}
+}
+
+// resumingProvider is a flakyProvider that reconnects itself, keeping its
+// URL, and records how it was reconnected.
+type resumingProvider struct {
+	flakyProvider
+	reconnects    int
+	closes        int
+	reconnectPort int // port of the last Reconnect
+}
+
+func (r *resumingProvider) Reconnect(ctx context.Context, localPort int) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reconnects++
+	r.reconnectPort = localPort
+	r.connected = true
+	return "https://resumed.example.com", nil
+}
+
+func (r *resumingProvider) Close() error {
+	r.mu.Lock()
+	r.closes++
+	r.mu.Unlock()
+	return r.flakyProvider.Close()
+}
+
+// TestService_Supervise_UsesReconnector verifies providers implementing
+// Reconnector reconnect themselves instead of being closed and reconnected
+func TestService_Supervise_UsesReconnector(t *testing.T) {
+	p := &resumingProvider{}
+	svc := NewService(p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := svc.Start(ctx, 3000); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	go svc.Supervise(ctx, ReconnectPolicy{CheckInterval: 5 * time.Millisecond, Backoff: time.Millisecond})
+
+	p.drop()
+
+	select {
+	case url := <-svc.URLChanges():
+		if url != "https://resumed.example.com" {
+			t.Errorf("expected the URL returned by Reconnect, got %s", url)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for reconnect")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.reconnects != 1 || p.connects != 1 || p.closes != 0 {
+		t.Errorf("expected 1 Reconnect and no Close or further Connect, got %d reconnects, %d connects, %d closes",
+			p.reconnects, p.connects, p.closes)
+	}
+}
+
+// TestReconnect_Fallback verifies providers without Reconnector are closed and connected again
+func TestReconnect_Fallback(t *testing.T) {
+	p := &flakyProvider{}
+	if _, err := p.Connect(context.Background(), 3000); err != nil {
+		t.Fatal(err)
+	}
+
+	url, err := Reconnect(context.Background(), p, 3000)
+	if err != nil {
+		t.Fatalf("Reconnect() error = %v", err)
+	}
+	if url != "https://session-2.example.com" || !p.IsConnected() {
+		t.Errorf("expected a second session, got %s (connected=%v)", url, p.IsConnected())
+	}
+}
+
+func TestService_Restart_NotStarted(t *testing.T) {
+	svc := NewService(&flakyProvider{})
+	if err := svc.Restart(context.Background()); err == nil {
+		t.Error("expected error restarting a service that was never started")
+	}
+
+	_ = svc.Close()
+	if err := svc.Restart(context.Background()); err == nil {
+		t.Error("expected error restarting a closed service")
+	}
+}
+
+// supervise runs Supervise in the background and returns its result channel.
+func supervise(svc *Service, policy ReconnectPolicy) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- svc.Supervise(context.Background(), policy)
+	}()
+	return done
+}
@@ -0,0 +1,101 @@
+package tunnel
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// WithThrottle limits the bandwidth of proxied requests to simulate a slow
+// network: up is the bytes per second from clients to the local server,
+// down the bytes per second back. Each limit is shared by all requests,
+// like a single slow link. Zero or negative leaves a direction unlimited.
+func WithThrottle(up, down int64) ManagerOption {
+	return func(m *Manager) {
+		m.throttleUp = newBandwidthLimiter(up)
+		m.throttleDown = newBandwidthLimiter(down)
+	}
+}
+
+// bandwidthLimiter paces reads to rate bytes per second. It is safe for
+// concurrent use, readers share the rate.
+type bandwidthLimiter struct {
+	rate int64
+
+	mu sync.Mutex
+	// next is when the bytes granted so far will have gone through
+	next time.Time
+}
+
+// newBandwidthLimiter returns a limiter for rate bytes per second, nil
+// when rate is zero or negative.
+func newBandwidthLimiter(rate int64) *bandwidthLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &bandwidthLimiter{rate: rate}
+}
+
+// chunk is the largest read passed through at once, a tenth of a second
+// worth of bytes, so a slow rate trickles instead of stalling.
+func (l *bandwidthLimiter) chunk() int {
+	return int(max(l.rate/10, 1))
+}
+
+// wait blocks until n more bytes fit into the rate, or ctx is done.
+func (l *bandwidthLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(n) * time.Second / time.Duration(l.rate))
+	delay := l.next.Sub(now)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reader returns r with its reads paced by l until ctx is done.
+func (l *bandwidthLimiter) reader(ctx context.Context, r io.Reader) io.Reader {
+	return &throttledReader{ctx: ctx, r: r, limiter: l}
+}
+
+// throttledReader is an io.Reader paced by a bandwidthLimiter.
+type throttledReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *bandwidthLimiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if err := t.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if len(p) > t.limiter.chunk() {
+		p = p[:t.limiter.chunk()]
+	}
+
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if werr := t.limiter.wait(t.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// throttledBody is a request body paced by a bandwidthLimiter, closing
+// the original body.
+type throttledBody struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,97 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestBandwidthLimiter_Reader verifies a transfer takes at least size/rate
+func TestBandwidthLimiter_Reader(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 2000)
+	l := newBandwidthLimiter(10_000)
+
+	start := time.Now()
+	got, err := io.ReadAll(l.reader(context.Background(), bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("expected %d bytes through unchanged, got %d", len(data), len(got))
+	}
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+		t.Errorf("expected 2000 B at 10000 B/s to take 200ms, took %v", elapsed)
+	}
+}
+
+// TestBandwidthLimiter_Cancel verifies a throttled read gives up once ctx is done
+func TestBandwidthLimiter_Cancel(t *testing.T) {
+	l := newBandwidthLimiter(10)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := io.ReadAll(l.reader(ctx, strings.NewReader(strings.Repeat("x", 100))))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the read to stop with ctx, took %v", elapsed)
+	}
+}
+
+// TestNewBandwidthLimiter_Unlimited verifies zero and negative rates disable throttling
+func TestNewBandwidthLimiter_Unlimited(t *testing.T) {
+	for _, rate := range []int64{0, -1} {
+		if l := newBandwidthLimiter(rate); l != nil {
+			t.Errorf("expected no limiter for rate %d", rate)
+		}
+	}
+}
+
+// TestManager_Throttle verifies both directions of a proxied request are paced
+func TestManager_Throttle(t *testing.T) {
+	payload := strings.Repeat("x", 4000)
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer local.Close()
+
+	tests := []struct {
+		name     string
+		up, down int64
+		min      time.Duration
+	}{
+		{name: "unlimited", min: 0},
+		{name: "up", up: 20_000, min: 190 * time.Millisecond},
+		{name: "down", down: 20_000, min: 190 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager(serverPort(t, local), WithThrottle(tt.up, tt.down))
+			w := httptest.NewRecorder()
+
+			start := time.Now()
+			m.proxyHandler(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(payload)))
+			elapsed := time.Since(start)
+
+			if w.Code != http.StatusOK || w.Body.String() != payload {
+				t.Fatalf("expected the payload echoed, got %d with %d bytes", w.Code, w.Body.Len())
+			}
+			if elapsed < tt.min {
+				t.Errorf("expected at least %v for 4000 B, took %v", tt.min, elapsed)
+			}
+			if tt.min == 0 && elapsed > 150*time.Millisecond {
+				t.Errorf("expected no throttling, took %v", elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+)
+
+// ByteCounter counts the bytes read from and written to connections.
+// The zero value is ready to use and safe for concurrent use.
+type ByteCounter struct {
+	in  atomic.Int64
+	out atomic.Int64
+}
+
+// Conn returns conn with reads counted as bytes in and writes as bytes out.
+func (c *ByteCounter) Conn(conn net.Conn) net.Conn {
+	return &countingConn{Conn: conn, counter: c}
+}
+
+// Listener returns l with every accepted connection counted, see Conn.
+func (c *ByteCounter) Listener(l net.Listener) net.Listener {
+	return &countingListener{Listener: l, counter: c}
+}
+
+// BytesIn returns the total bytes read so far.
+func (c *ByteCounter) BytesIn() int64 {
+	return c.in.Load()
+}
+
+// BytesOut returns the total bytes written so far.
+func (c *ByteCounter) BytesOut() int64 {
+	return c.out.Load()
+}
+
+// countingConn adds the bytes moved through a connection to its counter.
+type countingConn struct {
+	net.Conn
+	counter *ByteCounter
+}
+
+func (cc *countingConn) Read(p []byte) (int, error) {
+	n, err := cc.Conn.Read(p)
+	cc.counter.in.Add(int64(n))
+	return n, err
+}
+
+func (cc *countingConn) Write(p []byte) (int, error) {
+	n, err := cc.Conn.Write(p)
+	cc.counter.out.Add(int64(n))
+	return n, err
+}
+
+// countingListener wraps accepted connections in a countingConn.
+type countingListener struct {
+	net.Listener
+	counter *ByteCounter
+}
+
+func (cl *countingListener) Accept() (net.Conn, error) {
+	conn, err := cl.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return cl.counter.Conn(conn), nil
+}
+
+// FormatBytes renders n as a human readable size, e.g. "1.5 MB".
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,134 @@
+package tunnel
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestByteCounter_Conn verifies reads count as bytes in and writes as bytes out
+func TestByteCounter_Conn(t *testing.T) {
+	var c ByteCounter
+	local, remote := net.Pipe()
+	conn := c.Conn(local)
+
+	go func() {
+		remote.Write([]byte("request"))
+		io.ReadAll(remote)
+	}()
+
+	if _, err := io.ReadFull(conn, make([]byte, len("request"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("a longer response")); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	if c.BytesIn() != int64(len("request")) {
+		t.Errorf("expected %d bytes in, got %d", len("request"), c.BytesIn())
+	}
+	if c.BytesOut() != int64(len("a longer response")) {
+		t.Errorf("expected %d bytes out, got %d", len("a longer response"), c.BytesOut())
+	}
+}
+
+// TestByteCounter_Listener verifies accepted connections share the counter
+func TestByteCounter_Listener(t *testing.T) {
+	var c ByteCounter
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := c.Listener(ln)
+	defer l.Close()
+
+	for range 2 {
+		client, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		server, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.Write([]byte("hi"))
+		io.ReadFull(server, make([]byte, 2))
+		server.Write([]byte("hey"))
+		io.ReadFull(client, make([]byte, 3))
+		client.Close()
+		server.Close()
+	}
+
+	if c.BytesIn() != 4 || c.BytesOut() != 6 {
+		t.Errorf("expected 4 in / 6 out, got %d / %d", c.BytesIn(), c.BytesOut())
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KB"},
+		{1536, "1.5 KB"},
+		{5 << 20, "5.0 MB"},
+		{3 << 30, "3.0 GB"},
+	}
+	for _, tt := range tests {
+		if got := FormatBytes(tt.n); got != tt.want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+// TestManager_StatsTraffic verifies bytes through the proxy show up in Stats
+func TestManager_StatsTraffic(t *testing.T) {
+	body := strings.Repeat("x", 4096)
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer localServer.Close()
+
+	m := NewManager(serverPort(t, localServer))
+	startManager(t, m)
+
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/", m.ListenPort()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	st := m.Stats()
+	if st.BytesIn == 0 {
+		t.Error("expected request bytes to be counted")
+	}
+	if st.BytesOut < int64(len(body)) {
+		t.Errorf("expected at least %d bytes out, got %d", len(body), st.BytesOut)
+	}
+}
+
+// trafficProvider is a mock provider that counts its own traffic.
+type trafficProvider struct {
+	MockProvider
+}
+
+func (p *trafficProvider) Traffic() (in, out int64) {
+	return 10, 20
+}
+
+// TestService_StatsProviderTraffic verifies provider byte counts are used without a proxy
+func TestService_StatsProviderTraffic(t *testing.T) {
+	svc := NewService(&trafficProvider{})
+	st := svc.Stats()
+	if st.BytesIn != 10 || st.BytesOut != 20 {
+		t.Errorf("expected provider traffic 10 in / 20 out, got %d / %d", st.BytesIn, st.BytesOut)
+	}
+}
@@ -0,0 +1,92 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+const (
+	// localIdleConns is how many idle connections to the local server are
+	// kept open for the next requests.
+	localIdleConns = 32
+	// localIdleTimeout closes idle local connections before the local
+	// server does, Node's http server gives up on them after 5s, so a
+	// request is never sent on a connection that is being closed.
+	localIdleTimeout = 4 * time.Second
+)
+
+// newLocalTransport returns the HTTP/1.1 transport to the local server,
+// keeping connections open across requests. dialLocal does the TLS
+// handshake for HTTPS servers. Every connection counts the bytes it
+// receives, so roundTripLocal can tell a dropped request from a broken
+// response.
+func (m *Manager) newLocalTransport() *http.Transport {
+	dial := func(ctx context.Context, _, _ string) (net.Conn, error) {
+		conn, err := m.dialLocal(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		return new(ByteCounter).Conn(conn), nil
+	}
+	return &http.Transport{
+		// every request goes to the local server, whatever its URL says
+		DialContext:           dial,
+		DialTLSContext:        dial,
+		MaxIdleConnsPerHost:   localIdleConns,
+		IdleConnTimeout:       localIdleTimeout,
+		ExpectContinueTimeout: expectContinueTimeout,
+		// the body is passed on as the local server encoded it
+		DisableCompression: true,
+	}
+}
+
+// roundTripLocal sends r to the local server over a pooled connection,
+// like exchangeLocal does over a new one. Closing the response body
+// returns the connection to the pool.
+func (m *Manager) roundTripLocal(r *http.Request) (*http.Response, error) {
+	// the connection the request went out on, and what it had received
+	// before, see newLocalTransport
+	var conn *ByteCounter
+	var before int64
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if cc, ok := info.Conn.(*countingConn); ok {
+				conn, before = cc.counter, cc.counter.BytesIn()
+			}
+		},
+	}
+	out := r.WithContext(httptrace.WithClientTrace(r.Context(), trace))
+	if expectsContinue(r) {
+		// a body the local server refuses is dropped with the connection,
+		// the transport would read it from the client to keep it open
+		out.Close = true
+	}
+
+	resp, err := m.localH1.RoundTrip(out)
+	if errors.Is(err, errLocalTLS) {
+		return nil, &localExchangeError{
+			msg: fmt.Sprintf("TLS handshake with %s failed - is it serving HTTPS?", m.localName()),
+			err: err,
+		}
+	}
+	if errors.Is(err, ErrLocalUnreachable) {
+		return nil, &localExchangeError{
+			msg:        fmt.Sprintf("Failed to connect %s - is your server running?", m.localName()),
+			err:        err,
+			noResponse: true,
+		}
+	}
+	if err != nil {
+		return nil, &localExchangeError{
+			msg:        fmt.Sprintf("Failed to read response from local server: %v", err),
+			err:        err,
+			noResponse: conn == nil || conn.BytesIn() == before,
+		}
+	}
+	return resp, nil
+}